@@ -1,6 +1,9 @@
 package mar
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"testing"
 )
 
@@ -89,3 +92,45 @@ func TestEmptyIndex(t *testing.T) {
 		t.Fatalf("expected to fail with %q but failed with %v", errIndexTooSmall, err)
 	}
 }
+
+// an entry that contains the content of another one must be rejected
+// whatever the order of the entries in the index
+func TestContainedContent(t *testing.T) {
+	for _, order := range [][]string{{"a", "b"}, {"b", "a"}} {
+		m := New()
+		content := map[string][]byte{"a": bytes.Repeat([]byte("a"), 100), "b": bytes.Repeat([]byte("b"), 10)}
+		for _, name := range order {
+			m.AddContent(content[name], name, 0600)
+		}
+		o, err := m.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var offsetA, offsetB uint32
+		for _, idx := range m.Index {
+			switch idx.FileName {
+			case "a":
+				offsetA = idx.OffsetToContent
+			case "b":
+				offsetB = idx.OffsetToContent
+			}
+		}
+		// move the content of b inside the content of a
+		header := make([]byte, 14)
+		binary.BigEndian.PutUint32(header, offsetB)
+		binary.BigEndian.PutUint32(header[4:], 10)
+		binary.BigEndian.PutUint32(header[8:], 0600)
+		copy(header[12:], "b\x00")
+		pos := bytes.Index(o[m.OffsetToIndex:], header)
+		if pos < 0 {
+			t.Fatal("index entry of b not found")
+		}
+		binary.BigEndian.PutUint32(o[int(m.OffsetToIndex)+pos:], offsetA+10)
+
+		var reparsed File
+		err = Unmarshal(o, &reparsed)
+		if !errors.Is(err, ErrOverlappingContent) {
+			t.Fatalf("order %q: expected to fail with %q but got %v", order, ErrOverlappingContent, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SignatureAlgorithm describes how the signatures of an algorithm ID are
+// made and verified
+type SignatureAlgorithm struct {
+	// Name is the name of the algorithm, like "RSA-PKCS1v15-SHA384"
+	Name string
+
+	// Hash is the hash function the signed data is digested with before
+	// being passed to Sign and Verify
+	Hash crypto.Hash
+
+	// SignatureSize returns the size of the signatures made with the
+	// public key, or an error if the key can't be used with the algorithm.
+	// It is optional, but SignAll can't use the algorithm without it.
+	SignatureSize func(pub crypto.PublicKey) (uint32, error)
+
+	// Sign signs the digest of the signed data with the signer and returns
+	// the signature as stored in the MAR file. It is optional, for
+	// algorithms that are only verified.
+	Sign func(signer crypto.Signer, rand io.Reader, digest []byte) ([]byte, error)
+
+	// Verify returns nil if sig is a valid signature of the digest of the
+	// signed data by the public key
+	Verify func(pub crypto.PublicKey, digest, sig []byte) error
+}
+
+var (
+	signatureAlgorithms   map[uint32]*SignatureAlgorithm
+	signatureAlgorithmsMu sync.RWMutex
+)
+
+func init() {
+	signatureAlgorithms = map[uint32]*SignatureAlgorithm{
+		SigAlgRsaPkcs1Sha1:    rsaPkcs1Algorithm("RSA-PKCS1v15-SHA1", crypto.SHA1),
+		SigAlgRsaPkcs1Sha384:  rsaPkcs1Algorithm("RSA-PKCS1v15-SHA384", crypto.SHA384),
+		SigAlgEcdsaP256Sha256: ecdsaAlgorithm("ECDSA-P256-SHA256", crypto.SHA256, elliptic.P256()),
+		SigAlgEcdsaP384Sha384: ecdsaAlgorithm("ECDSA-P384-SHA384", crypto.SHA384, elliptic.P384()),
+	}
+}
+
+// rsaPkcs1Algorithm returns a built-in RSA PKCS#1 v1.5 algorithm
+func rsaPkcs1Algorithm(name string, h crypto.Hash) *SignatureAlgorithm {
+	return &SignatureAlgorithm{
+		Name: name,
+		Hash: h,
+		SignatureSize: func(pub crypto.PublicKey) (uint32, error) {
+			rsaKey, ok := pub.(*rsa.PublicKey)
+			if !ok {
+				return 0, fmt.Errorf("%w: %s signatures can't be made with a key of type %T", errBadSigAlg, name, pub)
+			}
+			return rsaSignatureSize(rsaKey), nil
+		},
+		Sign: func(signer crypto.Signer, rand io.Reader, digest []byte) ([]byte, error) {
+			// the signature is already in the PKCS1v15 format
+			return signer.Sign(rand, digest, h)
+		},
+		Verify: func(pub crypto.PublicKey, digest, sig []byte) error {
+			if _, ok := pub.(*rsa.PublicKey); !ok {
+				return fmt.Errorf("%w: %s signatures can't be verified with a key of type %T", errBadSigAlg, name, pub)
+			}
+			return VerifyHashSignature(sig, digest, h, pub)
+		},
+	}
+}
+
+// ecdsaAlgorithm returns a built-in ECDSA algorithm on the curve, with
+// signatures encoded as the concatenation of R and S
+func ecdsaAlgorithm(name string, h crypto.Hash, curve elliptic.Curve) *SignatureAlgorithm {
+	_, size := getEcdsaInfo(curve.Params().Name)
+	return &SignatureAlgorithm{
+		Name: name,
+		Hash: h,
+		SignatureSize: func(pub crypto.PublicKey) (uint32, error) {
+			ecKey, ok := pub.(*ecdsa.PublicKey)
+			if !ok {
+				return 0, fmt.Errorf("%w: %s signatures can't be made with a key of type %T", errBadSigAlg, name, pub)
+			}
+			if ecKey.Params().Name != curve.Params().Name {
+				return 0, fmt.Errorf("%w: %s signatures can't be made with a key on curve %s", errBadSigAlg, name, ecKey.Params().Name)
+			}
+			return size, nil
+		},
+		Sign: func(signer crypto.Signer, rand io.Reader, digest []byte) ([]byte, error) {
+			sigData, err := signer.Sign(rand, digest, h)
+			if err != nil {
+				return nil, err
+			}
+			// when using an ecdsa key, the Sign() interface returns an ASN.1 encoded signature
+			// which we need to parse and convert to its R||S form
+			return convertAsn1EcdsaToRS(sigData, int(size))
+		},
+		Verify: func(pub crypto.PublicKey, digest, sig []byte) error {
+			ecKey, ok := pub.(*ecdsa.PublicKey)
+			if !ok {
+				return fmt.Errorf("%w: %s signatures can't be verified with a key of type %T", errBadSigAlg, name, pub)
+			}
+			if ecKey.Params().Name != curve.Params().Name {
+				return fmt.Errorf("%w: %s signatures can't be verified with a key on curve %s", errBadSigAlg, name, ecKey.Params().Name)
+			}
+			return VerifyHashSignature(sig, digest, h, pub)
+		},
+	}
+}
+
+// RegisterSignatureAlgorithm registers a signature algorithm under an ID,
+// such as an experimental algorithm used by a Firefox fork. Signatures of
+// that ID are then parsed, signed and verified like the built-in ones. An
+// ID can only be registered once.
+func RegisterSignatureAlgorithm(id uint32, alg SignatureAlgorithm) error {
+	if alg.Name == "" || alg.Name == "unknown" || !alg.Hash.Available() || alg.Verify == nil {
+		return errBadSignatureAlgorithm
+	}
+	signatureAlgorithmsMu.Lock()
+	defer signatureAlgorithmsMu.Unlock()
+	if existing, ok := signatureAlgorithms[id]; ok {
+		return fmt.Errorf("signature algorithm ID %d is already registered as %q", id, existing.Name)
+	}
+	signatureAlgorithms[id] = &alg
+	return nil
+}
+
+// lookupSignatureAlgorithm returns the algorithm registered for an ID,
+// or nil if there is none
+func lookupSignatureAlgorithm(id uint32) *SignatureAlgorithm {
+	signatureAlgorithmsMu.RLock()
+	defer signatureAlgorithmsMu.RUnlock()
+	return signatureAlgorithms[id]
+}
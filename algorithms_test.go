@@ -0,0 +1,163 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// algorithm IDs that are only registered in tests
+const (
+	sigAlgRsaPkcs1Sha512 = 0x5A12
+	sigAlgVerifyOnly     = 0x5A13
+)
+
+func init() {
+	err := RegisterSignatureAlgorithm(sigAlgRsaPkcs1Sha512, SignatureAlgorithm{
+		Name: "RSA-PKCS1v15-SHA512",
+		Hash: crypto.SHA512,
+		SignatureSize: func(pub crypto.PublicKey) (uint32, error) {
+			rsaKey, ok := pub.(*rsa.PublicKey)
+			if !ok {
+				return 0, fmt.Errorf("unsupported key type %T", pub)
+			}
+			return rsaSignatureSize(rsaKey), nil
+		},
+		Sign: func(signer crypto.Signer, rand io.Reader, digest []byte) ([]byte, error) {
+			return signer.Sign(rand, digest, crypto.SHA512)
+		},
+		Verify: func(pub crypto.PublicKey, digest, sig []byte) error {
+			rsaKey, ok := pub.(*rsa.PublicKey)
+			if !ok {
+				return fmt.Errorf("unsupported key type %T", pub)
+			}
+			return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA512, digest, sig)
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = RegisterSignatureAlgorithm(sigAlgVerifyOnly, SignatureAlgorithm{
+		Name:   "VERIFY-ONLY",
+		Hash:   crypto.SHA256,
+		Verify: func(pub crypto.PublicKey, digest, sig []byte) error { return nil },
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterSignatureAlgorithm(t *testing.T) {
+	if name := getSigAlgNameFromID(sigAlgRsaPkcs1Sha512); name != "RSA-PKCS1v15-SHA512" {
+		t.Fatalf("expected algorithm name RSA-PKCS1v15-SHA512 but got %q", name)
+	}
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.SignAll(rand.Reader,
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha384},
+		SigningKey{rsa2048Key, sigAlgRsaPkcs1Sha512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the custom algorithm is parsed and verified like the built-in ones
+	var file File
+	err = Unmarshal(signed, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Signatures[1].Algorithm != "RSA-PKCS1v15-SHA512" {
+		t.Fatalf("expected second signature to be RSA-PKCS1v15-SHA512 but got %q", file.Signatures[1].Algorithm)
+	}
+	validKeys, err := file.VerifyWithKeys(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 2 {
+		t.Fatalf("expected 2 valid signatures but got %d", len(validKeys))
+	}
+	data, err := file.MarshalForSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifySignature(data, file.Signatures[1].Data, sigAlgRsaPkcs1Sha512, rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifySignature(data, file.Signatures[1].Data, SigAlgRsaPkcs1Sha384, rsa2048Key.Public())
+	if err == nil {
+		t.Fatal("expected verification with the wrong algorithm to fail")
+	}
+}
+
+func TestRegisterSignatureAlgorithmErrors(t *testing.T) {
+	verify := func(pub crypto.PublicKey, digest, sig []byte) error { return nil }
+	for i, alg := range []SignatureAlgorithm{
+		{Hash: crypto.SHA256, Verify: verify},
+		{Name: "unknown", Hash: crypto.SHA256, Verify: verify},
+		{Name: "nohash", Verify: verify},
+		{Name: "noverify", Hash: crypto.SHA256},
+	} {
+		err := RegisterSignatureAlgorithm(0xBAD0+uint32(i), alg)
+		if err != errBadSignatureAlgorithm {
+			t.Fatalf("testcase %d: expected to fail with %q but got %v", i, errBadSignatureAlgorithm, err)
+		}
+	}
+	err := RegisterSignatureAlgorithm(SigAlgRsaPkcs1Sha384, SignatureAlgorithm{Name: "dup", Hash: crypto.SHA256, Verify: verify})
+	if err == nil {
+		t.Fatal("expected registering a duplicate ID to fail but it succeeded")
+	}
+}
+
+func TestSignVerifyOnlyAlgorithm(t *testing.T) {
+	_, err := Sign(rsa2048Key, rand.Reader, make([]byte, 32), sigAlgVerifyOnly)
+	if err != errCannotSign {
+		t.Fatalf("expected to fail with %q but got %v", errCannotSign, err)
+	}
+	m := New()
+	err = m.Sign(rand.Reader, rsa2048Key, sigAlgVerifyOnly)
+	if err != errBadSigAlg {
+		t.Fatalf("expected to fail with %q but got %v", errBadSigAlg, err)
+	}
+}
+
+func TestVerifyWrongKeyType(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := make([]byte, 48)
+	for _, testcase := range []struct {
+		key          crypto.Signer
+		signAlg      uint32
+		wrongAlg     uint32
+		expectedName string
+	}{
+		{ecdsaKey, SigAlgEcdsaP384Sha384, SigAlgRsaPkcs1Sha384, "RSA-PKCS1v15-SHA384"},
+		{rsa2048Key, SigAlgRsaPkcs1Sha384, SigAlgEcdsaP384Sha384, "ECDSA-P384-SHA384"},
+	} {
+		sig, err := Sign(testcase.key, rand.Reader, digest, testcase.signAlg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = lookupSignatureAlgorithm(testcase.signAlg).Verify(testcase.key.Public(), digest, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = lookupSignatureAlgorithm(testcase.wrongAlg).Verify(testcase.key.Public(), digest, sig)
+		if !errors.Is(err, errBadSigAlg) || !strings.Contains(err.Error(), testcase.expectedName) {
+			t.Fatalf("expected %s to reject a key of type %T but got %v", testcase.expectedName, testcase.key.Public(), err)
+		}
+	}
+}
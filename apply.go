@@ -0,0 +1,198 @@
+package mar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mozilla.org/mar/internal/manifest"
+	"go.mozilla.org/mar/mbsdiff"
+)
+
+// PatchFunc applies a patch to the old content of a file and returns
+// its new content
+type PatchFunc func(old, patch []byte) ([]byte, error)
+
+// ApplyPartial applies the update manifest of the MAR file to the
+// installation directory, like the Firefox updater does: files are added
+// from the content of the MAR, patched, or removed, in the order of the
+// manifest. The updatev3.manifest entry is used if present, otherwise the
+// update.manifest entry. It also applies complete updates. Patches are
+// applied with mbsdiff.Patch, unless another function is set by the
+// PatchWith option.
+//
+// The paths of the manifest are checked against the PathPolicy of the
+// WithPathPolicy option, or DefaultPathPolicy, before anything is written,
+// such that a malicious MAR cannot write outside of the installation
+// directory. Instructions whose path goes through an existing symbolic link
+// are handled according to the policy, and rmrfdir instructions are always
+// refused on the installation directory itself or outside of it. The
+// installation is left partially updated if applying an instruction fails.
+func ApplyPartial(partial *File, installDir string, opts ...Option) error {
+	o := newOptions(opts)
+	policy := o.pathPolicyOrDefault()
+	if o.patch == nil {
+		o.patch = mbsdiff.Patch
+	}
+	m, err := partial.updateManifest()
+	if err != nil {
+		return err
+	}
+	for _, inst := range m.Instructions {
+		err = partial.checkInstruction(inst, policy)
+		if err != nil {
+			return err
+		}
+	}
+	for _, inst := range m.Instructions {
+		err = partial.applyInstruction(inst, installDir, o.patch, policy)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s %q: %w", inst.Op, inst.Path, err)
+		}
+	}
+	return nil
+}
+
+// checkInstruction verifies the paths of an instruction follow the policy,
+// and that the entries it needs are in the file
+func (file *File) checkInstruction(inst manifest.Instruction, policy PathPolicy) error {
+	err := policy.CheckName(inst.Path)
+	if err != nil {
+		return err
+	}
+	if filepath.Clean(filepath.FromSlash(inst.Path)) == "." {
+		return fmt.Errorf("refusing to apply %s to the installation directory itself", inst.Op)
+	}
+	if inst.Test != "" {
+		err = policy.CheckName(inst.Test)
+		if err != nil {
+			return err
+		}
+	}
+	var name string
+	switch inst.Op {
+	case manifest.OpAdd, manifest.OpAddIf, manifest.OpAddIfNot:
+		name = inst.Path
+	case manifest.OpPatch, manifest.OpPatchIf:
+		name = inst.Patch
+	default:
+		return nil
+	}
+	if _, ok := file.Content[name]; !ok {
+		return fmt.Errorf("manifest references missing entry %q", name)
+	}
+	return nil
+}
+
+// updateManifest returns the parsed update manifest of the file
+func (file *File) updateManifest() (*manifest.Manifest, error) {
+	for _, name := range []string{manifest.V3Name, manifest.V2Name} {
+		entry, ok := file.Content[name]
+		if !ok {
+			continue
+		}
+		data, err := entry.Decompressed()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", name, err)
+		}
+		return manifest.Parse(data)
+	}
+	return nil, errNoManifest
+}
+
+// applyInstruction applies a single instruction of the manifest
+func (file *File) applyInstruction(inst manifest.Instruction, installDir string, patch PatchFunc, policy PathPolicy) error {
+	path := filepath.Join(installDir, filepath.FromSlash(inst.Path))
+	if policy.Symlinks != SymlinksFollow {
+		link, err := findSymlink(installDir, path)
+		if err != nil {
+			return err
+		}
+		if link != "" && policy.Symlinks == SymlinksReject {
+			return fmt.Errorf("%w: %q would be applied through %q", errSymlink, inst.Path, link)
+		}
+		if link != "" {
+			return nil
+		}
+	}
+	switch inst.Op {
+	case manifest.OpAddIf, manifest.OpPatchIf:
+		if !exists(filepath.Join(installDir, filepath.FromSlash(inst.Test))) {
+			return nil
+		}
+	case manifest.OpAddIfNot:
+		if exists(filepath.Join(installDir, filepath.FromSlash(inst.Test))) {
+			return nil
+		}
+	}
+	switch inst.Op {
+	case manifest.OpAdd, manifest.OpAddIf, manifest.OpAddIfNot:
+		data, err := file.Content[inst.Path].Decompressed()
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		return writeFile(path, data, file.entryPerm(inst.Path))
+	case manifest.OpPatch, manifest.OpPatchIf:
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		old, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p, err := file.Content[inst.Patch].Decompressed()
+		if err != nil {
+			return err
+		}
+		data, err := patch(old, p)
+		if err != nil {
+			return err
+		}
+		return writeFile(path, data, fi.Mode().Perm())
+	case manifest.OpRemove:
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	case manifest.OpRmdir:
+		// like the updater, directories that aren't empty are left alone
+		os.Remove(path)
+		return nil
+	case manifest.OpRmrfdir:
+		// the policy may allow parent references, but recursive
+		// removals never leave the installation directory
+		rel, err := filepath.Rel(installDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("refusing to apply rmrfdir to %q which is not inside the installation directory", inst.Path)
+		}
+		return os.RemoveAll(path)
+	}
+	return fmt.Errorf("unknown operation %q", inst.Op)
+}
+
+// entryPerm returns the permissions of the entry named name in the index
+func (file *File) entryPerm(name string) os.FileMode {
+	for _, idx := range file.Index {
+		if idx.FileName == name {
+			return idx.FileMode()
+		}
+	}
+	return os.FileMode(FlagsRegular)
+}
+
+// exists returns true if a file or directory exists at path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,186 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// appendPatch applies patches that are appended to the old content
+func appendPatch(old, patch []byte) ([]byte, error) {
+	return append(append([]byte{}, old...), patch...), nil
+}
+
+func newInstallDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "margo_apply_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestApplyPartial(t *testing.T) {
+	dir := newInstallDir(t, map[string]string{
+		"firefox":               "old firefox",
+		"libxul.so":             "old libxul",
+		"uninstall.log":         "log",
+		"distribution/keep":     "keep",
+		"extensions/foo/a.js":   "a",
+		"defaults/channel.js":   "release",
+		"empty/.placeholder":    "",
+		"notempty/.placeholder": "",
+	})
+	defer os.RemoveAll(dir)
+	// empty the directory that rmdir should remove
+	os.Remove(filepath.Join(dir, "empty", ".placeholder"))
+
+	partial := New()
+	partial.AddContent([]byte(`type "partial"
+add "newfile"
+add-if "distribution" "distribution/ext.xpi"
+add-if "missing" "skipped"
+add-if-not "defaults/channel.js" "defaults/channel.js"
+patch "firefox.patch" "firefox"
+patch-if "missing" "libxul.so.patch" "libxul.so"
+remove "uninstall.log"
+remove "already-gone"
+rmdir "empty/"
+rmdir "notempty/"
+rmrfdir "extensions/"
+`), "updatev3.manifest", 0644, Compress())
+	partial.AddContent([]byte("new file"), "newfile", 0755, Compress())
+	partial.AddContent([]byte("xpi"), "distribution/ext.xpi", 0644)
+	partial.AddContent([]byte("skipped"), "skipped", 0644)
+	partial.AddContent([]byte("nightly"), "defaults/channel.js", 0644)
+	partial.AddContent([]byte(" patched"), "firefox.patch", 0644, Compress())
+	partial.AddContent([]byte(" patched"), "libxul.so.patch", 0644)
+
+	err := ApplyPartial(partial, dir, PatchWith(appendPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"newfile":              "new file",
+		"distribution/ext.xpi": "xpi",
+		"defaults/channel.js":  "release",
+		"firefox":              "old firefox patched",
+		"libxul.so":            "old libxul",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte(content)) {
+			t.Fatalf("expected %s to contain %q, got %q", name, content, data)
+		}
+	}
+	fi, err := os.Stat(filepath.Join(dir, "newfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Fatalf("expected newfile to have permissions 0755, got %o", fi.Mode().Perm())
+	}
+	for _, name := range []string{"skipped", "uninstall.log", "empty", "extensions"} {
+		if exists(filepath.Join(dir, name)) {
+			t.Fatalf("expected %s not to exist", name)
+		}
+	}
+	if !exists(filepath.Join(dir, "notempty")) {
+		t.Fatal("expected directory that isn't empty to be kept")
+	}
+}
+
+func TestApplyPartialErrors(t *testing.T) {
+	testCases := []struct {
+		manifest string
+		opts     []Option
+		err      string
+	}{
+		{`add "../evil"`, nil, `refusing to extract entry "../evil" that contains a parent directory reference`},
+		{`add-if "/etc" "foo"`, nil, `refusing to extract entry with absolute name "/etc"`},
+		{`rmrfdir "./"`, nil, "refusing to apply rmrfdir to the installation directory itself"},
+		{`add "missing"`, nil, `manifest references missing entry "missing"`},
+		{`patch "foo.patch" "foo"`, nil, `failed to apply patch "foo": mbsdiff: corrupt patch`},
+		{`rmrfdir "../other"`, []Option{WithPathPolicy(PathPolicy{AllowParentRefs: true})},
+			`failed to apply rmrfdir "../other": refusing to apply rmrfdir to "../other" which is not inside the installation directory`},
+		{`rmrfdir "sub/.."`, []Option{WithPathPolicy(PathPolicy{AllowParentRefs: true})},
+			"refusing to apply rmrfdir to the installation directory itself"},
+		{`add "foo"`, []Option{WithPathPolicy(PathPolicy{AllowedPrefixes: []string{"bin"}})},
+			`path is not under any of the allowed prefixes: "foo"`},
+	}
+	for i, testCase := range testCases {
+		dir := newInstallDir(t, map[string]string{"foo": "foo"})
+		defer os.RemoveAll(dir)
+		partial := New()
+		partial.AddContent([]byte(testCase.manifest), "updatev3.manifest", 0644)
+		partial.AddContent([]byte("patch"), "foo.patch", 0644)
+		err := ApplyPartial(partial, dir, testCase.opts...)
+		if err == nil || err.Error() != testCase.err {
+			t.Fatalf("testcase %d expected error %q, got %v", i, testCase.err, err)
+		}
+		if !exists(filepath.Join(dir, "foo")) {
+			t.Fatalf("testcase %d expected nothing to be applied", i)
+		}
+	}
+
+	err := ApplyPartial(New(), os.TempDir())
+	if err != errNoManifest {
+		t.Fatalf("expected error %v, got %v", errNoManifest, err)
+	}
+}
+
+func TestApplyPartialSymlinks(t *testing.T) {
+	outDir := newInstallDir(t, map[string]string{"victim/file": "victim"})
+	defer os.RemoveAll(outDir)
+	partial := New()
+	partial.AddContent([]byte("cariboumaurice"), "link/foo", 0644)
+	partial.AddContent([]byte("cariboumaurice"), "bar", 0644)
+
+	for _, manifest := range []string{
+		"add \"link/foo\"\nadd \"bar\"\n",
+		"rmrfdir \"link/victim\"\nadd \"bar\"\n",
+		"remove \"link/victim/file\"\nadd \"bar\"\n",
+	} {
+		dir := newInstallDir(t, nil)
+		defer os.RemoveAll(dir)
+		err := os.Symlink(outDir, filepath.Join(dir, "link"))
+		if err != nil {
+			t.Skip("symlinks are not supported:", err)
+		}
+		partial.Content["updatev3.manifest"] = Entry{Data: []byte(manifest)}
+		err = ApplyPartial(partial, dir)
+		if !errors.Is(err, errSymlink) {
+			t.Fatalf("expected %q to fail with %q but got %v", manifest, errSymlink, err)
+		}
+		if exists(filepath.Join(outDir, "foo")) || !exists(filepath.Join(outDir, "victim", "file")) {
+			t.Fatalf("expected %q to leave the target of the link alone", manifest)
+		}
+
+		err = ApplyPartial(partial, dir, WithPathPolicy(PathPolicy{Symlinks: SymlinksSkip}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists(filepath.Join(dir, "bar")) {
+			t.Fatalf("expected %q to apply the instructions outside of the link", manifest)
+		}
+		if exists(filepath.Join(outDir, "foo")) || !exists(filepath.Join(outDir, "victim", "file")) {
+			t.Fatalf("expected %q to skip the instructions through the link", manifest)
+		}
+	}
+}
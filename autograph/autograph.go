@@ -0,0 +1,151 @@
+// Package autograph signs MAR files with the Autograph signing service.
+//
+// A Signer sends the digest of the signed block of a MAR file to the
+// /sign/hash endpoint of Autograph, authenticated with Hawk, and returns
+// the signature made by the Autograph signer. It implements the
+// crypto.Signer interface, so it plugs into the signing functions of the
+// mar package:
+//
+//	signer := &autograph.Signer{
+//		URL:       "https://autograph.example.net/",
+//		User:      "alice",
+//		Key:       "fs5wgcer9qj819kfptdlp8gm227ewxnzvsuj9ztycsx08hfhzu",
+//		KeyID:     "firefox_mar",
+//		PublicKey: pub,
+//	}
+//	err := file.Sign(rand.Reader, signer, mar.SigAlgRsaPkcs1Sha384)
+package autograph
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"go.mozilla.org/mar"
+)
+
+// Signer signs digests with a signer of an Autograph service
+type Signer struct {
+	// URL is the base URL of the Autograph service
+	URL string
+	// User is the Hawk ID used to authenticate to Autograph
+	User string
+	// Key is the Hawk key of the user
+	Key string
+	// KeyID is the ID of the Autograph signer to sign with
+	KeyID string
+	// PublicKey is the public key of the Autograph signer, which
+	// determines the size of the signatures it makes
+	PublicKey crypto.PublicKey
+	// Client is the HTTP client used to send requests,
+	// http.DefaultClient if nil
+	Client *http.Client
+}
+
+// signatureRequest is a request to the /sign/hash endpoint of Autograph
+type signatureRequest struct {
+	Input   string            `json:"input"`
+	KeyID   string            `json:"keyid,omitempty"`
+	Options *signatureOptions `json:"options,omitempty"`
+}
+
+// signatureOptions are the options of the MAR signers of Autograph
+type signatureOptions struct {
+	SigAlg uint32 `json:"sigalg"`
+}
+
+// signatureResponse is a response of the /sign/hash endpoint of Autograph
+type signatureResponse struct {
+	Ref       string `json:"ref"`
+	Type      string `json:"type"`
+	Mode      string `json:"mode"`
+	SignerID  string `json:"signer_id"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// Public returns the public key of the Autograph signer
+func (s *Signer) Public() crypto.PublicKey {
+	return s.PublicKey
+}
+
+// Sign sends the digest to Autograph and returns the signature it made. The
+// hash function of opts selects the MAR signature algorithm requested from
+// Autograph, SHA1 for SigAlgRsaPkcs1Sha1 and SHA384 for SigAlgRsaPkcs1Sha384.
+// Autograph makes the entropy it needs, so rand is unused.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var sigalg uint32
+	switch opts.HashFunc() {
+	case crypto.SHA1:
+		sigalg = mar.SigAlgRsaPkcs1Sha1
+	case crypto.SHA384:
+		sigalg = mar.SigAlgRsaPkcs1Sha384
+	default:
+		return nil, fmt.Errorf("autograph: unsupported hash function %v", opts.HashFunc())
+	}
+	body, err := json.Marshal([]signatureRequest{{
+		Input:   base64.StdEncoding.EncodeToString(digest),
+		KeyID:   s.KeyID,
+		Options: &signatureOptions{SigAlg: sigalg},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("autograph: invalid url: %w", err)
+	}
+	u := base.ResolveReference(&url.URL{Path: "sign/hash"})
+	auth, err := newHawkAuth(s.User, s.Key, http.MethodPost, u, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", auth.header())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("autograph: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("autograph: failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("autograph: request failed with status %s: %s", resp.Status, respBody)
+	}
+	var sigs []signatureResponse
+	err = json.Unmarshal(respBody, &sigs)
+	if err != nil {
+		return nil, fmt.Errorf("autograph: failed to parse response: %w", err)
+	}
+	if len(sigs) != 1 {
+		return nil, fmt.Errorf("autograph: expected 1 signature in response, got %d", len(sigs))
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigs[0].Signature)
+	if err != nil {
+		return nil, fmt.Errorf("autograph: failed to decode signature: %w", err)
+	}
+	return sig, nil
+}
+
+// SignFile adds a signature made by Autograph to the MAR file,
+// using the algorithm requested
+func (s *Signer) SignFile(file *mar.File, algorithmID uint32) error {
+	return file.Sign(nil, s, algorithmID)
+}
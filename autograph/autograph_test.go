@@ -0,0 +1,132 @@
+package autograph
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"go.mozilla.org/mar"
+)
+
+const (
+	testUser = "alice"
+	testKey  = "fs5wgcer9qj819kfptdlp8gm227ewxnzvsuj9ztycsx08hfhzu"
+)
+
+var hawkParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// newTestServer returns a fake Autograph service that checks the Hawk
+// authorization of requests and signs their input with key
+func newTestServer(key *rsa.PrivateKey) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/sign/hash" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params := make(map[string]string)
+		for _, match := range hawkParamRe.FindAllStringSubmatch(r.Header.Get("Authorization"), -1) {
+			params[match[1]] = match[2]
+		}
+		ts, _ := strconv.ParseInt(params["ts"], 10, 64)
+		u, _ := url.Parse("http://" + r.Host + r.URL.RequestURI())
+		auth := &hawkAuth{
+			id: params["id"], key: testKey, ts: ts, nonce: params["nonce"],
+			method: r.Method, url: u, contentType: r.Header.Get("Content-Type"), payload: body,
+		}
+		if params["id"] != testUser || params["hash"] != auth.payloadHash() || params["mac"] != auth.mac(params["hash"]) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var reqs []signatureRequest
+		err = json.Unmarshal(body, &reqs)
+		if err != nil || len(reqs) != 1 || reqs[0].Options == nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		digest, _ := base64.StdEncoding.DecodeString(reqs[0].Input)
+		h := crypto.SHA384
+		if reqs[0].Options.SigAlg == mar.SigAlgRsaPkcs1Sha1 {
+			h = crypto.SHA1
+		}
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, h, digest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode([]signatureResponse{{
+			Ref:       "test",
+			Type:      "mar",
+			SignerID:  reqs[0].KeyID,
+			Signature: base64.StdEncoding.EncodeToString(sig),
+		}})
+	}))
+}
+
+func TestSignFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(key)
+	defer server.Close()
+
+	for _, alg := range []uint32{mar.SigAlgRsaPkcs1Sha1, mar.SigAlgRsaPkcs1Sha384} {
+		file := mar.New()
+		file.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+		signer := &Signer{
+			URL:       server.URL,
+			User:      testUser,
+			Key:       testKey,
+			KeyID:     "testmar",
+			PublicKey: key.Public(),
+		}
+		err = signer.SignFile(file, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = file.VerifySignature(key.Public())
+		if err != nil {
+			t.Fatalf("signature with algorithm %d failed to verify: %v", alg, err)
+		}
+	}
+}
+
+func TestSignBadCredentials(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(key)
+	defer server.Close()
+
+	file := mar.New()
+	file.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	signer := &Signer{
+		URL:       server.URL,
+		User:      testUser,
+		Key:       "wrong key",
+		PublicKey: key.Public(),
+	}
+	err = signer.SignFile(file, mar.SigAlgRsaPkcs1Sha384)
+	if err == nil {
+		t.Fatal("expected signing with bad credentials to fail")
+	}
+	if len(file.Signatures) != 0 {
+		t.Fatalf("expected no signature but found %d", len(file.Signatures))
+	}
+}
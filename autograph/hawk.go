@@ -0,0 +1,92 @@
+package autograph
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hawkAuth holds the parameters of a Hawk authorization header, as
+// described in https://github.com/mozilla/hawk/blob/main/API.md
+type hawkAuth struct {
+	id, key     string
+	ts          int64
+	nonce       string
+	method      string
+	url         *url.URL
+	contentType string
+	payload     []byte
+	ext         string
+}
+
+// newHawkAuth returns the parameters of a Hawk authorization header for a
+// request made now with a random nonce
+func newHawkAuth(id, key, method string, u *url.URL, contentType string, payload []byte) (*hawkAuth, error) {
+	nonce := make([]byte, 6)
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &hawkAuth{
+		id:          id,
+		key:         key,
+		ts:          time.Now().Unix(),
+		nonce:       base64.RawURLEncoding.EncodeToString(nonce),
+		method:      method,
+		url:         u,
+		contentType: contentType,
+		payload:     payload,
+	}, nil
+}
+
+// payloadHash returns the base64 encoded hash of the content type and payload
+func (a *hawkAuth) payloadHash() string {
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(a.contentType, ";")[0]))
+	h := sha256.New()
+	fmt.Fprintf(h, "hawk.1.payload\n%s\n", contentType)
+	h.Write(a.payload)
+	h.Write([]byte("\n"))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// mac returns the base64 encoded MAC of the normalized request string
+func (a *hawkAuth) mac(hash string) string {
+	host, port := a.url.Hostname(), a.url.Port()
+	if port == "" {
+		port = "80"
+		if a.url.Scheme == "https" {
+			port = "443"
+		}
+	}
+	normalized := strings.Join([]string{
+		"hawk.1.header",
+		strconv.FormatInt(a.ts, 10),
+		a.nonce,
+		strings.ToUpper(a.method),
+		a.url.RequestURI(),
+		strings.ToLower(host),
+		port,
+		hash,
+		a.ext,
+	}, "\n") + "\n"
+	m := hmac.New(sha256.New, []byte(a.key))
+	m.Write([]byte(normalized))
+	return base64.StdEncoding.EncodeToString(m.Sum(nil))
+}
+
+// header returns the value of the Authorization header of the request
+func (a *hawkAuth) header() string {
+	hash := a.payloadHash()
+	header := fmt.Sprintf(`Hawk id="%s", ts="%d", nonce="%s", hash="%s"`, a.id, a.ts, a.nonce, hash)
+	if a.ext != "" {
+		header += fmt.Sprintf(`, ext="%s"`, a.ext)
+	}
+	return header + fmt.Sprintf(`, mac="%s"`, a.mac(hash))
+}
@@ -0,0 +1,47 @@
+package autograph
+
+import (
+	"net/url"
+	"testing"
+)
+
+// the test vectors come from the Hawk specification
+func TestHawkMac(t *testing.T) {
+	testCases := []struct {
+		method, rawurl, contentType, payload string
+		expectedHash, expectedMac            string
+	}{
+		{"GET", "http://example.com:8000/resource/1?b=1&a=2", "", "",
+			"", "6R4rV5iE+NPoym+WwjeHzjAGXUtLNIxmo1vpMofpLAE="},
+		{"POST", "http://example.com:8000/resource/1?b=1&a=2", "text/plain", "Thank you for flying Hawk",
+			"Yi9LfIIFRtBEPt74PVmbTF/xVAwPn7ub15ePICfgnuY=", "aSe1DERmZuRl3pI36/9BdZmnErTw3sNzOOAUlfeKjVw="},
+	}
+	for i, testCase := range testCases {
+		u, err := url.Parse(testCase.rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth := &hawkAuth{
+			id:          "dh37fgj492je",
+			key:         "werxhqb98rpaxn39848xrunpaw3489ruxnpa98w4rxn",
+			ts:          1353832234,
+			nonce:       "j4h3g2",
+			method:      testCase.method,
+			url:         u,
+			contentType: testCase.contentType,
+			payload:     []byte(testCase.payload),
+			ext:         "some-app-ext-data",
+		}
+		var hash string
+		if testCase.expectedHash != "" {
+			hash = auth.payloadHash()
+			if hash != testCase.expectedHash {
+				t.Fatalf("testcase %d expected payload hash %q, got %q", i, testCase.expectedHash, hash)
+			}
+		}
+		mac := auth.mac(hash)
+		if mac != testCase.expectedMac {
+			t.Fatalf("testcase %d expected mac %q, got %q", i, testCase.expectedMac, mac)
+		}
+	}
+}
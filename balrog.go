@@ -0,0 +1,43 @@
+package mar
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+)
+
+// ReleaseMetadata holds the fields Balrog, Mozilla's update server, needs
+// to publish a MAR file
+type ReleaseMetadata struct {
+	// FileSize is the size of the MAR file, in bytes
+	FileSize uint64 `json:"filesize"`
+	// HashFunction is the name of the hash function of HashValue
+	HashFunction string `json:"hashFunction"`
+	// HashValue is the hex encoded hash of the MAR file
+	HashValue string `json:"hashValue"`
+	// AppVersion is the product version of the Product Information block
+	AppVersion string `json:"appVersion,omitempty"`
+	// Channels are the MAR channel IDs of the Product Information block
+	Channels []string `json:"channels,omitempty"`
+}
+
+// ReleaseMetadata returns the size and SHA512 hash of the MAR file as
+// Marshal writes it, along with the product version and MAR channel IDs
+// of its Product Information block, such that release automation can
+// submit it to Balrog
+func (file *File) ReleaseMetadata() (*ReleaseMetadata, error) {
+	output, err := file.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha512.Sum512(output)
+	md := &ReleaseMetadata{
+		FileSize:     uint64(len(output)),
+		HashFunction: "sha512",
+		HashValue:    hex.EncodeToString(sum[:]),
+	}
+	if info := file.productInfo(); info != nil {
+		md.AppVersion = info.Version
+		md.Channels = info.Channels
+	}
+	return md, nil
+}
@@ -0,0 +1,51 @@
+package mar
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestReleaseMetadata(t *testing.T) {
+	m := New()
+	err := m.SetProductInformation("62.0", "firefox-mozilla-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := reparsed.ReleaseMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha512.Sum512(o)
+	if md.FileSize != uint64(len(o)) || md.HashFunction != "sha512" || md.HashValue != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected size or hash in %+v", md)
+	}
+	if md.AppVersion != "62.0" || len(md.Channels) != 1 || md.Channels[0] != "firefox-mozilla-release" {
+		t.Fatalf("unexpected product info in %+v", md)
+	}
+	out, err := json.Marshal(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(out, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"filesize", "hashFunction", "hashValue", "appVersion", "channels"} {
+		if _, ok := fields[key]; !ok {
+			t.Fatalf("expected json field %q in %s", key, out)
+		}
+	}
+}
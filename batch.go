@@ -0,0 +1,145 @@
+package mar
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// BatchResult is the outcome of the verification of one file by VerifyBatch
+type BatchResult struct {
+	// Path is the path of the file that was verified
+	Path string `json:"path" yaml:"path"`
+	// Keys are the names of the keys that verified each signature, in
+	// the order the signatures appear in the file
+	Keys []string `json:"keys,omitempty" yaml:"keys,omitempty"`
+	// Err is set if the file could not be parsed or one of its
+	// signatures did not validate with any key
+	Err error `json:"-" yaml:"-"`
+}
+
+// VerifyBatch verifies the signatures of the MAR files at paths against the
+// named public keys, on up to concurrency goroutines, or one per CPU if
+// concurrency is zero or less. It returns the result of each file in the
+// order of paths. As with VerifyWithKeys, a file is valid if every one of
+// its signatures validates with one of the keys.
+//
+// Files are verified with constant memory as VerifyFile does, such that
+// large sets of large files can be audited in a single process. Once ctx
+// is done, the files that are left are reported with the error of the
+// context.
+func VerifyBatch(ctx context.Context, paths []string, keys map[string]crypto.PublicKey, concurrency int) []BatchResult {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	results := make([]BatchResult, len(paths))
+	forEach(len(paths), concurrency, func(i int) error {
+		results[i].Path = paths[i]
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			return nil
+		}
+		results[i].Keys, results[i].Err = verifyFileStream(ctx, paths[i], keys)
+		return nil
+	})
+	return results
+}
+
+// VerifyFile verifies the signatures of the MAR file at path against the
+// named public keys with constant memory, whatever the size of the file.
+// Only the headers and index are parsed, and the signed data is read from
+// disk in chunks, skipping the data of the signatures, and streamed through
+// the hash functions of the signatures. Like the Firefox updater, it
+// verifies the bytes of the file as they are, rather than the output of
+// MarshalForSignature. It returns the names of the keys that verified each
+// signature, as VerifyWithKeys does.
+func VerifyFile(path string, keys map[string]crypto.PublicKey) ([]string, error) {
+	return verifyFileStream(context.Background(), path, keys)
+}
+
+// verifyFileStream verifies the signatures of the MAR file at path
+// without loading its content in memory
+func verifyFileStream(ctx context.Context, path string, keys map[string]crypto.PublicKey) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(fd, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	file := r.File
+	if len(file.Signatures) == 0 {
+		return nil, errNoSignature
+	}
+
+	// the signed block is the whole file but the data of the signatures,
+	// so hash everything around it with the hash function of each
+	// signature, as the Firefox updater does
+	hashes, w := signatureHashes(file.Signatures)
+	pos := int64(MarIDLen + OffsetToIndexLen + FileSizeLen + SignaturesHeaderLen)
+	start := int64(0)
+	for _, sig := range file.Signatures {
+		pos += SignatureEntryHeaderLen
+		err = copyRange(ctx, w, fd, start, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos += int64(sig.Size)
+		start = pos
+	}
+	err = copyRange(ctx, w, fd, start, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make(map[crypto.Hash][]byte, len(hashes))
+	for h, md := range hashes {
+		digests[h] = md.Sum(nil)
+	}
+	var validKeys []string
+	keyNames := sortedKeyNames(keys)
+	for i, sig := range file.Signatures {
+		matched := false
+		for _, keyName := range keyNames {
+			if verifyDigest(digests, sig, keys[keyName]) == nil {
+				validKeys = append(validKeys, keyName)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("signature %d with algorithm %s did not validate with any key", i, getSigAlgNameFromID(sig.AlgorithmID))
+		}
+	}
+	return validKeys, nil
+}
+
+// copyRange copies the bytes of r between start and end to w, and stops
+// early if ctx is done
+func copyRange(ctx context.Context, w io.Writer, r io.ReaderAt, start, end int64) error {
+	_, err := copyBuffer(w, &ctxReader{ctx: ctx, r: io.NewSectionReader(r, start, end-start)})
+	return err
+}
+
+// ctxReader is a reader that fails with the error of its context once the
+// context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,173 @@
+package mar
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{
+		"rsa":   rsa2048Key.Public(),
+		"ecdsa": ecdsaKey.Public(),
+	}
+	dir, err := ioutil.TempDir("", "marbatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	unsigned, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.PrepareSignature(rsa2048Key, rsa2048Key.Public())
+	m.PrepareSignature(ecdsaKey, ecdsaKey.Public())
+	err = m.FinalizeSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, signed...)
+	tampered[m.Index[0].OffsetToContent] = 'b'
+
+	files := map[string][]byte{
+		"signed.mar":   signed,
+		"unsigned.mar": unsigned,
+		"tampered.mar": tampered,
+		"old.mar":      oldMarB,
+	}
+	for name, data := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var paths []string
+	for _, name := range []string{"signed.mar", "unsigned.mar", "tampered.mar", "missing.mar", "old.mar", "signed.mar"} {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+
+	for _, concurrency := range []int{1, 0} {
+		results := VerifyBatch(context.Background(), paths, keys, concurrency)
+		if len(results) != len(paths) {
+			t.Fatalf("expected %d results but got %d", len(paths), len(results))
+		}
+		for i, res := range results {
+			if res.Path != paths[i] {
+				t.Fatalf("expected result %d to be for %q but got %q", i, paths[i], res.Path)
+			}
+		}
+		for _, i := range []int{0, 5} {
+			if results[i].Err != nil {
+				t.Fatalf("expected signed file to verify but got %v", results[i].Err)
+			}
+			if len(results[i].Keys) != 2 || results[i].Keys[0] != "rsa" || results[i].Keys[1] != "ecdsa" {
+				t.Fatalf("expected signatures from keys [rsa ecdsa] but got %v", results[i].Keys)
+			}
+		}
+		if results[1].Err != errNoSignature {
+			t.Fatalf("expected unsigned file to fail with %q but got %v", errNoSignature, results[1].Err)
+		}
+		for _, i := range []int{2, 3, 4} {
+			if results[i].Err == nil {
+				t.Fatalf("expected verification of %q to fail", paths[i])
+			}
+		}
+	}
+
+	// the streamed verification must agree with the in-memory one
+	var file File
+	err = Unmarshal(tampered, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.VerifyWithKeys(keys)
+	if err == nil {
+		t.Fatal("expected verification of the tampered file to fail")
+	}
+}
+
+func TestVerifyBatchCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marbatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.mar")
+	err = ioutil.WriteFile(path, miniMarB, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := VerifyBatch(ctx, []string{path, path}, map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()}, 2)
+	for _, res := range results {
+		if res.Err != context.Canceled {
+			t.Fatalf("expected error %v but got %v", context.Canceled, res.Err)
+		}
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	m := New()
+	m.AddContent(bytes.Repeat([]byte("caribou maurice "), 10000), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "marverifyfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signed.mar")
+	err = ioutil.WriteFile(path, signed, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()}
+	validKeys, err := VerifyFile(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 1 || validKeys[0] != "rsa" {
+		t.Fatalf("expected signature from key [rsa] but got %v", validKeys)
+	}
+
+	// altering the data of the signature or the content fails verification
+	for _, offset := range []int{len(signed) / 2, MarIDLen + OffsetToIndexLen + FileSizeLen + SignaturesHeaderLen + SignatureEntryHeaderLen} {
+		tampered := append([]byte{}, signed...)
+		tampered[offset] ^= 0xff
+		err = ioutil.WriteFile(path, tampered, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = VerifyFile(path, keys)
+		if err == nil {
+			t.Fatalf("expected verification to fail with byte %d altered", offset)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package mar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// this is a minimal CBOR (RFC 7049) encoder and decoder, limited to the
+// types COSE structures are made of: integers, byte and text strings,
+// arrays, maps, tags, booleans and null
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTagged = 6
+	cborSimple = 7
+)
+
+// cborMaxDepth is the maximum nesting of arrays, maps and tags decoded
+const cborMaxDepth = 16
+
+// cborTag is a tagged CBOR data item
+type cborTag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// cborAppendHead appends the head of a data item of a major type with
+// argument n, in its shortest form
+func cborAppendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, major|25, 0, 0)
+		binary.BigEndian.PutUint16(b[len(b)-2:], uint16(n))
+		return b
+	case n <= math.MaxUint32:
+		b = append(b, major|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], uint32(n))
+		return b
+	default:
+		b = append(b, major|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], n)
+		return b
+	}
+}
+
+// cborAppend appends the encoding of v to b. Maps are encoded with their
+// keys in the order they are given, as COSE headers have at most a
+// couple of keys.
+func cborAppend(b []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborSimple<<5|22), nil
+	case bool:
+		if v {
+			return append(b, cborSimple<<5|21), nil
+		}
+		return append(b, cborSimple<<5|20), nil
+	case int:
+		return cborAppend(b, int64(v))
+	case int64:
+		if v < 0 {
+			return cborAppendHead(b, cborNegInt, uint64(-(v + 1))), nil
+		}
+		return cborAppendHead(b, cborUint, uint64(v)), nil
+	case uint64:
+		return cborAppendHead(b, cborUint, v), nil
+	case []byte:
+		return append(cborAppendHead(b, cborBytes, uint64(len(v))), v...), nil
+	case string:
+		return append(cborAppendHead(b, cborText, uint64(len(v))), v...), nil
+	case []interface{}:
+		b = cborAppendHead(b, cborArray, uint64(len(v)))
+		for _, item := range v {
+			b, err = cborAppend(b, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case cborMapItems:
+		b = cborAppendHead(b, cborMap, uint64(len(v)))
+		for _, item := range v {
+			b, err = cborAppend(b, item.Key)
+			if err != nil {
+				return nil, err
+			}
+			b, err = cborAppend(b, item.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case cborTag:
+		return cborAppend(cborAppendHead(b, cborTagged, v.Number), v.Content)
+	}
+	return nil, fmt.Errorf("cbor: unsupported type %T", v)
+}
+
+// cborMapItems is a map to encode, in the order of its items
+type cborMapItems []cborMapItem
+
+type cborMapItem struct {
+	Key, Value interface{}
+}
+
+// cborDecode decodes the single data item of data. Integers are decoded as
+// int64, byte strings as []byte, text strings as string, arrays as
+// []interface{}, maps as map[interface{}]interface{} with integer or text
+// keys, and tags as cborTag.
+func cborDecode(data []byte) (interface{}, error) {
+	d := cborDecoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("cbor: %d bytes of trailing data", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads the head of the next data item and returns its major type
+// and argument
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, errCBORTruncated
+	}
+	major, info := d.data[d.pos]>>5, d.data[d.pos]&0x1f
+	d.pos++
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	var size int
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		// indefinite lengths aren't used by COSE
+		return 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+	if len(d.data)-d.pos < size {
+		return 0, 0, errCBORTruncated
+	}
+	var n uint64
+	for _, c := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, n, nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, fmt.Errorf("cbor: data items are nested more than %d levels deep", cborMaxDepth)
+	}
+	start := d.pos
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	remaining := uint64(len(d.data) - d.pos)
+	switch major {
+	case cborUint, cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: integer overflows int64")
+		}
+		if major == cborNegInt {
+			return -int64(n) - 1, nil
+		}
+		return int64(n), nil
+	case cborBytes, cborText:
+		if n > remaining {
+			return nil, errCBORTruncated
+		}
+		s := d.data[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		if major == cborText {
+			return string(s), nil
+		}
+		return append([]byte{}, s...), nil
+	case cborArray:
+		// every item takes at least one byte
+		if n > remaining {
+			return nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		if n > remaining/2 {
+			return nil, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			if _, ok := m[key]; ok {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+			m[key], err = d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case cborTagged:
+		content, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return cborTag{Number: n, Content: content}, nil
+	default:
+		// floats share the major type of simple values
+		if d.data[start]&0x1f >= 24 {
+			return nil, fmt.Errorf("cbor: unsupported floating point value")
+		}
+		switch n {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", n)
+	}
+}
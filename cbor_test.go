@@ -0,0 +1,61 @@
+package mar
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	for i, testCase := range []struct {
+		in  interface{}
+		out interface{}
+	}{
+		{int64(0), int64(0)},
+		{int64(23), int64(23)},
+		{int64(24), int64(24)},
+		{int64(-7), int64(-7)},
+		{int64(-1000000), int64(-1000000)},
+		{uint64(1 << 40), int64(1 << 40)},
+		{[]byte("caribou"), []byte("caribou")},
+		{string(bytes.Repeat([]byte("m"), 300)), string(bytes.Repeat([]byte("m"), 300))},
+		{nil, nil},
+		{true, true},
+		{[]interface{}{int64(1), []byte{}, "x"}, []interface{}{int64(1), []byte{}, "x"}},
+		{cborMapItems{{int64(1), int64(-7)}, {"kid", []byte{1}}}, map[interface{}]interface{}{int64(1): int64(-7), "kid": []byte{1}}},
+		{cborTag{Number: coseSignTag, Content: int64(1)}, cborTag{Number: coseSignTag, Content: int64(1)}},
+	} {
+		data, err := cborAppend(nil, testCase.in)
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+		out, err := cborDecode(data)
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(out, testCase.out) {
+			t.Fatalf("testcase %d: expected %#v but got %#v", i, testCase.out, out)
+		}
+	}
+}
+
+func TestCBORDecodeErrors(t *testing.T) {
+	for i, data := range [][]byte{
+		{},
+		{0x18},                         // truncated argument
+		{0x45, 1, 2},                   // truncated byte string
+		{0x9a, 0xff, 0xff, 0xff, 0xff}, // array longer than the data
+		{0xa1, 0x01},                   // map without a value
+		{0xa2, 0x01, 0x01, 0x01, 0x01}, // duplicate key
+		{0xa1, 0x41, 0x00, 0x01},       // byte string key
+		{0x5f},                         // indefinite length
+		{0xf9, 0x00, 0x14},             // half float
+		{0x01, 0x02},                   // trailing data
+		bytes.Repeat([]byte{0x81}, cborMaxDepth+2),
+	} {
+		_, err := cborDecode(data)
+		if err == nil {
+			t.Fatalf("testcase %d: expected decoding %x to fail", i, data)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package mar
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// VerifyWithCertificate verifies the MAR file against the public key of a
+// signing certificate issued by an internal CA. The certificate is first
+// validated against the roots and intermediates of opts at opts.CurrentTime,
+// or now if it is zero, and must be valid for code signing unless
+// opts.KeyUsages lists other extended key usages. One of the signatures of
+// the file must then validate with the key of the certificate. It returns
+// the chains that validated the certificate.
+func (file *File) VerifyWithCertificate(cert *x509.Certificate, opts x509.VerifyOptions) ([][]*x509.Certificate, error) {
+	if len(opts.KeyUsages) == 0 {
+		// x509 defaults to server authentication, which signing
+		// certificates aren't issued for
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, errCertificateKeyUsage
+	}
+	chains, err := cert.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %q did not validate: %w", cert.Subject.CommonName, err)
+	}
+	err = file.VerifySignature(cert.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("no signature validates with the key of certificate %q", cert.Subject.CommonName)
+	}
+	return chains, nil
+}
+
+// ParseCertificatesPEM returns the certificates of the PEM blocks of data,
+// such as a bundle of roots or intermediates to build the pools of the
+// options of VerifyWithCertificate. Blocks that aren't certificates are
+// skipped.
+func ParseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errNoCertificate
+	}
+	return certs, nil
+}
@@ -0,0 +1,182 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// newTestCA returns a self-signed root
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "margo test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	return &testCA{cert: issueTestCertificate(t, tmpl, tmpl, key.Public(), key), key: key}
+}
+
+// issue returns a certificate of the public key signed by the CA
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate, pub crypto.PublicKey) *x509.Certificate {
+	return issueTestCertificate(t, tmpl, ca.cert, pub, ca.key)
+}
+
+func issueTestCertificate(t *testing.T, tmpl, parent *x509.Certificate, pub crypto.PublicKey, key crypto.Signer) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// signingCertificateTemplate returns the template of a leaf certificate
+// with the extended key usages
+func signingCertificateTemplate(serial int64, usages ...x509.ExtKeyUsage) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "margo test signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+}
+
+func TestVerifyWithCertificate(t *testing.T) {
+	root := newTestCA(t)
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate := &testCA{
+		cert: root.issue(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "margo test intermediate"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, intermediateKey.Public()),
+		key: intermediateKey,
+	}
+	leaf := intermediate.issue(t, signingCertificateTemplate(3, x509.ExtKeyUsageCodeSigning), rsa2048Key.Public())
+
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err = m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate.cert)
+	chains, err := m.VerifyWithCertificate(leaf, x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 3 || !chains[0][2].Equal(root.cert) {
+		t.Fatalf("expected a chain of 3 certificates up to the root but got %v", chains)
+	}
+
+	// the chain must be complete, valid at the time and for code signing
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(newTestCA(t).cert)
+	serverLeaf := intermediate.issue(t, signingCertificateTemplate(4, x509.ExtKeyUsageServerAuth), rsa2048Key.Public())
+	for i, testCase := range []struct {
+		cert *x509.Certificate
+		opts x509.VerifyOptions
+	}{
+		{leaf, x509.VerifyOptions{Roots: roots}},
+		{leaf, x509.VerifyOptions{Roots: otherRoots, Intermediates: intermediates}},
+		{leaf, x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: time.Now().Add(2 * time.Hour)}},
+		{serverLeaf, x509.VerifyOptions{Roots: roots, Intermediates: intermediates}},
+	} {
+		_, err = m.VerifyWithCertificate(testCase.cert, testCase.opts)
+		if err == nil {
+			t.Fatalf("testcase %d: expected verification to fail", i)
+		}
+	}
+	_, err = m.VerifyWithCertificate(serverLeaf, x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		t.Fatalf("expected the key usages of the options to be honored: %v", err)
+	}
+
+	// a valid certificate of another key doesn't verify the signature
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherLeaf := intermediate.issue(t, signingCertificateTemplate(5, x509.ExtKeyUsageCodeSigning), otherKey.Public())
+	_, err = m.VerifyWithCertificate(otherLeaf, x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if err == nil {
+		t.Fatal("expected the certificate of another key to fail verification")
+	}
+
+	// certificates restricted to other key usages can't sign
+	tmpl := signingCertificateTemplate(6, x509.ExtKeyUsageCodeSigning)
+	tmpl.KeyUsage = x509.KeyUsageKeyEncipherment
+	encipherLeaf := intermediate.issue(t, tmpl, rsa2048Key.Public())
+	_, err = m.VerifyWithCertificate(encipherLeaf, x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if err != errCertificateKeyUsage {
+		t.Fatalf("expected to fail with %q but got %v", errCertificateKeyUsage, err)
+	}
+}
+
+func TestParseCertificatesPEM(t *testing.T) {
+	root, other := newTestCA(t), newTestCA(t)
+	var bundle []byte
+	for _, block := range []*pem.Block{
+		{Type: "CERTIFICATE", Bytes: root.cert.Raw},
+		{Type: "PUBLIC KEY", Bytes: []byte("skipped")},
+		{Type: "CERTIFICATE", Bytes: other.cert.Raw},
+	} {
+		bundle = append(bundle, pem.EncodeToMemory(block)...)
+	}
+	certs, err := ParseCertificatesPEM(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(root.cert) || !certs[1].Equal(other.cert) {
+		t.Fatalf("unexpected certificates %v", certs)
+	}
+	_, err = ParseCertificatesPEM([]byte("no certificate"))
+	if err != errNoCertificate {
+		t.Fatalf("expected to fail with %q but got %v", errNoCertificate, err)
+	}
+	_, err = ParseCertificatesPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}))
+	if err == nil {
+		t.Fatal("expected a malformed certificate to fail")
+	}
+}
@@ -0,0 +1,121 @@
+package mar
+
+import (
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Checksum manifest formats accepted by WriteChecksums
+const (
+	// ChecksumJSON writes the Checksums as a JSON document
+	ChecksumJSON = "json"
+	// ChecksumSums writes one "<hex digest>  <name>" line per entry of
+	// the decompressed content, like the output of sha256sum
+	ChecksumSums = "sums"
+)
+
+// EntryChecksum holds the digests of an entry, as stored in the MAR
+// and once decompressed
+type EntryChecksum struct {
+	// Name is the name of the entry in the index
+	Name string `json:"name" yaml:"name"`
+	// Size is the size of the entry as stored in the MAR, in bytes
+	Size uint64 `json:"size" yaml:"size"`
+	// Digest is the hex encoded digest of the entry as stored in the MAR
+	Digest string `json:"digest" yaml:"digest"`
+	// DecompressedSize is the size of the decompressed entry, in bytes
+	DecompressedSize uint64 `json:"decompressed_size" yaml:"decompressed_size"`
+	// DecompressedDigest is the hex encoded digest of the decompressed entry
+	DecompressedDigest string `json:"decompressed_digest" yaml:"decompressed_digest"`
+}
+
+// Checksums is the list of digests of every entry of a MAR
+type Checksums struct {
+	// HashFunction is the name of the hash function of the digests
+	HashFunction string `json:"hash_function" yaml:"hash_function"`
+	// Entries are the digests of the entries in the order of the index
+	Entries []EntryChecksum `json:"entries" yaml:"entries"`
+}
+
+// Checksums computes the digests of every entry of the MAR with the hash
+// function h, both of the data stored in the file and of its decompressed
+// content. Entries are decompressed as a stream and never fully held in
+// memory.
+func (file *File) Checksums(h crypto.Hash) (*Checksums, error) {
+	if !h.Available() {
+		return nil, errHashUnavailable
+	}
+	sums := &Checksums{
+		HashFunction: hashName(h),
+		Entries:      make([]EntryChecksum, 0, len(file.Index)),
+	}
+	for _, e := range file.Entries() {
+		stored, err := NewHashWriter(nil, h)
+		if err != nil {
+			return nil, err
+		}
+		stored.Write(e.Data)
+		decompressed, err := NewHashWriter(nil, h)
+		if err != nil {
+			return nil, err
+		}
+		r, err := e.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+		_, err = copyBuffer(decompressed, r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+		sums.Entries = append(sums.Entries, EntryChecksum{
+			Name:               e.Name,
+			Size:               uint64(stored.Size()),
+			Digest:             hex.EncodeToString(stored.Sum()),
+			DecompressedSize:   uint64(decompressed.Size()),
+			DecompressedDigest: hex.EncodeToString(decompressed.Sum()),
+		})
+	}
+	return sums, nil
+}
+
+// WriteChecksums writes the checksums to w in the format ChecksumJSON or
+// ChecksumSums
+func (sums *Checksums) WriteChecksums(w io.Writer, format string) error {
+	switch format {
+	case ChecksumJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sums)
+	case ChecksumSums:
+		for _, e := range sums.Entries {
+			_, err := fmt.Fprintf(w, "%s  %s\n", e.DecompressedDigest, e.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errUnknownChecksumFormat
+	}
+}
+
+// hashName returns the lower case name of a hash function, as used in
+// update metadata
+func hashName(h crypto.Hash) string {
+	switch h {
+	case crypto.SHA1:
+		return "sha1"
+	case crypto.SHA256:
+		return "sha256"
+	case crypto.SHA384:
+		return "sha384"
+	case crypto.SHA512:
+		return "sha512"
+	default:
+		return fmt.Sprintf("hash-%d", uint(h))
+	}
+}
@@ -0,0 +1,86 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	plain := []byte("plain content")
+	packed := bytes.Repeat([]byte("compressible content "), 100)
+	m := New()
+	m.AddContent(plain, "/plain", 0600)
+	err := m.AddContent(packed, "/packed", 0600, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums, err := m.Checksums(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums.HashFunction != "sha256" || len(sums.Entries) != 2 {
+		t.Fatalf("unexpected checksums %+v", sums)
+	}
+	for _, e := range sums.Entries {
+		stored := sha256.Sum256(m.Content[e.Name].Data)
+		if e.Digest != hex.EncodeToString(stored[:]) || e.Size != uint64(len(m.Content[e.Name].Data)) {
+			t.Fatalf("unexpected stored digest of %q: %+v", e.Name, e)
+		}
+	}
+	expected := map[string][]byte{"/plain": plain, "/packed": packed}
+	for _, e := range sums.Entries {
+		sum := sha256.Sum256(expected[e.Name])
+		if e.DecompressedDigest != hex.EncodeToString(sum[:]) || e.DecompressedSize != uint64(len(expected[e.Name])) {
+			t.Fatalf("unexpected decompressed digest of %q: %+v", e.Name, e)
+		}
+	}
+	if sums.Entries[1].Digest == sums.Entries[1].DecompressedDigest {
+		t.Fatal("expected the compressed entry to have different digests")
+	}
+}
+
+func TestWriteChecksums(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaa"), "/foo/bar", 0600)
+	sums, err := m.Checksums(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = sums.WriteChecksums(&buf, ChecksumSums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("aaaa"))
+	if buf.String() != hex.EncodeToString(sum[:])+"  /foo/bar\n" {
+		t.Fatalf("unexpected sums output %q", buf.String())
+	}
+	buf.Reset()
+	err = sums.WriteChecksums(&buf, ChecksumJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Checksums
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.HashFunction != "sha256" || len(decoded.Entries) != 1 || decoded.Entries[0] != sums.Entries[0] {
+		t.Fatalf("unexpected json output %s", buf.String())
+	}
+	err = sums.WriteChecksums(&buf, "xml")
+	if err != errUnknownChecksumFormat {
+		t.Fatalf("expected error %v, got %v", errUnknownChecksumFormat, err)
+	}
+}
+
+func TestChecksumsUnavailableHash(t *testing.T) {
+	_, err := New().Checksums(crypto.Hash(0))
+	if err != errHashUnavailable {
+		t.Fatalf("expected error %v, got %v", errHashUnavailable, err)
+	}
+}
@@ -0,0 +1,67 @@
+package mar
+
+// Clone returns a deep copy of the file, whose signatures, additional
+// sections, index, entries and their data can be modified without
+// affecting the original, such as to strip the signatures of a copy of a
+// parsed file while keeping the original intact.
+func (file *File) Clone() *File {
+	c := *file
+	if file.ProductInfo != nil {
+		info := *file.ProductInfo
+		info.Channels = cloneStrings(info.Channels)
+		c.ProductInfo = &info
+	}
+	if file.Signatures != nil {
+		c.Signatures = make([]Signature, len(file.Signatures))
+		for i, sig := range file.Signatures {
+			sig.Data = cloneBytes(sig.Data)
+			c.Signatures[i] = sig
+		}
+	}
+	if file.AdditionalSections != nil {
+		c.AdditionalSections = make([]AdditionalSection, len(file.AdditionalSections))
+		for i, as := range file.AdditionalSections {
+			as.Data = cloneBytes(as.Data)
+			c.AdditionalSections[i] = as
+		}
+	}
+	if file.Index != nil {
+		c.Index = append(make([]IndexEntry, 0, len(file.Index)), file.Index...)
+	}
+	if file.Content != nil {
+		c.Content = make(map[string]Entry, len(file.Content))
+		for name, e := range file.Content {
+			e.Data = cloneBytes(e.Data)
+			c.Content[name] = e
+		}
+	}
+	c.Warnings = cloneStrings(file.Warnings)
+	if file.layout != nil {
+		l := *file.layout
+		l.entries = append([]IndexEntry(nil), l.entries...)
+		l.gaps = make([]rawChunk, len(file.layout.gaps))
+		for i, gap := range file.layout.gaps {
+			gap.data = cloneBytes(gap.data)
+			l.gaps[i] = gap
+		}
+		l.trailer = cloneBytes(l.trailer)
+		c.layout = &l
+	}
+	return &c
+}
+
+// cloneBytes returns a copy of b, which is nil if b is
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+// cloneStrings returns a copy of s, which is nil if s is
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
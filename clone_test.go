@@ -0,0 +1,77 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.AddProductInfoBlock(ProductInfo{Version: "62.0", Channels: []string{"firefox-mozilla-release"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	err = Unmarshal(input, &file, ZeroCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := file.Clone()
+	// strip the signatures and modify everything else of the clone
+	c.Signatures[0].Data[0] ^= 0xff
+	c.Signatures = nil
+	c.AdditionalSections[0].Data[0] ^= 0xff
+	c.Index[0].Flags = 0755
+	c.Content["/foo/bar"].Data[0] = 'b'
+	c.ProductInfo.Channels[0] = "other"
+	delete(c.Content, "/foo/bar")
+
+	if !bytes.Equal(input[file.Index[0].OffsetToContent:][:1], []byte("a")) || file.Content["/foo/bar"].Data[0] != 'a' {
+		t.Fatal("expected the content of the original to be intact")
+	}
+	if file.Index[0].Flags != 0600 || file.ProductInfo.Channels[0] != "firefox-mozilla-release" {
+		t.Fatal("expected the index and product information of the original to be intact")
+	}
+	_, err = file.VerifyWithKeys(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatalf("expected the original to still verify: %v", err)
+	}
+	// the original still marshals to the bytes it was parsed from
+	output, err := file.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, output) {
+		t.Fatal("expected the original to marshal identically")
+	}
+
+	// a clone marshals and verifies like the original
+	c = file.Clone()
+	output, err = c.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, output) {
+		t.Fatal("expected the clone to marshal identically")
+	}
+}
+
+func TestCloneEmpty(t *testing.T) {
+	var file File
+	c := file.Clone()
+	if c.Signatures != nil || c.AdditionalSections != nil || c.Index != nil || c.Content != nil || c.layout != nil {
+		t.Fatalf("expected the clone of an empty file to be empty but got %+v", c)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+var checksumHashes = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+func runChecksums(args []string) error {
+	fs := newFlagSet("checksums", "<file.mar>")
+	hashName := fs.String("a", "sha256", "hash function: sha1, sha256, sha384 or sha512")
+	format := fs.String("format", mar.ChecksumSums, "output format: sums, json or yaml")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	h, ok := checksumHashes[*hashName]
+	if !ok {
+		return fmt.Errorf("unsupported hash function %q", *hashName)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	sums, err := file.Checksums(h)
+	if err != nil {
+		return err
+	}
+	if *format == "yaml" {
+		return printFormatted(*format, sums)
+	}
+	return sums.WriteChecksums(os.Stdout, *format)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.mozilla.org/mar"
+)
+
+func runConvert(args []string) error {
+	fs := newFlagSet("convert", "<file.mar> <output>")
+	format := fs.String("f", "", "archive format: tar, tar.gz or zip (default: from the extension of the output)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	output := fs.Arg(1)
+	if *format == "" {
+		*format = archiveFormat(output)
+	}
+	var convert func(io.Writer, *mar.File, ...mar.Option) error
+	switch *format {
+	case "tar":
+		convert = mar.ToTar
+	case "tar.gz", "tgz":
+		convert = func(w io.Writer, file *mar.File, opts ...mar.Option) error {
+			gw := gzip.NewWriter(w)
+			err := mar.ToTar(gw, file, opts...)
+			if err != nil {
+				return err
+			}
+			return gw.Close()
+		}
+	case "zip":
+		convert = mar.ToZip
+	default:
+		return fmt.Errorf("unknown archive format %q, must be tar, tar.gz or zip", *format)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fd, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = convert(fd, file)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// archiveFormat returns the archive format of a file name's extension
+func archiveFormat(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	}
+	return "tar"
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mozilla.org/mar"
+	"go.mozilla.org/mar/manifest"
+)
+
+func runCreate(args []string) error {
+	fs := newFlagSet("create", "<file.mar> <file>...")
+	productInfo := fs.String("p", "", "product information to store in the MAR")
+	channels := fs.String("H", "", "comma-separated MAR channel IDs to store in the product information block")
+	version := fs.String("V", "", "product version to store in the product information block")
+	compress := fs.Bool("J", false, "compress entries with xz")
+	withManifest := fs.Bool("M", false, "add an updatev3.manifest that adds every file, for a complete update")
+	withHashes := fs.Bool("S", false, "add a section with the SHA256 digest of every entry")
+	root := fs.String("C", ".", "directory the names of entries are relative to, which files must be in")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	paths := fs.Args()[1:]
+	names, err := entryNames(*root, paths)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	var opts []mar.Option
+	if *compress {
+		opts = append(opts, mar.Compress())
+	}
+	w := mar.NewWriter(fd, opts...)
+	switch {
+	case *channels != "" || *version != "":
+		err = w.AddProductInfoBlock(mar.ProductInfo{
+			Version:  *version,
+			Channels: strings.Split(*channels, ","),
+		})
+	case *productInfo != "":
+		err = w.AddProductInfo(*productInfo)
+	}
+	if err != nil {
+		return err
+	}
+	var manifestData []byte
+	if *withManifest {
+		manifestData, err = completeManifest(names)
+		if err != nil {
+			return err
+		}
+	}
+	if *withHashes {
+		// the section is written before the content, so the files are
+		// hashed beforehand
+		hashes, err := hashFiles(manifestData, names, paths)
+		if err != nil {
+			return err
+		}
+		err = w.AddAdditionalSection(hashes.Bytes(), mar.BlockIDEntryHashes)
+		if err != nil {
+			return err
+		}
+	}
+	if manifestData != nil {
+		err = w.AddFile(manifest.V3Name, bytes.NewReader(manifestData), mar.FlagsRegular)
+		if err != nil {
+			return err
+		}
+	}
+	for i, path := range paths {
+		err = addFile(w, names[i], path)
+		if err != nil {
+			return err
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// entryNames returns the names of the entries of the files at paths, which
+// are their paths relative to root. Files outside of root are rejected.
+func entryNames(root string, paths []string) ([]string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	policy := mar.DefaultPathPolicy()
+	var names []string
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(absRoot, absPath)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.ToSlash(rel)
+		err = policy.CheckName(name)
+		if err != nil {
+			return nil, fmt.Errorf("refusing to add %s which is not in %s: %v", path, root, err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// completeManifest returns the manifest of a complete update of the entries
+func completeManifest(names []string) ([]byte, error) {
+	m, err := manifest.Complete(names)
+	if err != nil {
+		return nil, err
+	}
+	return m.Bytes()
+}
+
+// hashFiles returns the hashes of the entries of the manifest, if any, and
+// of the files at paths, named after names
+func hashFiles(manifestData []byte, names, paths []string) (mar.EntryHashes, error) {
+	var hashes mar.EntryHashes
+	if manifestData != nil {
+		err := hashes.Add(manifest.V3Name, bytes.NewReader(manifestData))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, path := range paths {
+		fd, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = hashes.Add(names[i], fd)
+		fd.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+func addFile(w *mar.Writer, name, path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	return w.AddFile(name, fd, uint32(fi.Mode().Perm()))
+}
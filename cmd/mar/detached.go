@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+func runExportSignature(args []string) error {
+	fs := newFlagSet("export-sig", "<input.mar> <output.sig>")
+	index := fs.Int("n", 0, "index of the signature to export")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	detached, err := file.ExportSignature(*index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fs.Arg(1), detached, 0644)
+}
+
+func runImportSignature(args []string) error {
+	fs := newFlagSet("import-sig", "<input.mar> <input.sig> <output.mar>")
+	index := fs.Int("n", 0, "index of the signature to replace, or the number of signatures to add it")
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	detached, err := ioutil.ReadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	err = file.ImportSignature(*index, detached)
+	if err != nil {
+		return err
+	}
+	return writeMar(file, fs.Arg(2))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+func runDiff(args []string) error {
+	fs := newFlagSet("diff", "<old.mar> <new.mar>")
+	format := addFormatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	oldFile, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newFile, err := readMar(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	report, err := mar.Diff(oldFile, newFile)
+	if err != nil {
+		return err
+	}
+	if *format != "text" {
+		return printFormatted(*format, report)
+	}
+	for _, e := range report.Removed {
+		fmt.Printf("- %s (%d bytes)\n", e.Name, e.OldSize)
+	}
+	for _, e := range report.Added {
+		fmt.Printf("+ %s (%d bytes)\n", e.Name, e.NewSize)
+	}
+	for _, e := range report.Changed {
+		if e.OldFlags != e.NewFlags {
+			fmt.Printf("~ %s (mode %s -> %s)\n", e.Name, os.FileMode(e.OldFlags), os.FileMode(e.NewFlags))
+		}
+		if e.OldSHA256 != e.NewSHA256 {
+			fmt.Printf("~ %s (%d -> %d bytes)\n", e.Name, e.OldSize, e.NewSize)
+		}
+	}
+	if pi := report.ProductInformation; pi != nil {
+		fmt.Printf("product information: %q -> %q\n", pi.Old, pi.New)
+	}
+	if sigs := report.Signatures; sigs != nil {
+		for _, sig := range sigs.Old {
+			fmt.Printf("- signature %s %s\n", sig.Algorithm, sig.SHA256)
+		}
+		for _, sig := range sigs.New {
+			fmt.Printf("+ signature %s %s\n", sig.Algorithm, sig.SHA256)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+func runExplain(args []string) error {
+	fs := newFlagSet("explain", "<file.mar>")
+	lenient := fs.Bool("l", false, "accept files with cosmetic inconsistencies")
+	format := addFormatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	input, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var opts []mar.Option
+	if *lenient {
+		opts = append(opts, mar.Lenient())
+	}
+	if *format == "text" {
+		return mar.Explain(os.Stdout, input, opts...)
+	}
+	var file mar.File
+	err = mar.Unmarshal(input, &file, append(opts, mar.SkipContent())...)
+	if err != nil {
+		return err
+	}
+	return printFormatted(*format, file.Layout())
+}
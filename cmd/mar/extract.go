@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+func runExtract(args []string) error {
+	fs := newFlagSet("extract", "<file.mar>")
+	destDir := fs.String("C", ".", "directory to extract the entries to")
+	verbose := fs.Bool("v", false, "print the name of each extracted entry")
+	jobs := fs.Int("j", 1, "number of entries to extract in parallel, 0 for one per CPU")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	err = file.ExtractAll(*destDir, mar.WithConcurrency(*jobs))
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		for _, idx := range file.Index {
+			fmt.Println(idx.FileName)
+		}
+	}
+	return nil
+}
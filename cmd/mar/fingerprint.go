@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+func runFingerprint(args []string) error {
+	fs := newFlagSet("fingerprint", "<key.pem>...")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, path := range fs.Args() {
+		key, err := readPublicKey(path)
+		if err != nil {
+			return err
+		}
+		fp, err := mar.KeyFingerprint(key)
+		if err != nil {
+			return fmt.Errorf("failed to compute the fingerprint of %s: %w", path, err)
+		}
+		fmt.Printf("%s  %s\n", mar.FormatFingerprint(fp), path)
+	}
+	return nil
+}
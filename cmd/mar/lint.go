@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func runLint(args []string) error {
+	fs := newFlagSet("lint", "<file.mar>")
+	format := addFormatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	findings := file.Lint()
+	if *format != "text" {
+		err = printFormatted(*format, findings)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			if f.Entry != "" {
+				fmt.Printf("%s: %s: %s\n", f.Check, f.Entry, f.Message)
+			} else {
+				fmt.Printf("%s: %s\n", f.Check, f.Message)
+			}
+		}
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("%d findings", len(findings))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go.mozilla.org/mar"
+)
+
+func runList(args []string) error {
+	fs := newFlagSet("list", "<file.mar>")
+	format := addFormatFlag(fs)
+	data := fs.String("data", "summary", "encoding of binary data in json output: summary, base64, hex or none")
+	withContent := fs.Bool("content", false, "include the content of entries in json output")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	enc, err := mar.ParseDataEncoding(*data)
+	if err != nil {
+		return err
+	}
+	var opts []mar.Option
+	if !*withContent {
+		opts = append(opts, mar.SkipContent())
+	}
+	file, err := readMar(fs.Arg(0), opts...)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return printFormatted(*format, file.JSON(enc))
+	}
+	if *format != "text" {
+		return printFormatted(*format, file)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "SIZE\tMODE\tNAME\n")
+	for _, idx := range file.Index {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", idx.Size, os.FileMode(idx.Flags), idx.FileName)
+	}
+	return tw.Flush()
+}
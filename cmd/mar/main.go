@@ -0,0 +1,59 @@
+// Command mar lists, extracts, creates, signs and verifies MAR files
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name, usage string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"list", "list the entries of a MAR file", runList},
+	{"extract", "extract the entries of a MAR file to a directory", runExtract},
+	{"create", "create a MAR file from a list of files", runCreate},
+	{"sign", "sign a MAR file with RSA or ECDSA private keys", runSign},
+	{"verify", "verify the signatures of a MAR file", runVerify},
+	{"fingerprint", "print the SHA256 fingerprints of public keys", runFingerprint},
+	{"export-sig", "export a signature of a MAR file to a detached file", runExportSignature},
+	{"import-sig", "import a detached signature into a MAR file", runImportSignature},
+	{"checksums", "print the digests of the entries of a MAR file", runChecksums},
+	{"stats", "print the size statistics of a MAR file", runStats},
+	{"convert", "convert a MAR file to a tar, tar.gz or zip archive", runConvert},
+	{"diff", "compare the entries and headers of two MAR files", runDiff},
+	{"explain", "print a hexdump of a MAR file labeled with its fields", runExplain},
+	{"lint", "report the oddities of a MAR file", runLint},
+	{"recover", "rebuild the index of a damaged MAR file", runRecover},
+	{"serve", "serve the entries of a MAR file over HTTP", runServe},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [arguments]\n\ncommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s%s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun '%s <command> -h' for the arguments of a command\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		err := cmd.run(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mar %s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+func runRecover(args []string) error {
+	fs := newFlagSet("recover", "<damaged.mar> <recovered.mar>")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	input, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	file, err := mar.Recover(input)
+	if err != nil {
+		return err
+	}
+	for _, warning := range file.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return writeMar(file, fs.Arg(1))
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+func runServe(args []string) error {
+	fs := newFlagSet("serve", "<file.mar>")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	m, err := mar.OpenMapped(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", fs.Arg(0), err)
+	}
+	defer m.Close()
+	fmt.Fprintf(os.Stderr, "serving the entries of %s on http://%s/\n", fs.Arg(0), *addr)
+	return http.ListenAndServe(*addr, mar.NewHandler(m.Reader))
+}
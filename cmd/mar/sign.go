@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"os"
+
+	"go.mozilla.org/mar"
+)
+
+func runSign(args []string) error {
+	fs := newFlagSet("sign", "<input.mar> <output.mar>")
+	var keyPaths stringList
+	fs.Var(&keyPaths, "k", "path to a PEM encoded RSA or ECDSA private key, can be repeated to add several signatures")
+	algName := fs.String("a", "sha384", "signature algorithm of RSA keys, sha384 or sha1; ECDSA keys use the algorithm of their curve")
+	fs.Parse(args)
+	if fs.NArg() != 2 || len(keyPaths) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var algorithmID uint32
+	switch *algName {
+	case "sha384":
+		algorithmID = mar.SigAlgRsaPkcs1Sha384
+	case "sha1":
+		algorithmID = mar.SigAlgRsaPkcs1Sha1
+	default:
+		return fmt.Errorf("unknown signature algorithm %q", *algName)
+	}
+	var keys []mar.SigningKey
+	for _, keyPath := range keyPaths {
+		key, err := readPrivateKey(keyPath)
+		if err != nil {
+			return err
+		}
+		keyAlgorithmID := algorithmID
+		if ecKey, ok := key.Public().(*ecdsa.PublicKey); ok {
+			switch ecKey.Params().Name {
+			case elliptic.P256().Params().Name:
+				keyAlgorithmID = mar.SigAlgEcdsaP256Sha256
+			case elliptic.P384().Params().Name:
+				keyAlgorithmID = mar.SigAlgEcdsaP384Sha384
+			default:
+				return fmt.Errorf("unsupported ecdsa curve %s in %q", ecKey.Params().Name, keyPath)
+			}
+		}
+		keys = append(keys, mar.SigningKey{Signer: key, AlgorithmID: keyAlgorithmID})
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	// existing signatures would be invalidated by the new one, so remove them
+	file.StripSignatures()
+	err = file.SignAll(rand.Reader, keys...)
+	if err != nil {
+		return err
+	}
+	return writeMar(file, fs.Arg(1))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func runStats(args []string) error {
+	fs := newFlagSet("stats", "<file.mar>")
+	format := addFormatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	stats, err := file.Stats()
+	if err != nil {
+		return err
+	}
+	if *format != "text" {
+		return printFormatted(*format, stats)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "File size:\t%d bytes\n", stats.FileSize)
+	fmt.Fprintf(tw, "Entries:\t%d (%d compressed)\n", stats.Entries, stats.CompressedEntries)
+	fmt.Fprintf(tw, "Stored size:\t%d bytes\n", stats.StoredSize)
+	fmt.Fprintf(tw, "Decompressed size:\t%d bytes\n", stats.DecompressedSize)
+	fmt.Fprintf(tw, "Compression ratio:\t%.1f%%\n", stats.CompressionRatio*100)
+	fmt.Fprintf(tw, "Signature overhead:\t%d bytes\n", stats.SignatureOverhead)
+	fmt.Fprintf(tw, "Additional sections:\t%d bytes\n", stats.AdditionalSectionsSize)
+	fmt.Fprintf(tw, "Index:\t%d bytes\n", stats.IndexSize)
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nBy extension:\n")
+	fmt.Fprintf(tw, "  extension\tentries\tstored\tdecompressed\tratio\n")
+	for _, ext := range stats.Extensions {
+		name := ext.Extension
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%d\t%.1f%%\n",
+			name, ext.Entries, ext.StoredSize, ext.DecompressedSize, ext.CompressionRatio*100)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nLargest entries:\n")
+	fmt.Fprintf(tw, "  stored\tdecompressed\tratio\tcompression\tname\n")
+	for _, e := range stats.Largest {
+		fmt.Fprintf(tw, "  %d\t%d\t%.1f%%\t%s\t%s\n",
+			e.StoredSize, e.DecompressedSize, e.CompressionRatio*100, e.Compression, e.Name)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"go.mozilla.org/mar"
+	"gopkg.in/yaml.v2"
+)
+
+// newFlagSet returns a flag set for a command with a usage message
+// that documents its positional arguments
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [flags] %s\n", os.Args[0], name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// addFormatFlag adds the -format flag of the commands that can print
+// machine-readable output
+func addFormatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", "text", "output format: text, json or yaml")
+}
+
+// printFormatted writes v to the standard output as JSON or YAML
+func printFormatted(format string, v interface{}) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
+
+// readMar reads and parses the MAR file at path
+func readMar(path string, opts ...mar.Option) (*mar.File, error) {
+	var file mar.File
+	err := mar.UnmarshalFile(path, &file, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return &file, nil
+}
+
+// writeMar marshals the MAR file and writes it to path
+func writeMar(file *mar.File, path string) error {
+	return file.MarshalToFile(path, 0644)
+}
+
+// readPEM returns the first PEM block of the file at path
+func readPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	return block, nil
+}
+
+// readPrivateKey loads a PKCS1, PKCS8 or EC private key from a PEM file
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type %q in %s", block.Type, path)
+}
+
+// readPublicKey loads a public key or the key of a certificate from a PEM
+// or DER file
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := mar.ParsePublicKeyPEM(data)
+	if err != nil {
+		key, err = mar.ParsePublicKeyDER(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key from %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
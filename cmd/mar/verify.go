@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"go.mozilla.org/mar"
+)
+
+func runVerify(args []string) error {
+	fs := newFlagSet("verify", "<file.mar>")
+	var keyPaths stringList
+	fs.Var(&keyPaths, "k", "path to a PEM or DER encoded public key or certificate, optionally labeled as label=path, or to a directory of them named after their files, can be repeated. Defaults to the Firefox keys")
+	report := fs.Bool("v", false, "print the algorithm, and the label and fingerprint of the key of each signature")
+	fs.BoolVar(report, "r", false, "same as -v")
+	certPath := fs.String("cert", "", "path to a PEM encoded signing certificate to validate and verify the signatures with, instead of keys")
+	rootsPath := fs.String("roots", "", "path to a PEM bundle of the root certificates that issued the -cert certificate")
+	intermediatesPath := fs.String("intermediates", "", "path to a PEM bundle of intermediate certificates of the -cert certificate")
+	format := addFormatFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*certPath == "") != (*rootsPath == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file, err := readMar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *certPath != "" {
+		return verifyWithCertificate(file, *certPath, *rootsPath, *intermediatesPath)
+	}
+	if *format != "text" {
+		return printVerifyReport(file, keyPaths, *format)
+	}
+	if len(keyPaths) == 0 && !*report {
+		validKeys, isSigned, err := file.VerifyWithFirefoxKeys()
+		if err != nil {
+			return err
+		}
+		if !isSigned {
+			return fmt.Errorf("no valid signature found")
+		}
+		fmt.Printf("signature: OK, valid signature from %s\n", strings.Join(validKeys, ","))
+		return nil
+	}
+	keys, err := readVerifyKeys(keyPaths)
+	if err != nil {
+		return err
+	}
+	if *report {
+		results, err := file.VerifyReport(keys)
+		if err != nil {
+			return err
+		}
+		for i, sr := range results {
+			if sr.Valid {
+				fmt.Printf("signature %d: %s OK, signed by %s (%s)\n", i, sr.Algorithm, sr.KeyName, mar.FormatFingerprint(sr.KeyFingerprint))
+			} else {
+				fmt.Printf("signature %d: %s FAILED, %s\n", i, sr.Algorithm, sr.Reason)
+			}
+		}
+		if len(keyPaths) == 0 {
+			// like without -v, a single valid firefox signature is enough
+			for _, sr := range results {
+				if sr.Valid {
+					return nil
+				}
+			}
+			return fmt.Errorf("no valid signature found")
+		}
+	}
+	validKeys, err := file.VerifyWithKeys(keys)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("signature: OK, valid signature from %s\n", strings.Join(validKeys, ","))
+	return nil
+}
+
+// printVerifyReport prints the result of every signature of the file
+// against the keys, or the Firefox keys if none is given, and fails if
+// none of the signatures is valid
+func printVerifyReport(file *mar.File, keyPaths []string, format string) error {
+	keys, err := readVerifyKeys(keyPaths)
+	if err != nil {
+		return err
+	}
+	results, err := file.VerifyReport(keys)
+	if err != nil {
+		return err
+	}
+	err = printFormatted(format, results)
+	if err != nil {
+		return err
+	}
+	for _, sr := range results {
+		if sr.Valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("no valid signature found")
+}
+
+// readVerifyKeys loads the public keys given with -k, named by their label
+// or their path, or returns the Firefox keys if there are none
+func readVerifyKeys(keyPaths []string) (map[string]crypto.PublicKey, error) {
+	if len(keyPaths) == 0 {
+		return mar.FirefoxKeys()
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, arg := range keyPaths {
+		label, path := arg, arg
+		// paths that exist win over labels, in case they contain an '='
+		if i := strings.Index(arg, "="); i > 0 {
+			if _, err := os.Stat(arg); err != nil {
+				label, path = arg[:i], arg[i+1:]
+			}
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
+			dirKeys, err := mar.LoadKeysFromDir(path)
+			if err != nil {
+				return nil, err
+			}
+			for name, key := range dirKeys {
+				keys[name] = key
+			}
+			continue
+		}
+		key, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys[label] = key
+	}
+	return keys, nil
+}
+
+// verifyWithCertificate validates the signing certificate at certPath
+// against the roots and intermediates bundles, and verifies the signatures
+// of the file with its key
+func verifyWithCertificate(file *mar.File, certPath, rootsPath, intermediatesPath string) error {
+	certs, err := readCertificates(certPath)
+	if err != nil {
+		return err
+	}
+	opts := x509.VerifyOptions{Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool()}
+	roots, err := readCertificates(rootsPath)
+	if err != nil {
+		return err
+	}
+	for _, cert := range roots {
+		opts.Roots.AddCert(cert)
+	}
+	// intermediates can come in their own bundle or after the leaf
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if intermediatesPath != "" {
+		intermediates, err := readCertificates(intermediatesPath)
+		if err != nil {
+			return err
+		}
+		for _, cert := range intermediates {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	chains, err := file.VerifyWithCertificate(certs[0], opts)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, cert := range chains[0] {
+		names = append(names, cert.Subject.CommonName)
+	}
+	fmt.Printf("signature: OK, valid signature from certificate chain %s\n", strings.Join(names, " > "))
+	return nil
+}
+
+// readCertificates loads the certificates of a PEM bundle
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := mar.ParseCertificatesPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificates from %s: %w", path, err)
+	}
+	return certs, nil
+}
@@ -13,7 +13,7 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Printf("usage: %s <file> [json]\nParse and Verify the signature of a Firefox MAR.\nIf json is set as 2nd arg, dump the MAR as JSON too.\n", os.Args[0])
+		fmt.Printf("usage: %s <file> [json|dump]\nParse and Verify the signature of a Firefox MAR.\nIf json is set as 2nd arg, dump the MAR as JSON too.\nIf dump is set as 2nd arg, print a detailed report of the MAR.\n", os.Args[0])
 		os.Exit(1)
 	}
 	var file mar.File
@@ -31,6 +31,11 @@ func main() {
 			log.Fatal(err)
 		}
 		fmt.Printf("%s\n", o)
+	} else if len(os.Args) > 2 && os.Args[2] == "dump" {
+		err = file.Dump(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else {
 		fmt.Printf("%s\tsize=%d bytes\tsignatures=%d\tcontent=%d entries\tproduct=%q\trevision=%d\n",
 			file.MarID, file.Size,
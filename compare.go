@@ -0,0 +1,173 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+// Difference is a field that differs between two MAR files. Values are
+// formatted for display, with binary data replaced by its size and digest.
+type Difference struct {
+	// Field is the path of the field, like "signatures[0].data" or
+	// "index[/foo/bar].flags"
+	Field string `json:"field" yaml:"field"`
+	// A is the value of the field in the first file
+	A string `json:"a" yaml:"a"`
+	// B is the value of the field in the second file
+	B string `json:"b" yaml:"b"`
+}
+
+// String returns the difference on one line
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s != %s", d.Field, d.A, d.B)
+}
+
+// Equal returns true if Compare finds no difference between the files
+func Equal(a, b *File) bool {
+	return len(Compare(a, b)) == 0
+}
+
+// Compare returns the differences between the headers, signatures,
+// additional sections, index and content of two files. Signatures and
+// additional sections are compared in the order of the files, while index
+// entries and content are matched by name, such that their order only
+// counts as a single difference of the order of the index. Unlike Diff,
+// the data of entries is compared as stored, not once decompressed, and
+// warnings and the layout of parsed files are ignored.
+func Compare(a, b *File) []Difference {
+	var c comparison
+	c.value("mar_id", a.MarID, b.MarID)
+	c.value("revision", a.Revision, b.Revision)
+	c.value("size", a.Size, b.Size)
+	c.value("offset_to_index", a.OffsetToIndex, b.OffsetToIndex)
+	c.value("product_information", fmt.Sprintf("%q", a.ProductInformation), fmt.Sprintf("%q", b.ProductInformation))
+
+	c.value("signature_header.num_signatures", a.SignaturesHeader.NumSignatures, b.SignaturesHeader.NumSignatures)
+	c.value("len(signatures)", len(a.Signatures), len(b.Signatures))
+	for i := 0; i < len(a.Signatures) && i < len(b.Signatures); i++ {
+		sa, sb := a.Signatures[i], b.Signatures[i]
+		c.value(fmt.Sprintf("signatures[%d].algorithm_id", i), sa.AlgorithmID, sb.AlgorithmID)
+		c.value(fmt.Sprintf("signatures[%d].size", i), sa.Size, sb.Size)
+		c.data(fmt.Sprintf("signatures[%d].data", i), sa.Data, sb.Data)
+	}
+
+	c.value("additional_sections_header.num_additional_sections",
+		a.AdditionalSectionsHeader.NumAdditionalSections, b.AdditionalSectionsHeader.NumAdditionalSections)
+	c.value("len(additional_sections)", len(a.AdditionalSections), len(b.AdditionalSections))
+	for i := 0; i < len(a.AdditionalSections) && i < len(b.AdditionalSections); i++ {
+		asa, asb := a.AdditionalSections[i], b.AdditionalSections[i]
+		c.value(fmt.Sprintf("additional_sections[%d].block_id", i), asa.BlockID, asb.BlockID)
+		c.value(fmt.Sprintf("additional_sections[%d].block_size", i), asa.BlockSize, asb.BlockSize)
+		c.data(fmt.Sprintf("additional_sections[%d].data", i), asa.Data, asb.Data)
+	}
+
+	c.value("index_header.size", a.IndexHeader.Size, b.IndexHeader.Size)
+	indexB := make(map[string]IndexEntry, len(b.Index))
+	for _, idx := range b.Index {
+		indexB[idx.FileName] = idx
+	}
+	var namesA, namesB []string
+	for _, idx := range a.Index {
+		other, ok := indexB[idx.FileName]
+		if !ok {
+			c.add(fmt.Sprintf("index[%s]", idx.FileName), "present", "missing")
+			continue
+		}
+		namesA = append(namesA, idx.FileName)
+		c.value(fmt.Sprintf("index[%s].offset_to_content", idx.FileName), idx.OffsetToContent, other.OffsetToContent)
+		c.value(fmt.Sprintf("index[%s].size", idx.FileName), idx.Size, other.Size)
+		c.value(fmt.Sprintf("index[%s].flags", idx.FileName), fmt.Sprintf("%#o", idx.Flags), fmt.Sprintf("%#o", other.Flags))
+	}
+	indexA := make(map[string]bool, len(a.Index))
+	for _, idx := range a.Index {
+		indexA[idx.FileName] = true
+	}
+	for _, idx := range b.Index {
+		if !indexA[idx.FileName] {
+			c.add(fmt.Sprintf("index[%s]", idx.FileName), "missing", "present")
+			continue
+		}
+		namesB = append(namesB, idx.FileName)
+	}
+	c.value("index order", fmt.Sprintf("%q", namesA), fmt.Sprintf("%q", namesB))
+
+	// content is compared in the order of the index, then of the names
+	// that are only in the content map, to be independent of map order
+	for _, name := range contentNames(a, b) {
+		ea, okA := a.Content[name]
+		eb, okB := b.Content[name]
+		switch {
+		case !okA:
+			c.add(fmt.Sprintf("content[%s]", name), "missing", "present")
+		case !okB:
+			c.add(fmt.Sprintf("content[%s]", name), "present", "missing")
+		default:
+			c.data(fmt.Sprintf("content[%s].data", name), ea.Data, eb.Data)
+			c.value(fmt.Sprintf("content[%s].compression", name), ea.Compression, eb.Compression)
+		}
+	}
+	return c.diffs
+}
+
+// contentNames returns the names of the content of both files, in the
+// order of the index of a, then of b, then sorted
+func contentNames(a, b *File) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, f := range []*File{a, b} {
+		for _, idx := range f.Index {
+			if !seen[idx.FileName] {
+				seen[idx.FileName] = true
+				names = append(names, idx.FileName)
+			}
+		}
+	}
+	for _, f := range []*File{a, b} {
+		for _, name := range sortedContentNames(f.Content) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// sortedContentNames returns the names of the content map in order
+func sortedContentNames(content map[string]Entry) []string {
+	names := make([]string, 0, len(content))
+	for name := range content {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// comparison accumulates the differences found by Compare
+type comparison struct {
+	diffs []Difference
+}
+
+func (c *comparison) add(field, a, b string) {
+	c.diffs = append(c.diffs, Difference{Field: field, A: a, B: b})
+}
+
+func (c *comparison) value(field string, a, b interface{}) {
+	if a != b {
+		c.add(field, fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+func (c *comparison) data(field string, a, b []byte) {
+	if !bytes.Equal(a, b) {
+		c.add(field, summarizeData(a), summarizeData(b))
+	}
+}
+
+// summarizeData returns the size and the start of the SHA256 of data
+func summarizeData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%d bytes, sha256 %x...", len(data), sum[:8])
+}
@@ -0,0 +1,77 @@
+package mar
+
+import (
+	"crypto/rand"
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"), "/foo/baz", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, b File
+	err = Unmarshal(input, &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(input, &b, ZeroCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(&a, &b) {
+		t.Fatalf("expected files parsed from the same input to be equal but got %v", Compare(&a, &b))
+	}
+	if !Equal(&a, a.Clone()) {
+		t.Fatal("expected a file to equal its clone")
+	}
+
+	c := a.Clone()
+	c.Signatures[0].Data = append([]byte{}, c.Signatures[0].Data...)
+	c.Signatures[0].Data[0] ^= 0xff
+	c.Index[0].Flags = 0755
+	c.Index[0], c.Index[1] = c.Index[1], c.Index[0]
+	delete(c.Content, "/foo/baz")
+	c.Content["/extra"] = Entry{Data: []byte("extra")}
+	var fields []string
+	for _, d := range Compare(&a, c) {
+		fields = append(fields, d.Field)
+	}
+	expected := []string{
+		"signatures[0].data",
+		"index[/foo/bar].flags",
+		"index order",
+		"content[/foo/baz]",
+		"content[/extra]",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected differences in %q but got %q", expected, fields)
+	}
+	d := Compare(&a, c)[1]
+	if d.String() != "index[/foo/bar].flags: 0600 != 0755" {
+		t.Fatalf("unexpected difference %q", d)
+	}
+}
+
+func TestCompareIndexEntries(t *testing.T) {
+	a, b := New(), New()
+	a.AddContent([]byte("aaaa"), "/only/a", 0600)
+	b.AddContent([]byte("bbbb"), "/only/b", 0600)
+	var fields []string
+	for _, d := range Compare(a, b) {
+		fields = append(fields, d.Field)
+	}
+	expected := []string{"index[/only/a]", "index[/only/b]", "content[/only/a]", "content[/only/b]"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected differences in %q but got %q", expected, fields)
+	}
+}
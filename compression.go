@@ -0,0 +1,278 @@
+package mar
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ulikunitz/xz"
+)
+
+// CompressionType is the compression format of the content of an entry
+type CompressionType int
+
+const (
+	// CompressionNone indicates the content is not compressed
+	CompressionNone CompressionType = iota
+	// CompressionXZ indicates the content is compressed with xz,
+	// which is what Firefox uses since version 56
+	CompressionXZ
+	// CompressionBZ2 indicates the content is compressed with bzip2,
+	// which is what older MAR files used
+	CompressionBZ2
+)
+
+// String returns the name of the compression format
+func (c CompressionType) String() string {
+	if c == CompressionNone {
+		return "none"
+	}
+	codec := lookupCodec(c)
+	if codec == nil {
+		return fmt.Sprintf("unknown(%d)", int(c))
+	}
+	return codec.Name
+}
+
+// Codec describes a compression format that entries can be compressed with
+type Codec struct {
+	// Name is a short name of the format, like "xz"
+	Name string
+
+	// Magic is the sequence of bytes compressed data starts with,
+	// and is used to detect the format when parsing a MAR
+	Magic []byte
+
+	// Match optionally replaces the detection by Magic for formats
+	// that need to look at more than a fixed prefix
+	Match func(data []byte) bool
+
+	// NewReader returns a reader that decompresses the data read from r
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+
+	// NewWriter returns a writer that compresses the data written to it
+	// into w until it is closed. It may be nil for formats that can
+	// only be decompressed.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	codecs   []*Codec
+	codecsMu sync.RWMutex
+)
+
+func init() {
+	codecs = []*Codec{
+		nil, // CompressionNone
+		{
+			Name:  "xz",
+			Magic: []byte("\xFD\x37\x7A\x58\x5A\x00"),
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				xzr, err := xz.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				return ioutil.NopCloser(xzr), nil
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				// use a CRC64 check, like the files compressed by Mozilla's MAR tooling
+				return xz.WriterConfig{CheckSum: xz.CRC64}.NewWriter(w)
+			},
+		},
+		{
+			Name:  "bz2",
+			Match: isBZ2,
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return ioutil.NopCloser(bzip2.NewReader(r)), nil
+			},
+		},
+	}
+}
+
+// RegisterCodec adds a compression format to the ones the package can detect,
+// decompress and compress, and returns the CompressionType assigned to it.
+// Codecs are tried in the order they are registered, after the built-in xz
+// and bzip2 codecs.
+func RegisterCodec(codec Codec) (CompressionType, error) {
+	if codec.Name == "" || (len(codec.Magic) == 0 && codec.Match == nil) || codec.NewReader == nil {
+		return CompressionNone, errBadCodec
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	for _, c := range codecs {
+		if c != nil && c.Name == codec.Name {
+			return CompressionNone, fmt.Errorf("a codec named %q is already registered", codec.Name)
+		}
+	}
+	codecs = append(codecs, &codec)
+	return CompressionType(len(codecs) - 1), nil
+}
+
+// lookupCodec returns the codec registered for a compression format,
+// or nil if there is none
+func lookupCodec(c CompressionType) *Codec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c <= CompressionNone || int(c) >= len(codecs) {
+		return nil
+	}
+	return codecs[c]
+}
+
+// match returns true if data looks like it was compressed with the codec
+func (codec *Codec) match(data []byte) bool {
+	if codec.Match != nil {
+		return codec.Match(data)
+	}
+	return len(data) > len(codec.Magic) && bytes.Equal(data[:len(codec.Magic)], codec.Magic)
+}
+
+// isBZ2 returns true if data starts with "BZh", the block size from '1' to
+// '9', and then either the magic of a compressed block or of the end of stream
+func isBZ2(data []byte) bool {
+	return len(data) >= 10 && bytes.Equal(data[:3], []byte("BZh")) &&
+		data[3] >= '1' && data[3] <= '9' &&
+		(bytes.Equal(data[4:10], []byte("\x31\x41\x59\x26\x53\x59")) ||
+			bytes.Equal(data[4:10], []byte("\x17\x72\x45\x38\x50\x90")))
+}
+
+// compressionSniffLen is the number of bytes streams are detected as
+// compressed from, when their content isn't entirely in memory
+const compressionSniffLen = 512
+
+// detectCompression returns the compression format of data
+// by looking at its first bytes
+func detectCompression(data []byte) CompressionType {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for i, codec := range codecs {
+		if codec != nil && codec.match(data) {
+			return CompressionType(i)
+		}
+	}
+	return CompressionNone
+}
+
+// isCompressed returns true if data starts with the magic number
+// of one of the registered compression formats
+func isCompressed(data []byte) bool {
+	return detectCompression(data) != CompressionNone
+}
+
+// newCompressWriter returns a writer that compresses data written
+// to it into w with the given format until it is closed
+func newCompressWriter(c CompressionType, w io.Writer) (io.WriteCloser, error) {
+	codec := lookupCodec(c)
+	if codec == nil {
+		return nil, errUnknownCompression
+	}
+	if codec.NewWriter == nil {
+		return nil, errCodecCannotCompress
+	}
+	return codec.NewWriter(w)
+}
+
+// compress returns data compressed with the given format
+func compress(c CompressionType, data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w, err := newCompressWriter(c, buf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressXZ returns data compressed in the xz format
+func compressXZ(data []byte) ([]byte, error) {
+	return compress(CompressionXZ, data)
+}
+
+// compression returns the compression format of the entry. Entries that
+// are flagged as compressed without a format are assumed to use xz.
+func (e Entry) compression() CompressionType {
+	if e.Compression == CompressionNone && e.IsCompressed {
+		return CompressionXZ
+	}
+	return e.Compression
+}
+
+// Open returns a reader of the content of the entry, transparently
+// decompressing it with the codec of its compression format
+func (e Entry) Open() (io.ReadCloser, error) {
+	c := e.compression()
+	if c == CompressionNone {
+		return ioutil.NopCloser(bytes.NewReader(e.Data)), nil
+	}
+	codec := lookupCodec(c)
+	if codec == nil {
+		return nil, errUnknownCompression
+	}
+	r, err := codec.NewReader(bytes.NewReader(e.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%s decompression failed: %w", codec.Name, err)
+	}
+	return r, nil
+}
+
+// Decompressed returns the content of the entry, decompressed
+// if it is compressed
+func (e Entry) Decompressed() ([]byte, error) {
+	if e.compression() == CompressionNone {
+		return e.Data, nil
+	}
+	r, err := e.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// decompress into a pooled buffer, such that the only allocation
+	// left is the copy of the exact size of the result
+	buf := getBuffer()
+	defer putBuffer(buf)
+	_, err = buf.ReadFrom(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s decompression failed: %w", e.compression(), err)
+	}
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	return data, nil
+}
+
+// DecompressAll returns the decompressed content of every entry of the
+// file, keyed by name. With the WithConcurrency option, entries are
+// decompressed in parallel.
+func (file *File) DecompressAll(opts ...Option) (map[string][]byte, error) {
+	o := newOptions(opts)
+	names := make([]string, 0, len(file.Content))
+	for name := range file.Content {
+		names = append(names, name)
+	}
+	data := make([][]byte, len(names))
+	err := forEach(len(names), o.concurrency, func(i int) error {
+		d, err := file.Content[names[i]].Decompressed()
+		if err != nil {
+			return fmt.Errorf("failed to decompress %q: %w", names[i], err)
+		}
+		data[i] = d
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte, len(names))
+	for i, name := range names {
+		result[name] = data[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,185 @@
+package mar
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestEntryDecompressed(t *testing.T) {
+	data := bytes.Repeat([]byte("margo"), 1024)
+	compressed, err := compressXZ(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := Entry{Data: compressed, IsCompressed: isCompressed(compressed)}
+	if !entry.IsCompressed {
+		t.Fatal("expected xz compressed data to be detected as compressed")
+	}
+	decompressed, err := entry.Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Fatalf("decompressed data doesn't match the original")
+	}
+	r, err := entry.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	decompressed, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Fatalf("data read from Open() doesn't match the original")
+	}
+}
+
+func TestEntryDecompressedUncompressed(t *testing.T) {
+	entry := Entry{Data: []byte("not compressed")}
+	decompressed, err := entry.Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, entry.Data) {
+		t.Fatalf("expected uncompressed data to be returned as is but got %q", decompressed)
+	}
+}
+
+func TestEntryDecompressedCorrupted(t *testing.T) {
+	compressed, err := compressXZ([]byte("some data to corrupt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed = compressed[:len(compressed)-8]
+	entry := Entry{Data: compressed, IsCompressed: true}
+	_, err = entry.Decompressed()
+	if err == nil {
+		t.Fatal("expected decompression of truncated data to fail but it succeeded")
+	}
+}
+
+func TestEntryDecompressedBZ2(t *testing.T) {
+	var m File
+	err := Unmarshal(oldMarB, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range m.Index {
+		entry := m.Content[idx.FileName]
+		if entry.Compression != CompressionBZ2 || !entry.IsCompressed {
+			t.Fatalf("expected entry %q of legacy mar to be compressed with bz2 but found %s", idx.FileName, entry.Compression)
+		}
+		data, err := entry.Decompressed()
+		if err != nil {
+			t.Fatalf("failed to decompress entry %q: %v", idx.FileName, err)
+		}
+		if len(data) == 0 {
+			t.Fatalf("expected decompressed entry %q to not be empty", idx.FileName)
+		}
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	testcases := []struct {
+		data     []byte
+		expected CompressionType
+	}{
+		{[]byte("\xFD\x37\x7A\x58\x5A\x00\x00"), CompressionXZ},
+		{[]byte("BZh91AY&SY\x00"), CompressionBZ2},
+		{[]byte("BZh9\x17\x72\x45\x38\x50\x90"), CompressionBZ2},
+		{[]byte("BZh01AY&SY\x00"), CompressionNone},
+		{[]byte("BZh is not enough"), CompressionNone},
+		{[]byte("\xFD\x37\x7A"), CompressionNone},
+		{nil, CompressionNone},
+	}
+	for i, testcase := range testcases {
+		c := detectCompression(testcase.data)
+		if c != testcase.expected {
+			t.Fatalf("testcase %d expected compression %s but found %s", i, testcase.expected, c)
+		}
+	}
+}
+
+var (
+	gzipCompression     CompressionType
+	registerGzipOnce    sync.Once
+	registerGzipFailure error
+)
+
+// registerGzip registers a gzip codec once for all the tests that need it
+func registerGzip(t *testing.T) CompressionType {
+	registerGzipOnce.Do(func() {
+		gzipCompression, registerGzipFailure = RegisterCodec(Codec{
+			Name:  "gzip",
+			Magic: []byte("\x1F\x8B"),
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriter(w), nil
+			},
+		})
+	})
+	if registerGzipFailure != nil {
+		t.Fatal(registerGzipFailure)
+	}
+	return gzipCompression
+}
+
+func TestRegisterCodec(t *testing.T) {
+	gz := registerGzip(t)
+	if gz.String() != "gzip" {
+		t.Fatalf("expected registered codec to be named gzip but got %q", gz.String())
+	}
+	data := bytes.Repeat([]byte("margo"), 1024)
+	m := New()
+	err := m.AddContent(data, "foo", 0644, CompressWith(gz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := reparsed.Content["foo"]
+	if entry.Compression != gz || !entry.IsCompressed {
+		t.Fatalf("expected entry to be detected as gzip compressed but found %s", entry.Compression)
+	}
+	decompressed, err := entry.Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Fatal("decompressed data doesn't match the original")
+	}
+}
+
+func TestRegisterCodecErrors(t *testing.T) {
+	_, err := RegisterCodec(Codec{Name: "nomagic", NewReader: func(r io.Reader) (io.ReadCloser, error) { return nil, nil }})
+	if err != errBadCodec {
+		t.Fatalf("expected to fail with %q but got %v", errBadCodec, err)
+	}
+	_, err = RegisterCodec(Codec{Name: "xz", Magic: []byte("xz"), NewReader: func(r io.Reader) (io.ReadCloser, error) { return nil, nil }})
+	if err == nil {
+		t.Fatal("expected registering a codec with a duplicate name to fail but it succeeded")
+	}
+	err = New().AddContent([]byte("foo"), "foo", 0644, CompressWith(CompressionBZ2))
+	if err == nil {
+		t.Fatal("expected compressing with bzip2 to fail but it succeeded")
+	}
+	err = New().AddContent([]byte("foo"), "foo", 0644, CompressWith(CompressionType(1000)))
+	if err == nil {
+		t.Fatal("expected compressing with an unknown format to fail but it succeeded")
+	}
+}
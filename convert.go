@@ -0,0 +1,95 @@
+package mar
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// ToTar writes the entries of the MAR file to w as a tar archive, in the
+// order of the index. Each entry becomes a regular file with the name and
+// permission bits of the index, and the decompressed content of the entry.
+// The archive is not compressed; wrap w in a gzip.Writer to get a tar.gz.
+// Names are checked against the path policy set with WithPathPolicy, and
+// entries are streamed up to the MaxDecompressedSize limit of WithLimits.
+func ToTar(w io.Writer, f *File, opts ...Option) error {
+	o := newOptions(opts)
+	policy := o.pathPolicyOrDefault()
+	tw := tar.NewWriter(w)
+	for _, e := range f.Entries() {
+		err := policy.CheckName(e.Name)
+		if err != nil {
+			return err
+		}
+		// tar headers hold the size of the content, so compressed entries
+		// are decompressed once to measure them and once to copy them
+		size, err := copyDecompressed(ioutil.Discard, e.Entry, o)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+		// MARs have no timestamps, so entries are dated of the epoch
+		// and the output is reproducible
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.Name,
+			Mode:     int64(e.FileMode()),
+			Size:     size,
+			ModTime:  time.Unix(0, 0),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = copyDecompressed(tw, e.Entry, o)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+	}
+	return tw.Close()
+}
+
+// ToZip writes the entries of the MAR file to w as a zip archive, in the
+// order of the index. Each entry is stored deflated with the name and
+// permission bits of the index, and the decompressed content of the entry.
+// Names are checked against the path policy set with WithPathPolicy, and
+// entries are streamed up to the MaxDecompressedSize limit of WithLimits.
+func ToZip(w io.Writer, f *File, opts ...Option) error {
+	o := newOptions(opts)
+	policy := o.pathPolicyOrDefault()
+	zw := zip.NewWriter(w)
+	for _, e := range f.Entries() {
+		err := policy.CheckName(e.Name)
+		if err != nil {
+			return err
+		}
+		// zip dates start in 1980, so that is the date of every entry
+		hdr := &zip.FileHeader{
+			Name:     e.Name,
+			Method:   zip.Deflate,
+			Modified: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		hdr.SetMode(e.FileMode())
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = copyDecompressed(fw, e.Entry, o)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// copyDecompressed copies the decompressed content of e to w, failing
+// if it is larger than the MaxDecompressedSize limit
+func copyDecompressed(w io.Writer, e Entry, o *options) (int64, error) {
+	rc, err := e.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(w, newLimitedReader(rc, o.debug, "MaxDecompressedSize", o.limits.MaxDecompressedSize))
+}
@@ -0,0 +1,123 @@
+package mar
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// convertTestFile returns a MAR with a compressed and an uncompressed entry
+func convertTestFile(t *testing.T) *File {
+	m := New()
+	err := m.AddContent(bytes.Repeat([]byte("caribou"), 100), "bin/firefox", 0755, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.AddContent([]byte("maurice"), "defaults/pref/channel-prefs.js", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestToTar(t *testing.T) {
+	m := convertTestFile(t)
+	var buf bytes.Buffer
+	err := ToTar(&buf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(&buf)
+	for _, e := range m.Entries() {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != e.Name || os.FileMode(hdr.Mode) != e.FileMode() {
+			t.Fatalf("expected %q with mode %s but got %q with mode %s", e.Name, e.FileMode(), hdr.Name, os.FileMode(hdr.Mode))
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := e.Decompressed()
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("expected %q to hold its decompressed content", e.Name)
+		}
+	}
+	_, err = tr.Next()
+	if err != io.EOF {
+		t.Fatalf("expected the end of the archive but got %v", err)
+	}
+}
+
+func TestToZip(t *testing.T) {
+	m := convertTestFile(t)
+	var buf bytes.Buffer
+	err := ToZip(&buf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := m.Entries()
+	if len(zr.File) != len(entries) {
+		t.Fatalf("expected %d files but got %d", len(entries), len(zr.File))
+	}
+	for i, zf := range zr.File {
+		e := entries[i]
+		if zf.Name != e.Name || zf.Mode().Perm() != e.FileMode() {
+			t.Fatalf("expected %q with mode %s but got %q with mode %s", e.Name, e.FileMode(), zf.Name, zf.Mode())
+		}
+		r, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := e.Decompressed()
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("expected %q to hold its decompressed content", e.Name)
+		}
+	}
+}
+
+func TestConvertUnsafeNames(t *testing.T) {
+	for _, name := range []string{"/etc/passwd", "bin/../../escaped"} {
+		m := New()
+		err := m.AddContent([]byte("caribou"), name, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, convert := range []func(io.Writer, *File, ...Option) error{ToTar, ToZip} {
+			err = convert(ioutil.Discard, m)
+			if err == nil {
+				t.Fatalf("expected %q to be rejected", name)
+			}
+		}
+		err = ToTar(ioutil.Discard, m, WithPathPolicy(PathPolicy{AllowAbsolute: true, AllowParentRefs: true}))
+		if err != nil {
+			t.Fatalf("expected %q to be accepted by a permissive policy but got %v", name, err)
+		}
+	}
+}
+
+func TestConvertDecompressedLimit(t *testing.T) {
+	m := convertTestFile(t)
+	for _, convert := range []func(io.Writer, *File, ...Option) error{ToTar, ToZip} {
+		err := convert(ioutil.Discard, m, WithLimits(Limits{MaxDecompressedSize: 100}))
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Fatalf("expected to fail with %q but got %v", ErrLimitExceeded, err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/elliptic"
+	"fmt"
+	"io"
+)
+
+// BlockIDCOSESignature is the ID of the additional section that holds a
+// COSE_Sign structure, for forks that sign their MARs with COSE on top of
+// the signatures of the MAR format
+const BlockIDCOSESignature = 0x434F5345
+
+// COSE algorithm IDs the signatures of a COSE_Sign structure can be made with
+const (
+	// COSEAlgES256 is the ID of ECDSA on NIST curve P256 with SHA256
+	COSEAlgES256 = -7
+
+	// COSEAlgES384 is the ID of ECDSA on NIST curve P384 with SHA384
+	COSEAlgES384 = -35
+
+	// COSEAlgPS256 is the ID of RSA-PSS with SHA256
+	COSEAlgPS256 = -37
+)
+
+// coseSignTag is the CBOR tag of COSE_Sign structures
+const coseSignTag = 98
+
+// COSE header labels
+const (
+	coseHeaderAlgorithm = 1
+	coseHeaderKeyID     = 4
+)
+
+// coseAlgorithms maps COSE algorithm IDs to the signature algorithms that
+// make their signatures, which are encoded the same way in COSE
+var coseAlgorithms = map[int64]*SignatureAlgorithm{
+	COSEAlgES256: ecdsaAlgorithm("ES256", crypto.SHA256, elliptic.P256()),
+	COSEAlgES384: ecdsaAlgorithm("ES384", crypto.SHA384, elliptic.P384()),
+	COSEAlgPS256: func() *SignatureAlgorithm {
+		alg := RsaPssAlgorithm(crypto.SHA256)
+		return &alg
+	}(),
+}
+
+// COSESigner is a signer and the COSE algorithm of the signature it makes
+type COSESigner struct {
+	Signer    crypto.Signer
+	Algorithm int64
+	// KeyID optionally identifies the key to verifiers
+	KeyID []byte
+}
+
+// COSESign is the COSE_Sign structure of a COSE signature section
+type COSESign struct {
+	// Payload is the SHA384 digest of the data the signatures cover
+	Payload []byte `json:"payload" yaml:"payload"`
+
+	// Signatures are the signatures of the payload
+	Signatures []COSESignature `json:"signatures" yaml:"signatures"`
+
+	// protected is the encoded protected header of the structure
+	protected []byte
+}
+
+// COSESignature is a COSE_Signature of a COSE_Sign structure
+type COSESignature struct {
+	// Algorithm is the COSE algorithm ID of the signature, like COSEAlgES256
+	Algorithm int64 `json:"algorithm" yaml:"algorithm"`
+
+	// KeyID identifies the key of the signature, if the signer set it
+	KeyID []byte `json:"key_id,omitempty" yaml:"key_id,omitempty"`
+
+	// Signature is the signature data
+	Signature []byte `json:"signature" yaml:"signature"`
+
+	// protected is the encoded protected header of the signature
+	protected []byte
+}
+
+// AddCOSESignature signs the file with each of the signers into a COSE_Sign
+// structure, stored in the additional section of block ID
+// BlockIDCOSESignature, replacing the existing one if any. The payload of
+// the structure is the SHA384 digest of the signed data of the file as if
+// it had no signature, COSE section or timestamp section, such that the signatures of
+// the MAR format can be added afterwards and cover the COSE section. As
+// with any additional section, adding it invalidates the existing
+// signatures of the file, so it must be added before the file is signed.
+//
+// COSE signatures are only made and checked when AddCOSESignature and
+// VerifyCOSESignature are called, and are otherwise kept as an opaque
+// additional section.
+func (file *File) AddCOSESignature(rand io.Reader, signers ...COSESigner) error {
+	if len(signers) == 0 {
+		return fmt.Errorf("there are no keys to sign with")
+	}
+	payload, err := file.contentDigest(crypto.SHA384)
+	if err != nil {
+		return err
+	}
+	cs := COSESign{Payload: payload, protected: []byte{}}
+	for _, signer := range signers {
+		alg, ok := coseAlgorithms[signer.Algorithm]
+		if !ok {
+			return fmt.Errorf("%w: %d", errUnknownCOSEAlgorithm, signer.Algorithm)
+		}
+		_, err = alg.SignatureSize(signer.Signer.Public())
+		if err != nil {
+			return err
+		}
+		sig := COSESignature{Algorithm: signer.Algorithm, KeyID: signer.KeyID}
+		sig.protected, err = cborAppend(nil, cborMapItems{{int64(coseHeaderAlgorithm), signer.Algorithm}})
+		if err != nil {
+			return err
+		}
+		digest, err := cs.toBeSignedDigest(sig, alg.Hash)
+		if err != nil {
+			return err
+		}
+		sig.Signature, err = alg.Sign(signer.Signer, rand, digest)
+		if err != nil {
+			return err
+		}
+		cs.Signatures = append(cs.Signatures, sig)
+	}
+	data, err := cs.Bytes()
+	if err != nil {
+		return err
+	}
+	for i, as := range file.AdditionalSections {
+		if as.BlockID == BlockIDCOSESignature {
+			file.AdditionalSections[i].Data = data
+			file.Normalize()
+			return nil
+		}
+	}
+	file.AddAdditionalSection(data, BlockIDCOSESignature)
+	return nil
+}
+
+// COSESignature returns the COSE_Sign structure of the COSE signature
+// section of the file
+func (file *File) COSESignature() (*COSESign, error) {
+	for _, as := range file.AdditionalSections {
+		if as.BlockID == BlockIDCOSESignature {
+			return ParseCOSESign(as.Data)
+		}
+	}
+	return nil, errNoCOSESignature
+}
+
+// VerifyCOSESignature checks that the payload of the COSE signature section
+// of the file matches its content, and that every signature of the section
+// validates with one of the named public keys. It returns the names of the
+// keys that validated each signature, in the order of the signatures.
+func (file *File) VerifyCOSESignature(keys map[string]crypto.PublicKey) ([]string, error) {
+	cs, err := file.COSESignature()
+	if err != nil {
+		return nil, err
+	}
+	if len(cs.Signatures) == 0 {
+		return nil, errNoCOSESignature
+	}
+	payload, err := file.contentDigest(crypto.SHA384)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(payload, cs.Payload) {
+		return nil, errCOSEPayloadMismatch
+	}
+	var validKeys []string
+	keyNames := sortedKeyNames(keys)
+	for i, sig := range cs.Signatures {
+		alg, ok := coseAlgorithms[sig.Algorithm]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", errUnknownCOSEAlgorithm, sig.Algorithm)
+		}
+		digest, err := cs.toBeSignedDigest(sig, alg.Hash)
+		if err != nil {
+			return nil, err
+		}
+		matched := false
+		for _, keyName := range keyNames {
+			if alg.Verify(keys[keyName], digest, sig.Signature) == nil {
+				validKeys = append(validKeys, keyName)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("cose signature %d with algorithm %d did not validate with any key", i, sig.Algorithm)
+		}
+	}
+	return validKeys, nil
+}
+
+// contentDigest returns the digest of the signed data of the file without
+// its signatures and the sections that hold signatures over that digest,
+// like COSE signatures and timestamps, in the order of its index
+func (file *File) contentDigest(h crypto.Hash) ([]byte, error) {
+	t, err := file.transformed(nil)
+	if err != nil {
+		return nil, err
+	}
+	t.Signatures = nil
+	t.AdditionalSections = nil
+	for _, as := range file.AdditionalSections {
+		if as.BlockID != BlockIDCOSESignature && as.BlockID != BlockIDTimestamp {
+			t.AdditionalSections = append(t.AdditionalSections, as)
+		}
+	}
+	t.layout = nil
+	md := h.New()
+	err = t.WriteSignedData(md)
+	if err != nil {
+		return nil, err
+	}
+	return md.Sum(nil), nil
+}
+
+// toBeSignedDigest returns the digest of the Sig_structure of a signature
+// of the COSE_Sign structure, which is what the signature is made over
+func (cs *COSESign) toBeSignedDigest(sig COSESignature, h crypto.Hash) ([]byte, error) {
+	tbs, err := cborAppend(nil, []interface{}{"Signature", cs.protected, sig.protected, []byte{}, cs.Payload})
+	if err != nil {
+		return nil, err
+	}
+	md := h.New()
+	md.Write(tbs)
+	return md.Sum(nil), nil
+}
+
+// Bytes returns the tagged CBOR encoding of the COSE_Sign structure
+func (cs *COSESign) Bytes() ([]byte, error) {
+	sigs := make([]interface{}, 0, len(cs.Signatures))
+	for _, sig := range cs.Signatures {
+		protected := sig.protected
+		if protected == nil {
+			var err error
+			protected, err = cborAppend(nil, cborMapItems{{int64(coseHeaderAlgorithm), sig.Algorithm}})
+			if err != nil {
+				return nil, err
+			}
+		}
+		unprotected := cborMapItems{}
+		if len(sig.KeyID) > 0 {
+			unprotected = append(unprotected, cborMapItem{int64(coseHeaderKeyID), sig.KeyID})
+		}
+		sigs = append(sigs, []interface{}{protected, unprotected, sig.Signature})
+	}
+	protected := cs.protected
+	if protected == nil {
+		protected = []byte{}
+	}
+	return cborAppend(nil, cborTag{Number: coseSignTag, Content: []interface{}{protected, cborMapItems{}, cs.Payload, sigs}})
+}
+
+// ParseCOSESign decodes a tagged COSE_Sign structure, as stored in the
+// COSE signature section of a file
+func ParseCOSESign(data []byte) (*COSESign, error) {
+	v, err := cborDecode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedCOSE, err)
+	}
+	tag, ok := v.(cborTag)
+	if !ok || tag.Number != coseSignTag {
+		return nil, fmt.Errorf("%w: missing COSE_Sign tag", errMalformedCOSE)
+	}
+	items, ok := tag.Content.([]interface{})
+	if !ok || len(items) != 4 {
+		return nil, fmt.Errorf("%w: COSE_Sign must be an array of 4 items", errMalformedCOSE)
+	}
+	var cs COSESign
+	cs.protected, ok = items[0].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: protected header must be a byte string", errMalformedCOSE)
+	}
+	cs.Payload, ok = items[2].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: payload must be a byte string", errMalformedCOSE)
+	}
+	sigs, ok := items[3].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: signatures must be an array", errMalformedCOSE)
+	}
+	for i, s := range sigs {
+		sig, err := parseCOSESignature(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: signature %d: %v", errMalformedCOSE, i, err)
+		}
+		cs.Signatures = append(cs.Signatures, sig)
+	}
+	return &cs, nil
+}
+
+// parseCOSESignature decodes a COSE_Signature from its CBOR data item
+func parseCOSESignature(v interface{}) (sig COSESignature, err error) {
+	items, ok := v.([]interface{})
+	if !ok || len(items) != 3 {
+		return sig, fmt.Errorf("COSE_Signature must be an array of 3 items")
+	}
+	sig.protected, ok = items[0].([]byte)
+	if !ok {
+		return sig, fmt.Errorf("protected header must be a byte string")
+	}
+	protected, err := cborDecode(sig.protected)
+	if err != nil {
+		return sig, err
+	}
+	headers, ok := protected.(map[interface{}]interface{})
+	if !ok {
+		return sig, fmt.Errorf("protected header must be a map")
+	}
+	sig.Algorithm, ok = headers[int64(coseHeaderAlgorithm)].(int64)
+	if !ok {
+		return sig, fmt.Errorf("protected header must hold an integer algorithm")
+	}
+	unprotected, ok := items[1].(map[interface{}]interface{})
+	if !ok {
+		return sig, fmt.Errorf("unprotected header must be a map")
+	}
+	if kid, ok := unprotected[int64(coseHeaderKeyID)]; ok {
+		sig.KeyID, ok = kid.([]byte)
+		if !ok {
+			return sig, fmt.Errorf("key ID must be a byte string")
+		}
+	}
+	sig.Signature, ok = items[2].([]byte)
+	if !ok {
+		return sig, fmt.Errorf("signature must be a byte string")
+	}
+	return sig, nil
+}
@@ -0,0 +1,146 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestCOSESignature(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	_, err = m.VerifyCOSESignature(nil)
+	if err != errNoCOSESignature {
+		t.Fatalf("expected to fail with %q but got %v", errNoCOSESignature, err)
+	}
+	// adding a cose signature twice replaces the section
+	for i := 0; i < 2; i++ {
+		err = m.AddCOSESignature(rand.Reader,
+			COSESigner{Signer: ecdsaKey, Algorithm: COSEAlgES256, KeyID: []byte("ecdsa")},
+			COSESigner{Signer: rsa2048Key, Algorithm: COSEAlgPS256})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(m.AdditionalSections) != 2 {
+		t.Fatalf("expected 2 additional sections but got %d", len(m.AdditionalSections))
+	}
+	// the signatures of the MAR format are added afterwards
+	err = m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file File
+	err = Unmarshal(signed, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{"ecdsa": ecdsaKey.Public(), "rsa": rsa2048Key.Public()}
+	validKeys, err := file.VerifyCOSESignature(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 2 || validKeys[0] != "ecdsa" || validKeys[1] != "rsa" {
+		t.Fatalf("expected cose signatures from keys [ecdsa rsa] but got %v", validKeys)
+	}
+	_, err = file.VerifyWithKeys(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := file.AdditionalSections[1]
+	if as.Name() != "cose_sign" {
+		t.Fatalf("expected section name cose_sign but got %q", as.Name())
+	}
+	v, err := as.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := v.(*COSESign)
+	if len(cs.Signatures) != 2 || cs.Signatures[0].Algorithm != COSEAlgES256 || string(cs.Signatures[0].KeyID) != "ecdsa" ||
+		cs.Signatures[1].Algorithm != COSEAlgPS256 || len(cs.Signatures[1].KeyID) != 0 {
+		t.Fatalf("unexpected cose signatures %+v", cs.Signatures)
+	}
+	reencoded, err := cs.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reencoded, as.Data) {
+		t.Fatal("expected the cose structure to be reencoded identically")
+	}
+
+	// only the keys of the signatures verify them
+	_, err = file.VerifyCOSESignature(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err == nil {
+		t.Fatal("expected verification without the ecdsa key to fail")
+	}
+
+	// the payload covers the content
+	file.Content["/foo/bar"] = Entry{Data: []byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")}
+	_, err = file.VerifyCOSESignature(keys)
+	if err != errCOSEPayloadMismatch {
+		t.Fatalf("expected to fail with %q but got %v", errCOSEPayloadMismatch, err)
+	}
+}
+
+func TestAddCOSESignatureErrors(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.AddCOSESignature(rand.Reader)
+	if err == nil {
+		t.Fatal("expected signing without signers to fail")
+	}
+	err = m.AddCOSESignature(rand.Reader, COSESigner{Signer: rsa2048Key, Algorithm: -257})
+	if !errors.Is(err, errUnknownCOSEAlgorithm) {
+		t.Fatalf("expected to fail with %q but got %v", errUnknownCOSEAlgorithm, err)
+	}
+	err = m.AddCOSESignature(rand.Reader, COSESigner{Signer: rsa2048Key, Algorithm: COSEAlgES384})
+	if !errors.Is(err, errBadSigAlg) {
+		t.Fatalf("expected to fail with %q but got %v", errBadSigAlg, err)
+	}
+	if len(m.AdditionalSections) != 0 {
+		t.Fatalf("expected no additional section but got %d", len(m.AdditionalSections))
+	}
+}
+
+func TestParseCOSESignErrors(t *testing.T) {
+	encode := func(v interface{}) []byte {
+		data, err := cborAppend(nil, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	protected := encode(cborMapItems{{int64(coseHeaderAlgorithm), int64(COSEAlgES256)}})
+	for i, data := range [][]byte{
+		{0xff},
+		encode([]interface{}{[]byte{}, cborMapItems{}, []byte{}, []interface{}{}}),
+		encode(cborTag{Number: 18, Content: []interface{}{[]byte{}, cborMapItems{}, []byte{}, []interface{}{}}}),
+		encode(cborTag{Number: coseSignTag, Content: []interface{}{[]byte{}, cborMapItems{}, []byte{}}}),
+		encode(cborTag{Number: coseSignTag, Content: []interface{}{[]byte{}, cborMapItems{}, nil, []interface{}{}}}),
+		encode(cborTag{Number: coseSignTag, Content: []interface{}{[]byte{}, cborMapItems{}, []byte{}, []interface{}{
+			[]interface{}{[]byte{}, cborMapItems{}, []byte{}},
+		}}}),
+		encode(cborTag{Number: coseSignTag, Content: []interface{}{[]byte{}, cborMapItems{}, []byte{}, []interface{}{
+			[]interface{}{protected, cborMapItems{{int64(coseHeaderKeyID), "text"}}, []byte{}},
+		}}}),
+	} {
+		_, err := ParseCOSESign(data)
+		if !errors.Is(err, errMalformedCOSE) {
+			t.Fatalf("testcase %d: expected to fail with %q but got %v", i, errMalformedCOSE, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package mar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// CreateFromDir returns a new MAR file that contains every regular file found
+// under the root directory. Entries are named after the path of the file
+// relative to root, using forward slashes as separators, and their flags are
+// set to the permission bits of the file. Special files are rejected, and
+// symbolic links are handled according to the PathPolicy of the
+// WithPathPolicy option, or rejected by default. Symbolic links to
+// directories can't be followed. Names must follow the policy too. Use the
+// Compress option to compress entries with xz.
+func CreateFromDir(root string, opts ...Option) (*File, error) {
+	file := New()
+	policy := newOptions(opts).pathPolicyOrDefault()
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			switch policy.Symlinks {
+			case SymlinksSkip:
+				return nil
+			case SymlinksFollow:
+				fi, err = os.Stat(path)
+				if err != nil {
+					return err
+				}
+				if fi.IsDir() {
+					return fmt.Errorf("%w: refusing to follow %q to a directory", errSymlink, path)
+				}
+			default:
+				return fmt.Errorf("%w: refusing to add %q", errSymlink, path)
+			}
+		}
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("refusing to add %q which is not a regular file", path)
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		err = policy.CheckName(filepath.ToSlash(name))
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return file.AddContent(data, filepath.ToSlash(name), uint32(fi.Mode().Perm()), opts...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,127 @@
+package mar
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateFromDir(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "margo_create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	files := map[string]struct {
+		data []byte
+		mode os.FileMode
+	}{
+		"foo/bar":     {[]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), 0600},
+		"foo/baz/qux": {[]byte("bcdef"), 0755},
+		"toplevel":    {[]byte("ghijk"), 0644},
+	}
+	for name, f := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writeFile(path, f.data, f.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := CreateFromDir(srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != len(files) {
+		t.Fatalf("expected %d index entries but found %d", len(files), len(m.Index))
+	}
+	for _, idx := range m.Index {
+		f, ok := files[idx.FileName]
+		if !ok {
+			t.Fatalf("found unexpected entry %q", idx.FileName)
+		}
+		if !bytes.Equal(m.Content[idx.FileName].Data, f.data) {
+			t.Fatalf("expected entry %q to contain %q but found %q", idx.FileName, f.data, m.Content[idx.FileName].Data)
+		}
+		if os.FileMode(idx.Flags) != f.mode {
+			t.Fatalf("expected entry %q to have mode %s but found %s", idx.FileName, f.mode, os.FileMode(idx.Flags))
+		}
+	}
+
+	// extracting the created mar should give back the same tree
+	destDir, err := ioutil.TempDir("", "margo_create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(destDir)
+	err = m.ExtractAll(destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(destDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, f.data) {
+			t.Fatalf("expected extracted file %q to contain %q but found %q", name, f.data, data)
+		}
+	}
+}
+
+func TestCreateFromDirCompressed(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "margo_create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	err = ioutil.WriteFile(filepath.Join(srcDir, "foo"), bytes.Repeat([]byte("a"), 4096), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := CreateFromDir(srcDir, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reparsed.Content["foo"].IsCompressed {
+		t.Fatal("expected entry to be compressed with xz but it wasn't")
+	}
+	data, err := reparsed.Content["foo"].Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat([]byte("a"), 4096)) {
+		t.Fatal("decompressed entry doesn't match the original file")
+	}
+}
+
+func TestCreateFromDirSymlink(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "margo_create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	err = os.Symlink("/etc/passwd", filepath.Join(srcDir, "passwd"))
+	if err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	_, err = CreateFromDir(srcDir)
+	if err == nil {
+		t.Fatal("expected creating a mar from a directory with a symlink to fail but it succeeded")
+	}
+}
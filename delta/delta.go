@@ -0,0 +1,157 @@
+// Package delta generates partial MAR files from two complete MAR files,
+// like Mozilla's make_incremental_update.sh.
+//
+// A partial MAR holds only what changed between the old and new versions.
+// Files that are identical in both are skipped. Files that changed are
+// stored as binary patches against their old version, made with mbsdiff by
+// default, when the compressed patch is smaller than the compressed new
+// file, and stored whole otherwise. New files are stored whole, and files
+// that no longer exist are removed. The operations are listed in the
+// updatev3.manifest of the partial MAR, which has the "partial" type.
+package delta
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.mozilla.org/mar"
+	"go.mozilla.org/mar/manifest"
+	"go.mozilla.org/mar/mbsdiff"
+)
+
+// DiffFunc returns a patch that turns old into new
+type DiffFunc func(old, new []byte) ([]byte, error)
+
+// Options configures the generation of a partial MAR
+type Options struct {
+	// Diff makes the patches of files that changed, mbsdiff.Diff if nil
+	Diff DiffFunc
+	// EntryOptions are applied to the entries added to the partial
+	// MAR, such as mar.Compress
+	EntryOptions []mar.Option
+}
+
+// patchSuffix is appended to the name of a file to name its patch
+const patchSuffix = ".patch"
+
+// Partial returns a partial MAR that updates the content of the old
+// complete MAR to the content of the new one. The additional sections of
+// the new MAR, such as its product information, are copied to the partial.
+func Partial(oldFile, newFile *mar.File, opts Options) (*mar.File, error) {
+	diff := opts.Diff
+	if diff == nil {
+		diff = mbsdiff.Diff
+	}
+	partial := mar.New()
+	for _, as := range newFile.AdditionalSections {
+		partial.AddAdditionalSection(as.Data, as.BlockID)
+	}
+	m := &manifest.Manifest{Type: manifest.TypePartial}
+	type entry struct {
+		data  []byte
+		name  string
+		flags uint32
+	}
+	var entries []entry
+
+	newNames := make(map[string]bool)
+	for _, idx := range newFile.Index {
+		if isManifest(idx.FileName) || newNames[idx.FileName] {
+			continue
+		}
+		newNames[idx.FileName] = true
+		err := manifest.CheckPath(idx.FileName)
+		if err != nil {
+			return nil, err
+		}
+		newData, err := decompressed(newFile, idx.FileName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := oldFile.Content[idx.FileName]; !ok {
+			m.Instructions = append(m.Instructions, manifest.AddInstruction(idx.FileName))
+			entries = append(entries, entry{newData, idx.FileName, idx.Flags})
+			continue
+		}
+		oldData, err := decompressed(oldFile, idx.FileName)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(oldData, newData) {
+			continue
+		}
+		patch, err := diff(oldData, newData)
+		if err != nil {
+			return nil, fmt.Errorf("delta: failed to diff %q: %w", idx.FileName, err)
+		}
+		smaller, err := isSmaller(patch, newData)
+		if err != nil {
+			return nil, err
+		}
+		if smaller {
+			patchName := idx.FileName + patchSuffix
+			m.Instructions = append(m.Instructions, manifest.PatchInstruction(patchName, idx.FileName))
+			entries = append(entries, entry{patch, patchName, idx.Flags})
+			continue
+		}
+		m.Instructions = append(m.Instructions, manifest.AddInstruction(idx.FileName))
+		entries = append(entries, entry{newData, idx.FileName, idx.Flags})
+	}
+	for _, idx := range oldFile.Index {
+		if isManifest(idx.FileName) || newNames[idx.FileName] {
+			continue
+		}
+		// mark the name so it is only removed once
+		newNames[idx.FileName] = true
+		err := manifest.CheckPath(idx.FileName)
+		if err != nil {
+			return nil, err
+		}
+		m.Instructions = append(m.Instructions, manifest.Instruction{Op: manifest.OpRemove, Path: idx.FileName})
+	}
+
+	data, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	err = partial.AddContent(data, manifest.V3Name, mar.FlagsRegular, opts.EntryOptions...)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		err = partial.AddContent(e.data, e.name, e.flags, opts.EntryOptions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return partial, nil
+}
+
+// isManifest returns true if name is the name of an update manifest
+func isManifest(name string) bool {
+	return name == manifest.V3Name || name == manifest.V2Name
+}
+
+// isSmaller returns true if patch is smaller than data once both are
+// compressed with xz, like the Firefox updater expects them in a MAR
+func isSmaller(patch, data []byte) (bool, error) {
+	sizes := make([]int, 2)
+	for i, d := range [][]byte{patch, data} {
+		f := mar.New()
+		err := f.AddContent(d, "entry", mar.FlagsRegular, mar.Compress())
+		if err != nil {
+			return false, err
+		}
+		sizes[i] = len(f.Content["entry"].Data)
+	}
+	return sizes[0] < sizes[1], nil
+}
+
+// decompressed returns the decompressed content of the entry named name
+func decompressed(file *mar.File, name string) ([]byte, error) {
+	data, err := file.Content[name].Decompressed()
+	if err != nil {
+		return nil, fmt.Errorf("delta: failed to decompress %q: %w", name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,154 @@
+package delta
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.mozilla.org/mar"
+	"go.mozilla.org/mar/manifest"
+)
+
+func newComplete(t *testing.T, files map[string]string, names ...string) *mar.File {
+	file := mar.New()
+	file.AddProductInfo("test 1.0")
+	for _, name := range names {
+		err := file.AddContent([]byte(files[name]), name, 0644, mar.Compress())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file
+}
+
+// testDiff makes patches that are the new data after the common prefix
+func testDiff(old, new []byte) ([]byte, error) {
+	i := 0
+	for i < len(old) && i < len(new) && old[i] == new[i] {
+		i++
+	}
+	return new[i:], nil
+}
+
+func TestPartial(t *testing.T) {
+	files := map[string]string{
+		"unchanged": "same content",
+		"changed":   "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"rewritten": "completely different",
+		"removed":   "gone",
+	}
+	oldFile := newComplete(t, files, "unchanged", "changed", "rewritten", "removed")
+	files["changed"] = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaab"
+	files["rewritten"] = "something else"
+	files["added"] = "new file"
+	newFile := newComplete(t, files, "unchanged", "changed", "rewritten", "added")
+
+	partial, err := Partial(oldFile, newFile, Options{Diff: testDiff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.FromFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []manifest.Instruction{
+		{Op: manifest.OpPatch, Patch: "changed.patch", Path: "changed"},
+		{Op: manifest.OpAdd, Path: "rewritten"},
+		{Op: manifest.OpAdd, Path: "added"},
+		{Op: manifest.OpRemove, Path: "removed"},
+	}
+	if m.Type != manifest.TypePartial || !reflect.DeepEqual(m.Instructions, expected) {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	if string(partial.Content["changed.patch"].Data) != "b" {
+		t.Fatalf("unexpected patch %q", partial.Content["changed.patch"].Data)
+	}
+	if _, ok := partial.Content["unchanged"]; ok {
+		t.Fatal("expected unchanged file to be skipped")
+	}
+	if len(partial.AdditionalSections) != 1 || string(partial.AdditionalSections[0].Data) != "test 1.0" {
+		t.Fatalf("expected product information to be copied, got %+v", partial.AdditionalSections)
+	}
+}
+
+func TestPartialSmallFile(t *testing.T) {
+	oldFile := newComplete(t, map[string]string{"file": "old content"}, "file")
+	newFile := newComplete(t, map[string]string{"file": "new content"}, "file")
+	partial, err := Partial(oldFile, newFile, Options{EntryOptions: []mar.Option{mar.Compress()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.FromFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Instructions) != 1 || m.Instructions[0].Op != manifest.OpAdd {
+		t.Fatalf("expected changed file smaller than its patch to be added whole, got %+v", m.Instructions)
+	}
+	data, err := partial.Content["file"].Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("new content")) || !partial.Content["file"].IsCompressed {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
+
+func TestPartialUnsafeOldName(t *testing.T) {
+	evil := "evil\"\nrmrfdir \"browser/"
+	oldFile := newComplete(t, map[string]string{"file": "content", evil: "gone"}, "file", evil)
+	newFile := newComplete(t, map[string]string{"file": "content"}, "file")
+	_, err := Partial(oldFile, newFile, Options{Diff: testDiff})
+	if err == nil {
+		t.Fatal("expected an old name that can't be written in a manifest to be rejected")
+	}
+}
+
+func TestPartialApply(t *testing.T) {
+	oldContent := make([]byte, 20000)
+	rand.New(rand.NewSource(42)).Read(oldContent)
+	newContent := append([]byte{}, oldContent...)
+	copy(newContent[5000:], "patched")
+	oldFile := newComplete(t, map[string]string{"big": string(oldContent), "removed": "gone"}, "big", "removed")
+	newFile := newComplete(t, map[string]string{"big": string(newContent), "added": "new"}, "big", "added")
+
+	partial, err := Partial(oldFile, newFile, Options{EntryOptions: []mar.Option{mar.Compress()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := partial.Content["big.patch"]; !ok {
+		t.Fatal("expected big file to be patched")
+	}
+
+	dir, err := ioutil.TempDir("", "margo_delta_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = oldFile.ExtractAll(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mar.ApplyPartial(partial, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, newContent) {
+		t.Fatal("expected patched file to match the new content")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "removed")); !os.IsNotExist(err) {
+		t.Fatalf("expected removed file to be removed, got %v", err)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(dir, "added"))
+	if err != nil || string(data) != "new" {
+		t.Fatalf("expected added file to contain %q, got %q and %v", "new", data, err)
+	}
+}
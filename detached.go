@@ -0,0 +1,72 @@
+package mar
+
+import (
+	"encoding/pem"
+	"strconv"
+)
+
+// pemTypeSignature is the type of the PEM block of a detached signature
+const pemTypeSignature = "MAR SIGNATURE"
+
+// ExportSignature returns the i-th signature of the MAR file as a detached
+// signature, which is a PEM block holding the signature data with its
+// algorithm in the headers. It can be stored in a standalone file and
+// imported back with ImportSignature.
+func (file *File) ExportSignature(i int) ([]byte, error) {
+	if i < 0 || i >= len(file.Signatures) {
+		return nil, errSignatureIndex
+	}
+	sig := file.Signatures[i]
+	return pem.EncodeToMemory(&pem.Block{
+		Type: pemTypeSignature,
+		Headers: map[string]string{
+			"Algorithm-Id": strconv.FormatUint(uint64(sig.AlgorithmID), 10),
+			"Algorithm":    getSigAlgNameFromID(sig.AlgorithmID),
+		},
+		Bytes: sig.Data,
+	}), nil
+}
+
+// ImportSignature stores a detached signature produced by ExportSignature
+// or by an offline signer at the i-th position of the signatures of the
+// MAR file. If i is the number of signatures, the signature is attached
+// after the existing ones, otherwise it replaces the signature at that
+// position, such as a placeholder added to compute the signed data.
+func (file *File) ImportSignature(i int, detached []byte) error {
+	if i < 0 || i > len(file.Signatures) {
+		return errSignatureIndex
+	}
+	algID, data, err := parseDetachedSignature(detached)
+	if err != nil {
+		return err
+	}
+	if i == len(file.Signatures) {
+		return file.AttachSignature(algID, data)
+	}
+	sig := &file.Signatures[i]
+	sig.AlgorithmID = algID
+	sig.Algorithm = getSigAlgNameFromID(algID)
+	sig.Size = uint32(len(data))
+	sig.Data = data
+	file.Normalize()
+	return nil
+}
+
+// parseDetachedSignature returns the algorithm and data of a detached signature
+func parseDetachedSignature(detached []byte) (uint32, []byte, error) {
+	block, _ := pem.Decode(detached)
+	if block == nil || block.Type != pemTypeSignature {
+		return 0, nil, errBadDetachedSignature
+	}
+	algID, err := strconv.ParseUint(block.Headers["Algorithm-Id"], 10, 32)
+	if err != nil {
+		return 0, nil, errBadDetachedSignature
+	}
+	if getSigAlgNameFromID(uint32(algID)) == "unknown" {
+		return 0, nil, errBadSigAlg
+	}
+	if len(block.Bytes) == 0 {
+		return 0, nil, errEmptySignature
+	}
+	return uint32(algID), block.Bytes, nil
+}
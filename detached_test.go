@@ -0,0 +1,78 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestExportImportSignature(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	detached, err := m.ExportSignature(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(detached, []byte("-----BEGIN MAR SIGNATURE-----")) {
+		t.Fatalf("unexpected detached signature %q", detached)
+	}
+
+	// attach the detached signature to the stripped file
+	m.StripSignatures()
+	err = m.ImportSignature(0, detached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, signed) {
+		t.Fatal("expected file with imported signature to match the signed file")
+	}
+
+	// replace a placeholder signature with the detached signature
+	m.Signatures[0].Data = make([]byte, len(m.Signatures[0].Data))
+	err = m.ImportSignature(0, detached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.VerifySignature(rsa2048Key.Public())
+	if err != nil {
+		t.Fatalf("imported signature failed to verify: %v", err)
+	}
+}
+
+func TestImportSignatureBadInput(t *testing.T) {
+	m := New()
+	testCases := []struct {
+		i        int
+		detached string
+		err      error
+	}{
+		{1, "", errSignatureIndex},
+		{-1, "", errSignatureIndex},
+		{0, "not a pem block", errBadDetachedSignature},
+		{0, "-----BEGIN MAR SIGNATURE-----\nAAAA\n-----END MAR SIGNATURE-----\n", errBadDetachedSignature},
+		{0, "-----BEGIN MAR SIGNATURE-----\nAlgorithm-Id: 42\n\nAAAA\n-----END MAR SIGNATURE-----\n", errBadSigAlg},
+		{0, "-----BEGIN MAR SIGNATURE-----\nAlgorithm-Id: 2\n\n-----END MAR SIGNATURE-----\n", errEmptySignature},
+	}
+	for i, testCase := range testCases {
+		err := m.ImportSignature(testCase.i, []byte(testCase.detached))
+		if err != testCase.err {
+			t.Fatalf("testcase %d expected error %v, got %v", i, testCase.err, err)
+		}
+	}
+	_, err := m.ExportSignature(0)
+	if err != errSignatureIndex {
+		t.Fatalf("expected error %v, got %v", errSignatureIndex, err)
+	}
+}
@@ -0,0 +1,35 @@
+package mar
+
+import "sort"
+
+// Deterministic makes Marshal write the file in a canonical form, such that
+// two builds from identical inputs produce bit-identical MARs whatever the
+// order entries were added in, the permissions of the files they were read
+// from, or the layout of the file they were parsed from. Entries are sorted
+// by name, their flags are normalized to FlagsExecutable if any execute bit
+// is set and FlagsRegular otherwise, and their content is laid out in the
+// order of the index, without the data that was found between entries or
+// after the index when the file was parsed. The File itself is left
+// untouched, and its signatures are not recomputed, so a file must be
+// marshalled with this option and parsed back before it is signed.
+func Deterministic() Option {
+	return func(o *options) {
+		o.deterministic = true
+	}
+}
+
+// canonicalize sorts the index of the file, normalizes the flags of its
+// entries and drops the layout it was parsed with
+func (file *File) canonicalize() {
+	sort.SliceStable(file.Index, func(i, j int) bool {
+		return file.Index[i].FileName < file.Index[j].FileName
+	})
+	for i := range file.Index {
+		if file.Index[i].IsExecutable() {
+			file.Index[i].Flags = FlagsExecutable
+		} else {
+			file.Index[i].Flags = FlagsRegular
+		}
+	}
+	file.layout = nil
+}
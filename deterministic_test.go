@@ -0,0 +1,66 @@
+package mar
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeterministic(t *testing.T) {
+	a := New()
+	a.AddContent([]byte("bcdef"), "b/file", 0600)
+	a.AddContent([]byte("cariboumaurice"), "a/file", 0775)
+	a.AddProductInfo("caribou maurice v1.2")
+
+	b := New()
+	b.AddContent([]byte("cariboumaurice"), "a/file", 0755)
+	b.AddContent([]byte("bcdef"), "b/file", 0644)
+	b.AddProductInfo("caribou maurice v1.2")
+
+	// stale headers are recomputed on a copy of the file, not on the file
+	a.Size, a.OffsetToIndex = 0, 0
+	outA, err := a.Marshal(Deterministic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outB, err := b.Marshal(Deterministic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(outA, outB) {
+		t.Fatal("expected identical inputs to marshal to identical outputs")
+	}
+	if a.Index[0].FileName != "b/file" || a.Index[0].Flags != 0600 {
+		t.Fatalf("expected the file to be left untouched but its index is %+v", a.Index)
+	}
+
+	var parsed File
+	err = Unmarshal(outA, &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Index[0].FileName != "a/file" || parsed.Index[0].Flags != FlagsExecutable || parsed.Index[1].Flags != FlagsRegular {
+		t.Fatalf("unexpected index %+v", parsed.Index)
+	}
+	if a.Size != 0 || a.OffsetToIndex != 0 {
+		t.Fatalf("expected the headers of the file to be left untouched but got size=%d offsetToIndex=%d",
+			a.Size, a.OffsetToIndex)
+	}
+	if parsed.Size != uint64(len(outA)) || parsed.OffsetToIndex == 0 {
+		t.Fatalf("expected the headers of the output to be recomputed but got size=%d offsetToIndex=%d",
+			parsed.Size, parsed.OffsetToIndex)
+	}
+
+	// the layout of a parsed file is not kept
+	var lenient File
+	err = Unmarshal(append(outA, "trailing data"...), &lenient, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := lenient.Marshal(Deterministic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, outA) {
+		t.Fatal("expected the trailing data of the parsed file to be dropped")
+	}
+}
@@ -0,0 +1,155 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// DiffReport lists the differences between two MAR files
+type DiffReport struct {
+	// Added are the entries only present in the new file
+	Added []EntryDiff `json:"added,omitempty" yaml:"added,omitempty"`
+	// Removed are the entries only present in the old file
+	Removed []EntryDiff `json:"removed,omitempty" yaml:"removed,omitempty"`
+	// Changed are the entries whose content or flags differ
+	Changed []EntryDiff `json:"changed,omitempty" yaml:"changed,omitempty"`
+	// ProductInformation is set if the product information differs
+	ProductInformation *ProductInformationDiff `json:"product_information,omitempty" yaml:"product_information,omitempty"`
+	// Signatures is set if the signatures differ
+	Signatures *SignaturesDiff `json:"signatures,omitempty" yaml:"signatures,omitempty"`
+}
+
+// EntryDiff describes an entry in the old and new files. The fields of
+// the side the entry is missing from are left empty.
+type EntryDiff struct {
+	Name      string `json:"name" yaml:"name"`
+	OldSize   uint64 `json:"old_size,omitempty" yaml:"old_size,omitempty"`
+	NewSize   uint64 `json:"new_size,omitempty" yaml:"new_size,omitempty"`
+	OldFlags  uint32 `json:"old_flags,omitempty" yaml:"old_flags,omitempty"`
+	NewFlags  uint32 `json:"new_flags,omitempty" yaml:"new_flags,omitempty"`
+	OldSHA256 string `json:"old_sha256,omitempty" yaml:"old_sha256,omitempty"`
+	NewSHA256 string `json:"new_sha256,omitempty" yaml:"new_sha256,omitempty"`
+}
+
+// ProductInformationDiff holds the product information of both files
+type ProductInformationDiff struct {
+	Old string `json:"old" yaml:"old"`
+	New string `json:"new" yaml:"new"`
+}
+
+// SignaturesDiff holds the signatures of both files
+type SignaturesDiff struct {
+	Old []SignatureSummary `json:"old" yaml:"old"`
+	New []SignatureSummary `json:"new" yaml:"new"`
+}
+
+// SignatureSummary identifies a signature by its algorithm and the
+// SHA256 of its data
+type SignatureSummary struct {
+	AlgorithmID uint32 `json:"algorithm_id" yaml:"algorithm_id"`
+	Algorithm   string `json:"algorithm" yaml:"algorithm"`
+	SHA256      string `json:"sha256" yaml:"sha256"`
+}
+
+// Equal returns true if the report holds no difference
+func (r *DiffReport) Equal() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0 &&
+		r.ProductInformation == nil && r.Signatures == nil
+}
+
+// Diff compares the entries, product information and signatures of the
+// old and new MAR files. Entries are matched by name and compared by the
+// SHA256 of their decompressed content and by their flags, such that
+// recompressing an entry is not reported as a change. Entries are listed
+// in the order of the index of the file they come from.
+func Diff(oldFile, newFile *File) (*DiffReport, error) {
+	oldSums, err := oldFile.Checksums(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	newSums, err := newFile.Checksums(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	oldEntries := oldFile.Entries()
+	newEntries := newFile.Entries()
+	oldByName := make(map[string]int, len(oldEntries))
+	for i, e := range oldEntries {
+		oldByName[e.Name] = i
+	}
+	newByName := make(map[string]int, len(newEntries))
+	for i, e := range newEntries {
+		newByName[e.Name] = i
+	}
+
+	r := new(DiffReport)
+	for i, e := range oldEntries {
+		if _, ok := newByName[e.Name]; ok {
+			continue
+		}
+		r.Removed = append(r.Removed, EntryDiff{
+			Name:      e.Name,
+			OldSize:   oldSums.Entries[i].DecompressedSize,
+			OldFlags:  e.Flags,
+			OldSHA256: oldSums.Entries[i].DecompressedDigest,
+		})
+	}
+	for i, e := range newEntries {
+		d := EntryDiff{
+			Name:      e.Name,
+			NewSize:   newSums.Entries[i].DecompressedSize,
+			NewFlags:  e.Flags,
+			NewSHA256: newSums.Entries[i].DecompressedDigest,
+		}
+		j, ok := oldByName[e.Name]
+		if !ok {
+			r.Added = append(r.Added, d)
+			continue
+		}
+		d.OldSize = oldSums.Entries[j].DecompressedSize
+		d.OldFlags = oldEntries[j].Flags
+		d.OldSHA256 = oldSums.Entries[j].DecompressedDigest
+		if d.OldSHA256 != d.NewSHA256 || d.OldFlags != d.NewFlags {
+			r.Changed = append(r.Changed, d)
+		}
+	}
+
+	if oldFile.ProductInformation != newFile.ProductInformation {
+		r.ProductInformation = &ProductInformationDiff{
+			Old: oldFile.ProductInformation,
+			New: newFile.ProductInformation,
+		}
+	}
+	oldSigs := summarizeSignatures(oldFile.Signatures)
+	newSigs := summarizeSignatures(newFile.Signatures)
+	if !equalSignatures(oldSigs, newSigs) {
+		r.Signatures = &SignaturesDiff{Old: oldSigs, New: newSigs}
+	}
+	return r, nil
+}
+
+func summarizeSignatures(sigs []Signature) []SignatureSummary {
+	summaries := make([]SignatureSummary, 0, len(sigs))
+	for _, sig := range sigs {
+		sum := sha256.Sum256(sig.Data)
+		summaries = append(summaries, SignatureSummary{
+			AlgorithmID: sig.AlgorithmID,
+			Algorithm:   getSigAlgNameFromID(sig.AlgorithmID),
+			SHA256:      hex.EncodeToString(sum[:]),
+		})
+	}
+	return summaries
+}
+
+func equalSignatures(a, b []SignatureSummary) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package mar
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	oldFile := New()
+	oldFile.SetProductInformation("61.0", "firefox-mozilla-release")
+	oldFile.AddContent([]byte("unchanged"), "/same", 0644)
+	oldFile.AddContent([]byte("old content"), "/changed", 0644)
+	oldFile.AddContent([]byte("mode"), "/chmod", 0644)
+	oldFile.AddContent([]byte("gone"), "/removed", 0644)
+
+	newFile := New()
+	newFile.SetProductInformation("62.0", "firefox-mozilla-release")
+	err := newFile.AddContent([]byte("unchanged"), "/same", 0644, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFile.AddContent([]byte("new content"), "/changed", 0644)
+	newFile.AddContent([]byte("mode"), "/chmod", 0755)
+	newFile.AddContent([]byte("new"), "/added", 0644)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = newFile.Sign(rand.Reader, key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Diff(oldFile, newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Equal() {
+		t.Fatal("expected differences")
+	}
+	if len(r.Removed) != 1 || r.Removed[0].Name != "/removed" || r.Removed[0].OldSize != 4 {
+		t.Fatalf("unexpected removed entries %+v", r.Removed)
+	}
+	if len(r.Added) != 1 || r.Added[0].Name != "/added" || r.Added[0].NewSize != 3 {
+		t.Fatalf("unexpected added entries %+v", r.Added)
+	}
+	if len(r.Changed) != 2 || r.Changed[0].Name != "/changed" || r.Changed[1].Name != "/chmod" {
+		t.Fatalf("unexpected changed entries %+v", r.Changed)
+	}
+	if r.Changed[1].OldFlags != 0644 || r.Changed[1].NewFlags != 0755 || r.Changed[1].OldSHA256 != r.Changed[1].NewSHA256 {
+		t.Fatalf("unexpected mode change %+v", r.Changed[1])
+	}
+	if r.ProductInformation == nil || r.ProductInformation.Old == r.ProductInformation.New {
+		t.Fatalf("expected a product information change, got %+v", r.ProductInformation)
+	}
+	if r.Signatures == nil || len(r.Signatures.Old) != 0 || len(r.Signatures.New) != 1 ||
+		r.Signatures.New[0].AlgorithmID != SigAlgRsaPkcs1Sha384 {
+		t.Fatalf("unexpected signatures change %+v", r.Signatures)
+	}
+}
+
+func TestDiffEqual(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("content"), "/foo", 0644)
+	r, err := Diff(m, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Equal() {
+		t.Fatalf("expected no difference, got %+v", r)
+	}
+}
@@ -19,6 +19,17 @@ Unmarshal function, then signing them with either RSA or ECDSA keys.
 	output, _ := file.Marshal()
 	ioutil.WriteFile("/path/to/signed_firefox.mar", output, 0644)
 
+A single RSA or ECDSA signature can also be added and computed in one step.
+
+	_ = file.Sign(rand.Reader, rsaKey, mar.SigAlgRsaPkcs1Sha384)
+
+Algorithms the MAR format doesn't define can be registered under an ID of
+the caller's choosing, such as Ed25519 for MARs that are only read by a fork
+of the updater.
+
+	_ = mar.RegisterSignatureAlgorithm(0x100, mar.Ed25519Algorithm())
+	_ = file.Sign(rand.Reader, ed25519Key, 0x100)
+
 It can also be used to create new MARs and manipulate existing ones.
 
 	// create a new MAR
@@ -32,7 +43,7 @@ It can also be used to create new MARs and manipulate existing ones.
 
 The MAR data structure exposes all internal fields, including offsets,
 sizes, etc. Those fields can be manipulated directly, but are ignored
-and recomputed when marshalling.
+and recomputed by Normalize when marshalling.
 
 The parser is fairly secure and will refuse to parse files that have
 duplicate content or try to reference the same data chunk multiple
@@ -42,6 +53,30 @@ memory if you're going to parse a lot of very large MAR before the
 garbage collector has a chance to reclaim memory from previously
 parsed files.
 
-Various limits are enforced, take a look at errors.go for the details.
+Large MAR files don't have to be loaded in memory to be inspected. NewReader
+parses the headers and index from an io.ReaderAt, such as an *os.File, and
+the content of each entry is only read when opened.
+
+	fd, _ := os.Open("/path/to/firefox.mar")
+	fi, _ := fd.Stat()
+	r, _ := mar.NewReader(fd, fi.Size())
+	manifest, _ := r.Open("updatev3.manifest")
+
+The same works with a MAR hosted on a server that supports HTTP Range
+requests, in which case only the headers, the index and the opened entries
+are downloaded.
+
+	r, _ := mar.OpenURL(http.DefaultClient, "https://example.net/firefox.mar")
+
+Various limits are enforced, take a look at errors.go and limits.go for
+the details. Errors returned by the package belong to one of the classes
+defined in errors.go, like ErrTruncated or ErrMalformedIndex, and can be
+tested with errors.Is. Parsing failures are returned as a *ParseError that
+indicates the section of the file and the offset where they occurred.
+
+	err := mar.Unmarshal(input, &file)
+	if errors.Is(err, mar.ErrTruncated) {
+		// the download was probably interrupted
+	}
 */
 package mar
@@ -0,0 +1,78 @@
+package mar
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Dump writes a human-readable report of the MAR file to w, with the values
+// of its headers, the algorithm of each signature, the decoded additional
+// sections and a table of the index entries with their permissions.
+func (file *File) Dump(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "MAR ID:\t%s\n", file.MarID)
+	fmt.Fprintf(tw, "Revision:\t%d\n", file.Revision)
+	fmt.Fprintf(tw, "File size:\t%d bytes\n", file.Size)
+	fmt.Fprintf(tw, "Offset to index:\t%d\n", file.OffsetToIndex)
+	if file.ProductInformation != "" {
+		fmt.Fprintf(tw, "Product information:\t%s\n", file.ProductInformation)
+	}
+	if file.ProductInfo != nil {
+		fmt.Fprintf(tw, "Product version:\t%s\n", file.ProductInfo.Version)
+		fmt.Fprintf(tw, "MAR channel IDs:\t%s\n", strings.Join(file.ProductInfo.Channels, ", "))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nSignatures: %d\n", len(file.Signatures))
+	for i, sig := range file.Signatures {
+		fmt.Fprintf(tw, "  #%d\t%s\talgorithm id %d\t%d bytes\n",
+			i, getSigAlgNameFromID(sig.AlgorithmID), sig.AlgorithmID, sig.Size)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nAdditional sections: %d\n", len(file.AdditionalSections))
+	for i, as := range file.AdditionalSections {
+		switch as.BlockID {
+		case BlockIDProductInfo:
+			fmt.Fprintf(tw, "  #%d\tproduct information\tblock id %d\t%d bytes\t%s\n",
+				i, as.BlockID, as.BlockSize, productInfoString(as.Data))
+		default:
+			fmt.Fprintf(tw, "  #%d\t%s\tblock id %d\t%d bytes\t%s\n",
+				i, as.Name(), as.BlockID, as.BlockSize, dumpData(as.Data))
+		}
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nIndex: %d entries, %d bytes\n", len(file.Index), file.IndexHeader.Size)
+	fmt.Fprintf(tw, "  offset\tsize\tmode\tcompressed\tname\n")
+	for _, idx := range file.Index {
+		compressed := "-"
+		if entry, ok := file.Content[idx.FileName]; ok && entry.IsCompressed {
+			compressed = entry.compression().String()
+		}
+		fmt.Fprintf(tw, "  %d\t%d\t%s\t%s\t%s\n",
+			idx.OffsetToContent, idx.Size, os.FileMode(idx.Flags), compressed, idx.FileName)
+	}
+	return tw.Flush()
+}
+
+// dumpData returns a printable representation of the first bytes of data
+func dumpData(data []byte) string {
+	const maxLen = 32
+	if len(data) > maxLen {
+		return fmt.Sprintf("%q...", data[:maxLen])
+	}
+	return fmt.Sprintf("%q", data)
+}
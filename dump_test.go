@@ -0,0 +1,46 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	m := New()
+	m.AddProductInfo("caribou maurice v1.2")
+	m.AddAdditionalSection([]byte("foo bar baz"), uint32(1664))
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0755)
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = reparsed.Dump(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("\n%s", buf.String())
+	for _, expected := range []string{
+		"Product information:  caribou maurice v1.2",
+		"RSA-PKCS1v15-SHA384",
+		"product information",
+		`"foo bar baz"`,
+		"-rwxr-xr-x",
+		"/foo/bar",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("expected to find %q in dump but didn't", expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package mar
+
+import "fmt"
+
+// DuplicatePolicy decides what the parser does with index entries that
+// have the same name as an earlier entry, which the MAR format forbids
+// but files from the wild may still have
+type DuplicatePolicy int
+
+const (
+	// DuplicatesFail makes the parser fail with ErrDuplicateEntry
+	DuplicatesFail DuplicatePolicy = iota
+	// DuplicatesKeepFirst keeps the first entry of a name and removes
+	// the others from the index
+	DuplicatesKeepFirst
+	// DuplicatesKeepLast keeps the last entry of a name and removes the
+	// others from the index, which is what extracting the file would do
+	DuplicatesKeepLast
+	// DuplicatesRename keeps every entry and renames the duplicates by
+	// appending their ordinal to their name, such as "foo#2" for the
+	// second entry named "foo"
+	DuplicatesRename
+)
+
+// OnDuplicates sets what Unmarshal, NewReader and OpenMapped do with
+// entries that have the same name, instead of failing. Every duplicate
+// that is removed or renamed is recorded in the Warnings of the File.
+// The content of removed duplicates is still checked like that of other
+// entries, so it must not overlap them, and with Strict it counts towards
+// filling the space between the headers and the index.
+func OnDuplicates(policy DuplicatePolicy) Option {
+	return func(o *options) {
+		o.duplicates = policy
+	}
+}
+
+// resolveDuplicates applies the duplicate policy of the parser to the
+// index of the file, and returns the entries it removed. Duplicates are
+// left in place by DuplicatesFail, and rejected when the content is loaded.
+func resolveDuplicates(p *parser, file *File) []IndexEntry {
+	if p.duplicates == DuplicatesFail {
+		return nil
+	}
+	count := make(map[string]int, len(file.Index))
+	for _, idx := range file.Index {
+		count[idx.FileName]++
+	}
+	if len(count) == len(file.Index) {
+		return nil
+	}
+	var removed []IndexEntry
+	seen := make(map[string]int, len(count))
+	index := file.Index[:0]
+	for _, idx := range file.Index {
+		name := idx.FileName
+		seen[name]++
+		if count[name] == 1 {
+			index = append(index, idx)
+			continue
+		}
+		switch p.duplicates {
+		case DuplicatesKeepFirst:
+			if seen[name] > 1 {
+				file.addWarning("removed entry %d named %q which is a duplicate", seen[name], name)
+				removed = append(removed, idx)
+				continue
+			}
+		case DuplicatesKeepLast:
+			if seen[name] < count[name] {
+				file.addWarning("removed entry %d named %q which is a duplicate", seen[name], name)
+				removed = append(removed, idx)
+				continue
+			}
+		case DuplicatesRename:
+			if seen[name] > 1 {
+				idx.FileName = ordinalName(name, seen[name], count)
+				count[idx.FileName]++
+				file.addWarning("renamed entry %d named %q to %q", seen[name], name, idx.FileName)
+			}
+		}
+		index = append(index, idx)
+	}
+	file.Index = index
+	return removed
+}
+
+// ordinalName returns the name of the nth entry named name, which is not
+// taken by any other entry
+func ordinalName(name string, n int, taken map[string]int) string {
+	for ; ; n++ {
+		candidate := fmt.Sprintf("%s#%d", name, n)
+		if taken[candidate] == 0 {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// marWithDuplicates returns a MAR with three entries named foo, holding
+// 1111, 2222 and 3333, and an entry named foo#2
+func marWithDuplicates(t *testing.T) []byte {
+	m := New()
+	m.AddContent([]byte("1111"), "foo", 0600)
+	m.AddContent([]byte("2222"), "bar", 0600)
+	m.AddContent([]byte("4444"), "foo#2", 0600)
+	m.AddContent([]byte("3333"), "baz", 0600)
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input = bytes.Replace(input, []byte("bar\x00"), []byte("foo\x00"), 1)
+	return bytes.Replace(input, []byte("baz\x00"), []byte("foo\x00"), 1)
+}
+
+func TestOnDuplicates(t *testing.T) {
+	input := marWithDuplicates(t)
+	var file File
+	err := Unmarshal(input, &file)
+	if !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("expected to fail with %q but got %v", ErrDuplicateEntry, err)
+	}
+
+	testCases := []struct {
+		policy   DuplicatePolicy
+		names    []string
+		foo      string
+		warnings int
+	}{
+		{DuplicatesKeepFirst, []string{"foo", "foo#2"}, "1111", 2},
+		{DuplicatesKeepLast, []string{"foo#2", "foo"}, "3333", 2},
+		{DuplicatesRename, []string{"foo", "foo#3", "foo#2", "foo#4"}, "1111", 2},
+	}
+	for i, testCase := range testCases {
+		var file File
+		err := Unmarshal(input, &file, OnDuplicates(testCase.policy))
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+		var names []string
+		for _, idx := range file.Index {
+			names = append(names, idx.FileName)
+		}
+		if !reflect.DeepEqual(names, testCase.names) {
+			t.Fatalf("testcase %d: expected entries %q but got %q", i, testCase.names, names)
+		}
+		if string(file.Content["foo"].Data) != testCase.foo {
+			t.Fatalf("testcase %d: expected foo to hold %q but got %q", i, testCase.foo, file.Content["foo"].Data)
+		}
+		if len(file.Warnings) != testCase.warnings {
+			t.Fatalf("testcase %d: expected %d warnings but got %q", i, testCase.warnings, file.Warnings)
+		}
+		// the resolved file can be written out again
+		_, err = file.Marshal()
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+	}
+
+	r, err := NewReader(bytes.NewReader(input), int64(len(input)), OnDuplicates(DuplicatesRename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := r.GetEntry("foo#4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Data) != "3333" {
+		t.Fatalf("expected foo#4 to hold 3333 but got %q", entry.Data)
+	}
+}
+
+func TestOnDuplicatesStrict(t *testing.T) {
+	input := marWithDuplicates(t)
+	for _, policy := range []DuplicatePolicy{DuplicatesKeepFirst, DuplicatesKeepLast, DuplicatesRename} {
+		var file File
+		err := Unmarshal(input, &file, Strict(), OnDuplicates(policy))
+		if err != nil {
+			t.Fatalf("policy %d: expected the content of removed duplicates to fill the gaps but got %v", policy, err)
+		}
+		_, err = NewReader(bytes.NewReader(input), int64(len(input)), Strict(), OnDuplicates(policy))
+		if err != nil {
+			t.Fatalf("policy %d: %v", policy, err)
+		}
+	}
+	var file File
+	err := Unmarshal(input, &file, Strict())
+	if !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("expected to fail with %q but got %v", ErrDuplicateEntry, err)
+	}
+}
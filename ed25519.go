@@ -0,0 +1,45 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+)
+
+// Ed25519SignatureSize is the size in bytes of Ed25519 signatures
+const Ed25519SignatureSize = ed25519.SignatureSize
+
+// Ed25519Algorithm returns an Ed25519 signature algorithm to register under
+// an ID of the caller's choosing with RegisterSignatureAlgorithm, as
+// Ed25519 has no algorithm ID in the MAR format and the Firefox updater does
+// not support it. The signature is made over the SHA512 digest of the
+// signed data rather than the signed data itself, such that files are
+// hashed in a single pass like with the other algorithms.
+func Ed25519Algorithm() SignatureAlgorithm {
+	return SignatureAlgorithm{
+		Name: "ED25519-SHA512",
+		Hash: crypto.SHA512,
+		SignatureSize: func(pub crypto.PublicKey) (uint32, error) {
+			if _, ok := pub.(ed25519.PublicKey); !ok {
+				return 0, fmt.Errorf("unsupported key type %T", pub)
+			}
+			return Ed25519SignatureSize, nil
+		},
+		Sign: func(signer crypto.Signer, rand io.Reader, digest []byte) ([]byte, error) {
+			// ed25519 keys sign the message they are given, which
+			// they signal with a zero hash function
+			return signer.Sign(rand, digest, crypto.Hash(0))
+		},
+		Verify: func(pub crypto.PublicKey, digest, sig []byte) error {
+			edKey, ok := pub.(ed25519.PublicKey)
+			if !ok {
+				return fmt.Errorf("unknown public key type %T", pub)
+			}
+			if !ed25519.Verify(edKey, digest, sig) {
+				return fmt.Errorf("invalid signature")
+			}
+			return nil
+		},
+	}
+}
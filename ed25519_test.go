@@ -0,0 +1,111 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sigAlgEd25519 is the ID the tests register Ed25519 under
+const sigAlgEd25519 = 0x5A25
+
+func init() {
+	err := RegisterSignatureAlgorithm(sigAlgEd25519, Ed25519Algorithm())
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestEd25519SignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	err = m.SignAll(rand.Reader,
+		SigningKey{priv, sigAlgEd25519},
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Signatures[0].Size != Ed25519SignatureSize {
+		t.Fatalf("expected signature size %d but got %d", Ed25519SignatureSize, m.Signatures[0].Size)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file File
+	err = Unmarshal(signed, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Signatures[0].Algorithm != "ED25519-SHA512" {
+		t.Fatalf("expected first signature to be ED25519-SHA512 but got %q", file.Signatures[0].Algorithm)
+	}
+	keys := map[string]crypto.PublicKey{"ed25519": pub, "rsa": rsa2048Key.Public()}
+	validKeys, err := file.VerifyWithKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 2 || validKeys[0] != "ed25519" || validKeys[1] != "rsa" {
+		t.Fatalf("expected signatures from keys [ed25519 rsa] but got %v", validKeys)
+	}
+	_, err = file.VerifyWithKeys(map[string]crypto.PublicKey{"other": otherPub, "rsa": rsa2048Key.Public()})
+	if err == nil {
+		t.Fatal("expected verification with another ed25519 key to fail")
+	}
+
+	// streamed verification from disk, of the file as is and tampered
+	dir, err := ioutil.TempDir("", "mared25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signed.mar")
+	err = ioutil.WriteFile(path, signed, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyFile(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, signed...)
+	tampered[m.Index[0].OffsetToContent] = 'b'
+	err = ioutil.WriteFile(path, tampered, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyFile(path, keys)
+	if err == nil {
+		t.Fatal("expected verification of the tampered file to fail")
+	}
+}
+
+func TestEd25519WrongKeyType(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.Sign(rand.Reader, rsa2048Key, sigAlgEd25519)
+	if err == nil {
+		t.Fatal("expected signing ed25519 with an rsa key to fail")
+	}
+	if len(m.Signatures) != 0 {
+		t.Fatalf("expected no signature but found %d", len(m.Signatures))
+	}
+	err = VerifySignature([]byte("foo"), make([]byte, Ed25519SignatureSize), sigAlgEd25519, rsa2048Key.Public())
+	if err == nil {
+		t.Fatal("expected verifying ed25519 with an rsa key to fail")
+	}
+}
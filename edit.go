@@ -0,0 +1,74 @@
+package mar
+
+import "fmt"
+
+// RemoveEntry removes the entry from the index and content of the MAR. The
+// offsets and sizes of the index and headers are updated accordingly.
+func (file *File) RemoveEntry(name string) error {
+	if _, ok := file.Content[name]; !ok {
+		return errEntryNotFound
+	}
+	index := file.Index[:0]
+	for _, idx := range file.Index {
+		if idx.FileName != name {
+			index = append(index, idx)
+		}
+	}
+	file.Index = index
+	delete(file.Content, name)
+	file.Normalize()
+	return nil
+}
+
+// RenameEntry changes the name of an entry, keeping its position in the
+// index, its flags and its content. The offsets and sizes of the index
+// and headers are updated accordingly.
+func (file *File) RenameEntry(oldName, newName string) error {
+	entry, ok := file.Content[oldName]
+	if !ok {
+		return errEntryNotFound
+	}
+	err := checkFileName(newName)
+	if err != nil {
+		return err
+	}
+	if _, ok := file.Content[newName]; ok {
+		return errDupContent
+	}
+	for i := range file.Index {
+		if file.Index[i].FileName == oldName {
+			file.Index[i].FileName = newName
+		}
+	}
+	delete(file.Content, oldName)
+	file.Content[newName] = entry
+	file.Normalize()
+	return nil
+}
+
+// ReplaceEntry replaces the content of an entry, keeping its name, flags
+// and position in the index. Like AddContent, data is compressed with the
+// Compress or CompressWith options unless it already is. The offsets and
+// sizes of the index and headers are updated accordingly.
+func (file *File) ReplaceEntry(name string, data []byte, opts ...Option) error {
+	if _, ok := file.Content[name]; !ok {
+		return errEntryNotFound
+	}
+	compression := detectCompression(data)
+	o := newOptions(opts)
+	if o.compression != CompressionNone && compression == CompressionNone {
+		var err error
+		data, err = compress(o.compression, data)
+		if err != nil {
+			return fmt.Errorf("%s compression failed: %w", o.compression, err)
+		}
+		compression = o.compression
+	}
+	file.Content[name] = Entry{
+		Data:         data,
+		IsCompressed: compression != CompressionNone,
+		Compression:  compression,
+	}
+	file.Normalize()
+	return nil
+}
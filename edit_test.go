@@ -0,0 +1,114 @@
+package mar
+
+import (
+	"bytes"
+	"testing"
+)
+
+// reparse marshals the file and parses it back
+func reparse(t *testing.T, file *File) *File {
+	t.Helper()
+	o, err := file.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(o)) != file.Size {
+		t.Fatalf("expected a file of %d bytes, got %d", file.Size, len(o))
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed, Strict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &reparsed
+}
+
+func editTestFile(t *testing.T) *File {
+	m := New()
+	m.AddContent([]byte("aaaa"), "a", 0644)
+	m.AddContent([]byte("bbbbbbbb"), "b", 0755)
+	m.AddContent([]byte("cc"), "c", 0600)
+	return reparse(t, m)
+}
+
+func TestRemoveEntry(t *testing.T) {
+	m := editTestFile(t)
+	err := m.RemoveEntry("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reparse(t, m)
+	checkEntryNames(t, r.Entries(), "a", "c")
+	if string(r.Content["c"].Data) != "cc" || r.Index[1].Flags != 0600 {
+		t.Fatalf("unexpected entry c %+v", r.Index[1])
+	}
+	if m.RemoveEntry("b") != errEntryNotFound {
+		t.Fatal("expected an error removing a missing entry")
+	}
+}
+
+func TestRenameEntry(t *testing.T) {
+	m := editTestFile(t)
+	err := m.RenameEntry("b", "renamed/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reparse(t, m)
+	checkEntryNames(t, r.Entries(), "a", "renamed/b", "c")
+	if string(r.Content["renamed/b"].Data) != "bbbbbbbb" || r.Index[1].Flags != 0755 {
+		t.Fatalf("unexpected renamed entry %+v", r.Index[1])
+	}
+	if m.RenameEntry("b", "d") != errEntryNotFound {
+		t.Fatal("expected an error renaming a missing entry")
+	}
+	if m.RenameEntry("a", "c") != errDupContent {
+		t.Fatal("expected an error renaming to an existing name")
+	}
+	if m.RenameEntry("a", "") != errEmptyFileName {
+		t.Fatal("expected an error renaming to an empty name")
+	}
+}
+
+func TestReplaceEntry(t *testing.T) {
+	m := editTestFile(t)
+	err := m.ReplaceEntry("a", []byte("a longer content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed := bytes.Repeat([]byte("compressible "), 50)
+	err = m.ReplaceEntry("c", packed, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reparse(t, m)
+	checkEntryNames(t, r.Entries(), "a", "b", "c")
+	if string(r.Content["a"].Data) != "a longer content" || string(r.Content["b"].Data) != "bbbbbbbb" {
+		t.Fatalf("unexpected content %q and %q", r.Content["a"].Data, r.Content["b"].Data)
+	}
+	c, err := r.Content["c"].Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Content["c"].IsCompressed || !bytes.Equal(c, packed) {
+		t.Fatal("expected the replaced entry to be compressed")
+	}
+	if m.ReplaceEntry("d", nil) != errEntryNotFound {
+		t.Fatal("expected an error replacing a missing entry")
+	}
+}
+
+func TestEditPreservedLayout(t *testing.T) {
+	var m File
+	err := Unmarshal(rawMar(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.RenameEntry(m.Index[0].FileName, "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reparse(t, &m)
+	if r.Index[0].FileName != "renamed" {
+		t.Fatalf("expected the first entry to be renamed, got %q", r.Index[0].FileName)
+	}
+}
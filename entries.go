@@ -0,0 +1,60 @@
+package mar
+
+import "sort"
+
+// NamedEntry is an entry of the MAR along with its name and the
+// offset, size and flags recorded in the index
+type NamedEntry struct {
+	// Name is the name of the entry in the index
+	Name string
+	IndexEntryHeader
+	Entry
+}
+
+// Entries returns the entries of the MAR in the order of the index. The
+// Entry of each is taken from the Content map, and left empty if the
+// content was not parsed.
+func (file *File) Entries() []NamedEntry {
+	entries := make([]NamedEntry, 0, len(file.Index))
+	for _, idx := range file.Index {
+		entries = append(entries, NamedEntry{
+			Name:             idx.FileName,
+			IndexEntryHeader: idx.IndexEntryHeader,
+			Entry:            file.Content[idx.FileName],
+		})
+	}
+	return entries
+}
+
+// EntriesByOffset returns the entries of the MAR in the order their
+// content is stored in the file. Entries sharing the same offset are
+// kept in the order of the index.
+func (file *File) EntriesByOffset() []NamedEntry {
+	entries := file.Entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].OffsetToContent < entries[j].OffsetToContent
+	})
+	return entries
+}
+
+// WalkFunc is the function Walk calls for each entry of a MAR
+type WalkFunc func(name string, e Entry, idx IndexEntry) error
+
+// Walk calls fn for each entry of the MAR in the order their content is
+// stored in the file, like EntriesByOffset, such that tools that care about
+// where content is on disk can process it sequentially. Walk stops at the
+// first error returned by fn and returns it.
+func (file *File) Walk(fn WalkFunc) error {
+	index := make([]IndexEntry, len(file.Index))
+	copy(index, file.Index)
+	sort.SliceStable(index, func(i, j int) bool {
+		return index[i].OffsetToContent < index[j].OffsetToContent
+	})
+	for _, idx := range index {
+		err := fn(idx.FileName, file.Content[idx.FileName], idx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package mar
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEntries(t *testing.T) {
+	var m File
+	err := Unmarshal(rawMar(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntryNames(t, m.Entries(), "a", "b")
+	checkEntryNames(t, m.EntriesByOffset(), "b", "a")
+
+	entries := m.Entries()
+	if string(entries[0].Data) != "aaaa" {
+		t.Fatalf("expected content of entry a to be %q, got %q", "aaaa", entries[0].Data)
+	}
+	if entries[0].Flags != 0644 || entries[0].Size != 4 {
+		t.Fatalf("unexpected index header for entry a: %+v", entries[0].IndexEntryHeader)
+	}
+}
+
+func TestEntriesSkipContent(t *testing.T) {
+	var m File
+	err := Unmarshal(rawMar(), &m, SkipContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := m.Entries()
+	checkEntryNames(t, entries, "a", "b")
+	if entries[0].Data != nil {
+		t.Fatalf("expected no content with SkipContent, got %q", entries[0].Data)
+	}
+}
+
+func TestEntriesNewFile(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("first"), "z", 0600)
+	m.AddContent([]byte("second"), "y", 0600)
+	checkEntryNames(t, m.Entries(), "z", "y")
+	checkEntryNames(t, m.EntriesByOffset(), "z", "y")
+}
+
+func TestWalk(t *testing.T) {
+	var m File
+	err := Unmarshal(rawMar(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	err = m.Walk(func(name string, e Entry, idx IndexEntry) error {
+		if idx.FileName != name || int(idx.Size) != len(e.Data) {
+			t.Fatalf("unexpected entry %q with index entry %v and %d bytes", name, idx, len(e.Data))
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "b" || names[1] != "a" {
+		t.Fatalf("expected to walk b then a but got %q", names)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = m.Walk(func(name string, e Entry, idx IndexEntry) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("expected to stop after 1 call with %q but got %v after %d calls", stop, err, calls)
+	}
+}
+
+func checkEntryNames(t *testing.T, entries []NamedEntry, names ...string) {
+	t.Helper()
+	if len(entries) != len(names) {
+		t.Fatalf("expected %d entries, got %d", len(names), len(entries))
+	}
+	for i, name := range names {
+		if entries[i].Name != name {
+			t.Fatalf("expected entry %d to be named %q, got %q", i, name, entries[i].Name)
+		}
+	}
+}
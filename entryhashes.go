@@ -0,0 +1,186 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// BlockIDEntryHashes is the ID of the additional section that holds the
+// SHA256 digest of the decompressed content of every entry, such that
+// extracted files can be checked without the archive they came from
+const BlockIDEntryHashes = 0x48415348
+
+// EntryHash is the SHA256 digest of the decompressed content of an entry
+type EntryHash struct {
+	Name   string `json:"name" yaml:"name"`
+	SHA256 []byte `json:"sha256" yaml:"sha256"`
+}
+
+// EntryHashes is the content of an entry hashes section, in the order of
+// the index of the file
+type EntryHashes []EntryHash
+
+// Bytes returns the data of an entry hashes section, where each entry is
+// stored as its 32 bytes digest followed by its null terminated name
+func (hashes EntryHashes) Bytes() []byte {
+	var b bytes.Buffer
+	for _, h := range hashes {
+		b.Write(h.SHA256)
+		b.WriteString(h.Name)
+		b.WriteByte(0)
+	}
+	return b.Bytes()
+}
+
+// check returns an error if the hashes can't be stored in a section
+func (hashes EntryHashes) check() error {
+	for _, h := range hashes {
+		if h.Name == "" || strings.IndexByte(h.Name, 0) >= 0 {
+			return fmt.Errorf("%w: names must be non empty and free of null bytes", errMalformedEntryHashes)
+		}
+		if len(h.SHA256) != sha256.Size {
+			return fmt.Errorf("%w: the digest of %q is not %d bytes long", errMalformedEntryHashes, h.Name, sha256.Size)
+		}
+	}
+	return nil
+}
+
+// Add appends the digest of the content read from r under name, such that
+// the hashes of files can be computed before they are written to a MAR
+func (hashes *EntryHashes) Add(name string, r io.Reader) error {
+	md := sha256.New()
+	_, err := copyBuffer(md, r)
+	if err != nil {
+		return err
+	}
+	*hashes = append(*hashes, EntryHash{Name: name, SHA256: md.Sum(nil)})
+	return nil
+}
+
+// ParseEntryHashes decodes the data of an entry hashes section
+func ParseEntryHashes(data []byte) (EntryHashes, error) {
+	var hashes EntryHashes
+	for len(data) > 0 {
+		if len(data) < sha256.Size+1 {
+			return nil, fmt.Errorf("%w: truncated entry", errMalformedEntryHashes)
+		}
+		end := bytes.IndexByte(data[sha256.Size:], 0)
+		if end < 1 {
+			return nil, fmt.Errorf("%w: names must be non empty and null terminated", errMalformedEntryHashes)
+		}
+		hashes = append(hashes, EntryHash{
+			Name:   string(data[sha256.Size : sha256.Size+end]),
+			SHA256: append([]byte{}, data[:sha256.Size]...),
+		})
+		data = data[sha256.Size+end+1:]
+	}
+	return hashes, nil
+}
+
+// AddEntryHashes computes the SHA256 digest of the decompressed content of
+// every entry of the file and stores them in the additional section of
+// block ID BlockIDEntryHashes, replacing the existing one if any. As with
+// any additional section, it must be added before the file is signed, and
+// updated when entries change.
+func (file *File) AddEntryHashes() error {
+	hashes, err := file.computeEntryHashes(math.MaxUint64)
+	if err != nil {
+		return err
+	}
+	data := hashes.Bytes()
+	for i, as := range file.AdditionalSections {
+		if as.BlockID == BlockIDEntryHashes {
+			file.AdditionalSections[i].Data = data
+			file.Normalize()
+			return nil
+		}
+	}
+	file.AddAdditionalSection(data, BlockIDEntryHashes)
+	return nil
+}
+
+// EntryHashes returns the content of the entry hashes section of the file
+func (file *File) EntryHashes() (EntryHashes, error) {
+	for _, as := range file.AdditionalSections {
+		if as.BlockID == BlockIDEntryHashes {
+			return ParseEntryHashes(as.Data)
+		}
+	}
+	return nil, errNoEntryHashes
+}
+
+// VerifyEntryHashes checks that the entry hashes section of the file lists
+// every entry of the file once, with the digest of its decompressed
+// content. Entries larger than the MaxDecompressedSize of DefaultLimits
+// once decompressed are rejected.
+//
+// Unmarshal calls it on files that have such a section, unless the content
+// is skipped, with the MaxDecompressedSize of WithLimits. Entries are
+// checked under the names they have once duplicates are resolved with
+// OnDuplicates, such that renamed duplicates are reported as not listed.
+func (file *File) VerifyEntryHashes() error {
+	return file.verifyEntryHashes(DefaultLimits().MaxDecompressedSize)
+}
+
+// verifyEntryHashes is VerifyEntryHashes with a limit on the decompressed
+// size of entries
+func (file *File) verifyEntryHashes(maxDecompressedSize uint64) error {
+	expected, err := file.EntryHashes()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string][]byte, len(expected))
+	for _, h := range expected {
+		if _, ok := byName[h.Name]; ok {
+			return fmt.Errorf("%w: %q is listed twice", errMalformedEntryHashes, h.Name)
+		}
+		byName[h.Name] = h.SHA256
+	}
+	actual, err := file.computeEntryHashes(maxDecompressedSize)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(actual))
+	for _, h := range actual {
+		if seen[h.Name] {
+			return fmt.Errorf("%w: %q can't be checked against the entry hashes", ErrDuplicateEntry, h.Name)
+		}
+		seen[h.Name] = true
+		digest, ok := byName[h.Name]
+		if !ok {
+			return fmt.Errorf("%w: %q is not listed", ErrEntryHashMismatch, h.Name)
+		}
+		if !bytes.Equal(digest, h.SHA256) {
+			return fmt.Errorf("%w: %q", ErrEntryHashMismatch, h.Name)
+		}
+		delete(byName, h.Name)
+	}
+	for _, h := range expected {
+		if _, ok := byName[h.Name]; ok {
+			return fmt.Errorf("%w: %q is listed but not in the file", ErrEntryHashMismatch, h.Name)
+		}
+	}
+	return nil
+}
+
+// computeEntryHashes returns the digests of the entries of the file,
+// failing on entries larger than max once decompressed
+func (file *File) computeEntryHashes(max uint64) (EntryHashes, error) {
+	hashes := make(EntryHashes, 0, len(file.Index))
+	for _, e := range file.Entries() {
+		r, err := e.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+		err = hashes.Add(e.Name, newLimitedReader(r, file.debug, "MaxDecompressedSize", max))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+	}
+	return hashes, nil
+}
@@ -0,0 +1,180 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestEntryHashes(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.AddContent([]byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"), "/foo/baz", 0600, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.VerifyEntryHashes()
+	if err != errNoEntryHashes {
+		t.Fatalf("expected to fail with %q but got %v", errNoEntryHashes, err)
+	}
+	// adding the hashes twice replaces the section
+	for i := 0; i < 2; i++ {
+		err = m.AddEntryHashes()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(m.AdditionalSections) != 1 {
+		t.Fatalf("expected 1 additional section but got %d", len(m.AdditionalSections))
+	}
+	hashes, err := m.EntryHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the digest is of the decompressed content
+	expected := sha256.Sum256([]byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"))
+	if len(hashes) != 2 || hashes[1].Name != "/foo/baz" || !bytes.Equal(hashes[1].SHA256, expected[:]) {
+		t.Fatalf("unexpected entry hashes %+v", hashes)
+	}
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file File
+	err = Unmarshal(data, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := file.AdditionalSections[0]
+	if as.Name() != "entry_hashes" {
+		t.Fatalf("expected section name entry_hashes but got %q", as.Name())
+	}
+
+	// the content is checked at parse time
+	e := file.Content["/foo/bar"]
+	e.Data = []byte("cccccccccccccccccccccccccccccccccccccccc")
+	file.Content["/foo/bar"] = e
+	tampered, err := file.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed File
+	err = Unmarshal(tampered, &parsed)
+	if !errors.Is(err, ErrEntryHashMismatch) {
+		t.Fatalf("expected to fail with %q but got %v", ErrEntryHashMismatch, err)
+	}
+	parsed = File{}
+	err = Unmarshal(tampered, &parsed, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Warnings) != 1 {
+		t.Fatalf("expected the mismatch to be recorded as a warning but got %v", parsed.Warnings)
+	}
+	parsed = File{}
+	err = Unmarshal(tampered, &parsed, SkipContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyEntryHashesMismatch(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.AddEntryHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddContent([]byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"), "/foo/baz", 0600)
+	err = m.VerifyEntryHashes()
+	if !errors.Is(err, ErrEntryHashMismatch) {
+		t.Fatalf("expected an unlisted entry to fail with %q but got %v", ErrEntryHashMismatch, err)
+	}
+	err = m.RemoveEntry("/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.VerifyEntryHashes()
+	if !errors.Is(err, ErrEntryHashMismatch) {
+		t.Fatalf("expected a missing entry to fail with %q but got %v", ErrEntryHashMismatch, err)
+	}
+}
+
+func TestParseEntryHashesErrors(t *testing.T) {
+	digest := make([]byte, sha256.Size)
+	for i, data := range [][]byte{
+		digest,
+		append(append([]byte{}, digest...), "name"...),
+		append(append([]byte{}, digest...), 0),
+	} {
+		_, err := ParseEntryHashes(data)
+		if !errors.Is(err, errMalformedEntryHashes) {
+			t.Fatalf("testcase %d: expected to fail with %q but got %v", i, errMalformedEntryHashes, err)
+		}
+	}
+	m := New()
+	for i, hashes := range []EntryHashes{
+		{{Name: "", SHA256: digest}},
+		{{Name: "a\x00b", SHA256: digest}},
+		{{Name: "/foo", SHA256: digest[:4]}},
+	} {
+		err := m.AddSectionValue(BlockIDEntryHashes, hashes)
+		if !errors.Is(err, errMalformedEntryHashes) {
+			t.Fatalf("testcase %d: expected to fail with %q but got %v", i, errMalformedEntryHashes, err)
+		}
+	}
+}
+
+func TestEntryHashesLimits(t *testing.T) {
+	m := New()
+	err := m.AddContent(bytes.Repeat([]byte("a"), 10000), "/foo/bar", 0600, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.AddEntryHashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	err = Unmarshal(data, &file, WithLimits(Limits{MaxDecompressedSize: 1000}))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected to fail with %q but got %v", ErrLimitExceeded, err)
+	}
+}
+
+func TestEntryHashesDuplicates(t *testing.T) {
+	// the section only lists foo, with the digest of the first entry
+	digest := sha256.Sum256([]byte("1111"))
+	m := New()
+	m.AddAdditionalSection(EntryHashes{{Name: "foo", SHA256: digest[:]}}.Bytes(), BlockIDEntryHashes)
+	m.AddContent([]byte("1111"), "foo", 0600)
+	m.AddContent([]byte("2222"), "bar", 0600)
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input = bytes.Replace(input, []byte("bar\x00"), []byte("foo\x00"), 1)
+
+	testCases := []struct {
+		policy DuplicatePolicy
+		err    error
+	}{
+		{DuplicatesFail, ErrDuplicateEntry},
+		{DuplicatesKeepFirst, nil},
+		{DuplicatesKeepLast, ErrEntryHashMismatch},
+		{DuplicatesRename, ErrEntryHashMismatch},
+	}
+	for i, testCase := range testCases {
+		var file File
+		err := Unmarshal(input, &file, OnDuplicates(testCase.policy))
+		if !errors.Is(err, testCase.err) {
+			t.Fatalf("testcase %d: expected to fail with %v but got %v", i, testCase.err, err)
+		}
+	}
+}
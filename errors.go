@@ -3,6 +3,8 @@ package mar
 import (
 	"errors"
 	"fmt"
+	"io"
+	"os"
 )
 
 var (
@@ -26,35 +28,200 @@ var (
 
 	// additional data have a max size of 10MB
 	limitMaxAdditionalDataSize uint32 = 10485760
+
+	// Firefox rejects files with more than 8 signatures
+	// at modules/libmar/src/mar_private.h#32
+	limitMaxSignatures uint32 = 8
+
+	// Firefox only reads the product information block, so we
+	// don't expect more than a handful of additional sections
+	limitMaxAdditionalSections uint32 = 16
+
+	// a full Firefox update has a few thousand entries
+	limitMaxIndexEntries uint32 = 100000
+
+	// entries of a Firefox update decompress to a few hundred MB at most
+	limitMaxDecompressedSize uint64 = 1073741824
+
+	// mapped files don't use the heap, so OpenMapped accepts files well
+	// above the 4GB the 32 bits offsets of the index can address
+	limitMaxMappedFileSize uint64 = 1<<33 - 1
 )
 
+// Errors returned by the package belong to one of the following classes,
+// which can be tested with errors.Is to branch on the type of failure
 var (
-	errBadMarID                 = errors.New("mar ID must be MAR1")
+	// ErrTruncated is returned when the input ends before a MAR file does
+	ErrTruncated = errors.New("mar: truncated input")
+	// ErrBadMarID is returned when the input does not start with MAR1
+	ErrBadMarID = errors.New("mar: bad mar id")
+	// ErrMalformedHeader is returned when the headers, signatures or
+	// additional sections of a MAR file are inconsistent
+	ErrMalformedHeader = errors.New("mar: malformed header")
+	// ErrMalformedIndex is returned when the index or the name of an
+	// entry is invalid
+	ErrMalformedIndex = errors.New("mar: malformed index")
+	// ErrDuplicateEntry is returned when several entries have the same name
+	ErrDuplicateEntry = errors.New("mar: duplicate entry")
+	// ErrOffsetOutOfBounds is returned when an offset or a size points
+	// outside of the input
+	ErrOffsetOutOfBounds = errors.New("mar: offset out of bounds")
+	// ErrOverlappingContent is returned when the content of an entry
+	// overlaps another entry, the headers or the index
+	ErrOverlappingContent = errors.New("mar: overlapping content")
+	// ErrLimitExceeded is returned when a MAR file exceeds the limits
+	// of the parser, in which case the error is a *LimitError
+	ErrLimitExceeded = errors.New("mar: limit exceeded")
+	// ErrChannelMismatch is returned when the MAR channel IDs of a MAR
+	// file are not accepted, in which case the error is a *ChannelError
+	ErrChannelMismatch = errors.New("mar: channel mismatch")
+	// ErrEntryHashMismatch is returned when the content of an entry does
+	// not match the digest of the entry hashes section of its MAR file
+	ErrEntryHashMismatch = errors.New("mar: entry hash mismatch")
+)
+
+var (
+	errBadMarID                 = newClassError(ErrBadMarID, "mar ID must be MAR1")
 	errOffsetTooSmall           = errors.New("offset to index is too small to be valid")
 	errBadSigAlg                = errors.New("bad signature algorithm")
-	errInputTooShort            = errors.New("refusing to read more bytes than present in input")
-	errMalformedFileSize        = errors.New("the total file size does not match offset + index size")
-	errTooSmall                 = errors.New("the total file is below the minimum allowed of 32 bytes")
-	errTooBig                   = errors.New("the total file exceeds the maximum allowed of 500MB")
-	errSignatureTooBig          = errors.New("signature exceeds maximum allowed of 2048 bytes")
-	errSignatureUnknown         = errors.New("signature algorithm is unknown")
-	errAdditionalDataTooBig     = errors.New("additional data exceeds maximum allowed of 10MB")
-	errMalformedIndexFileName   = errors.New("malformed index is missing null terminator in file name")
-	errMalformedContentOverrun  = errors.New("malformed content offset and size overrun the end of the file")
-	errIndexFileNameTooBig      = errors.New("index file name exceeds the maximum length of 1024 characters")
-	errIndexFileNameOverrun     = errors.New("the length of the index file overruns the end of the file")
-	errIndexTooSmall            = errors.New("the index is smaller than the minimum allowed length of 12 bytes")
-	errIndexBadContentReference = errors.New("index entry references to content that does not exist")
-	errCursorStartAlreadyRead   = errors.New("start position has already been read in a previous chunk")
-	errCursorEndAlreadyRead     = errors.New("end position has already been read in a previous chunk")
-	errDupContent               = errors.New("a content entry with that name already exists")
+	errEmptySignature           = errors.New("signature data is empty")
+	errSignatureIndex           = errors.New("signature index is out of range")
+	errProductChannelTooLong    = errors.New("product information channel IDs are longer than 63 bytes")
+	errProductVersionTooLong    = errors.New("product information version is longer than 31 bytes")
+	errNoManifest               = errors.New("the file has no updatev3.manifest or update.manifest entry")
+	errBadDetachedSignature     = errors.New("detached signature must be a MAR SIGNATURE PEM block with an Algorithm-Id header")
+	errHashUnavailable          = errors.New("the hash function is not linked into the binary")
+	errUnknownChecksumFormat    = errors.New("checksum manifest format must be json or sums")
+	errEntryNotFound            = errors.New("the index has no entry with that name")
+	errInputTooShort            = newClassError(ErrTruncated, "refusing to read more bytes than present in input")
+	errMalformedFileSize        = newClassError(ErrMalformedHeader, "the total file size does not match offset + index size")
+	errTooSmall                 = newClassError(ErrTruncated, "the total file is below the minimum allowed of 32 bytes")
+	errTooBig                   = newClassError(ErrLimitExceeded, "the total file exceeds the maximum allowed of 500MB")
+	errSignatureUnknown         = newClassError(ErrMalformedHeader, "signature algorithm is unknown")
+	errAdditionalDataTooSmall   = newClassError(ErrMalformedHeader, "additional section block size is smaller than its header")
+	errMalformedIndexFileName   = newClassError(ErrMalformedIndex, "malformed index is missing null terminator in file name")
+	errMalformedContentOverrun  = newClassError(ErrOffsetOutOfBounds, "malformed content offset and size overrun the end of the file")
+	errIndexFileNameTooBig      = newClassError(ErrMalformedIndex, "index file name exceeds the maximum length of 1024 characters")
+	errIndexFileNameOverrun     = newClassError(ErrMalformedIndex, "the length of the index file overruns the end of the file")
+	errIndexTooSmall            = newClassError(ErrMalformedIndex, "the index is smaller than the minimum allowed length of 12 bytes")
+	errIndexBadContentReference = newClassError(ErrMalformedIndex, "index entry references to content that does not exist")
+	errCursorStartAlreadyRead   = newClassError(ErrOverlappingContent, "start position has already been read in a previous chunk")
+	errCursorEndAlreadyRead     = newClassError(ErrOverlappingContent, "end position has already been read in a previous chunk")
+	errCursorChunkAlreadyRead   = newClassError(ErrOverlappingContent, "chunk contains a previous chunk that has already been read")
+	errDupContent               = newClassError(ErrDuplicateEntry, "a content entry with that name already exists")
+	errSignatureSizeMismatch    = errors.New("signature data length does not match the signature size")
+	errEmptyFileName            = newClassError(ErrMalformedIndex, "content entries must have a non-empty file name")
+	errNoSignature              = errors.New("the file has no signature to verify")
+	errWriterStarted            = errors.New("additional sections must be added before the first entry")
+	errWriterClosed             = errors.New("the writer is already closed")
+	errMappedFileClosed         = errors.New("the mapped file is already closed")
+	errMappedFileTooLarge       = newClassError(ErrLimitExceeded, "the file is too large to be mapped in memory on this platform")
+	errContentOverlapsHeaders   = newClassError(ErrOverlappingContent, "index entry content overlaps the headers or signatures")
+	errContentOverlapsIndex     = newClassError(ErrOverlappingContent, "index entry content overlaps the index")
+	errContentOverlap           = newClassError(ErrOverlappingContent, "index entries have overlapping content")
+	errIndexSizeMismatch        = newClassError(ErrMalformedIndex, "the index header size does not match the size of the index entries")
+	errContentGap               = newClassError(ErrMalformedIndex, "the content of the entries does not fill the space between headers and index")
+	errNumSignaturesMismatch    = newClassError(ErrMalformedHeader, "the signatures header does not match the number of signatures")
+	errNumSectionsMismatch      = newClassError(ErrMalformedHeader, "the additional sections header does not match the number of additional sections")
+	errBlockSizeMismatch        = newClassError(ErrMalformedHeader, "additional section block size does not match the size of its data")
+	errIndexOverlapsHeaders     = newClassError(ErrOffsetOutOfBounds, "offset to index points inside the headers")
+	errContentSizeMismatch      = newClassError(ErrMalformedIndex, "index entry size does not match the size of its content")
+	errNegativeReadLen          = newClassError(ErrOffsetOutOfBounds, "refusing to read a negative number of bytes")
+	errOffsetOverflow           = newClassError(ErrOffsetOutOfBounds, "offset and length overflow the range of positions in the input")
+	errBadCodec                 = errors.New("codecs must have a name, a magic number or match function, and a reader")
+	errUnknownCompression       = errors.New("no codec is registered for the compression format")
+	errCodecCannotCompress      = errors.New("the codec of the compression format can only decompress")
+	errSignatureSlotSize        = errors.New("the size of rsa signatures must be set to the size of the key")
+	errSignatureCountMismatch   = errors.New("the number of signatures does not match the number of signature entries")
+	errBadSectionType           = errors.New("section types must have a name, a parse and a serialize function")
+	errUnknownSectionType       = errors.New("no section type is registered for the block ID")
+	errMalformedProductInfo     = errors.New("product information block must hold channel IDs and a version, each terminated by a null byte")
+	errRangeNotSupported        = errors.New("the server does not support range requests")
+	errBadContentRange          = errors.New("the server returned an invalid Content-Range header")
+	errRemoteChanged            = errors.New("the remote file changed while it was being read")
+	errBadSignatureAlgorithm    = errors.New("signature algorithms must have a name, an available hash function and a verify function")
+	errCannotSign               = errors.New("the signature algorithm can only verify")
+	errMalformedEcdsaSignature  = errors.New("ecdsa signature must hold positive R and S values")
+	errNoPublicKey              = errors.New("no public key or certificate found")
+	errNoCertificate            = errors.New("no certificate found")
+	errCBORTruncated            = errors.New("cbor: data item overruns the end of the data")
+	errMalformedCOSE            = errors.New("malformed COSE signature section")
+	errNoCOSESignature          = errors.New("the file has no COSE signature")
+	errUnknownCOSEAlgorithm     = errors.New("unsupported COSE algorithm")
+	errCOSEPayloadMismatch      = errors.New("the payload of the COSE signature does not match the content of the file")
+	errCertificateKeyUsage      = errors.New("the key usage of the certificate does not allow digital signatures")
+	errMalformedTimestamp       = errors.New("malformed timestamp token")
+	errNoTimestamp              = errors.New("the file has no timestamp")
+	errTimestampMismatch        = errors.New("the message imprint of the timestamp does not match the content of the file")
+	errMalformedEntryHashes     = errors.New("malformed entry hashes section")
+	errNoEntryHashes            = errors.New("the file has no entry hashes section")
+	errUnknownDataEncoding      = errors.New("data encoding must be summary, base64, hex or none")
+	errMalformedYAMLData        = errors.New("binary data must be encoded in base64, or in hex with a hex: prefix")
+	errFileNameTooLong          = newClassError(ErrMalformedIndex, "file name exceeds the maximum length")
+	errFileNameNotUTF8          = newClassError(ErrMalformedIndex, "file name is not valid UTF-8")
+	errFileNameControlChar      = newClassError(ErrMalformedIndex, "file name contains control characters")
+	errFileNameWindows          = newClassError(ErrMalformedIndex, "file name is not valid on Windows")
+	errPathNotAllowed           = errors.New("path is not under any of the allowed prefixes")
+	errSymlink                  = errors.New("symbolic links are not allowed")
 )
 
+// classError is an error of the package that belongs to
+// one of the exported classes of errors
+type classError struct {
+	msg   string
+	class error
+}
+
+func newClassError(class error, msg string) error {
+	return &classError{msg: msg, class: class}
+}
+
+func (e *classError) Error() string {
+	return e.msg
+}
+
+func (e *classError) Unwrap() error {
+	return e.class
+}
+
+// ParseError is returned when a MAR file fails to parse, and
+// indicates where in the input the failure occurred
+type ParseError struct {
+	// Section is the part of the file being parsed, like "index entry"
+	Section string
+	// Offset is the position in the input where the failure occurred
+	Offset uint64
+	// Err is the cause of the failure, which belongs to one of
+	// the classes of errors of the package
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s parsing failed at offset %d: %v", e.Section, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 // change that at runtime by setting -ldflags "-X go.mozilla.org/mar.debug=true"
+// to write debug traces to stderr
 var debug = "false"
 
-func debugPrint(format string, a ...interface{}) {
+// debugWriter is the default writer of the debug traces, set when the
+// package is built with debug set to true. The WithDebugWriter option
+// replaces it.
+var debugWriter io.Writer
+
+func init() {
 	if debug == "true" {
-		fmt.Printf(format, a...)
+		debugWriter = os.Stderr
+	}
+}
+
+// debugf writes a debug trace to w, unless it is nil
+func debugf(w io.Writer, format string, a ...interface{}) {
+	if w != nil {
+		fmt.Fprintf(w, format, a...)
 	}
 }
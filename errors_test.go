@@ -1,9 +1,122 @@
 package mar
 
-import "testing"
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
 
 func TestDebugPrint(t *testing.T) {
-	debug = "true"
-	debugPrint("debug is %s\n", debug)
-	debug = "false"
+	buf := new(bytes.Buffer)
+	debugf(buf, "debug is %s\n", "enabled")
+	debugf(nil, "debug is %s\n", "disabled")
+	if buf.String() != "debug is enabled\n" {
+		t.Fatalf("expected debug output %q but got %q", "debug is enabled\n", buf.String())
+	}
+}
+
+func TestDebugUnmarshal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	var m File
+	err := Unmarshal([]byte("MAR1"), &m, WithDebugWriter(buf))
+	if err != errTooSmall {
+		t.Fatalf("expected to fail with %q but got %v", errTooSmall, err)
+	}
+	if buf.Len() == 0 {
+		t.Fatal("expected debug output from unmarshal but got none")
+	}
+	buf.Reset()
+	_, err = NewReader(bytes.NewReader(miniMarB), int64(len(miniMarB)), WithLimits(Limits{MaxTotalSize: 100}), WithDebugWriter(buf))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected to fail with %q but got %v", ErrLimitExceeded, err)
+	}
+	if !strings.Contains(buf.String(), "MaxTotalSize") {
+		t.Fatalf("expected a trace of the limit from the reader but got %q", buf.String())
+	}
+	buf.Reset()
+	_, err = ReadFrom(bytes.NewReader(miniMarB), WithLimits(Limits{MaxTotalSize: 100}), WithDebugWriter(buf))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected to fail with %q but got %v", ErrLimitExceeded, err)
+	}
+	if !strings.Contains(buf.String(), "MaxTotalSize") {
+		t.Fatalf("expected a trace of the limit from the stream but got %q", buf.String())
+	}
+
+	// lenient warnings and the methods of the file are traced as well
+	buf.Reset()
+	m = File{}
+	err = Unmarshal(append(append([]byte{}, miniMarB...), "trailing data"...), &m, Lenient(), WithDebugWriter(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "warning: ") {
+		t.Fatalf("expected a trace of the warning but got %q", buf.String())
+	}
+	buf.Reset()
+	signed := New(WithDebugWriter(buf))
+	signed.AddContent([]byte("caribou"), "foo", 0600)
+	err = signed.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signed.VerifySignature(rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "found valid") {
+		t.Fatalf("expected a trace of the verification but got %q", buf.String())
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	var m File
+	err := Unmarshal(miniMarB[:len(miniMarB)-10], &m)
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected to fail with %q but got %v", ErrTruncated, err)
+	}
+
+	badID := make([]byte, len(miniMarB))
+	copy(badID, miniMarB)
+	copy(badID, "MAR2")
+	var badIDMar File
+	err = Unmarshal(badID, &badIDMar)
+	if !errors.Is(err, ErrBadMarID) {
+		t.Fatalf("expected to fail with %q but got %v", ErrBadMarID, err)
+	}
+
+	dup := New()
+	dup.AddContent([]byte("foo"), "foo", 0644)
+	err = dup.AddContent([]byte("bar"), "foo", 0644)
+	if !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("expected to fail with %q but got %v", ErrDuplicateEntry, err)
+	}
+
+	var limited File
+	err = Unmarshal(miniMarB, &limited, WithLimits(Limits{MaxTotalSize: 100}))
+	var lerr *LimitError
+	if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &lerr) {
+		t.Fatalf("expected to fail with a limit error but got %v", err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	// truncate the file in the middle of the signature data
+	var m File
+	input := make([]byte, len(miniMarB))
+	copy(input, miniMarB)
+	// announce a signature larger than what the file contains
+	input[MarIDLen+OffsetToIndexLen+FileSizeLen+SignaturesHeaderLen+7] = 0xFF
+	err := Unmarshal(input, &m)
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected to fail with a parse error but got %v", err)
+	}
+	if perr.Section != "signature data" {
+		t.Fatalf("expected parse error in section %q but got %q", "signature data", perr.Section)
+	}
+	if !errors.Is(err, ErrOverlappingContent) && !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected parse error to wrap a classified error but got %v", perr.Err)
+	}
 }
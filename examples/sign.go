@@ -19,7 +19,7 @@ import (
 func main() {
 	var file, refile mar.File
 	if len(os.Args) < 3 {
-		log.Fatal("usage: %s <input mar> <output mar>", os.Args[0])
+		log.Fatalf("usage: %s <input mar> <output mar>", os.Args[0])
 	}
 	input, err := ioutil.ReadFile(os.Args[1])
 	if err != nil {
@@ -38,10 +38,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	file.PrepareSignature(rsaKey, rsaKey.Public())
-
-	// once both keys are added to the file, finalize the signature
-	err = file.FinalizeSignatures()
+	err = file.Sign(rand.Reader, rsaKey, mar.SigAlgRsaPkcs1Sha384)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,79 @@
+package mar
+
+import (
+	"fmt"
+	"io"
+)
+
+// explainMaxLines is the number of hexdump lines Explain prints for
+// each region, beyond which the rest of the region is elided
+const explainMaxLines = 4
+
+// Explain parses the MAR file in input with the options, then writes an
+// annotated hexdump of input to w where each byte range is labeled with
+// the field it belongs to. Bytes that belong to no field, such as the gaps
+// between entries or data after the index, are labeled as slack. Only the
+// first lines of large ranges are printed. The Lenient option helps with
+// explaining archives that are slightly corrupted.
+func Explain(w io.Writer, input []byte, opts ...Option) error {
+	var file File
+	err := Unmarshal(input, &file, append(opts, SkipContent())...)
+	if err != nil {
+		return err
+	}
+	var pos uint64
+	size := uint64(len(input))
+	for _, r := range file.Layout() {
+		if r.Start >= size {
+			break
+		}
+		if r.End > size {
+			r.End = size
+		}
+		err = explainRange(w, input, r.Start, r.End, r.Name)
+		if err != nil {
+			return err
+		}
+		if r.End > pos {
+			pos = r.End
+		}
+	}
+	if size > pos {
+		return explainRange(w, input, pos, size, "slack")
+	}
+	return nil
+}
+
+// explainRange writes the hexdump of input[start:end] labeled with name
+func explainRange(w io.Writer, input []byte, start, end uint64, name string) error {
+	_, err := fmt.Fprintf(w, "%s (%d bytes)\n", name, end-start)
+	if err != nil {
+		return err
+	}
+	for line := 0; start < end; line++ {
+		if line == explainMaxLines {
+			_, err = fmt.Fprintf(w, "  ... %d more bytes\n", end-start)
+			return err
+		}
+		n := end - start
+		if n > 16 {
+			n = 16
+		}
+		chunk := input[start : start+n]
+		hex := ""
+		ascii := make([]byte, len(chunk))
+		for i, b := range chunk {
+			hex += fmt.Sprintf("%02x ", b)
+			ascii[i] = '.'
+			if b >= 0x20 && b < 0x7f {
+				ascii[i] = b
+			}
+		}
+		_, err = fmt.Fprintf(w, "  %08x  %-48s |%s|\n", start, hex, ascii)
+		if err != nil {
+			return err
+		}
+		start += n
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	m := New()
+	err := m.SetProductInformation("62.0", "firefox-mozilla-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddContent(bytes.Repeat([]byte("a"), 100), "foo", 0644)
+	m.AddContent([]byte("bar content"), "bar", 0644)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Sign(rand.Reader, key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = Explain(&buf, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"MAR ID (4 bytes)\n  00000000  4d 41 52 31 ",
+		"offset to index (4 bytes)\n  00000004  ",
+		"number of signatures (4 bytes)",
+		"signature 0 data, RSA-PKCS1v15-SHA384 (256 bytes)",
+		"additional section 0 data (96 bytes)",
+		"content of \"foo\" (100 bytes)",
+		"  ... 36 more bytes\n",
+		"content of \"bar\" (11 bytes)",
+		"|bar content|",
+		"index entry for \"bar\" name (4 bytes)",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected %q in explained output:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "slack") {
+		t.Fatalf("unexpected slack in explained output:\n%s", out)
+	}
+}
+
+func TestExplainSlack(t *testing.T) {
+	var buf bytes.Buffer
+	err := Explain(&buf, rawMar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "slack (") {
+		t.Fatalf("expected slack in explained output:\n%s", buf.String())
+	}
+}
+
+func TestExplainInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	err := Explain(&buf, []byte("MAR1"))
+	if err == nil {
+		t.Fatal("expected an error explaining a truncated file")
+	}
+}
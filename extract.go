@@ -0,0 +1,104 @@
+package mar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ExtractAll writes the content of every entry of the MAR file into the
+// destination directory, creating intermediate directories as needed and
+// applying the permission flags of the index to each file. Compressed entries
+// are decompressed before being written. The names of entries are checked
+// against the PathPolicy of the WithPathPolicy option, or DefaultPathPolicy,
+// before anything is written, such that a malicious MAR cannot write outside
+// of the destination directory. The policy also decides what happens to
+// entries that would be written through a symbolic link.
+// With the WithProgress option, progress is counted in bytes of the content
+// of the entries as stored in the MAR, before decompression. With the
+// WithConcurrency option, entries are decompressed and written in parallel.
+func (file *File) ExtractAll(destDir string, opts ...Option) error {
+	o := newOptions(opts)
+	policy := o.pathPolicyOrDefault()
+	last := make(map[string]int, len(file.Index))
+	for i, idx := range file.Index {
+		if _, ok := file.Content[idx.FileName]; !ok {
+			return errIndexBadContentReference
+		}
+		err := policy.CheckName(idx.FileName)
+		if err != nil {
+			return err
+		}
+		last[extractPath(destDir, idx.FileName)] = i
+	}
+	// entries that resolve to the same path are only written once, with
+	// the content and flags of their last index entry, such that two
+	// goroutines never write to the same file
+	var (
+		jobs  []IndexEntry
+		total uint64
+	)
+	for i, idx := range file.Index {
+		path := extractPath(destDir, idx.FileName)
+		if last[path] != i {
+			continue
+		}
+		if policy.Symlinks != SymlinksFollow {
+			link, err := findSymlink(destDir, path)
+			if err != nil {
+				return err
+			}
+			if link != "" && policy.Symlinks == SymlinksReject {
+				return fmt.Errorf("%w: entry %q would be written through %q", errSymlink, idx.FileName, link)
+			}
+			if link != "" {
+				continue
+			}
+		}
+		jobs = append(jobs, idx)
+		total += uint64(len(file.Content[idx.FileName].Data))
+	}
+	prog := newProgress(o.progress, total)
+	return forEach(len(jobs), o.concurrency, func(i int) error {
+		idx := jobs[i]
+		path := extractPath(destDir, idx.FileName)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		data, err := file.Content[idx.FileName].Decompressed()
+		if err != nil {
+			return fmt.Errorf("failed to decompress %q: %w", idx.FileName, err)
+		}
+		err = writeFile(path, data, idx.FileMode())
+		if err != nil {
+			return err
+		}
+		prog.add(uint64(len(file.Content[idx.FileName].Data)), idx.FileName)
+		return nil
+	})
+}
+
+// extractPath returns the path an entry is extracted to
+func extractPath(destDir, name string) string {
+	return filepath.Join(destDir, filepath.FromSlash(name))
+}
+
+// writeFile writes data to path and sets its permissions to perm
+// regardless of the umask of the process
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(data)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	err = fd.Close()
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
@@ -0,0 +1,76 @@
+package mar
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractAll(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "foo/baz/qux", 0755)
+	m.AddContent([]byte("ghijk"), "toplevel", 0644)
+
+	destDir, err := ioutil.TempDir("", "margo_extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(destDir)
+	err = m.ExtractAll(destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range m.Index {
+		path := filepath.Join(destDir, filepath.FromSlash(idx.FileName))
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, m.Content[idx.FileName].Data) {
+			t.Fatalf("expected file %q to contain %q but found %q", path, m.Content[idx.FileName].Data, data)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != os.FileMode(idx.Flags) {
+			t.Fatalf("expected file %q to have mode %s but found %s", path, os.FileMode(idx.Flags), fi.Mode().Perm())
+		}
+	}
+}
+
+func TestExtractAllTraversal(t *testing.T) {
+	for _, name := range []string{
+		"/etc/passwd",
+		"../../etc/passwd",
+		"foo/../../bar",
+		"foo/..",
+		`..\..\windows\system32`,
+		`\windows\system32`,
+	} {
+		m := New()
+		m.AddContent([]byte("pwned"), "foo/bar", 0600)
+		m.AddContent([]byte("pwned"), name, 0600)
+
+		destDir, err := ioutil.TempDir("", "margo_extract")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(destDir)
+		err = m.ExtractAll(destDir)
+		if err == nil {
+			t.Fatalf("expected extraction of %q to fail but it succeeded", name)
+		}
+		// nothing should have been written
+		files, err := ioutil.ReadDir(destDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 0 {
+			t.Fatalf("expected no file to be extracted with entry %q but found %d", name, len(files))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package mar
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// UnmarshalFile reads the MAR file at path and parses it into file, with
+// the same options as Unmarshal. The size of the file is checked against
+// the limits of the parser before it is read.
+func UnmarshalFile(path string, file *File, opts ...Option) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(fi.Size())
+	if size < limitMinFileSize {
+		return errTooSmall
+	}
+	o := newOptions(opts)
+	err = checkLimit(o.debug, "MaxTotalSize", size, o.limits.MaxTotalSize)
+	if err != nil {
+		return err
+	}
+	input := make([]byte, size)
+	_, err = io.ReadFull(fd, input)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(input, file, opts...)
+}
+
+// MarshalToFile marshals the MAR file with the same options as Marshal
+// and writes it to path with the permissions perm. The output is written
+// to a temporary file in the same directory which is then renamed to path,
+// such that path never holds a partially written file.
+func (file *File) MarshalToFile(path string, perm os.FileMode, opts ...Option) error {
+	output, err := file.Marshal(opts...)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, output, perm)
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of path
+// and renames it to path once it is complete
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// remove the temporary file if anything fails, this is
+	// a no-op once it has been renamed
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
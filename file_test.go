@@ -0,0 +1,104 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarshalToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.mar")
+	err = ioutil.WriteFile(path, []byte("previous content"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := New()
+	m.AddContent([]byte("content"), "foo", 0644)
+	err = m.MarshalToFile(path, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Fatalf("expected permissions 0640, got %s", fi.Mode())
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected the temporary file to be renamed, found %d files", len(files))
+	}
+
+	var reparsed File
+	err = UnmarshalFile(path, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reparsed.Content["foo"].Data, []byte("content")) {
+		t.Fatalf("unexpected content %q", reparsed.Content["foo"].Data)
+	}
+}
+
+func TestUnmarshalFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var m File
+	err = UnmarshalFile(filepath.Join(dir, "missing.mar"), &m)
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+
+	path := filepath.Join(dir, "test.mar")
+	err = ioutil.WriteFile(path, miniMarB, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UnmarshalFile(path, &m, WithLimits(Limits{MaxTotalSize: 100}))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected error %v, got %v", ErrLimitExceeded, err)
+	}
+
+	err = ioutil.WriteFile(path, []byte("MAR1"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UnmarshalFile(path, &m)
+	if err != errTooSmall {
+		t.Fatalf("expected error %v, got %v", errTooSmall, err)
+	}
+}
+
+func TestMarshalToFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := New()
+	m.MarID = "FOO1"
+	path := filepath.Join(dir, "test.mar")
+	err = m.MarshalToFile(path, 0644)
+	if err != errBadMarID {
+		t.Fatalf("expected error %v, got %v", errBadMarID, err)
+	}
+	_, err = os.Stat(path)
+	if !os.IsNotExist(err) {
+		t.Fatal("expected no file to be written")
+	}
+}
@@ -0,0 +1,33 @@
+package mar
+
+import "os"
+
+// Permission flags of the entries of Firefox updates, which the updater
+// applies to the files it writes
+const (
+	// FlagsRegular is the permissions of regular files, rw-r--r--
+	FlagsRegular uint32 = 0644
+	// FlagsExecutable is the permissions of executables, rwxr-xr-x
+	FlagsExecutable uint32 = 0755
+)
+
+// FileMode returns the permission bits of the flags of the entry
+func (h IndexEntryHeader) FileMode() os.FileMode {
+	return os.FileMode(h.Flags).Perm()
+}
+
+// IsExecutable returns true if any of the execute bits of the flags is set
+func (h IndexEntryHeader) IsExecutable() bool {
+	return h.Flags&0111 != 0
+}
+
+// SetExecutable sets the execute bits of the flags for everyone who can
+// read the entry, such that FlagsRegular becomes FlagsExecutable, or clears
+// all the execute bits when executable is false
+func (h *IndexEntryHeader) SetExecutable(executable bool) {
+	if executable {
+		h.Flags |= (h.Flags & 0444) >> 2
+	} else {
+		h.Flags &^= 0111
+	}
+}
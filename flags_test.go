@@ -0,0 +1,34 @@
+package mar
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	idx := IndexEntry{IndexEntryHeader{Flags: FlagsRegular}, "/foo/bar"}
+	if idx.FileMode() != os.FileMode(0644) || idx.IsExecutable() {
+		t.Fatalf("unexpected mode %s", idx.FileMode())
+	}
+	idx.SetExecutable(true)
+	if idx.Flags != FlagsExecutable || !idx.IsExecutable() {
+		t.Fatalf("expected flags %o but got %o", FlagsExecutable, idx.Flags)
+	}
+	idx.SetExecutable(false)
+	if idx.Flags != FlagsRegular {
+		t.Fatalf("expected flags %o but got %o", FlagsRegular, idx.Flags)
+	}
+
+	// only the readers of the entry can execute it
+	idx.Flags = 0640
+	idx.SetExecutable(true)
+	if idx.Flags != 0750 {
+		t.Fatalf("expected flags 0750 but got %o", idx.Flags)
+	}
+
+	// bits above the permissions are not part of the mode
+	idx.Flags = 0100755
+	if idx.FileMode() != os.FileMode(0755) {
+		t.Fatalf("expected mode -rwxr-xr-x but got %s", idx.FileMode())
+	}
+}
@@ -0,0 +1,68 @@
+package mar
+
+import (
+	"crypto"
+	"hash"
+	"io"
+	"os"
+)
+
+// HashFile returns the digest of the file at path using the hash function
+// h, such as crypto.SHA512 for the hash update servers publish. The file
+// is read in chunks rather than loaded in memory.
+func HashFile(path string, h crypto.Hash) ([]byte, error) {
+	hw, err := NewHashWriter(nil, h)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	_, err = copyBuffer(hw, fd)
+	if err != nil {
+		return nil, err
+	}
+	return hw.Sum(), nil
+}
+
+// HashWriter hashes everything written through it, such that the digest
+// of a MAR file can be computed while it is downloaded or created without
+// reading it again
+type HashWriter struct {
+	w  io.Writer
+	md hash.Hash
+	n  int64
+}
+
+// NewHashWriter returns a HashWriter that hashes with h and passes the
+// data on to w. w may be nil to only compute the digest.
+func NewHashWriter(w io.Writer, h crypto.Hash) (*HashWriter, error) {
+	if !h.Available() {
+		return nil, errHashUnavailable
+	}
+	return &HashWriter{w: w, md: h.New()}, nil
+}
+
+// Write writes p to the underlying writer and hashes the bytes that were
+// written
+func (hw *HashWriter) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if hw.w != nil {
+		n, err = hw.w.Write(p)
+	}
+	hw.md.Write(p[:n])
+	hw.n += int64(n)
+	return n, err
+}
+
+// Sum returns the digest of the data written so far
+func (hw *HashWriter) Sum() []byte {
+	return hw.md.Sum(nil)
+}
+
+// Size returns the number of bytes written so far
+func (hw *HashWriter) Size() int64 {
+	return hw.n
+}
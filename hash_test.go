@@ -0,0 +1,77 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	path := filepath.Join(dir, "test.mar")
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := HashFile(path, crypto.SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha512.Sum512(data)
+	if !bytes.Equal(sum, expected[:]) {
+		t.Fatalf("expected sha512 %x, got %x", expected, sum)
+	}
+	sum, err = HashFile(path, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected256 := sha256.Sum256(data)
+	if !bytes.Equal(sum, expected256[:]) {
+		t.Fatalf("expected sha256 %x, got %x", expected256, sum)
+	}
+	_, err = HashFile(filepath.Join(dir, "missing.mar"), crypto.SHA512)
+	if err == nil {
+		t.Fatal("expected an error hashing a missing file")
+	}
+}
+
+func TestHashWriter(t *testing.T) {
+	var buf bytes.Buffer
+	hw, err := NewHashWriter(&buf, crypto.SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(hw)
+	err = w.AddFile("/foo/bar", bytes.NewReader([]byte("cccccccccccccc")), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha512.Sum512(buf.Bytes())
+	if !bytes.Equal(hw.Sum(), expected[:]) {
+		t.Fatalf("expected sha512 %x, got %x", expected, hw.Sum())
+	}
+	if hw.Size() != int64(buf.Len()) {
+		t.Fatalf("expected size %d, got %d", buf.Len(), hw.Size())
+	}
+}
+
+func TestHashWriterUnavailable(t *testing.T) {
+	_, err := NewHashWriter(nil, crypto.Hash(0))
+	if err != errHashUnavailable {
+		t.Fatalf("expected error %v, got %v", errHashUnavailable, err)
+	}
+}
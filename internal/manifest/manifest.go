@@ -0,0 +1,209 @@
+// Package manifest implements the parsing and formatting of update
+// manifests, shared by the mar package and the public manifest package
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Names of the manifest entries in MAR files
+const (
+	// V3Name is the name of the manifest of recent MAR files
+	V3Name = "updatev3.manifest"
+	// V2Name is the name of the manifest of older MAR files
+	V2Name = "update.manifest"
+)
+
+// Types of update
+const (
+	// TypeComplete is the type of an update that contains every file
+	TypeComplete = "complete"
+	// TypePartial is the type of an update that patches files
+	TypePartial = "partial"
+)
+
+// Op is an operation of the manifest
+type Op string
+
+// Operations of the manifest
+const (
+	// OpAdd adds a file from the MAR
+	OpAdd Op = "add"
+	// OpAddIf adds a file from the MAR if the test path exists
+	OpAddIf Op = "add-if"
+	// OpAddIfNot adds a file from the MAR if the test path does not exist
+	OpAddIfNot Op = "add-if-not"
+	// OpPatch patches a file with a patch from the MAR
+	OpPatch Op = "patch"
+	// OpPatchIf patches a file with a patch from the MAR if the test path exists
+	OpPatchIf Op = "patch-if"
+	// OpRemove removes a file
+	OpRemove Op = "remove"
+	// OpRmdir removes a directory if it is empty
+	OpRmdir Op = "rmdir"
+	// OpRmrfdir removes a directory and its content
+	OpRmrfdir Op = "rmrfdir"
+)
+
+// args are the names of the arguments of each operation, in order
+var args = map[Op][]string{
+	OpAdd:      {"path"},
+	OpAddIf:    {"test", "path"},
+	OpAddIfNot: {"test", "path"},
+	OpPatch:    {"patch", "path"},
+	OpPatchIf:  {"test", "patch", "path"},
+	OpRemove:   {"path"},
+	OpRmdir:    {"path"},
+	OpRmrfdir:  {"path"},
+}
+
+// Manifest is a parsed update manifest
+type Manifest struct {
+	// Type is the type of update, TypeComplete or TypePartial
+	Type string
+	// Instructions are the operations of the manifest, in order
+	Instructions []Instruction
+}
+
+// Instruction is a single operation of the manifest
+type Instruction struct {
+	// Op is the operation
+	Op Op
+	// Path is the path of the file or directory the operation applies to
+	Path string
+	// Patch is the name of the entry of the MAR holding the patch,
+	// for OpPatch and OpPatchIf
+	Patch string
+	// Test is the path tested by OpAddIf, OpAddIfNot and OpPatchIf
+	Test string
+}
+
+// SyntaxError is returned when a line of the manifest is invalid
+type SyntaxError struct {
+	// Line is the number of the invalid line, starting at 1
+	Line int
+	// Msg describes the error
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("manifest: line %d: %s", e.Line, e.Msg)
+}
+
+// Parse parses an uncompressed update manifest
+func Parse(data []byte) (*Manifest, error) {
+	m := new(Manifest)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		op := Op(fields[0])
+		var rest string
+		if len(fields) == 2 {
+			rest = fields[1]
+		}
+		values, err := parseQuoted(rest)
+		if err != nil {
+			return nil, &SyntaxError{Line: lineNum, Msg: err.Error()}
+		}
+		if op == "type" {
+			if len(values) != 1 {
+				return nil, &SyntaxError{Line: lineNum, Msg: "type expects 1 argument"}
+			}
+			m.Type = values[0]
+			continue
+		}
+		names, ok := args[op]
+		if !ok {
+			return nil, &SyntaxError{Line: lineNum, Msg: fmt.Sprintf("unknown operation %q", op)}
+		}
+		if len(values) != len(names) {
+			return nil, &SyntaxError{Line: lineNum, Msg: fmt.Sprintf("%s expects %d arguments, got %d", op, len(names), len(values))}
+		}
+		inst := Instruction{Op: op}
+		for i, name := range names {
+			switch name {
+			case "path":
+				inst.Path = values[i]
+			case "patch":
+				inst.Patch = values[i]
+			case "test":
+				inst.Test = values[i]
+			}
+		}
+		m.Instructions = append(m.Instructions, inst)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseQuoted returns the values of a list of double quoted arguments
+// separated by spaces
+func parseQuoted(s string) ([]string, error) {
+	var values []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return values, nil
+		}
+		if s[0] != '"' {
+			return nil, fmt.Errorf("argument %q is not quoted", s)
+		}
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return nil, fmt.Errorf("argument %q is not terminated", s)
+		}
+		values = append(values, s[1:end+1])
+		s = s[end+2:]
+	}
+}
+
+// Bytes returns the manifest in the format of the updater. It fails if
+// one of the paths can't be written in a manifest, since it would be
+// parsed back as a different manifest.
+func (m *Manifest) Bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if m.Type != "" {
+		fmt.Fprintf(buf, "type %q\n", m.Type)
+	}
+	for _, inst := range m.Instructions {
+		buf.WriteString(string(inst.Op))
+		for _, name := range args[inst.Op] {
+			var value string
+			switch name {
+			case "path":
+				value = inst.Path
+			case "patch":
+				value = inst.Patch
+			case "test":
+				value = inst.Test
+			}
+			err := CheckPath(value)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(buf, ` "%s"`, value)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// CheckPath verifies a path can be written in a manifest
+func CheckPath(path string) error {
+	if path == "" || strings.ContainsAny(path, "\"\n\r") {
+		return fmt.Errorf("manifest: path %q can't be written in a manifest", path)
+	}
+	return nil
+}
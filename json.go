@@ -0,0 +1,141 @@
+package mar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// DataEncoding is how the binary data of signatures, additional sections
+// and entries is encoded in JSON
+type DataEncoding int
+
+const (
+	// DataSummary replaces binary data with its size and SHA256 digest
+	DataSummary DataEncoding = iota
+	// DataBase64 includes binary data encoded in base64, like the
+	// JSON encoding of a File
+	DataBase64
+	// DataHex includes binary data encoded in hexadecimal
+	DataHex
+	// DataOmit leaves binary data out
+	DataOmit
+)
+
+var dataEncodingNames = map[DataEncoding]string{
+	DataSummary: "summary",
+	DataBase64:  "base64",
+	DataHex:     "hex",
+	DataOmit:    "none",
+}
+
+// String returns the name of the data encoding
+func (enc DataEncoding) String() string {
+	if name, ok := dataEncodingNames[enc]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(enc))
+}
+
+// ParseDataEncoding returns the data encoding of a name returned by String,
+// like "summary" or "hex"
+func ParseDataEncoding(name string) (DataEncoding, error) {
+	for enc, encName := range dataEncodingNames {
+		if encName == name {
+			return enc, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", errUnknownDataEncoding, name)
+}
+
+// DataSummaryJSON is how DataSummary encodes binary data
+type DataSummaryJSON struct {
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// encodeData returns the JSON value of data in an encoding, which is nil
+// when the data is omitted
+func encodeData(data []byte, enc DataEncoding) interface{} {
+	switch enc {
+	case DataBase64:
+		return data
+	case DataHex:
+		return hex.EncodeToString(data)
+	case DataOmit:
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return DataSummaryJSON{Size: len(data), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// the JSON encodings of the types holding binary data, with the data of
+// an encoding in place of the raw bytes
+
+type signatureJSON struct {
+	SignatureEntryHeader `json:"signature_entry"`
+	Algorithm            string      `json:"algorithm"`
+	Data                 interface{} `json:"data,omitempty"`
+}
+
+type additionalSectionJSON struct {
+	AdditionalSectionEntryHeader `json:"additional_section_entry"`
+	Data                         interface{} `json:"data,omitempty"`
+}
+
+type entryJSON struct {
+	Data         interface{}     `json:"data,omitempty"`
+	IsCompressed bool            `json:"is_compressed"`
+	Compression  CompressionType `json:"compression"`
+}
+
+func newSignatureJSON(s Signature, enc DataEncoding) signatureJSON {
+	return signatureJSON{SignatureEntryHeader: s.SignatureEntryHeader, Algorithm: s.Algorithm, Data: encodeData(s.Data, enc)}
+}
+
+func newAdditionalSectionJSON(as AdditionalSection, enc DataEncoding) additionalSectionJSON {
+	return additionalSectionJSON{AdditionalSectionEntryHeader: as.AdditionalSectionEntryHeader, Data: encodeData(as.Data, enc)}
+}
+
+func newEntryJSON(e Entry, enc DataEncoding) entryJSON {
+	return entryJSON{Data: encodeData(e.Data, enc), IsCompressed: e.IsCompressed, Compression: e.Compression}
+}
+
+// JSON returns a value that encodes the file in JSON with the binary data
+// of its signatures, additional sections and entries in the given encoding,
+// such as a summary of the data or nothing at all. The file itself encodes
+// its data in base64, such that it can be decoded back into a File. The
+// content of entries is only included if it was loaded.
+func (file *File) JSON(enc DataEncoding) json.Marshaler {
+	return fileJSON{file: file, enc: enc}
+}
+
+type fileJSON struct {
+	file *File
+	enc  DataEncoding
+}
+
+func (fj fileJSON) MarshalJSON() ([]byte, error) {
+	// the fields of the outer struct take precedence over the fields of
+	// the same name of the embedded file
+	v := struct {
+		*File
+		Signatures         []signatureJSON         `json:"signatures"`
+		AdditionalSections []additionalSectionJSON `json:"additional_sections"`
+		Content            map[string]entryJSON    `json:"content,omitempty"`
+	}{File: fj.file}
+	for _, s := range fj.file.Signatures {
+		v.Signatures = append(v.Signatures, newSignatureJSON(s, fj.enc))
+	}
+	for _, as := range fj.file.AdditionalSections {
+		v.AdditionalSections = append(v.AdditionalSections, newAdditionalSectionJSON(as, fj.enc))
+	}
+	if fj.file.Content != nil && fj.enc != DataOmit {
+		v.Content = make(map[string]entryJSON, len(fj.file.Content))
+		for name, e := range fj.file.Content {
+			v.Content[name] = newEntryJSON(e, fj.enc)
+		}
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,166 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFileMarshalJSON(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 4096)
+	m := New()
+	m.AddContent(content, "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	for _, testCase := range []struct {
+		enc      DataEncoding
+		expected interface{}
+	}{
+		{DataSummary, map[string]interface{}{"size": float64(len(content)), "sha256": hex.EncodeToString(sum[:])}},
+		{DataBase64, base64.StdEncoding.EncodeToString(content)},
+		{DataHex, hex.EncodeToString(content)},
+		{DataOmit, nil},
+	} {
+		out, err := json.Marshal(m.JSON(testCase.enc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded struct {
+			MarID              string `json:"mar_id"`
+			Signatures         []map[string]interface{}
+			AdditionalSections []map[string]interface{} `json:"additional_sections"`
+			Content            map[string]map[string]interface{}
+		}
+		err = json.Unmarshal(out, &decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.MarID != "MAR1" || len(decoded.Signatures) != 1 || len(decoded.AdditionalSections) != 1 {
+			t.Fatalf("%s: unexpected file %s", testCase.enc, out)
+		}
+		if _, ok := decoded.Signatures[0]["data"]; ok != (testCase.enc != DataOmit) {
+			t.Fatalf("%s: unexpected signature %v", testCase.enc, decoded.Signatures[0])
+		}
+		if testCase.enc == DataOmit {
+			if decoded.Content != nil {
+				t.Fatalf("%s: expected the content to be omitted but got %v", testCase.enc, decoded.Content)
+			}
+			continue
+		}
+		data := decoded.Content["/foo/bar"]["data"]
+		expected, _ := json.Marshal(testCase.expected)
+		actual, _ := json.Marshal(data)
+		if !bytes.Equal(expected, actual) {
+			t.Fatalf("%s: expected entry data %s but got %s", testCase.enc, expected, actual)
+		}
+	}
+
+	// the file encodes its data in base64, and decodes back
+	out, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded File
+	err = json.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Signatures[0].Data, m.Signatures[0].Data) ||
+		!bytes.Equal(decoded.AdditionalSections[0].Data, m.AdditionalSections[0].Data) {
+		t.Fatalf("expected the data to round trip but got %s", out)
+	}
+	// values and pointers encode the same way
+	byValue, err := json.Marshal(*m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, byValue) {
+		t.Fatalf("expected a file and a pointer to it to encode the same way but got %s and %s", out, byValue)
+	}
+}
+
+func TestEntryMarshalJSON(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	out, err := json.Marshal(m.Entries())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	err = json.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0]["Name"] != "/foo/bar" || decoded[0]["flags"] != float64(0600) {
+		t.Fatalf("unexpected entries %s", out)
+	}
+	if decoded[0]["data"] != base64.StdEncoding.EncodeToString([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")) {
+		t.Fatalf("expected the entry data in base64 but got %s", out)
+	}
+	var entries []NamedEntry
+	err = json.Unmarshal(out, &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || string(entries[0].Data) != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Fatalf("expected the entries to round trip but got %+v", entries)
+	}
+}
+
+func TestParseDataEncoding(t *testing.T) {
+	for _, enc := range []DataEncoding{DataSummary, DataBase64, DataHex, DataOmit} {
+		parsed, err := ParseDataEncoding(enc.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != enc {
+			t.Fatalf("expected %s but got %s", enc, parsed)
+		}
+	}
+	_, err := ParseDataEncoding("base32")
+	if !errors.Is(err, errUnknownDataEncoding) {
+		t.Fatalf("expected to fail with %q but got %v", errUnknownDataEncoding, err)
+	}
+}
+
+func TestVerifiedFileMarshalJSON(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vf, err := ReadVerified(bytes.NewReader(input), map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(vf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		MarID string `json:"mar_id"`
+		Keys  []string
+	}
+	err = json.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.MarID != "MAR1" || len(decoded.Keys) != 1 || decoded.Keys[0] != "rsa" {
+		t.Fatalf("expected the file and its verifying keys but got %s", out)
+	}
+}
@@ -0,0 +1,108 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// keyFileExtensions are the extensions of the files LoadKeysFromDir loads
+var keyFileExtensions = map[string]bool{
+	".pem": true,
+	".pub": true,
+	".crt": true,
+	".cer": true,
+	".der": true,
+}
+
+// ParsePublicKeyPEM returns the public key of the first PEM block of data
+// that holds a PKIX public key, a PKCS1 RSA public key or a certificate.
+// Other blocks, such as the comments some tools add before a certificate,
+// are skipped.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errNoPublicKey
+		}
+		switch block.Type {
+		case "PUBLIC KEY", "RSA PUBLIC KEY", "CERTIFICATE":
+			return parsePublicKeyBlock(block.Type, block.Bytes)
+		}
+	}
+}
+
+// ParsePublicKeyDER returns the public key of a DER encoded PKIX public key,
+// PKCS1 RSA public key or certificate
+func ParsePublicKeyDER(der []byte) (crypto.PublicKey, error) {
+	for _, blockType := range []string{"PUBLIC KEY", "CERTIFICATE", "RSA PUBLIC KEY"} {
+		pub, err := parsePublicKeyBlock(blockType, der)
+		if err == nil {
+			return pub, nil
+		}
+	}
+	return nil, errNoPublicKey
+}
+
+// parsePublicKeyBlock returns the public key of the DER data of a PEM
+// block of the given type
+func parsePublicKeyBlock(blockType string, der []byte) (crypto.PublicKey, error) {
+	switch blockType {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(der)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(der)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type %q", blockType)
+}
+
+// LoadKeysFromDir loads the public keys and certificates of the files of a
+// directory, in PEM or DER encoding, such as a directory of the keys of a
+// key rotation. Files are loaded if their extension is .pem, .pub, .crt,
+// .cer or .der, and the keys are named after their file name without its
+// extension, ready to be used with VerifyWithKeys or VerifyReport.
+// Subdirectories are not loaded.
+func LoadKeysFromDir(path string) (map[string]crypto.PublicKey, error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, fi := range infos {
+		ext := strings.ToLower(filepath.Ext(fi.Name()))
+		if fi.IsDir() || !keyFileExtensions[ext] {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(path, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pub, err := ParsePublicKeyPEM(data)
+		if err == errNoPublicKey {
+			pub, err = ParsePublicKeyDER(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key from %s: %w", fi.Name(), err)
+		}
+		name := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+		if _, ok := keys[name]; ok {
+			return nil, fmt.Errorf("several files hold a key named %q", name)
+		}
+		keys[name] = pub
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key found in %s", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,154 @@
+package mar
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestCertificate returns the DER encoding of a self-signed certificate
+// of the ecdsa key
+func newTestCertificate(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "margo test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkixDER, err := x509.MarshalPKIXPublicKey(rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := newTestCertificate(t, ecdsaKey)
+	testCases := []struct {
+		data []byte
+		key  interface{}
+	}{
+		{pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER}), rsa2048Key.Public()},
+		{pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsa2048Key.PublicKey)}), rsa2048Key.Public()},
+		{pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), ecdsaKey.Public()},
+		// blocks that aren't keys are skipped
+		{append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{6, 8}}),
+			pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER})...), rsa2048Key.Public()},
+	}
+	for i, testCase := range testCases {
+		key, err := ParsePublicKeyPEM(testCase.data)
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(key, testCase.key) {
+			t.Fatalf("testcase %d: unexpected key %v", i, key)
+		}
+	}
+	_, err = ParsePublicKeyPEM([]byte("not a key"))
+	if err != errNoPublicKey {
+		t.Fatalf("expected to fail with %q but got %v", errNoPublicKey, err)
+	}
+	_, err = ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")}))
+	if err == nil {
+		t.Fatal("expected a malformed key to fail")
+	}
+
+	for i, der := range [][]byte{pkixDER, cert, x509.MarshalPKCS1PublicKey(&rsa2048Key.PublicKey)} {
+		_, err = ParsePublicKeyDER(der)
+		if err != nil {
+			t.Fatalf("der testcase %d: %v", i, err)
+		}
+	}
+	_, err = ParsePublicKeyDER([]byte("garbage"))
+	if err != errNoPublicKey {
+		t.Fatalf("expected to fail with %q but got %v", errNoPublicKey, err)
+	}
+}
+
+func TestLoadKeysFromDir(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkixDER, err := x509.MarshalPKIXPublicKey(rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "markeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{
+		"release-2023.pem": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER}),
+		"release-2024.der": newTestCertificate(t, ecdsaKey),
+		"README.txt":       []byte("not a key"),
+	}
+	for name, data := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.Mkdir(filepath.Join(dir, "old.pem"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadKeysFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !reflect.DeepEqual(keys["release-2023"], rsa2048Key.Public()) ||
+		!reflect.DeepEqual(keys["release-2024"], ecdsaKey.Public()) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	// keys with the same name in several files are ambiguous
+	err = ioutil.WriteFile(filepath.Join(dir, "release-2023.crt"), files["release-2024.der"], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKeysFromDir(dir)
+	if err == nil {
+		t.Fatal("expected keys with the same name to fail")
+	}
+
+	// files with a key extension must hold a key
+	os.Remove(filepath.Join(dir, "release-2023.crt"))
+	err = ioutil.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadKeysFromDir(dir)
+	if err == nil {
+		t.Fatal("expected a file without a key to fail")
+	}
+
+	empty, err := ioutil.TempDir("", "markeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	_, err = LoadKeysFromDir(empty)
+	if err == nil {
+		t.Fatal("expected a directory without keys to fail")
+	}
+}
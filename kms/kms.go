@@ -0,0 +1,130 @@
+// Package kms signs MAR files with RSA keys held in a cloud key management
+// service, such as AWS KMS or Google Cloud KMS, without depending on their
+// SDKs.
+//
+// A Signer implements the crypto.Signer interface on top of a DigestSigner,
+// which sends the digest computed by the mar package to the KMS. MAR
+// signatures of type SigAlgRsaPkcs1Sha384 are PKCS1v15 signatures of the
+// SHA384 digest of the signed block, so the KMS must be asked to sign a
+// precomputed SHA384 digest with an RSA PKCS1v15 key, and must not hash it
+// again.
+//
+// With the AWS SDK for Go v2, the key is an asymmetric RSA key with the
+// SIGN_VERIFY usage, and the digest is signed with MessageType DIGEST:
+//
+//	backend := kms.DigestSignerFunc(func(ctx context.Context, digest []byte, h crypto.Hash) ([]byte, error) {
+//		alg, err := kms.AWSSigningAlgorithm(h)
+//		if err != nil {
+//			return nil, err
+//		}
+//		out, err := client.Sign(ctx, &awskms.SignInput{
+//			KeyId:            aws.String(keyID),
+//			Message:          digest,
+//			MessageType:      types.MessageTypeDigest,
+//			SigningAlgorithm: types.SigningAlgorithmSpec(alg),
+//		})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return out.Signature, nil
+//	})
+//
+// With Google Cloud KMS, the key version has the RSA_SIGN_PKCS1_*_SHA384
+// algorithm, and the digest is passed in the Sha384 field of the request:
+//
+//	backend := kms.DigestSignerFunc(func(ctx context.Context, digest []byte, h crypto.Hash) ([]byte, error) {
+//		if h != crypto.SHA384 {
+//			return nil, fmt.Errorf("unsupported hash %v", h)
+//		}
+//		resp, err := client.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+//			Name:   keyVersionName,
+//			Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha384{Sha384: digest}},
+//		})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return resp.Signature, nil
+//	})
+//
+// The backend is then wrapped in a Signer along with the public key of the
+// KMS key, which both services can export in PKIX format:
+//
+//	signer := &kms.Signer{PublicKey: pub, Backend: backend}
+//	err := file.Sign(rand.Reader, signer, mar.SigAlgRsaPkcs1Sha384)
+//
+// Neither service supports PKCS1v15 signatures of SHA1 digests, so
+// SigAlgRsaPkcs1Sha1 signatures can't be made with them.
+package kms
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DigestSigner signs precomputed digests with a key of a KMS
+type DigestSigner interface {
+	// SignDigest returns the PKCS1v15 signature of the digest,
+	// which was computed with the hash function h
+	SignDigest(ctx context.Context, digest []byte, h crypto.Hash) ([]byte, error)
+}
+
+// DigestSignerFunc is a function that implements DigestSigner
+type DigestSignerFunc func(ctx context.Context, digest []byte, h crypto.Hash) ([]byte, error)
+
+// SignDigest calls f(ctx, digest, h)
+func (f DigestSignerFunc) SignDigest(ctx context.Context, digest []byte, h crypto.Hash) ([]byte, error) {
+	return f(ctx, digest, h)
+}
+
+// Signer signs digests with a key held in a KMS
+type Signer struct {
+	// PublicKey is the public key of the KMS key
+	PublicKey crypto.PublicKey
+	// Backend sends the digests to the KMS
+	Backend DigestSigner
+	// Context is passed to the backend, context.Background() if nil
+	Context context.Context
+}
+
+// Public returns the public key of the KMS key
+func (s *Signer) Public() crypto.PublicKey {
+	return s.PublicKey
+}
+
+// Sign returns the signature of the digest made by the KMS. The KMS
+// makes the entropy it needs, so rand is unused.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	h := opts.HashFunc()
+	if h == 0 || !h.Available() {
+		return nil, fmt.Errorf("kms: unsupported hash function %v", h)
+	}
+	if len(digest) != h.Size() {
+		return nil, errors.New("kms: digest length does not match the hash function")
+	}
+	ctx := s.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sig, err := s.Backend.SignDigest(ctx, digest, h)
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to sign: %w", err)
+	}
+	return sig, nil
+}
+
+// AWSSigningAlgorithm returns the AWS KMS signing algorithm that makes
+// PKCS1v15 signatures of digests computed with the hash function h
+func AWSSigningAlgorithm(h crypto.Hash) (string, error) {
+	switch h {
+	case crypto.SHA256:
+		return "RSASSA_PKCS1_V1_5_SHA_256", nil
+	case crypto.SHA384:
+		return "RSASSA_PKCS1_V1_5_SHA_384", nil
+	case crypto.SHA512:
+		return "RSASSA_PKCS1_V1_5_SHA_512", nil
+	}
+	return "", fmt.Errorf("kms: AWS KMS has no PKCS1v15 signing algorithm for hash %v", h)
+}
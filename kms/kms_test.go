@@ -0,0 +1,64 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"testing"
+
+	"go.mozilla.org/mar"
+)
+
+// fakeKMS signs digests with a local key, like a KMS asked to sign
+// a precomputed digest would
+func fakeKMS(key *rsa.PrivateKey) DigestSignerFunc {
+	return func(ctx context.Context, digest []byte, h crypto.Hash) ([]byte, error) {
+		_, err := AWSSigningAlgorithm(h)
+		if err != nil {
+			return nil, err
+		}
+		return rsa.SignPKCS1v15(rand.Reader, key, h, digest)
+	}
+}
+
+func TestSignFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &Signer{PublicKey: key.Public(), Backend: fakeKMS(key)}
+	file := mar.New()
+	file.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err = file.Sign(rand.Reader, signer, mar.SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.VerifySignature(key.Public())
+	if err != nil {
+		t.Fatalf("signature failed to verify: %v", err)
+	}
+
+	// the fake KMS, like AWS KMS, can't sign SHA1 digests
+	err = file.Sign(rand.Reader, signer, mar.SigAlgRsaPkcs1Sha1)
+	if err == nil {
+		t.Fatal("expected SHA1 signature to fail")
+	}
+}
+
+func TestSignBadDigest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &Signer{PublicKey: key.Public(), Backend: fakeKMS(key)}
+	_, err = signer.Sign(nil, make([]byte, sha1.Size), crypto.SHA384)
+	if err == nil {
+		t.Fatal("expected signing a digest of the wrong size to fail")
+	}
+	_, err = signer.Sign(nil, []byte("unhashed"), crypto.Hash(0))
+	if err == nil {
+		t.Fatal("expected signing without a hash function to fail")
+	}
+}
@@ -0,0 +1,285 @@
+package mar
+
+import (
+	"fmt"
+	"sort"
+)
+
+// rawLayout records how the content of a parsed file was laid out in its
+// input, such that Marshal can reproduce the input byte for byte as long
+// as the content and index of the file are left untouched
+type rawLayout struct {
+	// contentStart is the offset of the first byte after the headers
+	contentStart uint64
+	// offsetToIndex is the offset of the index in the input
+	offsetToIndex uint32
+	// entries is a copy of the index as it was parsed
+	entries []IndexEntry
+	// gaps holds the bytes found between content entries
+	gaps []rawChunk
+	// trailer holds the data found after the index in lenient mode
+	trailer []byte
+}
+
+// rawChunk is a chunk of data located at a given offset of a file
+type rawChunk struct {
+	offset uint64
+	data   []byte
+	// name of the entry the chunk is the content of, or "slack"
+	name string
+}
+
+// recordLayout stores the layout of a file that was just parsed from p,
+// including any data found in gaps between content entries or after the index
+func recordLayout(p *parser, file *File) error {
+	l := &rawLayout{
+		contentStart:  file.contentStart(),
+		offsetToIndex: file.OffsetToIndex,
+		entries:       make([]IndexEntry, len(file.Index)),
+	}
+	copy(l.entries, file.Index)
+
+	sorted := make([]IndexEntry, len(file.Index))
+	copy(sorted, file.Index)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].OffsetToContent < sorted[j].OffsetToContent
+	})
+	pos := l.contentStart
+	for _, idx := range append(sorted, IndexEntry{IndexEntryHeader: IndexEntryHeader{OffsetToContent: file.OffsetToIndex}}) {
+		start := uint64(idx.OffsetToContent)
+		if start > pos {
+			gap := rawChunk{offset: pos, data: make([]byte, start-pos), name: "slack"}
+			err := p.readAt(gap.data, pos)
+			if err != nil {
+				return err
+			}
+			l.gaps = append(l.gaps, gap)
+		}
+		if end := start + uint64(idx.Size); end > pos {
+			pos = end
+		}
+	}
+
+	indexEnd := uint64(file.OffsetToIndex) + IndexHeaderLen + uint64(file.IndexHeader.Size)
+	if p.size > indexEnd {
+		l.trailer = make([]byte, p.size-indexEnd)
+		err := p.readAt(l.trailer, indexEnd)
+		if err != nil {
+			return err
+		}
+	}
+	file.layout = l
+	return nil
+}
+
+// matches returns true if the index and content of the file still
+// have the layout that was recorded when it was parsed
+func (l *rawLayout) matches(file *File, contentStart uint64) bool {
+	if l.contentStart != contentStart || len(l.entries) != len(file.Index) {
+		return false
+	}
+	for i, idx := range file.Index {
+		entry, ok := file.Content[idx.FileName]
+		if !ok ||
+			idx.FileName != l.entries[i].FileName ||
+			idx.OffsetToContent != l.entries[i].OffsetToContent ||
+			uint64(len(entry.Data)) != uint64(l.entries[i].Size) {
+			return false
+		}
+	}
+	return true
+}
+
+// contentChunks returns the content of the entries and the recorded gaps
+// between them, sorted by offset. Content referenced by several entries
+// is only returned once.
+func (file *File) contentChunks() []rawChunk {
+	var chunks []rawChunk
+	seen := make(map[string]bool)
+	for _, idx := range file.Index {
+		if seen[idx.FileName] {
+			continue
+		}
+		seen[idx.FileName] = true
+		chunks = append(chunks, rawChunk{
+			offset: uint64(idx.OffsetToContent),
+			data:   file.Content[idx.FileName].Data,
+			name:   idx.FileName,
+		})
+	}
+	if file.layout != nil {
+		chunks = append(chunks, file.layout.gaps...)
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].offset < chunks[j].offset
+	})
+	return chunks
+}
+
+// RegionKind is the kind of data a Region of a MAR file holds
+type RegionKind int
+
+const (
+	// RegionHeader is a header of the file, like the MAR ID or the
+	// number of signatures
+	RegionHeader RegionKind = iota
+	// RegionSignature is a part of a signature entry
+	RegionSignature
+	// RegionAdditionalSection is a part of an additional section
+	RegionAdditionalSection
+	// RegionContent is the content of an entry
+	RegionContent
+	// RegionIndex is the index header or a part of an index entry
+	RegionIndex
+	// RegionSlack is data that belongs to no field, such as gaps
+	// between entries or trailing data after the index
+	RegionSlack
+)
+
+// String returns the name of the kind of region
+func (k RegionKind) String() string {
+	switch k {
+	case RegionHeader:
+		return "header"
+	case RegionSignature:
+		return "signature"
+	case RegionAdditionalSection:
+		return "additional"
+	case RegionContent:
+		return "content"
+	case RegionIndex:
+		return "index"
+	case RegionSlack:
+		return "slack"
+	}
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+// MarshalText encodes the kind of region by its name
+func (k RegionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Region is a labeled byte range of a MAR file, from Start included
+// to End excluded
+type Region struct {
+	Start uint64     `json:"start" yaml:"start"`
+	End   uint64     `json:"end" yaml:"end"`
+	Kind  RegionKind `json:"kind" yaml:"kind"`
+	// Name describes the field, like "signature 0 size" or
+	// "content of \"foo\""
+	Name string `json:"name" yaml:"name"`
+}
+
+// Layout returns the byte ranges of the headers, signatures, additional
+// sections, content and index of the file, sorted by offset, as described
+// by the values it was parsed with or last marshalled with. Bytes between
+// those ranges, and trailing data after the index of a file parsed in
+// lenient mode, are returned as RegionSlack. Content shared by several
+// entries is only returned once, and the content of crafted files may
+// overlap other regions.
+func (file *File) Layout() []Region {
+	var r []Region
+	add := func(start, size uint64, kind RegionKind, format string, a ...interface{}) uint64 {
+		r = append(r, Region{start, start + size, kind, fmt.Sprintf(format, a...)})
+		return start + size
+	}
+	pos := add(0, MarIDLen, RegionHeader, "MAR ID")
+	pos = add(pos, OffsetToIndexLen, RegionHeader, "offset to index")
+	if file.Revision != 2005 {
+		pos = add(pos, FileSizeLen, RegionHeader, "file size")
+		pos = add(pos, SignaturesHeaderLen, RegionHeader, "number of signatures")
+		for i, sig := range file.Signatures {
+			pos = add(pos, 4, RegionSignature, "signature %d algorithm id", i)
+			pos = add(pos, 4, RegionSignature, "signature %d size", i)
+			pos = add(pos, uint64(sig.Size), RegionSignature, "signature %d data, %s", i, getSigAlgNameFromID(sig.AlgorithmID))
+		}
+		pos = add(pos, AdditionalSectionsHeaderLen, RegionHeader, "number of additional sections")
+		for i, as := range file.AdditionalSections {
+			pos = add(pos, 4, RegionAdditionalSection, "additional section %d block size", i)
+			pos = add(pos, 4, RegionAdditionalSection, "additional section %d block id", i)
+			pos = add(pos, uint64(len(as.Data)), RegionAdditionalSection, "additional section %d data", i)
+		}
+	}
+	seen := make(map[uint32]bool)
+	for _, idx := range file.Index {
+		if seen[idx.OffsetToContent] {
+			continue
+		}
+		seen[idx.OffsetToContent] = true
+		add(uint64(idx.OffsetToContent), uint64(idx.Size), RegionContent, "content of %q", idx.FileName)
+	}
+	pos = add(uint64(file.OffsetToIndex), IndexHeaderLen, RegionIndex, "index size")
+	for _, idx := range file.Index {
+		pos = add(pos, 4, RegionIndex, "index entry for %q offset", idx.FileName)
+		pos = add(pos, 4, RegionIndex, "index entry for %q size", idx.FileName)
+		pos = add(pos, 4, RegionIndex, "index entry for %q flags", idx.FileName)
+		pos = add(pos, uint64(len(idx.FileName))+1, RegionIndex, "index entry for %q name", idx.FileName)
+	}
+	if file.layout != nil {
+		pos = add(pos, uint64(len(file.layout.trailer)), RegionSlack, "trailing data")
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Start < r[j].Start
+	})
+
+	// fill the gaps between regions with slack
+	var filled []Region
+	pos = 0
+	for _, region := range r {
+		if region.Start > pos {
+			filled = append(filled, Region{pos, region.Start, RegionSlack, "slack"})
+		}
+		if region.End > region.Start {
+			filled = append(filled, region)
+		}
+		if region.End > pos {
+			pos = region.End
+		}
+	}
+	return filled
+}
+
+// slackSampleLen is the number of bytes of a SlackRange kept as sample
+const slackSampleLen = 32
+
+// SlackRange is a range of bytes of a parsed MAR file that belongs to no
+// header, signature, additional section, entry or index. Such data is not
+// extracted and may go unnoticed, so it can be used to smuggle data into
+// a file.
+type SlackRange struct {
+	// Offset is the position of the range in the file
+	Offset uint64 `json:"offset" yaml:"offset"`
+	// Length is the size of the range, in bytes
+	Length uint64 `json:"length" yaml:"length"`
+	// Sample holds the first bytes of the range
+	Sample []byte `json:"sample" yaml:"sample"`
+}
+
+// Slack returns the ranges of data found between the content of entries,
+// and after the index of a file parsed in lenient mode, sorted by offset.
+// It returns nil for files that were not parsed with their content, since
+// the data of the ranges is only recorded while parsing it.
+func (file *File) Slack() []SlackRange {
+	if file.layout == nil {
+		return nil
+	}
+	chunks := file.layout.gaps
+	if len(file.layout.trailer) > 0 {
+		indexEnd := uint64(file.layout.offsetToIndex) + IndexHeaderLen + uint64(file.IndexHeader.Size)
+		chunks = append(chunks[:len(chunks):len(chunks)], rawChunk{offset: indexEnd, data: file.layout.trailer, name: "slack"})
+	}
+	var slack []SlackRange
+	for _, c := range chunks {
+		sample := c.data
+		if len(sample) > slackSampleLen {
+			sample = sample[:slackSampleLen]
+		}
+		slack = append(slack, SlackRange{
+			Offset: c.offset,
+			Length: uint64(len(c.data)),
+			Sample: append([]byte(nil), sample...),
+		})
+	}
+	return slack
+}
@@ -0,0 +1,308 @@
+package mar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+func TestRoundTripOldMar(t *testing.T) {
+	var m File
+	err := Unmarshal(oldMarB, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, oldMarB) {
+		t.Fatal("expected old mar to marshal back to its input")
+	}
+}
+
+// rawMar builds a MAR with an unknown additional section and content laid
+// out with padding and in a different order than the index
+func rawMar() []byte {
+	var (
+		content    = []byte("\x00\x01bbbbPADaaaa\xff")
+		asData     = []byte("unknown block")
+		idxEntries = []struct {
+			offset, size uint32
+			name         string
+		}{{9, 4, "a"}, {2, 4, "b"}}
+	)
+	contentStart := uint32(MarIDLen + OffsetToIndexLen + FileSizeLen + SignaturesHeaderLen +
+		AdditionalSectionsHeaderLen + AdditionalSectionsEntryHeaderLen + len(asData))
+	var index []byte
+	for _, e := range idxEntries {
+		index = append(index, make([]byte, IndexEntryHeaderLen)...)
+		binary.BigEndian.PutUint32(index[len(index)-12:], contentStart+e.offset)
+		binary.BigEndian.PutUint32(index[len(index)-8:], e.size)
+		binary.BigEndian.PutUint32(index[len(index)-4:], 0644)
+		index = append(index, []byte(e.name+"\x00")...)
+	}
+	offsetToIndex := contentStart + uint32(len(content))
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("MAR1")
+	binary.Write(buf, binary.BigEndian, offsetToIndex)
+	binary.Write(buf, binary.BigEndian, uint64(offsetToIndex)+IndexHeaderLen+uint64(len(index)))
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, uint32(1))
+	binary.Write(buf, binary.BigEndian, uint32(AdditionalSectionsEntryHeaderLen+len(asData)))
+	binary.Write(buf, binary.BigEndian, uint32(1664))
+	buf.Write(asData)
+	buf.Write(content)
+	binary.Write(buf, binary.BigEndian, uint32(len(index)))
+	buf.Write(index)
+	return buf.Bytes()
+}
+
+func TestRoundTripPreservesLayout(t *testing.T) {
+	input := rawMar()
+	var m File
+	err := Unmarshal(input, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Content["a"].Data) != "aaaa" || string(m.Content["b"].Data) != "bbbb" {
+		t.Fatalf("unexpected content %q and %q", m.Content["a"].Data, m.Content["b"].Data)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, input) {
+		t.Fatalf("expected untouched file to marshal back to its input\nexpected %q\ngot      %q", input, o)
+	}
+
+	// once the content changes, the layout is recomputed without gaps
+	m.Content["a"] = Entry{Data: []byte("cccccc")}
+	o, err = m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed, Strict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reparsed.Content["a"].Data) != "cccccc" || string(reparsed.Content["b"].Data) != "bbbb" {
+		t.Fatalf("unexpected content %q and %q", reparsed.Content["a"].Data, reparsed.Content["b"].Data)
+	}
+}
+
+func TestRoundTripLenientTrailer(t *testing.T) {
+	input := append(append([]byte{}, miniMarB...), []byte("garbage")...)
+	var m File
+	err := Unmarshal(input, &m, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, input) {
+		t.Fatal("expected file with trailing data to marshal back to its input")
+	}
+}
+
+// randomMar is a MAR generated by testing/quick
+type randomMar struct {
+	File *File
+}
+
+// Generate returns a MAR with random content, additional sections and signatures
+func (randomMar) Generate(r *rand.Rand, size int) reflect.Value {
+	m := New()
+	for i := 0; i < r.Intn(3); i++ {
+		sig := Signature{
+			SignatureEntryHeader: SignatureEntryHeader{AlgorithmID: SigAlgRsaPkcs1Sha384, Size: uint32(r.Intn(512))},
+		}
+		sig.Data = make([]byte, sig.Size)
+		r.Read(sig.Data)
+		m.Signatures = append(m.Signatures, sig)
+	}
+	for i := 0; i < r.Intn(3); i++ {
+		data := make([]byte, r.Intn(size+1))
+		r.Read(data)
+		m.AddAdditionalSection(data, uint32(r.Intn(5)))
+	}
+	for i := 0; i < 1+r.Intn(10); i++ {
+		data := make([]byte, r.Intn(size*10+1))
+		r.Read(data)
+		m.AddContent(data, fmt.Sprintf("/random/%d/%d", r.Int(), i), uint32(r.Intn(0777)))
+	}
+	return reflect.ValueOf(randomMar{m})
+}
+
+func TestRoundTripProperty(t *testing.T) {
+	property := func(rm randomMar) bool {
+		input, err := rm.File.Marshal()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		var m File
+		err = Unmarshal(input, &m)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		o, err := m.Marshal()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		return bytes.Equal(o, input)
+	}
+	err := quick.Check(property, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	input := rawMar()
+	var m File
+	err := Unmarshal(input, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := m.Layout()
+	checkRegionsCover(t, regions, uint64(len(input)))
+	contentStart := m.contentStart()
+	var slack, content []Region
+	for _, r := range regions {
+		switch r.Kind {
+		case RegionSlack:
+			slack = append(slack, r)
+		case RegionContent:
+			content = append(content, r)
+		}
+	}
+	if len(slack) != 3 || slack[0].Start != contentStart || slack[0].End != contentStart+2 ||
+		slack[1].Start != contentStart+6 || slack[2].End != contentStart+14 {
+		t.Fatalf("unexpected slack regions %+v", slack)
+	}
+	if len(content) != 2 || content[0].Name != `content of "b"` || content[1].Name != `content of "a"` {
+		t.Fatalf("unexpected content regions %+v", content)
+	}
+	if regions[0].Kind != RegionHeader || regions[0].Name != "MAR ID" {
+		t.Fatalf("unexpected first region %+v", regions[0])
+	}
+	if regions[len(regions)-1].Kind != RegionIndex {
+		t.Fatalf("unexpected last region %+v", regions[len(regions)-1])
+	}
+}
+
+func TestLayoutMarshalled(t *testing.T) {
+	m := New()
+	m.SetProductInformation("62.0", "firefox-mozilla-release")
+	m.AddContent([]byte("foo content"), "foo", 0644)
+	m.AddContent([]byte("bar content"), "bar", 0644)
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := m.Layout()
+	checkRegionsCover(t, regions, uint64(len(o)))
+	kinds := make(map[RegionKind]int)
+	for _, r := range regions {
+		kinds[r.Kind]++
+	}
+	if kinds[RegionSlack] != 0 || kinds[RegionContent] != 2 || kinds[RegionAdditionalSection] != 3 || kinds[RegionIndex] != 9 {
+		t.Fatalf("unexpected regions %+v", regions)
+	}
+}
+
+func TestLayoutTrailer(t *testing.T) {
+	input := append(append([]byte{}, miniMarB...), []byte("garbage")...)
+	var m File
+	err := Unmarshal(input, &m, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := m.Layout()
+	checkRegionsCover(t, regions, uint64(len(input)))
+	last := regions[len(regions)-1]
+	if last.Kind != RegionSlack || last.Name != "trailing data" || last.End-last.Start != 7 {
+		t.Fatalf("unexpected last region %+v", last)
+	}
+}
+
+// checkRegionsCover verifies the regions are contiguous from the
+// start of the file to its end
+func checkRegionsCover(t *testing.T, regions []Region, size uint64) {
+	t.Helper()
+	var pos uint64
+	for _, r := range regions {
+		if r.Start != pos || r.End <= r.Start {
+			t.Fatalf("region %+v does not start at %d", r, pos)
+		}
+		pos = r.End
+	}
+	if pos != size {
+		t.Fatalf("expected regions to end at %d, got %d", size, pos)
+	}
+}
+
+func TestRegionKindString(t *testing.T) {
+	if RegionAdditionalSection.String() != "additional" || RegionKind(42).String() != "unknown(42)" {
+		t.Fatal("unexpected region kind names")
+	}
+	out, err := json.Marshal(Region{Kind: RegionContent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out, []byte(`"kind":"content"`)) {
+		t.Fatalf("unexpected json encoding of region %s", out)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	input := rawMar()
+	var m File
+	err := Unmarshal(input, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentStart := m.contentStart()
+	slack := m.Slack()
+	if len(slack) != 3 {
+		t.Fatalf("expected 3 slack ranges, got %+v", slack)
+	}
+	for i, expected := range []SlackRange{
+		{contentStart, 2, []byte("\x00\x01")},
+		{contentStart + 6, 3, []byte("PAD")},
+		{contentStart + 13, 1, []byte("\xff")},
+	} {
+		if slack[i].Offset != expected.Offset || slack[i].Length != expected.Length || !bytes.Equal(slack[i].Sample, expected.Sample) {
+			t.Fatalf("expected slack range %d to be %+v, got %+v", i, expected, slack[i])
+		}
+	}
+
+	trailer := bytes.Repeat([]byte("smuggled"), 10)
+	input = append(append([]byte{}, miniMarB...), trailer...)
+	var lenient File
+	err = Unmarshal(input, &lenient, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack = lenient.Slack()
+	if len(slack) != 1 || slack[0].Offset != uint64(len(miniMarB)) || slack[0].Length != uint64(len(trailer)) ||
+		!bytes.Equal(slack[0].Sample, trailer[:slackSampleLen]) {
+		t.Fatalf("unexpected trailing slack %+v", slack)
+	}
+
+	if len(New().Slack()) != 0 {
+		t.Fatal("expected no slack in a new file")
+	}
+}
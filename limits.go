@@ -0,0 +1,191 @@
+package mar
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Limits bounds the values the parser accepts from the headers and index
+// of a MAR file, such that a crafted file can't make it allocate large
+// amounts of memory. Fields left to zero use the value of DefaultLimits.
+type Limits struct {
+	// MaxTotalSize is the maximum size of a MAR file, in bytes
+	MaxTotalSize uint64
+
+	// MaxSignatures is the maximum number of signatures
+	MaxSignatures uint32
+
+	// MaxSignatureSize is the maximum size of a signature, in bytes
+	MaxSignatureSize uint32
+
+	// MaxAdditionalSections is the maximum number of additional sections
+	MaxAdditionalSections uint32
+
+	// MaxAdditionalSectionSize is the maximum size of an additional
+	// section, including its header, in bytes
+	MaxAdditionalSectionSize uint32
+
+	// MaxIndexEntries is the maximum number of entries in the index
+	MaxIndexEntries uint32
+
+	// MaxEntrySize is the maximum size of the content of an entry, in bytes
+	MaxEntrySize uint32
+
+	// MaxFileNameLength is the maximum length of the name of an entry
+	MaxFileNameLength uint32
+
+	// MaxDecompressedSize is the maximum size of the content of an entry
+	// once decompressed, in bytes
+	MaxDecompressedSize uint64
+}
+
+// DefaultLimits returns the limits used by the parser when none are
+// provided, which match the ones of Firefox's libmar where it has any
+func DefaultLimits() Limits {
+	return Limits{
+		MaxTotalSize:             limitMaxFileSize,
+		MaxSignatures:            limitMaxSignatures,
+		MaxSignatureSize:         limitMaxSignatureSize,
+		MaxAdditionalSections:    limitMaxAdditionalSections,
+		MaxAdditionalSectionSize: limitMaxAdditionalDataSize,
+		MaxIndexEntries:          limitMaxIndexEntries,
+		MaxEntrySize:             uint32(limitMaxFileSize),
+		MaxFileNameLength:        uint32(limitFileNameLength),
+		MaxDecompressedSize:      limitMaxDecompressedSize,
+	}
+}
+
+// withDefaults returns a copy of the limits where zero fields
+// are replaced with their default value
+func (l Limits) withDefaults() Limits {
+	d := DefaultLimits()
+	if l.MaxTotalSize == 0 {
+		l.MaxTotalSize = d.MaxTotalSize
+	}
+	if l.MaxSignatures == 0 {
+		l.MaxSignatures = d.MaxSignatures
+	}
+	if l.MaxSignatureSize == 0 {
+		l.MaxSignatureSize = d.MaxSignatureSize
+	}
+	if l.MaxAdditionalSections == 0 {
+		l.MaxAdditionalSections = d.MaxAdditionalSections
+	}
+	if l.MaxAdditionalSectionSize == 0 {
+		l.MaxAdditionalSectionSize = d.MaxAdditionalSectionSize
+	}
+	if l.MaxIndexEntries == 0 {
+		l.MaxIndexEntries = d.MaxIndexEntries
+	}
+	if l.MaxEntrySize == 0 {
+		l.MaxEntrySize = d.MaxEntrySize
+	}
+	if l.MaxFileNameLength == 0 {
+		l.MaxFileNameLength = d.MaxFileNameLength
+	}
+	if l.MaxDecompressedSize == 0 {
+		l.MaxDecompressedSize = d.MaxDecompressedSize
+	}
+	return l
+}
+
+// checkLimits verifies the layout of a file that is about to be marshalled
+// is within the limits, such that the parser will accept it
+func (file *File) checkLimits(l Limits) error {
+	err := checkLimit(file.debug, "MaxTotalSize", file.Size, l.MaxTotalSize)
+	if err != nil {
+		return err
+	}
+	err = checkLimit(file.debug, "MaxSignatures", uint64(len(file.Signatures)), uint64(l.MaxSignatures))
+	if err != nil {
+		return err
+	}
+	for _, sig := range file.Signatures {
+		err = checkLimit(file.debug, "MaxSignatureSize", uint64(sig.Size), uint64(l.MaxSignatureSize))
+		if err != nil {
+			return err
+		}
+	}
+	err = checkLimit(file.debug, "MaxAdditionalSections", uint64(len(file.AdditionalSections)), uint64(l.MaxAdditionalSections))
+	if err != nil {
+		return err
+	}
+	for _, as := range file.AdditionalSections {
+		err = checkLimit(file.debug, "MaxAdditionalSectionSize", uint64(as.BlockSize), uint64(l.MaxAdditionalSectionSize))
+		if err != nil {
+			return err
+		}
+	}
+	err = checkLimit(file.debug, "MaxIndexEntries", uint64(len(file.Index)), uint64(l.MaxIndexEntries))
+	if err != nil {
+		return err
+	}
+	for _, idx := range file.Index {
+		err = checkLimit(file.debug, "MaxEntrySize", uint64(idx.Size), uint64(l.MaxEntrySize))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LimitError is returned when a MAR file exceeds one of the Limits
+// of the parser
+type LimitError struct {
+	// Limit is the name of the field of Limits that was exceeded
+	Limit string
+	// Value is the value found in the MAR file
+	Value uint64
+	// Max is the value of the limit
+	Max uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s of %d exceeds the limit of %d", e.Limit, e.Value, e.Max)
+}
+
+// Unwrap returns ErrLimitExceeded, such that errors.Is can
+// match all the limit errors
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// limitedReader reads from r until more than max bytes are read, at which
+// point it fails with a LimitError
+type limitedReader struct {
+	r     io.Reader
+	debug io.Writer
+	limit string
+	read  uint64
+	max   uint64
+}
+
+// newLimitedReader returns a reader of r that fails with a LimitError of
+// the named limit if r holds more than max bytes, traced to debug
+func newLimitedReader(r io.Reader, debug io.Writer, limit string, max uint64) io.Reader {
+	// reading one byte past max is enough to know r is too large
+	if max < math.MaxInt64 {
+		r = io.LimitReader(r, int64(max)+1)
+	}
+	return &limitedReader{r: r, debug: debug, limit: limit, max: max}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.read += uint64(n)
+	if lr.read > lr.max {
+		return n - int(lr.read-lr.max), checkLimit(lr.debug, lr.limit, lr.read, lr.max)
+	}
+	return n, err
+}
+
+// checkLimit returns a LimitError if value is above max, and writes a
+// trace of it to debug
+func checkLimit(debug io.Writer, limit string, value, max uint64) error {
+	if value > max {
+		debugf(debug, "%s=%d > limit=%d\n", limit, value, max)
+		return &LimitError{Limit: limit, Value: value, Max: max}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package mar
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLimitsIndexEntries(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed, WithLimits(Limits{MaxIndexEntries: 1}))
+	lerr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("expected to fail with a limit error but got %v", err)
+	}
+	if lerr.Limit != "MaxIndexEntries" || lerr.Max != 1 {
+		t.Fatalf("expected to exceed MaxIndexEntries of 1 but got %v", lerr)
+	}
+	// the default limits accept the file
+	var accepted File
+	err = Unmarshal(o, &accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitsCraftedHeaders(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigHeaderPos := MarIDLen + OffsetToIndexLen + FileSizeLen
+	addHeaderPos := sigHeaderPos + SignaturesHeaderLen
+
+	testcases := []struct {
+		pos   int
+		value uint32
+		limit string
+	}{
+		{sigHeaderPos, 0xFFFFFFFF, "MaxSignatures"},
+		{addHeaderPos, 0xFFFFFFFF, "MaxAdditionalSections"},
+		{addHeaderPos + AdditionalSectionsHeaderLen, 0xFFFFFFFF, "MaxAdditionalSectionSize"},
+	}
+	for i, testcase := range testcases {
+		crafted := make([]byte, len(o))
+		copy(crafted, o)
+		binary.BigEndian.PutUint32(crafted[testcase.pos:], testcase.value)
+		var reparsed File
+		err = Unmarshal(crafted, &reparsed)
+		lerr, ok := err.(*LimitError)
+		if !ok {
+			t.Fatalf("testcase %d expected to fail with a limit error but got %v", i, err)
+		}
+		if lerr.Limit != testcase.limit {
+			t.Fatalf("testcase %d expected to exceed %s but exceeded %s", i, testcase.limit, lerr.Limit)
+		}
+	}
+
+	// a block size smaller than the header of the section must not underflow
+	crafted := make([]byte, len(o))
+	copy(crafted, o)
+	binary.BigEndian.PutUint32(crafted[addHeaderPos+AdditionalSectionsHeaderLen:], 4)
+	var reparsed File
+	err = Unmarshal(crafted, &reparsed)
+	if err != errAdditionalDataTooSmall {
+		t.Fatalf("expected to fail with %q but got %v", errAdditionalDataTooSmall, err)
+	}
+}
+
+func TestLimitsWithDefaults(t *testing.T) {
+	l := Limits{MaxSignatures: 2}.withDefaults()
+	d := DefaultLimits()
+	if l.MaxSignatures != 2 {
+		t.Fatalf("expected MaxSignatures to be kept at 2 but found %d", l.MaxSignatures)
+	}
+	d.MaxSignatures = 2
+	if l != d {
+		t.Fatalf("expected zero limits to be set to their default but got %+v", l)
+	}
+}
+
+func TestLimitsMarshal(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+	_, err := m.Marshal(WithLimits(Limits{MaxEntrySize: 10}))
+	lerr, ok := err.(*LimitError)
+	if !ok || lerr.Limit != "MaxEntrySize" {
+		t.Fatalf("expected to exceed MaxEntrySize but got %v", err)
+	}
+	_, err = m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	data, err := ioutil.ReadAll(newLimitedReader(strings.NewReader("caribou"), nil, "MaxDecompressedSize", 7))
+	if err != nil || string(data) != "caribou" {
+		t.Fatalf("expected to read caribou but got %q and %v", data, err)
+	}
+	data, err = ioutil.ReadAll(newLimitedReader(strings.NewReader("caribou"), nil, "MaxDecompressedSize", 6))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected to fail with %q but got %v", ErrLimitExceeded, err)
+	}
+	if string(data) != "caribo" {
+		t.Fatalf("expected to read no more than the limit but got %q", data)
+	}
+}
@@ -0,0 +1,79 @@
+package mar
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+)
+
+// Names of the checks of Lint
+const (
+	LintUnsigned         = "unsigned"
+	LintSHA1Only         = "sha1-only"
+	LintUncompressed     = "uncompressed"
+	LintUnusualMode      = "unusual-mode"
+	LintDuplicateContent = "duplicate-content"
+	LintSlack            = "slack"
+)
+
+// LintFinding is an oddity of a MAR file reported by Lint
+type LintFinding struct {
+	// Check is the name of the check that reported the finding
+	Check string `json:"check" yaml:"check"`
+	// Entry is the name of the entry the finding is about, if any
+	Entry string `json:"entry,omitempty" yaml:"entry,omitempty"`
+	// Message describes the finding
+	Message string `json:"message" yaml:"message"`
+}
+
+// Lint reports the oddities of a MAR file that don't make it invalid but
+// that a release hygiene check should look at: missing signatures or
+// signatures that only use SHA1, entries that are not compressed or have
+// permissions other than 0644 and 0755, entries with identical content,
+// and slack space between the sections of the file as returned by Slack.
+// Content and slack checks are skipped for files parsed with SkipContent.
+func (file *File) Lint() []LintFinding {
+	var findings []LintFinding
+	report := func(check, entry, format string, a ...interface{}) {
+		findings = append(findings, LintFinding{check, entry, fmt.Sprintf(format, a...)})
+	}
+
+	if len(file.Signatures) == 0 {
+		report(LintUnsigned, "", "the file has no signature")
+	} else {
+		sha1Only := true
+		for _, sig := range file.Signatures {
+			if sig.AlgorithmID != SigAlgRsaPkcs1Sha1 {
+				sha1Only = false
+			}
+		}
+		if sha1Only {
+			report(LintSHA1Only, "", "all %d signatures use SHA1", len(file.Signatures))
+		}
+	}
+
+	firstName := make(map[[sha256.Size]byte]string)
+	for _, idx := range file.Index {
+		if mode := os.FileMode(idx.Flags); idx.Flags != FlagsRegular && idx.Flags != FlagsExecutable {
+			report(LintUnusualMode, idx.FileName, "entry has mode %s", mode)
+		}
+		entry, ok := file.Content[idx.FileName]
+		if !ok || len(entry.Data) == 0 {
+			continue
+		}
+		if !entry.IsCompressed {
+			report(LintUncompressed, idx.FileName, "entry is not compressed")
+		}
+		sum := sha256.Sum256(entry.Data)
+		if name, ok := firstName[sum]; ok {
+			report(LintDuplicateContent, idx.FileName, "entry has the same content as %q", name)
+		} else {
+			firstName[sum] = idx.FileName
+		}
+	}
+
+	for _, r := range file.Slack() {
+		report(LintSlack, "", "%d bytes of slack at offset %d: %s", r.Length, r.Offset, dumpData(r.Sample))
+	}
+	return findings
+}
@@ -0,0 +1,80 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+// lintChecks returns the number of findings of each check
+func lintChecks(findings []LintFinding) map[string]int {
+	checks := make(map[string]int)
+	for _, f := range findings {
+		checks[f.Check]++
+	}
+	return checks
+}
+
+func TestLint(t *testing.T) {
+	m := New()
+	content := bytes.Repeat([]byte("content "), 20)
+	for _, name := range []string{"a", "b"} {
+		err := m.AddContent(content, name, 0644, Compress())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddContent([]byte("plain"), "c", 0777)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Sign(rand.Reader, key, SigAlgRsaPkcs1Sha1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := m.Lint()
+	checks := lintChecks(findings)
+	if len(findings) != 4 || checks[LintSHA1Only] != 1 || checks[LintUncompressed] != 1 ||
+		checks[LintUnusualMode] != 1 || checks[LintDuplicateContent] != 1 {
+		t.Fatalf("unexpected findings %+v", findings)
+	}
+	for _, f := range findings {
+		if f.Check == LintDuplicateContent && (f.Entry != "b" || f.Message != `entry has the same content as "a"`) {
+			t.Fatalf("unexpected duplicate content finding %+v", f)
+		}
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	m := New()
+	err := m.AddContent(bytes.Repeat([]byte("content "), 20), "a", 0755, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.SignAll(rand.Reader, SigningKey{key, SigAlgRsaPkcs1Sha1}, SigningKey{key, SigAlgRsaPkcs1Sha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := m.Lint()
+	if len(findings) != 0 {
+		t.Fatalf("expected no finding, got %+v", findings)
+	}
+}
+
+func TestLintSlack(t *testing.T) {
+	var m File
+	err := Unmarshal(rawMar(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := lintChecks(m.Lint())
+	if checks[LintSlack] != 3 || checks[LintUnsigned] != 1 {
+		t.Fatalf("unexpected findings %+v", checks)
+	}
+}
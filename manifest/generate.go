@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mozilla.org/mar"
+	im "go.mozilla.org/mar/internal/manifest"
+)
+
+// extensionsDir is the directory of the distribution extensions, which the
+// updater only adds files to if the extension is already installed
+const extensionsDir = "distribution/extensions/"
+
+// Complete returns the manifest of a complete update that adds the files
+// at paths, like make_full_update.sh does
+func Complete(paths []string) (*Manifest, error) {
+	m := &Manifest{Type: TypeComplete}
+	for _, path := range paths {
+		err := CheckPath(path)
+		if err != nil {
+			return nil, err
+		}
+		m.Instructions = append(m.Instructions, AddInstruction(path))
+	}
+	return m, nil
+}
+
+// AddInstruction returns the instruction that adds the file at path, which
+// is conditioned on the existence of the extension for files of distribution
+// extensions
+func AddInstruction(path string) Instruction {
+	if test := extensionTest(path); test != "" {
+		return Instruction{Op: OpAddIf, Test: test, Path: path}
+	}
+	return Instruction{Op: OpAdd, Path: path}
+}
+
+// PatchInstruction returns the instruction that patches the file at path
+// with the patch entry, which is conditioned on the existence of the
+// extension for files of distribution extensions
+func PatchInstruction(patch, path string) Instruction {
+	if test := extensionTest(path); test != "" {
+		return Instruction{Op: OpPatchIf, Test: test, Patch: patch, Path: path}
+	}
+	return Instruction{Op: OpPatch, Patch: patch, Path: path}
+}
+
+// extensionTest returns the directory of the distribution extension
+// the file at path belongs to, if any
+func extensionTest(path string) string {
+	if strings.HasPrefix(path, extensionsDir) {
+		rest := path[len(extensionsDir):]
+		if i := strings.IndexByte(rest, '/'); i > 0 {
+			return path[:len(extensionsDir)+i]
+		}
+	}
+	return ""
+}
+
+// CheckPath verifies a path can be written in a manifest
+func CheckPath(path string) error {
+	return im.CheckPath(path)
+}
+
+// CreateComplete returns a new MAR file of a complete update that contains
+// every regular file found under the root directory, as mar.CreateFromDir
+// does, along with the updatev3.manifest that adds them. The options are
+// also applied to the manifest entry.
+func CreateComplete(root string, opts ...mar.Option) (*mar.File, error) {
+	file, err := mar.CreateFromDir(root, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, idx := range file.Index {
+		if idx.FileName == V3Name || idx.FileName == V2Name {
+			return nil, fmt.Errorf("manifest: %s already contains a %s file", root, idx.FileName)
+		}
+		paths = append(paths, idx.FileName)
+	}
+	m, err := Complete(paths)
+	if err != nil {
+		return nil, err
+	}
+	data, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	err = file.AddContent(data, V3Name, 0644, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
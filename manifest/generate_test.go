@@ -0,0 +1,98 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.mozilla.org/mar"
+)
+
+func TestBytesRoundTrip(t *testing.T) {
+	m, err := Parse([]byte(partialManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, reparsed) {
+		t.Fatalf("expected %+v, got %+v", m, reparsed)
+	}
+}
+
+func TestBytesUnsafePath(t *testing.T) {
+	for _, inst := range []Instruction{
+		{Op: OpRemove, Path: "evil\"\nrmrfdir \"browser/"},
+		{Op: OpPatch, Patch: "foo\r.patch", Path: "foo"},
+		{Op: OpAddIf, Test: "", Path: "foo"},
+	} {
+		m := &Manifest{Type: TypePartial, Instructions: []Instruction{inst}}
+		_, err := m.Bytes()
+		if err == nil {
+			t.Fatalf("expected instruction %+v to be rejected", inst)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	m, err := Complete([]string{"firefox", "distribution/extensions/foo@bar/install.rdf", "distribution/extensions/foo.xpi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "type \"complete\"\n" +
+		"add \"firefox\"\n" +
+		"add-if \"distribution/extensions/foo@bar\" \"distribution/extensions/foo@bar/install.rdf\"\n" +
+		"add \"distribution/extensions/foo.xpi\"\n"
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Fatalf("expected manifest\n%s\ngot\n%s", expected, data)
+	}
+	_, err = Complete([]string{`bad"name`})
+	if err == nil {
+		t.Fatal("expected a path with a quote to be rejected")
+	}
+}
+
+func TestCreateComplete(t *testing.T) {
+	root, err := ioutil.TempDir("", "margo_manifest_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	err = os.MkdirAll(filepath.Join(root, "browser"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"firefox", "browser/omni.ja"} {
+		err = ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, err := CreateComplete(root, mar.Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := FromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Instruction{{Op: OpAdd, Path: "browser/omni.ja"}, {Op: OpAdd, Path: "firefox"}}
+	if m.Type != TypeComplete || !reflect.DeepEqual(m.Instructions, expected) {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	if !file.Content[V3Name].IsCompressed {
+		t.Fatal("expected manifest to be compressed")
+	}
+}
@@ -0,0 +1,99 @@
+// Package manifest parses the update manifests stored in MAR files.
+//
+// Complete and partial MAR files carry an updatev3.manifest entry, and
+// older ones an update.manifest entry, listing the operations the Firefox
+// updater applies to the installation: adding files from the MAR, patching
+// them, and removing files and directories. Each line holds an operation
+// followed by its arguments in double quotes:
+//
+//	type "partial"
+//	add "precomplete"
+//	add-if "distribution/extensions" "distribution/extensions/foo.xpi"
+//	patch-if "firefox.exe" "firefox.exe.patch" "firefox.exe"
+//	remove "uninstall.log"
+//	rmrfdir "extensions/"
+//
+// Parse reads the manifest of an existing MAR file, while Complete and
+// CreateComplete generate the manifest of a complete update.
+package manifest
+
+import (
+	"fmt"
+
+	"go.mozilla.org/mar"
+	im "go.mozilla.org/mar/internal/manifest"
+)
+
+// Names of the manifest entries in MAR files
+const (
+	// V3Name is the name of the manifest of recent MAR files
+	V3Name = im.V3Name
+	// V2Name is the name of the manifest of older MAR files
+	V2Name = im.V2Name
+)
+
+// Types of update
+const (
+	// TypeComplete is the type of an update that contains every file
+	TypeComplete = im.TypeComplete
+	// TypePartial is the type of an update that patches files
+	TypePartial = im.TypePartial
+)
+
+// Op is an operation of the manifest
+type Op = im.Op
+
+// Operations of the manifest
+const (
+	// OpAdd adds a file from the MAR
+	OpAdd = im.OpAdd
+	// OpAddIf adds a file from the MAR if the test path exists
+	OpAddIf = im.OpAddIf
+	// OpAddIfNot adds a file from the MAR if the test path does not exist
+	OpAddIfNot = im.OpAddIfNot
+	// OpPatch patches a file with a patch from the MAR
+	OpPatch = im.OpPatch
+	// OpPatchIf patches a file with a patch from the MAR if the test path exists
+	OpPatchIf = im.OpPatchIf
+	// OpRemove removes a file
+	OpRemove = im.OpRemove
+	// OpRmdir removes a directory if it is empty
+	OpRmdir = im.OpRmdir
+	// OpRmrfdir removes a directory and its content
+	OpRmrfdir = im.OpRmrfdir
+)
+
+// Manifest is a parsed update manifest
+type Manifest = im.Manifest
+
+// Instruction is a single operation of the manifest
+type Instruction = im.Instruction
+
+// SyntaxError is returned when a line of the manifest is invalid
+type SyntaxError = im.SyntaxError
+
+// Parse parses an uncompressed update manifest
+func Parse(data []byte) (*Manifest, error) {
+	return im.Parse(data)
+}
+
+// ParseEntry decompresses and parses the update manifest stored in a
+// MAR entry
+func ParseEntry(entry mar.Entry) (*Manifest, error) {
+	data, err := entry.Decompressed()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// FromFile parses the update manifest of a MAR file, trying V3Name
+// before V2Name
+func FromFile(file *mar.File) (*Manifest, error) {
+	for _, name := range []string{V3Name, V2Name} {
+		if entry, ok := file.Content[name]; ok {
+			return ParseEntry(entry)
+		}
+	}
+	return nil, fmt.Errorf("manifest: no %s or %s entry in the MAR file", V3Name, V2Name)
+}
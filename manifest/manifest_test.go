@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mozilla.org/mar"
+)
+
+const partialManifest = `type "partial"
+add "precomplete"
+add-if "distribution/extensions" "distribution/extensions/foo.xpi"
+add-if-not "defaults/pref/channel-prefs.js" "defaults/pref/channel-prefs.js"
+patch "libxul.so.patch" "libxul.so"
+patch-if "firefox.exe" "firefox.exe.patch" "firefox.exe"
+
+# removed files
+remove "uninstall.log"
+rmdir "old/"
+rmrfdir "extensions/"
+`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(partialManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != TypePartial {
+		t.Fatalf("expected type %q, got %q", TypePartial, m.Type)
+	}
+	expected := []Instruction{
+		{Op: OpAdd, Path: "precomplete"},
+		{Op: OpAddIf, Test: "distribution/extensions", Path: "distribution/extensions/foo.xpi"},
+		{Op: OpAddIfNot, Test: "defaults/pref/channel-prefs.js", Path: "defaults/pref/channel-prefs.js"},
+		{Op: OpPatch, Patch: "libxul.so.patch", Path: "libxul.so"},
+		{Op: OpPatchIf, Test: "firefox.exe", Patch: "firefox.exe.patch", Path: "firefox.exe"},
+		{Op: OpRemove, Path: "uninstall.log"},
+		{Op: OpRmdir, Path: "old/"},
+		{Op: OpRmrfdir, Path: "extensions/"},
+	}
+	if !reflect.DeepEqual(m.Instructions, expected) {
+		t.Fatalf("expected instructions %+v, got %+v", expected, m.Instructions)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		data string
+		line int
+	}{
+		{`type "complete" "partial"`, 1},
+		{"type \"complete\"\nunlink \"foo\"", 2},
+		{`add "foo" "bar"`, 1},
+		{`add foo`, 1},
+		{`add "foo`, 1},
+		{"\n\npatch-if \"foo\" \"bar\"", 3},
+	}
+	for i, testCase := range testCases {
+		_, err := Parse([]byte(testCase.data))
+		var synErr *SyntaxError
+		if !errors.As(err, &synErr) {
+			t.Fatalf("testcase %d expected a syntax error, got %v", i, err)
+		}
+		if synErr.Line != testCase.line {
+			t.Fatalf("testcase %d expected error on line %d, got %d", i, testCase.line, synErr.Line)
+		}
+	}
+}
+
+func TestFromFile(t *testing.T) {
+	file := mar.New()
+	err := file.AddContent([]byte(partialManifest), V3Name, 0644, mar.Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := FromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != TypePartial || len(m.Instructions) != 8 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	_, err = FromFile(mar.New())
+	if err == nil {
+		t.Fatal("expected a file without manifest to fail")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"crypto"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 )
 
@@ -58,6 +60,7 @@ type File struct {
 	OffsetToIndex            uint32                   `json:"offset_to_index" yaml:"offset_to_index"`
 	Size                     uint64                   `json:"size" yaml:"size"`
 	ProductInformation       string                   `json:"product_information,omitempty" yaml:"product_information,omitempty"`
+	ProductInfo              *ProductInfo             `json:"product_info,omitempty" yaml:"product_info,omitempty"`
 	SignaturesHeader         SignaturesHeader         `json:"signature_header" yaml:"signature_header"`
 	Signatures               []Signature              `json:"signatures" yaml:"signatures"`
 	AdditionalSectionsHeader AdditionalSectionsHeader `json:"additional_sections_header" yaml:"additional_sections_header"`
@@ -67,9 +70,19 @@ type File struct {
 	Content                  map[string]Entry         `json:"-" yaml:"-"`
 	Revision                 int                      `json:"revision" yaml:"revision"`
 
+	// Warnings lists the inconsistencies found while parsing the file
+	// in lenient mode, which would have failed the parsing otherwise
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+
 	// marshalForSignature is used to tell the marshaller to exclude
 	// signature data when preparing a file for signing
 	marshalForSignature bool
+
+	// layout is the layout of the content of a parsed file
+	layout *rawLayout
+
+	// debug receives the debug traces of the methods of the file
+	debug io.Writer
 }
 
 // SignaturesHeader contains the number of signatures in the MAR file
@@ -84,7 +97,7 @@ type Signature struct {
 	// Algorithm is a string that represents the signing algorithm name
 	Algorithm string `json:"algorithm" yaml:"algorithm"`
 	// Data is the signature bytes
-	Data []byte `json:"data" yaml:"-"`
+	Data []byte `json:"data" yaml:"data"`
 
 	// privateKey is a RSA private key used for signing the MAR file
 	privateKey crypto.PrivateKey
@@ -109,7 +122,7 @@ type AdditionalSectionsHeader struct {
 type AdditionalSection struct {
 	AdditionalSectionEntryHeader `json:"additional_section_entry" yaml:"additional_section_entry"`
 	// Data contains the additional section data
-	Data []byte `json:"data" yaml:"-"`
+	Data []byte `json:"data" yaml:"data"`
 }
 
 // AdditionalSectionEntryHeader is the header of each additional section
@@ -125,12 +138,14 @@ type AdditionalSectionEntryHeader struct {
 }
 
 // Entry is a single file entry in the MAR file. If IsCompressed is true, the content
-// is compressed with xz
+// is compressed in the format indicated by Compression
 type Entry struct {
 	// Data contains the raw data of the entry. It may still be compressed.
-	Data []byte `json:"data" yaml:"-"`
-	// IsCompressed is set to true if the Data is compressed with xz
-	IsCompressed bool `json:"is_compressed" yaml:"-"`
+	Data []byte `json:"data" yaml:"data"`
+	// IsCompressed is set to true if the Data is compressed
+	IsCompressed bool `json:"is_compressed" yaml:"is_compressed"`
+	// Compression is the compression format of the Data
+	Compression CompressionType `json:"compression" yaml:"compression"`
 }
 
 // IndexHeader is the size of the index section of the MAR file, in bytes
@@ -159,11 +174,31 @@ type IndexEntryHeader struct {
 }
 
 // New returns an initialized MAR data structure
-func New() *File {
+func New(opts ...Option) *File {
 	return &File{
 		MarID:    "MAR1",
 		Content:  make(map[string]Entry),
 		Revision: 2012,
+		debug:    newOptions(opts).debug,
+	}
+}
+
+// Reset clears the file such that it can be reused to Unmarshal another
+// MAR, which keeps the memory of its index, signatures, additional sections
+// and content map instead of allocating new ones. Data previously read from
+// the file, such as its entries, must not be used after it is Reset.
+func (file *File) Reset() {
+	content := file.Content
+	for name := range content {
+		delete(content, name)
+	}
+	*file = File{
+		Signatures:         file.Signatures[:0],
+		AdditionalSections: file.AdditionalSections[:0],
+		Index:              file.Index[:0],
+		Content:            content,
+		Warnings:           file.Warnings[:0],
+		debug:              file.debug,
 	}
 }
 
@@ -174,17 +209,88 @@ func New() *File {
 // There's a bit of magic in this function to detect which version of a MAR we're
 // dealing with, and store that in the Revision field of the file. 2005 is an old
 // MAR, 2012 is a current one with signatures and additional sections.
-func Unmarshal(input []byte, file *File) error {
-	switch file.Size = uint64(len(input)); {
+//
+// With the SkipContent option, the content of entries is not loaded and
+// file.Content is left nil. The index is still fully validated. With the
+// ZeroCopy option, the Data of entries points into input instead of being
+// copied, so input must not be modified for as long as the File is used.
+// The WithLimits option changes the limits the parser enforces, and the
+// Strict and Lenient options how strictly the layout of the file is checked.
+// Entries with the same name are rejected unless the OnDuplicates option
+// sets how to resolve them.
+// When the file has an entry hashes section and its content is loaded, the
+// content of every entry is checked against it.
+func Unmarshal(input []byte, file *File, opts ...Option) error {
+	o := newOptions(opts)
+	p := newParser(input)
+	p.limits = o.limits
+	p.mode = o.mode
+	p.names = o.nameRules()
+	p.duplicates = o.duplicates
+	p.debug = o.debug
+	file.debug = o.debug
+	err := unmarshalHeaders(p, file)
+	if err != nil {
+		return err
+	}
+	// everything but the content has been parsed at this point
+	prog := newProgress(o.progress, p.size)
+	var contentSize uint64
+	for _, idxEntry := range file.Index {
+		contentSize += uint64(idxEntry.Size)
+	}
+	if contentSize < p.size {
+		prog.add(p.size-contentSize, "index")
+	}
+	if o.skipContent {
+		file.Content = nil
+		return nil
+	}
+	if o.zeroCopy {
+		err = unmarshalContentZeroCopy(input, file, prog)
+	} else {
+		err = unmarshalContent(p, file, prog)
+	}
+	if err != nil {
+		return err
+	}
+	err = recordLayout(p, file)
+	if err != nil {
+		return err
+	}
+	return checkEntryHashes(p, file)
+}
+
+// checkEntryHashes verifies the content of a parsed file against its
+// entry hashes section, if it has one, decompressing entries up to the
+// MaxDecompressedSize limit. Mismatches are only recorded as warnings in
+// lenient mode.
+func checkEntryHashes(p *parser, file *File) error {
+	err := file.verifyEntryHashes(p.limits.MaxDecompressedSize)
+	switch {
+	case err == nil || err == errNoEntryHashes:
+		return nil
+	case p.mode == lenientMode:
+		file.addWarning("%v", err)
+		return nil
+	}
+	return err
+}
+
+// unmarshalHeaders parses everything but the content of a MAR file: the
+// headers, signatures, additional sections and index. The chunks of content
+// referenced by the index are reserved in the parser, such that overlapping
+// entries are rejected even if their content is never loaded.
+func unmarshalHeaders(p *parser, file *File) error {
+	switch file.Size = p.size; {
 	case file.Size < limitMinFileSize:
-		debugPrint("input=%d < limit=%d\n", file.Size, limitMinFileSize)
+		debugf(p.debug, "input=%d < limit=%d\n", file.Size, limitMinFileSize)
 		return errTooSmall
-	case file.Size > limitMaxFileSize:
-		debugPrint("input=%d > limit=%d\n", file.Size, limitMaxFileSize)
-		return errTooBig
 	}
-
-	p := newParser(input)
+	err := checkLimit(p.debug, "MaxTotalSize", file.Size, p.limits.MaxTotalSize)
+	if err != nil {
+		return err
+	}
 
 	//  A modern MAR is composed of the following fields, in bytes:
 	//  0                   1
@@ -207,9 +313,9 @@ func Unmarshal(input []byte, file *File) error {
 
 	// Parse the MAR ID
 	marid := make([]byte, MarIDLen, MarIDLen)
-	err := p.parse(&marid, MarIDLen)
+	err = p.parse(marid, MarIDLen)
 	if err != nil {
-		return fmt.Errorf("mar id parsing failed: %v", err)
+		return &ParseError{Section: "mar id", Offset: p.cursor, Err: err}
 	}
 	file.MarID = string(marid)
 	if file.MarID != "MAR1" {
@@ -217,43 +323,56 @@ func Unmarshal(input []byte, file *File) error {
 	}
 
 	// Parse the offset to the index
-	err = p.parse(&file.OffsetToIndex, OffsetToIndexLen)
+	file.OffsetToIndex, err = p.parseUint32()
 	if err != nil {
-		return fmt.Errorf("offset parsing failed: %v", err)
+		return &ParseError{Section: "offset", Offset: p.cursor, Err: err}
 	}
 
 	// parse the index
 	p.cursor = uint64(file.OffsetToIndex)
-	err = p.parse(&file.IndexHeader, IndexHeaderLen)
+	file.IndexHeader.Size, err = p.parseUint32()
 	if err != nil {
-		return fmt.Errorf("index header parsing failed: %v", err)
+		return &ParseError{Section: "index header", Offset: p.cursor, Err: err}
 	}
 	if file.IndexHeader.Size < IndexEntryHeaderLen {
 		return errIndexTooSmall
 	}
 
-	for i := 0; ; i++ {
-		var (
-			idxEntryHeader IndexEntryHeader
-			idxEntry       IndexEntry
-		)
-		// don't read beyond the end of the file
-		if uint64(p.cursor) >= file.Size {
-			break
+	// the index entries run until the end of the file, so we read
+	// them all at once and parse them from memory
+	if p.cursor > file.Size {
+		return errInputTooShort
+	}
+	indexStart := p.cursor
+	indexEnd := file.Size
+	if p.mode == lenientMode && indexStart+uint64(file.IndexHeader.Size) < file.Size {
+		// only parse the announced index and ignore the trailing data
+		indexEnd = indexStart + uint64(file.IndexHeader.Size)
+		file.addWarning("ignored %d bytes of trailing data after the index", file.Size-indexEnd)
+	}
+	index := make([]byte, indexEnd-indexStart)
+	err = p.parse(index, len(index))
+	if err != nil {
+		return &ParseError{Section: "index", Offset: p.cursor, Err: err}
+	}
+	for pos := 0; pos < len(index); {
+		var idxEntry IndexEntry
+		if len(index)-pos < IndexEntryHeaderLen {
+			return &ParseError{Section: "index entry", Offset: indexStart + uint64(pos), Err: errInputTooShort}
 		}
-		err = p.parse(&idxEntryHeader, IndexEntryHeaderLen)
-		if err != nil {
-			return fmt.Errorf("index entry parsing failed: %v", err)
+		idxEntry.OffsetToContent = binary.BigEndian.Uint32(index[pos : pos+4])
+		idxEntry.Size = binary.BigEndian.Uint32(index[pos+4 : pos+8])
+		idxEntry.Flags = binary.BigEndian.Uint32(index[pos+8 : pos+12])
+		pos += IndexEntryHeaderLen
+		if uint64(idxEntry.OffsetToContent)+uint64(idxEntry.Size) > file.Size {
+			return &ParseError{Section: "index entry", Offset: indexStart + uint64(pos-IndexEntryHeaderLen), Err: errMalformedContentOverrun}
 		}
-
-		idxEntry.Size = idxEntryHeader.Size
-		idxEntry.Flags = idxEntryHeader.Flags
-		idxEntry.OffsetToContent = idxEntryHeader.OffsetToContent
-		if uint64(idxEntry.OffsetToContent+idxEntry.Size) > file.Size {
-			return errMalformedContentOverrun
+		err = checkLimit(p.debug, "MaxEntrySize", uint64(idxEntry.Size), uint64(p.limits.MaxEntrySize))
+		if err != nil {
+			return err
 		}
 
-		endNamePos := bytes.Index(input[p.cursor:], []byte("\x00"))
+		endNamePos := bytes.IndexByte(index[pos:], 0)
 
 		// apply some sanity checking on filenames.
 		// they shouldn't be longer than 1024 characters, and their length
@@ -261,32 +380,53 @@ func Unmarshal(input []byte, file *File) error {
 		if endNamePos < 0 {
 			return errMalformedIndexFileName
 		}
-		if endNamePos > limitFileNameLength {
-			return errIndexFileNameTooBig
+		err = checkLimit(p.debug, "MaxFileNameLength", uint64(endNamePos), uint64(p.limits.MaxFileNameLength))
+		if err != nil {
+			return err
 		}
-		if (p.cursor + uint64(endNamePos)) > file.Size {
+		if pos+endNamePos > len(index) {
 			return errIndexFileNameOverrun
-
 		}
-		idxEntry.FileName = string(input[p.cursor : p.cursor+uint64(endNamePos)])
+		idxEntry.FileName = string(index[pos : pos+endNamePos])
+		if p.names != nil {
+			err = p.names.Check(idxEntry.FileName)
+			if err != nil {
+				return &ParseError{Section: "index entry", Offset: indexStart + uint64(pos-IndexEntryHeaderLen), Err: err}
+			}
+		}
 
-		// manually move the cursor to the end of the filename
-		p.cursor = p.cursor + uint64(endNamePos) + 1
+		// move the position to the end of the filename
+		pos += endNamePos + 1
 
 		file.Index = append(file.Index, idxEntry)
+		err = checkLimit(p.debug, "MaxIndexEntries", uint64(len(file.Index)), uint64(p.limits.MaxIndexEntries))
+		if err != nil {
+			return err
+		}
+	}
+	if p.mode == strictMode && uint64(file.IndexHeader.Size) != uint64(len(index)) {
+		debugf(p.debug, "index header size=%d; index entries=%d\n", file.IndexHeader.Size, len(index))
+		return errIndexSizeMismatch
 	}
+	// entries removed as duplicates still go through the checks of their
+	// content, such that they can't overlap other entries or leave gaps
+	removed := resolveDuplicates(p, file)
+	all := append(append([]IndexEntry{}, file.Index...), removed...)
 
-	// evaluate the first index entry and if the offset to content is set to byte 8,
-	// we have an old MAR that has no signature or additional sections
+	// if the content of an index entry is set to start at byte 8, we have
+	// an old MAR that has no signature or additional sections. All the
+	// entries are looked at since the index of old MARs is not always in
+	// the order of the content.
 	if len(file.Index) < 1 {
 		return errIndexTooSmall
 	}
-	if file.Index[0].OffsetToContent == MarIDLen+OffsetToIndexLen {
+	contentStart := uint64(MarIDLen + OffsetToIndexLen)
+	if isOldLayout(all) {
 		file.Revision = 2005
 		// use the input len as a file size since we don't have one in the headers
-		file.Size = uint64(len(input))
+		file.Size = p.size
 		// skip the signature and additonal section parsing, we have none
-		goto parseContent
+		goto reserveContent
 	}
 
 	// go back to the beginning of the signatures block
@@ -294,38 +434,90 @@ func Unmarshal(input []byte, file *File) error {
 	file.Revision = 2012
 
 	// Parse the total file size header
-	err = p.parse(&file.Size, FileSizeLen)
+	file.Size, err = p.parseUint64()
 	if err != nil {
-		return fmt.Errorf("total file size header parsing failed: %v", err)
+		return &ParseError{Section: "total file size header", Offset: p.cursor, Err: err}
 	}
 	// make sure the file size is consistent with the offsets and index len
-	if file.Size != uint64(file.OffsetToIndex+file.IndexHeader.Size+IndexHeaderLen) {
-		debugPrint("filesize=%d; offset to index=%d; index size=%d\n",
+	// the sum is done on 64 bits so crafted offsets can't wrap around
+	if file.Size != uint64(file.OffsetToIndex)+uint64(file.IndexHeader.Size)+IndexHeaderLen {
+		debugf(p.debug, "filesize=%d; offset to index=%d; index size=%d\n",
 			file.Size, file.OffsetToIndex, file.IndexHeader.Size)
-		return errMalformedFileSize
+		if p.mode != lenientMode {
+			return errMalformedFileSize
+		}
+		file.addWarning("total file size header of %d does not match offset to index %d + index size %d",
+			file.Size, file.OffsetToIndex, file.IndexHeader.Size+IndexHeaderLen)
+	}
+	err = unmarshalSignaturesAndSections(p, file)
+	if err != nil {
+		return err
+	}
+
+	// content starts right after the additional sections
+	contentStart = p.cursor
+
+	// reserve the chunks of content referenced by the index, which
+	// prevents multiple index entries from pointing to the same data
+reserveContent:
+	for _, idxEntry := range all {
+		err = checkContentRange(p.debug, idxEntry, contentStart, uint64(file.OffsetToIndex))
+		if err != nil {
+			return &ParseError{Section: "content", Offset: uint64(idxEntry.OffsetToContent), Err: err}
+		}
+		p.cursor = uint64(idxEntry.OffsetToContent)
+		err = p.reserve64(uint64(idxEntry.Size))
+		if err != nil {
+			return err
+		}
+	}
+	if p.mode == strictMode {
+		return checkContentGaps(p.debug, all, contentStart, uint64(file.OffsetToIndex))
+	}
+	return nil
+}
+
+// isOldLayout returns true if the content of an index entry starts right
+// after the MAR ID and offset to index, where the headers of a modern MAR are
+func isOldLayout(index []IndexEntry) bool {
+	for _, idx := range index {
+		if idx.OffsetToContent == MarIDLen+OffsetToIndexLen {
+			return true
+		}
 	}
+	return false
+}
+
+// unmarshalSignaturesAndSections parses the signatures and additional
+// sections of a file, starting at the cursor of the parser
+func unmarshalSignaturesAndSections(p *parser, file *File) error {
+	var err error
 	// Parse the signatures header
-	err = p.parse(&file.SignaturesHeader, SignaturesHeaderLen)
+	file.SignaturesHeader.NumSignatures, err = p.parseUint32()
+	if err != nil {
+		return &ParseError{Section: "signatures header", Offset: p.cursor, Err: err}
+	}
+
+	err = checkLimit(p.debug, "MaxSignatures", uint64(file.SignaturesHeader.NumSignatures), uint64(p.limits.MaxSignatures))
 	if err != nil {
-		return fmt.Errorf("total file size header parsing failed: %v", err)
+		return err
 	}
 
 	// Parse each signature and append them to the File
 	for i := uint32(0); i < file.SignaturesHeader.NumSignatures; i++ {
-		var (
-			sigEntryHeader SignatureEntryHeader
-			sig            Signature
-		)
+		var sig Signature
 
-		err = p.parse(&sigEntryHeader, SignatureEntryHeaderLen)
+		sig.AlgorithmID, err = p.parseUint32()
 		if err != nil {
-			return fmt.Errorf("signature entry header parsing failed: %v", err)
+			return &ParseError{Section: "signature entry header", Offset: p.cursor, Err: err}
 		}
-
-		sig.AlgorithmID = sigEntryHeader.AlgorithmID
-		sig.Size = sigEntryHeader.Size
-		if sig.Size > limitMaxSignatureSize {
-			return errSignatureTooBig
+		sig.Size, err = p.parseUint32()
+		if err != nil {
+			return &ParseError{Section: "signature entry header", Offset: p.cursor, Err: err}
+		}
+		err = checkLimit(p.debug, "MaxSignatureSize", uint64(sig.Size), uint64(p.limits.MaxSignatureSize))
+		if err != nil {
+			return err
 		}
 		sig.Algorithm = getSigAlgNameFromID(sig.AlgorithmID)
 		if sig.Algorithm == "unknown" {
@@ -333,250 +525,515 @@ func Unmarshal(input []byte, file *File) error {
 		}
 
 		sig.Data = make([]byte, sig.Size, sig.Size)
-		err = p.parse(&sig.Data, int(sig.Size))
+		err = p.parse(sig.Data, len(sig.Data))
 		if err != nil {
-			return fmt.Errorf("signature data parsing failed: %v", err)
+			return &ParseError{Section: "signature data", Offset: p.cursor, Err: err}
 		}
 		file.Signatures = append(file.Signatures, sig)
 	}
 
 	// Parse the additional sections header
-	err = p.parse(&file.AdditionalSectionsHeader, AdditionalSectionsHeaderLen)
+	file.AdditionalSectionsHeader.NumAdditionalSections, err = p.parseUint32()
+	if err != nil {
+		return &ParseError{Section: "additional section header", Offset: p.cursor, Err: err}
+	}
+
+	err = checkLimit(p.debug, "MaxAdditionalSections", uint64(file.AdditionalSectionsHeader.NumAdditionalSections), uint64(p.limits.MaxAdditionalSections))
 	if err != nil {
-		return fmt.Errorf("additional section header parsing failed: %v", err)
+		return err
 	}
 
 	// Parse each additional section and append them to the File
 	for i := uint32(0); i < file.AdditionalSectionsHeader.NumAdditionalSections; i++ {
-		var (
-			ash AdditionalSectionEntryHeader
-			as  AdditionalSection
-		)
+		var as AdditionalSection
 
-		err = p.parse(&ash, AdditionalSectionsEntryHeaderLen)
+		as.BlockSize, err = p.parseUint32()
 		if err != nil {
-			return fmt.Errorf("additional section entry header parsing failed: %v", err)
+			return &ParseError{Section: "additional section entry header", Offset: p.cursor, Err: err}
 		}
-
-		as.BlockID = ash.BlockID
-		as.BlockSize = ash.BlockSize
-		if as.BlockSize > limitMaxAdditionalDataSize {
-			debugPrint("block size %d is larger than limit %d\n", as.BlockSize, limitMaxAdditionalDataSize)
-			return errAdditionalDataTooBig
+		as.BlockID, err = p.parseUint32()
+		if err != nil {
+			return &ParseError{Section: "additional section entry header", Offset: p.cursor, Err: err}
+		}
+		err = checkLimit(p.debug, "MaxAdditionalSectionSize", uint64(as.BlockSize), uint64(p.limits.MaxAdditionalSectionSize))
+		if err != nil {
+			return err
+		}
+		if as.BlockSize < AdditionalSectionsEntryHeaderLen {
+			return errAdditionalDataTooSmall
 		}
-		dataSize := ash.BlockSize - AdditionalSectionsEntryHeaderLen
+		dataSize := as.BlockSize - AdditionalSectionsEntryHeaderLen
 		as.Data = make([]byte, dataSize, dataSize)
 
-		err = p.parse(&as.Data, int(dataSize))
+		err = p.parse(as.Data, len(as.Data))
 		if err != nil {
-			return fmt.Errorf("additional section data parsing failed: %v", err)
+			return &ParseError{Section: "additional section data", Offset: p.cursor, Err: err}
 		}
 
-		switch ash.BlockID {
-		case BlockIDProductInfo:
-			// remove all the null bytes from the product info string
-			file.ProductInformation = fmt.Sprintf("%s", strings.Replace(strings.Trim(string(as.Data), "\x00"), "\x00", " ", -1))
+		if as.BlockID == BlockIDProductInfo {
+			file.cacheProductInfo(as.Data)
 		}
 		file.AdditionalSections = append(file.AdditionalSections, as)
 	}
+	return nil
+}
 
-	// parse the content
-parseContent:
-	file.Content = make(map[string]Entry)
+// checkContentRange verifies the content of an index entry is located
+// between the end of the headers and the beginning of the index, such
+// that it can't be confused with the signed headers or the signatures,
+// which Firefox's libmar also refuses
+func checkContentRange(debug io.Writer, idx IndexEntry, contentStart, offsetToIndex uint64) error {
+	start := uint64(idx.OffsetToContent)
+	if start < contentStart {
+		debugf(debug, "entry %q starts at %d before end of headers at %d\n", idx.FileName, start, contentStart)
+		return errContentOverlapsHeaders
+	}
+	if start+uint64(idx.Size) > offsetToIndex {
+		debugf(debug, "entry %q ends at %d after start of index at %d\n", idx.FileName, start+uint64(idx.Size), offsetToIndex)
+		return errContentOverlapsIndex
+	}
+	return nil
+}
+
+// checkContentGaps verifies the content of the index entries fills the
+// space between the headers and the index, such that no unreferenced
+// data hides in the signed part of the file
+func checkContentGaps(debug io.Writer, index []IndexEntry, contentStart, offsetToIndex uint64) error {
+	entries := make([]IndexEntry, len(index))
+	copy(entries, index)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].OffsetToContent < entries[j].OffsetToContent
+	})
+	pos := contentStart
+	for _, idx := range entries {
+		if uint64(idx.OffsetToContent) != pos {
+			debugf(debug, "gap between %d and entry %q at %d\n", pos, idx.FileName, idx.OffsetToContent)
+			return errContentGap
+		}
+		pos += uint64(idx.Size)
+	}
+	if pos != offsetToIndex {
+		debugf(debug, "gap between %d and index at %d\n", pos, offsetToIndex)
+		return errContentGap
+	}
+	return nil
+}
+
+// tracef writes a debug trace to the debug writer of the file, if any
+func (file *File) tracef(format string, a ...interface{}) {
+	debugf(file.debug, format, a...)
+}
+
+// addWarning records a warning about an inconsistency found while parsing
+func (file *File) addWarning(format string, a ...interface{}) {
+	file.tracef("warning: "+format+"\n", a...)
+	file.Warnings = append(file.Warnings, fmt.Sprintf(format, a...))
+}
+
+// unmarshalContent reads the content of each index entry from the
+// parser into the Content map of the file
+func unmarshalContent(p *parser, file *File, prog *progress) error {
+	file.Content = newContentMap(file)
 	for _, idxEntry := range file.Index {
 		var entry Entry
 		// copy the content from the input buffer into the entry data.
 		// security checks were already done when parsing the index, so
 		// we know this is safe
 		entry.Data = make([]byte, idxEntry.Size, idxEntry.Size)
-		p.cursor = uint64(idxEntry.OffsetToContent)
-		err = p.parse(entry.Data, int(idxEntry.Size))
+		err := p.readAt(entry.Data, uint64(idxEntry.OffsetToContent))
 		if err != nil {
 			return err
 		}
-		// move the cursor to the location of the content
-		// files in MAR archives can be compressed with xz, so we test
-		// the first 6 bytes to check for that
-		//                                                             /---XZ's magic number--\
-		if len(entry.Data) > 6 && bytes.Equal(entry.Data[0:6], []byte("\xFD\x37\x7A\x58\x5A\x00")) {
-			entry.IsCompressed = true
+		entry.Compression = detectCompression(entry.Data)
+		entry.IsCompressed = entry.Compression != CompressionNone
+		if _, ok := file.Content[idxEntry.FileName]; ok {
+			return fmt.Errorf("%w: file named %q already exists in the archive", ErrDuplicateEntry, idxEntry.FileName)
 		}
+		file.Content[idxEntry.FileName] = entry
+		prog.add(uint64(idxEntry.Size), idxEntry.FileName)
+	}
+	return nil
+}
+
+// newContentMap returns the map the content of a parsed file is stored in.
+// The empty map of a file that was Reset is reused.
+func newContentMap(file *File) map[string]Entry {
+	if file.Content != nil && len(file.Content) == 0 {
+		return file.Content
+	}
+	return make(map[string]Entry, len(file.Index))
+}
+
+// unmarshalContentZeroCopy sets the data of each index entry to the
+// slice of the input that contains it, without copying it
+func unmarshalContentZeroCopy(input []byte, file *File, prog *progress) error {
+	file.Content = newContentMap(file)
+	for _, idxEntry := range file.Index {
+		var entry Entry
+		// security checks were already done when parsing the index, so
+		// we know the slice is within the input. its capacity is capped
+		// such that appending to it can't overwrite the rest of the input
+		start := uint64(idxEntry.OffsetToContent)
+		end := start + uint64(idxEntry.Size)
+		entry.Data = input[start:end:end]
+		entry.Compression = detectCompression(entry.Data)
+		entry.IsCompressed = entry.Compression != CompressionNone
 		if _, ok := file.Content[idxEntry.FileName]; ok {
-			return fmt.Errorf("file named %q already exists in the archive, duplicates are not permitted", idxEntry.FileName)
+			return fmt.Errorf("%w: file named %q already exists in the archive", ErrDuplicateEntry, idxEntry.FileName)
 		}
 		file.Content[idxEntry.FileName] = entry
+		prog.add(uint64(idxEntry.Size), idxEntry.FileName)
 	}
 	return nil
 }
 
+// productInfoString returns the data of a product information block
+// as a string, with all the null bytes removed
+func productInfoString(data []byte) string {
+	return strings.Replace(strings.Trim(string(data), "\x00"), "\x00", " ", -1)
+}
+
 // Marshal returns an []byte of the marshalled MAR file that follows the
 // expected MAR binary format. It expects a properly constructed MAR object
 // with the index and content already in place. It also should already be
 // signed, as the output of this function can no longer be modified.
-func (file *File) Marshal() ([]byte, error) {
-	var (
-		offsetToContent, sigSizes int
-		output                    []byte
-	)
-	buf := new(bytes.Buffer)
+//
+// The signatures and additional sections headers, the index entries offsets
+// and sizes, the index header, the offset to index and the total file size
+// are all recomputed from the signatures, additional sections and content
+// of the file, and updated in the File to reflect what was written out.
+// With the TransformWith or Deterministic options, they are recomputed on a
+// copy of the file instead and the File itself is left untouched.
+//
+// The output is checked against the limits of the parser, such that it can
+// be parsed back. Use the WithLimits option to change them.
+func (file *File) Marshal(opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+	// reset the signature flag when the function exits, whether
+	// or not the file has signatures to skip
+	defer func() { file.marshalForSignature = false }()
 
-	// Write the headers
-	if file.MarID != "MAR1" {
-		return nil, errBadMarID
+	if len(o.transforms) > 0 || o.deterministic {
+		t, err := file.transformed(o.transforms)
+		if err != nil {
+			return nil, err
+		}
+		if o.deterministic {
+			t.canonicalize()
+		}
+		return t.Marshal(WithLimits(o.limits), WithProgress(o.progress), WithDebugWriter(o.debug))
 	}
-	err := binary.Write(buf, binary.BigEndian, []byte(file.MarID))
+
+	total, err := file.prepareMarshal(o.limits)
 	if err != nil {
 		return nil, err
 	}
-	err = binary.Write(buf, binary.BigEndian, file.OffsetToIndex)
+	buf := new(bytes.Buffer)
+	buf.Grow(int(total))
+	err = file.marshalTo(buf, newProgress(o.progress, total))
 	if err != nil {
 		return nil, err
 	}
-	err = binary.Write(buf, binary.BigEndian, file.Size)
+	return buf.Bytes(), nil
+}
+
+// WriteSignedData writes the data covered by the signatures of the file to
+// w, which is the output of MarshalForSignature, without building it in
+// memory. Passing a hash.Hash as w computes the digest to sign or verify
+// without a copy of the whole file.
+func (file *File) WriteSignedData(w io.Writer) error {
+	file.marshalForSignature = true
+	defer func() { file.marshalForSignature = false }()
+	total, err := file.prepareMarshal(DefaultLimits())
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return file.marshalTo(w, newProgress(nil, total))
+}
+
+// prepareMarshal checks that the file can be marshalled, updates its
+// headers and offsets, and returns the size of its output
+func (file *File) prepareMarshal(limits Limits) (uint64, error) {
+	if file.MarID != "MAR1" {
+		return 0, errBadMarID
+	}
+	for _, sig := range file.Signatures {
+		if !file.marshalForSignature && uint32(len(sig.Data)) != sig.Size {
+			return 0, errSignatureSizeMismatch
+		}
+	}
+	for _, idx := range file.Index {
+		if _, ok := file.Content[idx.FileName]; !ok {
+			return 0, errIndexBadContentReference
+		}
 	}
-	err = binary.Write(buf, binary.BigEndian, file.SignaturesHeader)
+	file.Normalize()
+	err := file.checkLimits(limits)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	if file.OffsetToIndex < uint32(limitMinFileSize-IndexHeaderLen) {
+		return 0, errOffsetTooSmall
+	}
+	total := file.Size
+	if file.layout != nil {
+		total += uint64(len(file.layout.trailer))
+	}
+	return total, nil
+}
+
+// marshalTo writes the file to w once prepareMarshal has updated its layout
+func (file *File) marshalTo(w io.Writer, prog *progress) error {
+	cw := &countingWriter{w: w}
+	err := file.marshalHeaders(cw)
+	if err != nil {
+		return err
+	}
+	prog.add(uint64(cw.n), "headers")
+
+	// Write the content of each entry at its offset, along with the data
+	// found between entries when the file was parsed, if any
+	pos := file.contentStart()
+	for _, chunk := range file.contentChunks() {
+		if chunk.offset > pos {
+			_, err = cw.Write(make([]byte, chunk.offset-pos))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = cw.Write(chunk.data)
+		if err != nil {
+			return err
+		}
+		pos = chunk.offset + uint64(len(chunk.data))
+		prog.add(uint64(cw.n)-prog.done, chunk.name)
+	}
+
+	err = file.marshalIndex(cw)
+	if err != nil {
+		return err
+	}
+	if file.layout != nil {
+		_, err = cw.Write(file.layout.trailer)
+		if err != nil {
+			return err
+		}
+	}
+	prog.add(uint64(cw.n)-prog.done, "index")
+	return nil
+}
+
+// marshalHeaders writes the headers, signatures and additional sections
+// of the file, which is everything that comes before the content
+func (file *File) marshalHeaders(w io.Writer) error {
+	err := binary.Write(w, binary.BigEndian, []byte(file.MarID))
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, file.OffsetToIndex)
+	if err != nil {
+		return err
+	}
+	if file.isOldFormat() {
+		// old files have no size, signatures or additional sections
+		return nil
+	}
+	err = binary.Write(w, binary.BigEndian, file.Size)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, file.SignaturesHeader)
+	if err != nil {
+		return err
 	}
-	// start the cursor after the headers
-	offsetToContent = MarIDLen + OffsetToIndexLen + FileSizeLen + SignaturesHeaderLen
 
 	// Write the signatures
 	for _, sig := range file.Signatures {
-		err = binary.Write(buf, binary.BigEndian, sig.AlgorithmID)
+		err = binary.Write(w, binary.BigEndian, sig.AlgorithmID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		err = binary.Write(buf, binary.BigEndian, sig.Size)
+		err = binary.Write(w, binary.BigEndian, sig.Size)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		// If we're marshalling for signature, skip the actual signature data
-		// from the output, but count it in the total size and offsets
-		if file.marshalForSignature {
-			// reset the flag when the function exits
-			defer func() { file.marshalForSignature = false }()
-			// even though we're not writing the signature, we still need
-			// to account for its size in the offsets and total
-			sigSizes += int(sig.Size)
-		} else {
-			// if we're not preparing a signable block,
-			// include the signature data
-			_, err = buf.Write(sig.Data)
+		// from the output. Its size is still accounted for in the offsets and
+		// total size, since those were computed for the final file.
+		if !file.marshalForSignature {
+			_, err = w.Write(sig.Data)
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
-		offsetToContent += SignatureEntryHeaderLen + int(sig.Size)
 	}
-	err = binary.Write(buf, binary.BigEndian, file.AdditionalSectionsHeader)
+
+	// Write the additional sections
+	err = binary.Write(w, binary.BigEndian, file.AdditionalSectionsHeader)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	offsetToContent += AdditionalSectionsHeaderLen
 	for _, as := range file.AdditionalSections {
-		err = binary.Write(buf, binary.BigEndian, as.BlockSize)
+		err = binary.Write(w, binary.BigEndian, as.BlockSize)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		err = binary.Write(buf, binary.BigEndian, as.BlockID)
+		err = binary.Write(w, binary.BigEndian, as.BlockID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		err = binary.Write(buf, binary.BigEndian, as.Data)
+		_, err = w.Write(as.Data)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		offsetToContent += int(as.BlockSize)
 	}
+	return nil
+}
 
-	// We need to create the index that will go to the end of the file.
-	// For that, we create a new buffer where index entries will be written to,
-	// then process each index entry, add them to the index buffer and add the
-	// content to the main buffer.
-	idxBuf := new(bytes.Buffer)
+// marshalIndex writes the index header and entries that go at the end of the file
+func (file *File) marshalIndex(w io.Writer) error {
+	err := binary.Write(w, binary.BigEndian, file.IndexHeader)
+	if err != nil {
+		return err
+	}
 	for _, idx := range file.Index {
-		if _, ok := file.Content[idx.FileName]; !ok {
-			return nil, errIndexBadContentReference
-		}
 		// Write the index entry piece by piece:
 		// first we put the offset to content
 		// then the size of the content
 		// then the permission flags
 		// and finally the filename, with a null terminator
-		err = binary.Write(idxBuf, binary.BigEndian, uint32(offsetToContent))
-		if err != nil {
-			return nil, err
-		}
-		err = binary.Write(idxBuf, binary.BigEndian, uint32(len(file.Content[idx.FileName].Data)))
-		if err != nil {
-			return nil, err
-		}
-		err = binary.Write(idxBuf, binary.BigEndian, idx.Flags)
-		if err != nil {
-			return nil, err
-		}
-		err = binary.Write(idxBuf, binary.BigEndian, []byte(idx.FileName))
+		err = binary.Write(w, binary.BigEndian, idx.IndexEntryHeader)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		_, err = idxBuf.Write([]byte("\x00"))
+		_, err = io.WriteString(w, idx.FileName+"\x00")
 		if err != nil {
-			return nil, err
+			return err
 		}
-		// with the index in place, we append the content to the main buffer
-		// and increase the value of offsetToContent to reflect how far into
-		// the main buffer we will be writing next
-		buf.Write(file.Content[idx.FileName].Data)
-		offsetToContent += int(idx.Size)
 	}
-	// rewrite the index header size now that we know it's final size
-	file.IndexHeader.Size = uint32(idxBuf.Len())
-	finalIdxBuf := new(bytes.Buffer)
-	err = binary.Write(finalIdxBuf, binary.BigEndian, file.IndexHeader)
-	if err != nil {
-		return nil, err
-	}
-	finalIdxBuf.Write(idxBuf.Bytes())
+	return nil
+}
 
-	output = append(output, buf.Bytes()...)
-	output = append(output, finalIdxBuf.Bytes()...)
+// Normalize recomputes the sizes and offsets stored in the headers
+// and index of the file from its signatures, additional sections and
+// content, such that they describe the file Marshal will write out: the
+// signatures and additional sections headers, the block size of additional
+// sections, the offset and size of each index entry, the index header size,
+// the offset to the index and the total file size. Marshal, and the methods
+// that add or remove signatures, sections and entries call it, so a File
+// built in memory never has to be kept consistent by hand, but it can be
+// called directly to inspect or Validate a File before it is marshalled.
+// The content of a parsed file keeps its original layout, including any
+// data between entries, as long as the entries are left untouched.
+func (file *File) Normalize() {
+	file.SignaturesHeader.NumSignatures = uint32(len(file.Signatures))
+	file.AdditionalSectionsHeader.NumAdditionalSections = uint32(len(file.AdditionalSections))
 
-	// update the total size directly in the output data.
-	// this is basically the size of both the main and index buffer, but also the
-	// size of any future signatures if we're marshalling for signature (otherwise
-	// sigSizes is zero because the signature data is already in buf)
-	file.Size = uint64(buf.Len() + finalIdxBuf.Len() + sigSizes)
-	fsizeBuf := new(bytes.Buffer)
-	err = binary.Write(fsizeBuf, binary.BigEndian, file.Size)
-	if err != nil {
-		return nil, err
+	for i := range file.AdditionalSections {
+		// the block size includes the header of the section
+		file.AdditionalSections[i].BlockSize = uint32(len(file.AdditionalSections[i].Data) + AdditionalSectionsEntryHeaderLen)
+	}
+	if file.Revision == 2005 && !file.isOldFormat() {
+		// signatures or additional sections were added to an old file
+		file.Revision = 2012
+	}
+	// start the cursor after the headers. offsets are computed on 64 bits
+	// such that a file too large to be marshalled can't wrap around and
+	// look valid, and is rejected because of its total size instead
+	offsetToContent := file.contentStart()
+	if file.layout != nil && file.layout.matches(file, offsetToContent) {
+		// the content is untouched since the file was parsed,
+		// so keep its original layout
+		offsetToContent = uint64(file.layout.offsetToIndex)
+	} else {
+		file.layout = nil
 	}
-	copy(output[MarIDLen+OffsetToIndexLen:MarIDLen+OffsetToIndexLen+8], fsizeBuf.Bytes())
 
-	// update the offset to index directly in the output data
-	file.OffsetToIndex = uint32(buf.Len() + sigSizes)
-	if file.OffsetToIndex < uint32(limitMinFileSize-IndexHeaderLen) {
-		return nil, errOffsetTooSmall
+	// otherwise, content is laid out in the order of the index. It is only
+	// written once, even if referenced by several index entries, in which
+	// case they all point to the same offset.
+	var idxSize uint64
+	written := make(map[string]uint64)
+	for i, idx := range file.Index {
+		// the size of the content may have changed since the index
+		// entry was created, so always use the size of the actual data
+		size := uint64(len(file.Content[idx.FileName].Data))
+		file.Index[i].Size = uint32(size)
+		if file.layout == nil {
+			if offset, ok := written[idx.FileName]; ok {
+				file.Index[i].OffsetToContent = uint32(offset)
+			} else {
+				file.Index[i].OffsetToContent = uint32(offsetToContent)
+				written[idx.FileName] = offsetToContent
+				offsetToContent += size
+			}
+		}
+		idxSize += IndexEntryHeaderLen + uint64(len(idx.FileName)) + 1
 	}
-	offsetBuf := new(bytes.Buffer)
-	err = binary.Write(offsetBuf, binary.BigEndian, file.OffsetToIndex)
-	if err != nil {
-		return nil, err
+	file.IndexHeader.Size = uint32(idxSize)
+	file.OffsetToIndex = uint32(offsetToContent)
+	file.Size = offsetToContent + IndexHeaderLen + idxSize
+}
+
+// contentStart returns the offset of the end of the headers, signatures
+// and additional sections of the file, where content starts when the
+// file is marshalled
+func (file *File) contentStart() uint64 {
+	if file.isOldFormat() {
+		return MarIDLen + OffsetToIndexLen
 	}
-	copy(output[MarIDLen:MarIDLen+OffsetToIndexLen], offsetBuf.Bytes())
+	start := uint64(MarIDLen + OffsetToIndexLen + FileSizeLen + SignaturesHeaderLen)
+	for _, sig := range file.Signatures {
+		start += SignatureEntryHeaderLen + uint64(sig.Size)
+	}
+	start += AdditionalSectionsHeaderLen
+	for _, as := range file.AdditionalSections {
+		start += uint64(as.BlockSize)
+	}
+	return start
+}
 
-	return output, nil
+// isOldFormat returns true if the file is an old MAR without signatures
+// or additional sections, which is marshalled in the format it was parsed
+func (file *File) isOldFormat() bool {
+	return file.Revision == 2005 && len(file.Signatures) == 0 && len(file.AdditionalSections) == 0
 }
 
-// AddContent stores content in a MAR and creates a new entry in the index
-func (file *File) AddContent(data []byte, name string, flags uint32) error {
+// AddContent stores content in a MAR and creates a new entry in the index.
+// The offsets and sizes of the index and headers are updated accordingly.
+// With the Compress or CompressWith options, data is compressed unless it
+// already is, and with the ValidateNames option, name must follow its rules.
+func (file *File) AddContent(data []byte, name string, flags uint32, opts ...Option) error {
+	o := newOptions(opts)
+	err := checkFileName(name)
+	if err != nil {
+		return err
+	}
+	if o.names != nil {
+		err = o.names.Check(name)
+		if err != nil {
+			return err
+		}
+	}
+	if file.Content == nil {
+		file.Content = make(map[string]Entry)
+	}
 	if _, ok := file.Content[name]; ok {
 		return errDupContent
 	}
-	file.Content[name] = Entry{Data: data}
+	compression := detectCompression(data)
+	if o.compression != CompressionNone && compression == CompressionNone {
+		data, err = compress(o.compression, data)
+		if err != nil {
+			return fmt.Errorf("%s compression failed: %w", o.compression, err)
+		}
+		compression = o.compression
+	}
+	file.Content[name] = Entry{
+		Data:         data,
+		IsCompressed: compression != CompressionNone,
+		Compression:  compression,
+	}
 	file.Index = append(file.Index, IndexEntry{
 		IndexEntryHeader{
 			Size:  uint32(len(data)),
@@ -584,10 +1041,26 @@ func (file *File) AddContent(data []byte, name string, flags uint32) error {
 		},
 		name,
 	})
+	file.Normalize()
 	return nil
 }
 
-// AddAdditionalSection stores data in the additional section of a MAR
+// checkFileName verifies a name can be stored in the index
+func checkFileName(name string) error {
+	if name == "" {
+		return errEmptyFileName
+	}
+	if strings.IndexByte(name, 0) >= 0 {
+		return errMalformedIndexFileName
+	}
+	if len(name) > limitFileNameLength {
+		return errIndexFileNameTooBig
+	}
+	return nil
+}
+
+// AddAdditionalSection stores data in the additional section of a MAR.
+// The offsets and sizes of the index and headers are updated accordingly.
 func (file *File) AddAdditionalSection(data []byte, blockID uint32) {
 	file.AdditionalSections = append(file.AdditionalSections, AdditionalSection{
 		AdditionalSectionEntryHeader{
@@ -596,7 +1069,10 @@ func (file *File) AddAdditionalSection(data []byte, blockID uint32) {
 		},
 		data,
 	})
-	file.AdditionalSectionsHeader.NumAdditionalSections++
+	if blockID == BlockIDProductInfo {
+		file.cacheProductInfo(data)
+	}
+	file.Normalize()
 }
 
 // AddProductInfo adds a product information string (typically, the version of firefox)
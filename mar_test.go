@@ -2,6 +2,10 @@ package mar
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -26,6 +30,128 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+func TestUnmarshalSkipContent(t *testing.T) {
+	var full, m File
+	err := Unmarshal(miniMarB, &full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(miniMarB, &m, SkipContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Content != nil {
+		t.Fatalf("expected content to not be loaded but found %d entries", len(m.Content))
+	}
+	if len(m.Index) != len(full.Index) || len(m.Signatures) != len(full.Signatures) {
+		t.Fatalf("expected index and signatures to match a full parse")
+	}
+	for i := range m.Index {
+		if m.Index[i] != full.Index[i] {
+			t.Fatalf("expected index entry %d to be %+v but found %+v", i, full.Index[i], m.Index[i])
+		}
+	}
+	_, err = m.Marshal()
+	if err != errIndexBadContentReference {
+		t.Fatalf("expected marshalling without content to fail with %q but got %v", errIndexBadContentReference, err)
+	}
+}
+
+func TestUnmarshalZeroCopy(t *testing.T) {
+	input := make([]byte, len(miniMarB))
+	copy(input, miniMarB)
+	var m File
+	err := Unmarshal(input, &m, ZeroCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range m.Index {
+		data := m.Content[idx.FileName].Data
+		if len(data) != int(idx.Size) {
+			t.Fatalf("expected entry %q to have %d bytes but found %d", idx.FileName, idx.Size, len(data))
+		}
+		if cap(data) != len(data) {
+			t.Fatalf("expected the capacity of entry %q to be capped to its length", idx.FileName)
+		}
+		if len(data) > 0 && &data[0] != &input[idx.OffsetToContent] {
+			t.Fatalf("expected entry %q to alias the input buffer", idx.FileName)
+		}
+	}
+	// a zero copy file should marshal back to its input
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, miniMarB) {
+		t.Fatal("expected zero copy file to marshal back to its input")
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	for i, input := range [][]byte{miniMarB, oldMarB} {
+		var m File
+		err := Unmarshal(input, &m, Strict())
+		if err != nil {
+			t.Fatalf("testcase %d expected strict parsing to succeed but got %v", i, err)
+		}
+	}
+
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// shrink the first entry to leave a gap before the second one
+	binary.BigEndian.PutUint32(o[m.OffsetToIndex+IndexHeaderLen+4:], 39)
+	var lax File
+	err = Unmarshal(o, &lax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strict File
+	err = Unmarshal(o, &strict, Strict())
+	if err != errContentGap {
+		t.Fatalf("expected to fail with %q but got %v", errContentGap, err)
+	}
+}
+
+func TestUnmarshalLenient(t *testing.T) {
+	// trailing data after the index
+	input := append(append([]byte{}, miniMarB...), []byte("garbage")...)
+	var m File
+	err := Unmarshal(input, &m)
+	if err == nil {
+		t.Fatal("expected parsing a file with trailing data to fail but it succeeded")
+	}
+	var lenient File
+	err = Unmarshal(input, &lenient, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lenient.Warnings) != 1 {
+		t.Fatalf("expected 1 warning but got %q", lenient.Warnings)
+	}
+
+	// total file size header slightly off
+	input = append([]byte{}, miniMarB...)
+	binary.BigEndian.PutUint64(input[MarIDLen+OffsetToIndexLen:], uint64(len(miniMarB)+1))
+	var offSize File
+	err = Unmarshal(input, &offSize)
+	if err != errMalformedFileSize {
+		t.Fatalf("expected to fail with %q but got %v", errMalformedFileSize, err)
+	}
+	var lenientSize File
+	err = Unmarshal(input, &lenientSize, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lenientSize.Warnings) != 1 {
+		t.Fatalf("expected 1 warning but got %q", lenientSize.Warnings)
+	}
+}
+
 func TestUnmarshalOldMar(t *testing.T) {
 	var m File
 	err := Unmarshal(oldMarB, &m)
@@ -60,6 +186,62 @@ func TestMarshalUnmarshal(t *testing.T) {
 	}
 }
 
+func TestMarshalReproducesInput(t *testing.T) {
+	var m File
+	err := Unmarshal(miniMarB, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, miniMarB) {
+		t.Fatalf("expected marshalled output to match the unmarshalled input but it didn't")
+	}
+}
+
+func TestMarshalRecomputesIndex(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bbbb"), "/foo/baz", 0600)
+	// replace the content of the first entry without touching the index
+	m.Content["/foo/bar"] = Entry{Data: []byte("cccccccccccccccc")}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Index[0].Size != 16 {
+		t.Fatalf("expected first index entry to have size 16 but found %d", m.Index[0].Size)
+	}
+	if m.Index[1].OffsetToContent != m.Index[0].OffsetToContent+16 {
+		t.Fatalf("expected second entry at offset %d but found %d",
+			m.Index[0].OffsetToContent+16, m.Index[1].OffsetToContent)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reparsed.Content["/foo/baz"].Data, []byte("bbbb")) {
+		t.Fatalf("expected to find data %q in reparsed content but found %q",
+			"bbbb", reparsed.Content["/foo/baz"].Data)
+	}
+	if uint64(len(o)) != reparsed.Size {
+		t.Fatalf("expected file size %d but found %d", len(o), reparsed.Size)
+	}
+}
+
+func TestMarshalUnfinalizedSignature(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.PrepareSignature(rsa2048Key, rsa2048Key.Public())
+	_, err := m.Marshal()
+	if err != errSignatureSizeMismatch {
+		t.Fatalf("expected to fail with %q but got %v", errSignatureSizeMismatch, err)
+	}
+}
+
 func TestMarshalBadMarID(t *testing.T) {
 	badMar := New()
 	badMar.MarID = "foo"
@@ -100,6 +282,65 @@ func TestAddingContent(t *testing.T) {
 	}
 }
 
+func TestAddingContentUpdatesLayout(t *testing.T) {
+	m := New()
+	m.AddProductInfo("caribou maurice v1.2")
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0600)
+	m.AddAdditionalSection([]byte("foo bar baz"), uint32(1664))
+	if m.AdditionalSectionsHeader.NumAdditionalSections != 2 {
+		t.Fatalf("expected 2 additional sections but found %d", m.AdditionalSectionsHeader.NumAdditionalSections)
+	}
+	// keep a copy of the layout computed while adding content,
+	// and compare it with the layout of the marshalled file
+	var (
+		offsetToIndex = m.OffsetToIndex
+		size          = m.Size
+		indexSize     = m.IndexHeader.Size
+		index         = append([]IndexEntry(nil), m.Index...)
+	)
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.OffsetToIndex != offsetToIndex {
+		t.Fatalf("expected offset to index %d but found %d", offsetToIndex, reparsed.OffsetToIndex)
+	}
+	if reparsed.Size != size {
+		t.Fatalf("expected file size %d but found %d", size, reparsed.Size)
+	}
+	if reparsed.IndexHeader.Size != indexSize {
+		t.Fatalf("expected index size %d but found %d", indexSize, reparsed.IndexHeader.Size)
+	}
+	for i := range index {
+		if reparsed.Index[i] != index[i] {
+			t.Fatalf("expected index entry %+v but found %+v", index[i], reparsed.Index[i])
+		}
+	}
+}
+
+func TestAddingBadContentName(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{"", errEmptyFileName},
+		{"/foo\x00bar", errMalformedIndexFileName},
+		{strings.Repeat("a", limitFileNameLength+1), errIndexFileNameTooBig},
+	}
+	for i, testCase := range testCases {
+		err := New().AddContent([]byte("cariboumaurice"), testCase.name, 0640)
+		if err != testCase.err {
+			t.Fatalf("testcase %d expected to fail with %q but got %v", i, testCase.err, err)
+		}
+	}
+}
+
 func TestAddingDupContent(t *testing.T) {
 	newMar := New()
 	var (
@@ -148,3 +389,108 @@ var miniMarB = []byte("\x4D\x41\x52\x31\x00\x00\x01\x7D\x00\x00\x00\x00\x00\x00\
 	"\x61\x61\x61\x61\x61\x61\x61\x61\x61\x61\x61\x61\x61\x00\x00\x00" +
 	"\x15\x00\x00\x01\x68\x00\x00\x00\x15\x00\x00\x02\x58\x2F\x66\x6F" +
 	"\x6F\x2F\x62\x61\x72\x00")
+
+func BenchmarkUnmarshalLargeIndex(b *testing.B) {
+	m := New()
+	for i := 0; i < 2000; i++ {
+		m.AddContent([]byte("some content"), fmt.Sprintf("/path/to/file/%d", i), 0644)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var reparsed File
+		err = Unmarshal(o, &reparsed)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestFileReset(t *testing.T) {
+	var file File
+	for i, input := range [][]byte{miniMarB, oldMarB, miniMarB} {
+		file.Reset()
+		err := Unmarshal(input, &file)
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+		var expected File
+		err = Unmarshal(input, &expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(file.Index, expected.Index) {
+			t.Fatalf("testcase %d: expected index %+v but got %+v", i, expected.Index, file.Index)
+		}
+		if len(file.Signatures) != len(expected.Signatures) || len(file.AdditionalSections) != len(expected.AdditionalSections) {
+			t.Fatalf("testcase %d: expected %d signatures and %d sections but got %d and %d", i,
+				len(expected.Signatures), len(expected.AdditionalSections), len(file.Signatures), len(file.AdditionalSections))
+		}
+		if len(file.Content) != len(expected.Content) {
+			t.Fatalf("testcase %d: expected %d entries but got %d", i, len(expected.Content), len(file.Content))
+		}
+		for name, entry := range expected.Content {
+			if !bytes.Equal(file.Content[name].Data, entry.Data) {
+				t.Fatalf("testcase %d: unexpected content of %q", i, name)
+			}
+		}
+		output, err := file.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(output, input) {
+			t.Fatalf("testcase %d: reused file marshals differently from its input", i)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	file := &File{
+		MarID:         "MAR1",
+		Revision:      2012,
+		OffsetToIndex: 12345,
+		Size:          42,
+		Signatures: []Signature{{
+			SignatureEntryHeader: SignatureEntryHeader{AlgorithmID: SigAlgRsaPkcs1Sha384, Size: 4},
+			Data:                 []byte("sig!"),
+		}},
+		AdditionalSections: []AdditionalSection{{
+			AdditionalSectionEntryHeader: AdditionalSectionEntryHeader{BlockID: BlockIDProductInfo, BlockSize: 1},
+			Data:                         []byte("caribou maurice v1.2"),
+		}},
+		IndexHeader: IndexHeader{Size: 7},
+		Index: []IndexEntry{
+			{IndexEntryHeader{OffsetToContent: 1, Size: 2, Flags: 0644}, "/foo/bar"},
+			{IndexEntryHeader{OffsetToContent: 3, Size: 4, Flags: 0755}, "/foo/baz"},
+		},
+		Content: map[string]Entry{
+			"/foo/bar": {Data: []byte("cariboumaurice")},
+			"/foo/baz": {Data: []byte("bcdef")},
+		},
+	}
+	if file.Validate() == nil {
+		t.Fatal("expected the inconsistent file to fail validation")
+	}
+	file.Normalize()
+	err := file.Validate()
+	if err != nil {
+		t.Fatalf("expected the normalized file to be valid but got %v", err)
+	}
+	if file.SignaturesHeader.NumSignatures != 1 || file.AdditionalSectionsHeader.NumAdditionalSections != 1 {
+		t.Fatalf("unexpected headers %+v %+v", file.SignaturesHeader, file.AdditionalSectionsHeader)
+	}
+	output, err := file.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Size != uint64(len(output)) {
+		t.Fatalf("expected size %d but got %d", len(output), file.Size)
+	}
+	if file.Index[1].OffsetToContent != file.Index[0].OffsetToContent+14 || file.Index[1].Size != 5 {
+		t.Fatalf("unexpected index %+v", file.Index)
+	}
+}
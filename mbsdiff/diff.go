@@ -0,0 +1,277 @@
+package mbsdiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+)
+
+// Diff returns a patch that turns old into new, computed with the
+// bsdiff algorithm
+func Diff(old, new []byte) ([]byte, error) {
+	if uint64(len(old)) > math.MaxUint32 || uint64(len(new)) > math.MaxUint32 {
+		return nil, errFileTooLarge
+	}
+	I := qsufsort(old)
+	var ctrl, db, eb bytes.Buffer
+	var scan, length, pos, lastScan, lastPos, lastOffset int
+	for scan < len(new) {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < len(new); scan++ {
+			pos, length = search(I, old, new[scan:], 0, len(old))
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < len(old) && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < len(old) && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+		if length == oldScore && scan != len(new) {
+			continue
+		}
+
+		// extend the match forward from the last match
+		s, sf, lenf := 0, 0, 0
+		for i := 0; lastScan+i < scan && lastPos+i < len(old); {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+		// extend the match backward from the current match
+		lenb := 0
+		if scan < len(new) {
+			s, sb := 0, 0
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+		// split the overlap between both extensions
+		if lastScan+lenf > scan-lenb {
+			overlap := (lastScan + lenf) - (scan - lenb)
+			s, ss, lens := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if new[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		for i := 0; i < lenf; i++ {
+			db.WriteByte(new[lastScan+i] - old[lastPos+i])
+		}
+		extraLen := (scan - lenb) - (lastScan + lenf)
+		eb.Write(new[lastScan+lenf : lastScan+lenf+extraLen])
+		var triple [controlLen]byte
+		binary.BigEndian.PutUint32(triple[0:], uint32(lenf))
+		binary.BigEndian.PutUint32(triple[4:], uint32(extraLen))
+		binary.BigEndian.PutUint32(triple[8:], uint32(int32((pos-lenb)-(lastPos+lenf))))
+		ctrl.Write(triple[:])
+
+		lastScan = scan - lenb
+		lastPos = pos - lenb
+		lastOffset = pos - scan
+	}
+
+	patch := make([]byte, headerLen, headerLen+ctrl.Len()+db.Len()+eb.Len())
+	copy(patch, tag)
+	binary.BigEndian.PutUint32(patch[8:], uint32(len(old)))
+	binary.BigEndian.PutUint32(patch[12:], crc32.ChecksumIEEE(old))
+	binary.BigEndian.PutUint32(patch[16:], uint32(len(new)))
+	binary.BigEndian.PutUint32(patch[20:], uint32(ctrl.Len()))
+	binary.BigEndian.PutUint32(patch[24:], uint32(db.Len()))
+	binary.BigEndian.PutUint32(patch[28:], uint32(eb.Len()))
+	patch = append(patch, ctrl.Bytes()...)
+	patch = append(patch, db.Bytes()...)
+	return append(patch, eb.Bytes()...), nil
+}
+
+// matchLen returns the length of the common prefix of a and b
+func matchLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// search returns the position and length of the longest prefix of new
+// found in old, using the suffix array I of old between st and en
+func search(I []int, old, new []byte, st, en int) (int, int) {
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		n := len(old) - I[x]
+		if len(new) < n {
+			n = len(new)
+		}
+		if bytes.Compare(old[I[x]:I[x]+n], new[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x := matchLen(old[I[st]:], new)
+	y := matchLen(old[I[en]:], new)
+	if x > y {
+		return I[st], x
+	}
+	return I[en], y
+}
+
+// qsufsort returns the suffix array of old, computed with the
+// Larsson-Sadakane algorithm like bsdiff does
+func qsufsort(old []byte) []int {
+	n := len(old)
+	I := make([]int, n+1)
+	V := make([]int, n+1)
+	var buckets [256]int
+	for _, c := range old {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+	for i, c := range old {
+		buckets[c]++
+		I[buckets[c]] = i
+	}
+	I[0] = n
+	for i, c := range old {
+		V[i] = buckets[c]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := 1; I[0] != -(n + 1); h += h {
+		length := 0
+		i := 0
+		for i < n+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				split(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+// split sorts the group of suffixes of I between start and start+length
+// by the rank of their h-th character
+func split(I, V []int, start, length, h int) {
+	if length < 16 {
+		for k, j := start, 0; k < start+length; k += j {
+			j = 1
+			x := V[I[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	jj, kk := 0, 0
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, 0, 0
+	for i < jj {
+		if V[I[i]+h] < x {
+			i++
+		} else if V[I[i]+h] == x {
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		} else {
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := 0; i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
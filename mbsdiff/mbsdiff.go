@@ -0,0 +1,113 @@
+// Package mbsdiff encodes and applies binary patches in the format of
+// Mozilla's mbsdiff tool, which partial MAR files use to update files.
+//
+// The format is a variant of bsdiff 4 with a different header: a 32 bytes
+// header starting with the MBDIFF10 tag records the size and CRC32 of the
+// file to patch, the size of the result and the sizes of the three blocks
+// that follow. The control block is a list of triples of big endian 32 bits
+// integers: the number of bytes to add from the diff block to the old file,
+// the number of bytes to copy from the extra block, and the signed offset
+// to seek in the old file. Unlike bsdiff, the blocks aren't compressed with
+// bzip2, since the patch itself is compressed when stored in a MAR file.
+package mbsdiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// tag is the magic string at the beginning of a patch
+const tag = "MBDIFF10"
+
+// headerLen is the size of the header of a patch, in bytes
+const headerLen = 32
+
+// controlLen is the size of a triple of the control block, in bytes
+const controlLen = 12
+
+// header is the header of a patch, after the tag
+type header struct {
+	// OldLen is the size of the file to patch
+	OldLen uint32
+	// OldCRC32 is the CRC32 of the file to patch
+	OldCRC32 uint32
+	// NewLen is the size of the result of the patch
+	NewLen uint32
+	// ControlLen is the size of the control block
+	ControlLen uint32
+	// DiffLen is the size of the diff block
+	DiffLen uint32
+	// ExtraLen is the size of the extra block
+	ExtraLen uint32
+}
+
+var (
+	errBadTag       = errors.New("mbsdiff: patch does not start with " + tag)
+	errCorrupt      = errors.New("mbsdiff: corrupt patch")
+	errOldMismatch  = errors.New("mbsdiff: the file to patch does not match the patch")
+	errFileTooLarge = errors.New("mbsdiff: files larger than 4GB are not supported")
+)
+
+// Patch applies the patch to old and returns the patched content. The size
+// and CRC32 of old must match the ones recorded in the patch.
+func Patch(old, patch []byte) ([]byte, error) {
+	if len(patch) < headerLen {
+		return nil, errCorrupt
+	}
+	if string(patch[:len(tag)]) != tag {
+		return nil, errBadTag
+	}
+	var h header
+	h.OldLen = binary.BigEndian.Uint32(patch[8:])
+	h.OldCRC32 = binary.BigEndian.Uint32(patch[12:])
+	h.NewLen = binary.BigEndian.Uint32(patch[16:])
+	h.ControlLen = binary.BigEndian.Uint32(patch[20:])
+	h.DiffLen = binary.BigEndian.Uint32(patch[24:])
+	h.ExtraLen = binary.BigEndian.Uint32(patch[28:])
+	if uint64(len(old)) != uint64(h.OldLen) || crc32.ChecksumIEEE(old) != h.OldCRC32 {
+		return nil, errOldMismatch
+	}
+	if h.ControlLen%controlLen != 0 ||
+		uint64(headerLen)+uint64(h.ControlLen)+uint64(h.DiffLen)+uint64(h.ExtraLen) != uint64(len(patch)) {
+		return nil, errCorrupt
+	}
+	// every byte of the output comes from the diff or extra blocks, so a
+	// larger announced size is a lie that must not be allocated
+	if uint64(h.NewLen) > uint64(h.DiffLen)+uint64(h.ExtraLen) {
+		return nil, errCorrupt
+	}
+	ctrl := patch[headerLen : headerLen+h.ControlLen]
+	diff := patch[headerLen+h.ControlLen : headerLen+h.ControlLen+h.DiffLen]
+	extra := patch[headerLen+h.ControlLen+h.DiffLen:]
+
+	out := make([]byte, 0, h.NewLen)
+	oldPos := int64(0)
+	for ; len(ctrl) > 0; ctrl = ctrl[controlLen:] {
+		x := binary.BigEndian.Uint32(ctrl)
+		y := binary.BigEndian.Uint32(ctrl[4:])
+		z := int32(binary.BigEndian.Uint32(ctrl[8:]))
+		if uint64(x) > uint64(len(diff)) || uint64(y) > uint64(len(extra)) ||
+			uint64(len(out))+uint64(x)+uint64(y) > uint64(h.NewLen) {
+			return nil, errCorrupt
+		}
+		// add the diff block to the old content
+		for i := int64(0); i < int64(x); i++ {
+			b := diff[i]
+			if oldPos+i >= 0 && oldPos+i < int64(len(old)) {
+				b += old[oldPos+i]
+			}
+			out = append(out, b)
+		}
+		diff = diff[x:]
+		oldPos += int64(x)
+		// copy the extra block
+		out = append(out, extra[:y]...)
+		extra = extra[y:]
+		oldPos += int64(z)
+	}
+	if uint64(len(out)) != uint64(h.NewLen) || len(diff) != 0 || len(extra) != 0 {
+		return nil, errCorrupt
+	}
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package mbsdiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	random := func(n int) []byte {
+		data := make([]byte, n)
+		r.Read(data)
+		return data
+	}
+	base := random(64 * 1024)
+	// modify a few bytes, insert and remove chunks to make a new version
+	modified := append([]byte{}, base...)
+	for i := 0; i < 100; i++ {
+		modified[r.Intn(len(modified))]++
+	}
+	modified = append(modified[:1000], append(random(500), modified[1000:]...)...)
+	modified = append(modified[:30000], modified[32000:]...)
+
+	testCases := []struct {
+		name     string
+		old, new []byte
+	}{
+		{"modified", base, modified},
+		{"identical", base, base},
+		{"empty old", nil, base[:100]},
+		{"empty new", base[:100], nil},
+		{"both empty", nil, nil},
+		{"unrelated", random(1000), random(2000)},
+		{"text", []byte("the quick brown fox jumps over the lazy dog"), []byte("the quick red fox jumped over the lazy dogs")},
+	}
+	for _, testCase := range testCases {
+		patch, err := Diff(testCase.old, testCase.new)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.name, err)
+		}
+		if !bytes.HasPrefix(patch, []byte(tag)) {
+			t.Fatalf("%s: expected patch to start with %s", testCase.name, tag)
+		}
+		out, err := Patch(testCase.old, patch)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.name, err)
+		}
+		if !bytes.Equal(out, testCase.new) {
+			t.Fatalf("%s: patched output does not match the new content", testCase.name)
+		}
+	}
+
+	patch, err := Diff(base, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the diff block is mostly zeroes and only the inserted chunk is in
+	// the extra block, so the patch compresses well once stored in a MAR
+	extraLen := int(patch[28])<<24 | int(patch[29])<<16 | int(patch[30])<<8 | int(patch[31])
+	if extraLen > 1000 {
+		t.Fatalf("expected the extra block to hold about the inserted 500 bytes, got %d", extraLen)
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	old := []byte("the quick brown fox jumps over the lazy dog")
+	patch, err := Diff(old, []byte("the quick red fox jumped over the lazy dogs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	badTag := append([]byte("BSDIFF40"), patch[8:]...)
+	truncated := patch[:len(patch)-1]
+	badCtrl := append([]byte{}, patch...)
+	// claim the first triple adds more than the diff block holds
+	badCtrl[headerLen] = 0xff
+	bigNew := append([]byte{}, patch...)
+	// claim a result of 4GB
+	binary.BigEndian.PutUint32(bigNew[16:], 0xffffffff)
+
+	testCases := []struct {
+		old, patch []byte
+		err        error
+	}{
+		{old, patch[:10], errCorrupt},
+		{old, badTag, errBadTag},
+		{old, truncated, errCorrupt},
+		{old, badCtrl, errCorrupt},
+		{old, bigNew, errCorrupt},
+		{old[1:], patch, errOldMismatch},
+		{bytes.ToUpper(old), patch, errOldMismatch},
+	}
+	for i, testCase := range testCases {
+		_, err := Patch(testCase.old, testCase.patch)
+		if err != testCase.err {
+			t.Fatalf("testcase %d expected error %v, got %v", i, testCase.err, err)
+		}
+	}
+}
+
+func TestSuffixArray(t *testing.T) {
+	old := []byte("banana bandana cabana")
+	I := qsufsort(old)
+	if len(I) != len(old)+1 || I[0] != len(old) {
+		t.Fatalf("expected the empty suffix first, got %v", I)
+	}
+	for i := 1; i < len(I)-1; i++ {
+		if bytes.Compare(old[I[i]:], old[I[i+1]:]) >= 0 {
+			t.Fatalf("suffixes %d and %d are not sorted: %q >= %q", I[i], I[i+1], old[I[i]:], old[I[i+1]:])
+		}
+	}
+}
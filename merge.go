@@ -0,0 +1,63 @@
+package mar
+
+import "fmt"
+
+// MergePolicy decides which entry Merge keeps when several files
+// have an entry with the same name
+type MergePolicy int
+
+const (
+	// MergeFail makes Merge fail with ErrDuplicateEntry
+	MergeFail MergePolicy = iota
+	// MergeKeepFirst keeps the entry of the first file that has it
+	MergeKeepFirst
+	// MergeKeepLast keeps the entry of the last file that has it, such
+	// that later files overlay earlier ones
+	MergeKeepLast
+)
+
+// Merge returns a new MAR holding the entries of all the files, in the
+// order of their indexes. Entries keep their compression and flags, and
+// duplicate names are resolved with the policy; an entry replaced by a
+// later file keeps the position of the first one in the index. The
+// additional sections, such as the Product Information block, are copied
+// from the first file. Signatures are not copied since they would not be
+// valid for the merged content.
+func Merge(policy MergePolicy, files ...*File) (*File, error) {
+	merged := New()
+	if len(files) > 0 {
+		for _, as := range files[0].AdditionalSections {
+			merged.AdditionalSections = append(merged.AdditionalSections, AdditionalSection{
+				as.AdditionalSectionEntryHeader,
+				append([]byte(nil), as.Data...),
+			})
+		}
+		if files[0].ProductInfo != nil {
+			info := *files[0].ProductInfo
+			merged.ProductInfo = &info
+		}
+		merged.ProductInformation = files[0].ProductInformation
+	}
+	position := make(map[string]int)
+	for _, file := range files {
+		for _, e := range file.Entries() {
+			i, dup := position[e.Name]
+			if !dup {
+				position[e.Name] = len(merged.Index)
+				merged.Index = append(merged.Index, IndexEntry{e.IndexEntryHeader, e.Name})
+				merged.Content[e.Name] = e.Entry
+				continue
+			}
+			switch policy {
+			case MergeKeepFirst:
+			case MergeKeepLast:
+				merged.Index[i].Flags = e.Flags
+				merged.Content[e.Name] = e.Entry
+			default:
+				return nil, fmt.Errorf("%w: file named %q is in several files", ErrDuplicateEntry, e.Name)
+			}
+		}
+	}
+	merged.Normalize()
+	return merged, nil
+}
@@ -0,0 +1,72 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func mergeTestFiles(t *testing.T) (*File, *File) {
+	base := New()
+	err := base.SetProductInformation("62.0", "firefox-mozilla-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.AddContent([]byte("base a"), "a", 0644)
+	base.AddContent([]byte("base b"), "b", 0644)
+	overlay := New()
+	err = overlay.AddContent(bytes.Repeat([]byte("overlay b "), 20), "b", 0755, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay.AddContent([]byte("overlay c"), "c", 0644)
+	return base, overlay
+}
+
+func TestMerge(t *testing.T) {
+	base, overlay := mergeTestFiles(t)
+	for _, testcase := range []struct {
+		policy MergePolicy
+		b      []byte
+		flags  uint32
+	}{
+		{MergeKeepFirst, []byte("base b"), 0644},
+		{MergeKeepLast, bytes.Repeat([]byte("overlay b "), 20), 0755},
+	} {
+		merged, err := Merge(testcase.policy, base, overlay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEntryNames(t, merged.Entries(), "a", "b", "c")
+		if merged.Index[1].Flags != testcase.flags {
+			t.Fatalf("policy %d: expected flags %o, got %o", testcase.policy, testcase.flags, merged.Index[1].Flags)
+		}
+		o, err := merged.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reparsed File
+		err = Unmarshal(o, &reparsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := reparsed.Content["b"].Decompressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, testcase.b) {
+			t.Fatalf("policy %d: expected content %q, got %q", testcase.policy, testcase.b, b)
+		}
+		if reparsed.ProductInfo == nil || reparsed.ProductInfo.Version != "62.0" {
+			t.Fatalf("policy %d: expected the product information of the first file, got %+v", testcase.policy, reparsed.ProductInfo)
+		}
+	}
+}
+
+func TestMergeDuplicate(t *testing.T) {
+	base, overlay := mergeTestFiles(t)
+	_, err := Merge(MergeFail, base, overlay)
+	if !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("expected error %v, got %v", ErrDuplicateEntry, err)
+	}
+}
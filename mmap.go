@@ -0,0 +1,117 @@
+package mar
+
+import (
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// MappedFile is a MAR file opened with OpenMapped. It embeds a Reader to
+// access its headers, index and entries, and must be closed when done.
+// Reads from the Reader, and from the SectionReaders it returns, fail once
+// the file is closed.
+type MappedFile struct {
+	*Reader
+
+	input *mappedReaderAt
+	unmap func() error
+}
+
+// mappedReaderAt reads from mapped memory until it is closed. The lock
+// makes Close wait for the reads in progress before the memory is unmapped.
+type mappedReaderAt struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func (m *mappedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return 0, errMappedFileClosed
+	}
+	if off < 0 || off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// OpenMapped opens the MAR file at path and maps it in memory, such that
+// parsing it and reading its entries is done straight from the page cache
+// without copying the file in the heap. On platforms that don't support
+// memory mapping, the file is read in memory instead. Options are passed
+// to NewReader.
+//
+// Since the file isn't loaded in the heap, the MaxTotalSize and
+// MaxEntrySize limits default to the largest sizes a MAR can address
+// rather than to DefaultLimits. Limits set with WithLimits replace them.
+func OpenMapped(path string, opts ...Option) (*MappedFile, error) {
+	opts = append([]Option{WithLimits(Limits{
+		MaxTotalSize: limitMaxMappedFileSize,
+		MaxEntrySize: math.MaxUint32,
+	})}, opts...)
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(fi.Size())
+	if size < limitMinFileSize {
+		return nil, errTooSmall
+	}
+	o := newOptions(opts)
+	err = checkLimit(o.debug, "MaxTotalSize", size, o.limits.MaxTotalSize)
+	if err != nil {
+		return nil, err
+	}
+	// the length of a mapping is an int, which is 32 bits on some platforms
+	if size > uint64(maxInt) {
+		return nil, errMappedFileTooLarge
+	}
+	data, unmap, err := mapFile(fd, int(size))
+	if err != nil {
+		return nil, err
+	}
+	input := &mappedReaderAt{data: data}
+	r, err := NewReader(input, int64(len(data)), opts...)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	return &MappedFile{Reader: r, input: input, unmap: unmap}, nil
+}
+
+// maxInt is the largest value of an int
+const maxInt = int(^uint(0) >> 1)
+
+// Bytes returns the content of the mapped file, or nil once it is closed.
+// The returned slice, and the Data of entries parsed from it with the
+// ZeroCopy option, point to the mapped memory: they must not be modified,
+// nor used after the file is closed.
+func (m *MappedFile) Bytes() []byte {
+	m.input.mu.RLock()
+	defer m.input.mu.RUnlock()
+	return m.input.data
+}
+
+// Close unmaps the file from memory, once the reads in progress are done
+func (m *MappedFile) Close() error {
+	m.input.mu.Lock()
+	defer m.input.mu.Unlock()
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	m.unmap = nil
+	m.input.data = nil
+	return err
+}
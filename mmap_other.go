@@ -0,0 +1,19 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package mar
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads size bytes of fd in memory on platforms that
+// don't support memory mapping
+func mapFile(fd *os.File, size int) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(fd, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
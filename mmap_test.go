@@ -0,0 +1,125 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOpenMapped(t *testing.T) {
+	fd, err := ioutil.TempFile("", "margo_mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	_, err = fd.Write(miniMarB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+
+	m, err := OpenMapped(fd.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if !bytes.Equal(m.Bytes(), miniMarB) {
+		t.Fatal("expected mapped data to match the file content")
+	}
+	var full File
+	err = Unmarshal(m.Bytes(), &full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.File.Index) != len(full.Index) {
+		t.Fatalf("expected %d index entries but found %d", len(full.Index), len(m.File.Index))
+	}
+	for _, idx := range full.Index {
+		entry, err := m.GetEntry(idx.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(entry.Data, full.Content[idx.FileName].Data) {
+			t.Fatalf("expected content of mapped entry %q to match parsed content", idx.FileName)
+		}
+	}
+	err = m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenMappedTooSmall(t *testing.T) {
+	fd, err := ioutil.TempFile("", "margo_mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	fd.Close()
+	_, err = OpenMapped(fd.Name())
+	if err != errTooSmall {
+		t.Fatalf("expected to fail with %q but got %v", errTooSmall, err)
+	}
+}
+
+func TestOpenMappedClosed(t *testing.T) {
+	fd, err := ioutil.TempFile("", "margo_mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	_, err = fd.Write(miniMarB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+
+	m, err := OpenMapped(fd.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := m.File.Index[0].FileName
+	sr, err := m.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.GetEntry(name)
+	if !errors.Is(err, errMappedFileClosed) {
+		t.Fatalf("expected to fail with %q but got %v", errMappedFileClosed, err)
+	}
+	_, err = ioutil.ReadAll(sr)
+	if !errors.Is(err, errMappedFileClosed) {
+		t.Fatalf("expected to fail with %q but got %v", errMappedFileClosed, err)
+	}
+	if m.Bytes() != nil {
+		t.Fatal("expected no data once the file is closed")
+	}
+	err = m.Close()
+	if err != nil {
+		t.Fatalf("expected closing twice to succeed but got %v", err)
+	}
+}
+
+func TestOpenMappedLimits(t *testing.T) {
+	fd, err := ioutil.TempFile("", "margo_mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	_, err = fd.Write(miniMarB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+
+	_, err = OpenMapped(fd.Name(), WithLimits(Limits{MaxTotalSize: 100}))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected to fail with %q but got %v", ErrLimitExceeded, err)
+	}
+}
@@ -0,0 +1,19 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package mar
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile maps size bytes of fd in memory as read only, and returns
+// the mapped data and a function to unmap it
+func mapFile(fd *os.File, size int) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(fd.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mmap failed: %w", err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
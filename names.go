@@ -0,0 +1,122 @@
+package mar
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NameRules configures the validation of the names of entries, on top of
+// the checks every name goes through: it must be non empty and free of
+// null bytes, since names are null terminated in the index.
+type NameRules struct {
+	// MaxLength is the maximum length of a name in bytes, which defaults
+	// to the 1024 bytes the Firefox updater accepts
+	MaxLength int
+
+	// RequireUTF8 rejects names that are not valid UTF-8
+	RequireUTF8 bool
+
+	// NoControlChars rejects names containing control characters, like
+	// newlines or escape sequences that garble terminals
+	NoControlChars bool
+
+	// Windows rejects names that can't be extracted on Windows: names
+	// with one of the <>:"\|?* characters, and names with a component
+	// that is a reserved device name like CON or LPT1, or that ends
+	// with a dot or a space
+	Windows bool
+}
+
+// DefaultNameRules returns the rules the Strict parser applies when none
+// are set with ValidateNames, which require valid UTF-8 names without
+// control characters
+func DefaultNameRules() NameRules {
+	return NameRules{
+		MaxLength:      limitFileNameLength,
+		RequireUTF8:    true,
+		NoControlChars: true,
+	}
+}
+
+// ValidateNames makes Unmarshal, NewReader and OpenMapped reject files with
+// entry names that break the rules, and AddContent, CreateFromDir and the
+// Writer refuse to add such entries. The Strict parser applies
+// DefaultNameRules unless other rules are set.
+func ValidateNames(rules NameRules) Option {
+	return func(o *options) {
+		o.names = &rules
+	}
+}
+
+// windowsReservedNames are the device names Windows reserves in every
+// directory, with or without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Check returns an error if name breaks the rules. Names added to a MAR
+// can't be longer than 1024 bytes whatever MaxLength is.
+func (rules NameRules) Check(name string) error {
+	if name == "" {
+		return errEmptyFileName
+	}
+	if strings.IndexByte(name, 0) >= 0 {
+		return errMalformedIndexFileName
+	}
+	maxLength := rules.MaxLength
+	if maxLength <= 0 {
+		maxLength = limitFileNameLength
+	}
+	if len(name) > maxLength {
+		return fmt.Errorf("%w: %q is %d bytes long, the maximum is %d", errFileNameTooLong, name, len(name), maxLength)
+	}
+	if rules.RequireUTF8 && !utf8.ValidString(name) {
+		return fmt.Errorf("%w: %q", errFileNameNotUTF8, name)
+	}
+	if rules.NoControlChars {
+		// invalid bytes decode to RuneError, which is not a control character
+		for _, r := range name {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("%w: %q", errFileNameControlChar, name)
+			}
+		}
+	}
+	if rules.Windows {
+		if i := strings.IndexAny(name, `<>:"\|?*`); i >= 0 {
+			return fmt.Errorf("%w: %q contains %q", errFileNameWindows, name, name[i])
+		}
+		for _, component := range strings.Split(name, "/") {
+			if component == "" || component == "." || component == ".." {
+				continue
+			}
+			if strings.HasSuffix(component, ".") || strings.HasSuffix(component, " ") {
+				return fmt.Errorf("%w: %q ends with a dot or a space", errFileNameWindows, component)
+			}
+			// reserved names stay reserved with an extension, like NUL.txt
+			base := component
+			if i := strings.IndexByte(base, '.'); i >= 0 {
+				base = base[:i]
+			}
+			if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+				return fmt.Errorf("%w: %q is a reserved device name", errFileNameWindows, component)
+			}
+		}
+	}
+	return nil
+}
+
+// nameRules returns the rules names are validated with, which are nil when
+// they aren't validated
+func (o *options) nameRules() *NameRules {
+	if o.names == nil && o.mode == strictMode {
+		rules := DefaultNameRules()
+		return &rules
+	}
+	return o.names
+}
@@ -0,0 +1,106 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNameRulesCheck(t *testing.T) {
+	windows := NameRules{Windows: true}
+	testCases := []struct {
+		rules NameRules
+		name  string
+		err   error
+	}{
+		{DefaultNameRules(), "/foo/bar", nil},
+		{DefaultNameRules(), "dossier/café.txt", nil},
+		{DefaultNameRules(), "", errEmptyFileName},
+		{DefaultNameRules(), "foo\x00bar", errMalformedIndexFileName},
+		{DefaultNameRules(), "foo\xffbar", errFileNameNotUTF8},
+		{DefaultNameRules(), "foo\nbar", errFileNameControlChar},
+		{DefaultNameRules(), "foo\x1b[31mbar", errFileNameControlChar},
+		{DefaultNameRules(), strings.Repeat("a", 1025), errFileNameTooLong},
+		{NameRules{MaxLength: 8}, "foo/barbaz", errFileNameTooLong},
+		{NameRules{}, "foo\xff\nbar", nil},
+		{windows, "foo/bar.txt", nil},
+		{windows, "foo/console.txt", nil},
+		{windows, "foo/bar?.txt", errFileNameWindows},
+		{windows, `foo\bar`, errFileNameWindows},
+		{windows, "foo/CON", errFileNameWindows},
+		{windows, "nul.txt", errFileNameWindows},
+		{windows, "Lpt1/bar", errFileNameWindows},
+		{windows, "foo/bar.", errFileNameWindows},
+		{windows, "foo /bar", errFileNameWindows},
+	}
+	for i, testCase := range testCases {
+		err := testCase.rules.Check(testCase.name)
+		if !errors.Is(err, testCase.err) {
+			t.Errorf("testcase %d: expected %q to fail with %v but got %v", i, testCase.name, testCase.err, err)
+		}
+		if err != nil && !errors.Is(err, ErrMalformedIndex) {
+			t.Errorf("testcase %d: expected %v to be a malformed index error", i, err)
+		}
+	}
+}
+
+func TestValidateNamesParse(t *testing.T) {
+	m := New()
+	err := m.AddContent([]byte("cariboumaurice"), "foo\nbar", 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// names are only validated when asked to
+	var file File
+	err = Unmarshal(input, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strict File
+	err = Unmarshal(input, &strict, Strict())
+	if !errors.Is(err, errFileNameControlChar) {
+		t.Fatalf("expected strict parsing to fail with %q but got %v", errFileNameControlChar, err)
+	}
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Section != "index entry" {
+		t.Fatalf("expected an index entry parse error but got %v", err)
+	}
+	var relaxed File
+	err = Unmarshal(input, &relaxed, Strict(), ValidateNames(NameRules{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewReader(bytes.NewReader(input), int64(len(input)), ValidateNames(DefaultNameRules()))
+	if !errors.Is(err, errFileNameControlChar) {
+		t.Fatalf("expected the reader to fail with %q but got %v", errFileNameControlChar, err)
+	}
+}
+
+func TestValidateNamesCreate(t *testing.T) {
+	rules := ValidateNames(NameRules{Windows: true})
+	m := New()
+	err := m.AddContent([]byte("cariboumaurice"), "foo/aux.h", 0600, rules)
+	if !errors.Is(err, errFileNameWindows) {
+		t.Fatalf("expected to fail with %q but got %v", errFileNameWindows, err)
+	}
+	if len(m.Index) != 0 {
+		t.Fatalf("expected no entry to be added but got %d", len(m.Index))
+	}
+	err = m.AddContent([]byte("cariboumaurice"), "foo/auxiliary.h", 0600, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, rules)
+	err = w.AddFile("foo:bar", strings.NewReader("cariboumaurice"), 0600)
+	if !errors.Is(err, errFileNameWindows) {
+		t.Fatalf("expected the writer to fail with %q but got %v", errFileNameWindows, err)
+	}
+}
@@ -1,5 +1,11 @@
 package mar
 
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
 var oldMarB = []byte("\x4D\x41\x52\x31\x00\x03\x65\xF8\x42\x5A\x68\x39\x31\x41\x59\x26" +
 	"\x53\x59\x03\x2F\x74\x6C\x00\x04\xC9\xDF\x80\x00\x10\x50\x03\xFF" +
 	"\xE0\x72\x02\x1E\x40\xBF\xFF\xFF\xFA\x50\x04\x18\xB6\x6D\x79\xD3" +
@@ -13982,3 +13988,44 @@ var oldMarB = []byte("\x4D\x41\x52\x31\x00\x03\x65\xF8\x42\x5A\x68\x39\x31\x41\x
 	"\x6F\x7A\x69\x6C\x6C\x61\x2E\x6F\x72\x67\x2F\x63\x6F\x6D\x70\x6F" +
 	"\x6E\x65\x6E\x74\x73\x2F\x69\x6E\x73\x70\x65\x63\x74\x6F\x72\x2E" +
 	"\x64\x6C\x6C\x2E\x70\x61\x74\x63\x68\x00")
+
+func TestUnmarshalOldMarUnorderedIndex(t *testing.T) {
+	// an old MAR whose index lists the entries in a different order than
+	// their content, such that the first entry doesn't start at byte 8
+	content := []byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbaaaa")
+	index := new(bytes.Buffer)
+	for _, e := range []struct {
+		offset, size uint32
+		name         string
+	}{{38, 4, "a"}, {8, 30, "b"}} {
+		binary.Write(index, binary.BigEndian, e.offset)
+		binary.Write(index, binary.BigEndian, e.size)
+		binary.Write(index, binary.BigEndian, uint32(0644))
+		index.WriteString(e.name + "\x00")
+	}
+	input := new(bytes.Buffer)
+	input.WriteString("MAR1")
+	binary.Write(input, binary.BigEndian, uint32(MarIDLen+OffsetToIndexLen+len(content)))
+	input.Write(content)
+	binary.Write(input, binary.BigEndian, uint32(index.Len()))
+	input.Write(index.Bytes())
+
+	var m File
+	err := Unmarshal(input.Bytes(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Revision != 2005 || len(m.Signatures) != 0 || len(m.AdditionalSections) != 0 {
+		t.Fatalf("expected an old MAR, got revision %d", m.Revision)
+	}
+	if string(m.Content["a"].Data) != "aaaa" || string(m.Content["b"].Data) != string(content[:30]) {
+		t.Fatalf("unexpected content %q and %q", m.Content["a"].Data, m.Content["b"].Data)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, input.Bytes()) {
+		t.Fatal("expected the old MAR to marshal back to its input")
+	}
+}
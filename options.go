@@ -0,0 +1,169 @@
+package mar
+
+import "io"
+
+// Option configures the optional behaviors of the functions of the package
+// that accept them. Options that don't apply to a function are ignored by it.
+//
+//   - Unmarshal, UnmarshalFile, ReadFrom and ReadVerified accept SkipContent, ZeroCopy, WithLimits, Strict, Lenient, ValidateNames, OnDuplicates, WithProgress and WithDebugWriter
+//   - NewReader and OpenMapped accept WithLimits, Strict, Lenient, ValidateNames, OnDuplicates and WithDebugWriter
+//   - New accepts WithDebugWriter
+//   - Marshal and MarshalToFile accept WithLimits, TransformWith, Deterministic and WithProgress
+//   - ExtractAll accepts WithProgress, WithConcurrency and WithPathPolicy
+//   - DecompressAll accepts WithConcurrency
+//   - AddContent accepts Compress, CompressWith and ValidateNames
+//   - CreateFromDir accepts Compress, CompressWith, ValidateNames and WithPathPolicy
+//   - ReplaceEntry accepts Compress and CompressWith
+//   - NewWriter accepts Compress, CompressWith, AlignContent and ValidateNames
+//   - ApplyPartial accepts PatchWith and WithPathPolicy
+//   - ToTar and ToZip accept WithLimits and WithPathPolicy
+type Option func(*options)
+
+type options struct {
+	// compression format of content entries when creating a MAR
+	compression CompressionType
+	// only parse the headers and index of a MAR
+	skipContent bool
+	// make the content of entries point into the input of Unmarshal
+	zeroCopy bool
+	// bounds of the values accepted by the parser
+	limits Limits
+	// how strictly the parser checks the layout of a MAR
+	mode parseMode
+	// applies the patches of partial updates
+	patch PatchFunc
+	// transform the entries of a MAR when marshalling it
+	transforms []TransformFunc
+	// reports the progress of long operations
+	progress ProgressFunc
+	// number of goroutines used to process entries
+	concurrency int
+	// marshal files in a canonical form
+	deterministic bool
+	// boundary the content of entries is aligned to by the Writer
+	alignment uint64
+	// rules the names of entries are validated with
+	names *NameRules
+	// rules applied to the paths of extracted and added files
+	pathPolicy *PathPolicy
+	// what the parser does with entries that have the same name
+	duplicates DuplicatePolicy
+	// receives the traces of the parser
+	debug io.Writer
+}
+
+// parseMode is how strictly the parser checks the layout of a MAR
+type parseMode int
+
+const (
+	defaultMode parseMode = iota
+	strictMode
+	lenientMode
+)
+
+func newOptions(opts []Option) *options {
+	o := &options{limits: DefaultLimits(), debug: debugWriter}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Compress enables the xz compression of the content of entries when
+// creating a MAR file, which is what the Firefox updater expects
+func Compress() Option {
+	return func(o *options) {
+		o.compression = CompressionXZ
+	}
+}
+
+// CompressWith enables the compression of the content of entries with the
+// given format when creating a MAR file. The codec of the format must be
+// able to compress.
+func CompressWith(c CompressionType) Option {
+	return func(o *options) {
+		o.compression = c
+	}
+}
+
+// AlignContent makes the Writer start the content of every entry at an
+// offset of the file that is a multiple of n, such as 4096 to read entries
+// of a memory mapped file in whole pages. The space before each entry is
+// filled with zeros that count in the total file size but belong to no
+// index entry, so aligned files are rejected by the Strict parser.
+func AlignContent(n uint64) Option {
+	return func(o *options) {
+		o.alignment = n
+	}
+}
+
+// SkipContent makes Unmarshal parse the headers, signatures, additional
+// sections and index of a MAR without loading the content of its entries.
+// Signatures can't be verified on a file parsed that way, since they
+// cover the content.
+func SkipContent() Option {
+	return func(o *options) {
+		o.skipContent = true
+	}
+}
+
+// ZeroCopy makes Unmarshal set the Data of entries to slices of its input
+// instead of copies, which halves the memory used to parse a MAR. The input
+// must outlive the File and not be modified while the File is in use. It
+// works well with the Bytes of a MappedFile, as long as the MappedFile is
+// closed after the File is no longer needed.
+func ZeroCopy() Option {
+	return func(o *options) {
+		o.zeroCopy = true
+	}
+}
+
+// WithLimits sets the limits the parser enforces on the headers and index
+// of a MAR file. Fields of l left to zero use their default value.
+func WithLimits(l Limits) Option {
+	return func(o *options) {
+		o.limits = l.withDefaults()
+	}
+}
+
+// Strict makes Unmarshal enforce every invariant of the MAR format on top of
+// the default checks: the index header must describe the exact size of the
+// index, the content of entries must fill the space between the headers
+// and the index without gaps, and the names of entries must follow the
+// DefaultNameRules, unless ValidateNames sets other rules.
+func Strict() Option {
+	return func(o *options) {
+		o.mode = strictMode
+	}
+}
+
+// Lenient makes Unmarshal accept files with cosmetic inconsistencies, such
+// as a total file size header that is slightly off or trailing data after
+// the index, and record them in the Warnings of the File instead of failing.
+// Security checks, like the detection of overlapping content, still apply.
+func Lenient() Option {
+	return func(o *options) {
+		o.mode = lenientMode
+	}
+}
+
+// PatchWith sets the function ApplyPartial uses to apply the patches
+// of a partial update, instead of mbsdiff.Patch
+func PatchWith(apply PatchFunc) Option {
+	return func(o *options) {
+		o.patch = apply
+	}
+}
+
+// WithDebugWriter writes the debug traces of the package to w: the checks
+// that fail while parsing, with the offsets and sizes involved, the limits
+// that are exceeded, the warnings, and the outcome of signing and verifying.
+// The File returned by New or filled by Unmarshal keeps w for the traces of
+// its methods. Traces are disabled by default, unless the package is built
+// with -ldflags "-X go.mozilla.org/mar.debug=true", which sends them to
+// stderr, and a nil w disables them again.
+func WithDebugWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.debug = w
+	}
+}
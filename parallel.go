@@ -0,0 +1,66 @@
+package mar
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// WithConcurrency sets the number of goroutines ExtractAll and DecompressAll
+// use to decompress and write entries. A value of zero or less uses one
+// goroutine per CPU. Without this option, entries are processed one by one.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		o.concurrency = n
+	}
+}
+
+// forEach calls fn with every integer from 0 to n-1 on up to workers
+// goroutines. It returns the first error fn returns, after which the
+// calls that haven't started yet are skipped.
+func forEach(n, workers int, fn func(i int) error) error {
+	if workers <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			err := fn(i)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if workers > n {
+		workers = n
+	}
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		failed   int32
+	)
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+				err := fn(i)
+				if err != nil {
+					once.Do(func() { firstErr = err })
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n && atomic.LoadInt32(&failed) == 0; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
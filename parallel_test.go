@@ -0,0 +1,131 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForEach(t *testing.T) {
+	for _, workers := range []int{1, 4, 100} {
+		var sum int64
+		err := forEach(50, workers, func(i int) error {
+			atomic.AddInt64(&sum, int64(i))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum != 49*50/2 {
+			t.Fatalf("%d workers: expected a sum of %d but got %d", workers, 49*50/2, sum)
+		}
+	}
+
+	errBoom := errors.New("boom")
+	var calls int64
+	err := forEach(1000, 4, func(i int) error {
+		atomic.AddInt64(&calls, 1)
+		if i == 10 {
+			return errBoom
+		}
+		return nil
+	})
+	if err != errBoom {
+		t.Fatalf("expected error %v but got %v", errBoom, err)
+	}
+	if calls == 1000 {
+		t.Fatal("expected the remaining calls to be skipped after an error")
+	}
+}
+
+func newParallelTestMar(t *testing.T) *File {
+	m := New()
+	for i := 0; i < 40; i++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("entry %d ", i)), 100)
+		err := m.AddContent(data, fmt.Sprintf("dir%d/file%d", i%4, i), 0640, Compress())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestExtractAllConcurrency(t *testing.T) {
+	m := newParallelTestMar(t)
+	dir, err := ioutil.TempDir("", "marparallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var pr progressRecorder
+	err = m.ExtractAll(dir, WithConcurrency(4), WithProgress(pr.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total uint64
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("dir%d/file%d", i%4, i)
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, bytes.Repeat([]byte(fmt.Sprintf("entry %d ", i)), 100)) {
+			t.Fatalf("unexpected content of %q", name)
+		}
+		total += uint64(len(m.Content[name].Data))
+	}
+	pr.check(t, total)
+}
+
+func TestExtractAllDuplicateIndexEntries(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("bcdef"), "foo/bar", 0600)
+	m.Index = append(m.Index, IndexEntry{IndexEntryHeader{Flags: 0640}, "foo/bar"})
+	dir, err := ioutil.TempDir("", "marparallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = m.ExtractAll(dir, WithConcurrency(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "foo", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Fatalf("expected the flags of the last index entry but got %s", fi.Mode())
+	}
+}
+
+func TestDecompressAll(t *testing.T) {
+	m := newParallelTestMar(t)
+	m.AddContent([]byte("not compressed"), "plain", 0640)
+	for _, opts := range [][]Option{nil, {WithConcurrency(0)}} {
+		all, err := m.DecompressAll(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 41 {
+			t.Fatalf("expected 41 entries but got %d", len(all))
+		}
+		if string(all["plain"]) != "not compressed" {
+			t.Fatalf("unexpected content %q", all["plain"])
+		}
+		if !bytes.Equal(all["dir1/file5"], bytes.Repeat([]byte("entry 5 "), 100)) {
+			t.Fatal("unexpected content of dir1/file5")
+		}
+	}
+
+	m.Content["corrupted"] = Entry{Data: []byte("\xfd7zXZ\x00 corrupted"), Compression: CompressionXZ, IsCompressed: true}
+	_, err := m.DecompressAll(WithConcurrency(4))
+	if err == nil {
+		t.Fatal("expected corrupted entry to fail decompression")
+	}
+}
@@ -3,6 +3,7 @@ package mar
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 )
 
 // A parser is initialized to unmarshal a MAR file.
@@ -11,11 +12,23 @@ import (
 // is not thread safe, so use one parser per thread/goroutine.
 type parser struct {
 	// input data being read
-	input []byte
+	input io.ReaderAt
+	// size of the input data
+	size uint64
 	// current position of the cursor in the file
 	cursor uint64
 	// readChunks is the list of chunks that have already been read
 	readChunks []chunk
+	// limits bounds the values accepted from the input
+	limits Limits
+	// mode is how strictly the layout of the input is checked
+	mode parseMode
+	// names are the rules the names of entries are validated with, if any
+	names *NameRules
+	// duplicates is what is done with entries that have the same name
+	duplicates DuplicatePolicy
+	// debug receives the traces of the parser, if not nil
+	debug io.Writer
 }
 
 type chunk struct {
@@ -23,38 +36,113 @@ type chunk struct {
 }
 
 func newParser(input []byte) *parser {
-	return &parser{input: input}
+	return newReaderAtParser(bytes.NewReader(input), uint64(len(input)))
 }
 
-// parse reads from input and converts it into the target data structure.
+func newReaderAtParser(input io.ReaderAt, size uint64) *parser {
+	return &parser{input: input, size: size, limits: DefaultLimits(), debug: debugWriter}
+}
+
+// parse reads readLen bytes from input into data.
 // it applies some basic security checks: first we're making sure we're not
 // reading more than what is available in input, then we check that the chunk
 // has not already been read by the parser. This prevents logic bomb attacks
 // where multiple index entries reference the same chunk of content.
-func (p *parser) parse(data interface{}, readLen int) error {
+func (p *parser) parse(data []byte, readLen int) error {
+	if len(data) < readLen {
+		return errInputTooShort
+	}
+	startPos := p.cursor
+	err := p.reserve(readLen)
+	if err != nil {
+		return err
+	}
+	return p.readAt(data[:readLen], startPos)
+}
+
+// parseUint32 reads a big endian uint32 from input, with the same
+// security checks as parse. It avoids the reflection of binary.Read
+// which dominates the parsing time of large indexes.
+func (p *parser) parseUint32() (uint32, error) {
+	var buf [4]byte
+	err := p.parse(buf[:], len(buf))
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+// parseUint64 reads a big endian uint64 from input, with the same
+// security checks as parse
+func (p *parser) parseUint64() (uint64, error) {
+	var buf [8]byte
+	err := p.parse(buf[:], len(buf))
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// reserve marks the chunk of readLen bytes starting at the cursor as read,
+// after checking it is within the input and has not already been read,
+// and moves the cursor to the end of the chunk.
+func (p *parser) reserve(readLen int) error {
+	if readLen < 0 {
+		return errNegativeReadLen
+	}
+	return p.reserve64(uint64(readLen))
+}
+
+// reserve64 is reserve for lengths that come from the input and may not fit
+// in an int on 32 bits platforms
+func (p *parser) reserve64(readLen uint64) error {
 	startPos := p.cursor
-	endPos := p.cursor + uint64(readLen)
-	if uint64(len(p.input)) < endPos {
+	endPos := p.cursor + readLen
+	if endPos < startPos {
+		debugf(p.debug, "cursor=%d + len=%d overflows\n", startPos, readLen)
+		return errOffsetOverflow
+	}
+	if p.size < endPos {
 		return errInputTooShort
 	}
+	// empty chunks don't read anything, so they can't overlap
+	if readLen == 0 {
+		return nil
+	}
 	// verify that we're not trying to read a chunk that has already been read.
 	// TODO: this is slow and memory intensive, we should use an interval tree
 	for _, chunk := range p.readChunks {
+		if startPos >= chunk.end || endPos <= chunk.start {
+			continue
+		}
+		debugf(p.debug, "chunk.start=%d [ startPos=%d endPos=%d ] chunk.end=%d\n", chunk.start, startPos, endPos, chunk.end)
+		switch {
 		// the starting position is within a chunk already read
-		if chunk.start <= startPos && chunk.end > startPos {
-			debugPrint("chunk.start=%d [ startPos=%d ] chunk.end=%d\n", chunk.start, startPos, chunk.end)
+		case chunk.start <= startPos:
 			return errCursorStartAlreadyRead
-		}
 		// the end position is within a chunk already read
-		if chunk.start < endPos && chunk.end >= endPos {
-			debugPrint("chunk.start=%d [ endPos=%d ] chunk.end=%d\n", chunk.start, endPos, chunk.end)
+		case chunk.end >= endPos:
 			return errCursorEndAlreadyRead
 		}
+		// the chunk contains a chunk already read
+		return errCursorChunkAlreadyRead
 	}
 	p.readChunks = append(p.readChunks, chunk{startPos, endPos})
 
 	// move the cursor forward
 	p.cursor = endPos
-	r := bytes.NewReader(p.input[startPos:endPos])
-	return binary.Read(r, binary.BigEndian, data)
+	return nil
+}
+
+// readAt fills data with the input bytes starting at position pos
+func (p *parser) readAt(data []byte, pos uint64) error {
+	n, err := p.input.ReadAt(data, int64(pos))
+	if n == len(data) {
+		// a reader may return io.EOF along with the last bytes of the input
+		return nil
+	}
+	if err == io.EOF {
+		return errInputTooShort
+	}
+	return err
 }
@@ -95,3 +95,60 @@ func TestParserReadEnd(t *testing.T) {
 	}
 	t.Log(err)
 }
+
+func TestParserUint(t *testing.T) {
+	p := newParser([]byte("\x00\x00\x01\x02\x00\x00\x00\x00\x00\x00\x03\x04\xff"))
+	u32, err := p.parseUint32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u32 != 0x0102 {
+		t.Fatalf("expected to parse uint32 0x0102 but got %#x", u32)
+	}
+	u64, err := p.parseUint64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u64 != 0x0304 {
+		t.Fatalf("expected to parse uint64 0x0304 but got %#x", u64)
+	}
+	_, err = p.parseUint32()
+	if err != errInputTooShort {
+		t.Fatalf("expected to fail with input too short but got %v", err)
+	}
+}
+
+func TestParserOverflow(t *testing.T) {
+	p := newParser([]byte("foobarbaz"))
+	err := p.reserve(-1)
+	if err != errNegativeReadLen {
+		t.Fatalf("expected to fail with %q but got %v", errNegativeReadLen, err)
+	}
+	p.cursor = ^uint64(0) - 2
+	err = p.reserve64(10)
+	if err != errOffsetOverflow {
+		t.Fatalf("expected to fail with %q but got %v", errOffsetOverflow, err)
+	}
+	p.cursor = 4
+	err = p.reserve64(^uint64(0))
+	if err != errOffsetOverflow {
+		t.Fatalf("expected to fail with %q but got %v", errOffsetOverflow, err)
+	}
+}
+
+func TestParserReadContaining(t *testing.T) {
+	input := []byte("aaaaaaaaafoobarbaz")
+	p := newParser(input)
+	output := make([]byte, 18)
+	p.cursor = 4
+	err := p.parse(output, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reading a larger chunk around the chunk previously read must fail
+	p.cursor = 0
+	err = p.parse(output, 18)
+	if err != errCursorChunkAlreadyRead {
+		t.Fatalf("expected to fail with chunk already read but failed with: %v", err)
+	}
+}
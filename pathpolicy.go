@@ -0,0 +1,147 @@
+package mar
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy is how symbolic links met on the filesystem are handled
+type SymlinkPolicy int
+
+const (
+	// SymlinksReject fails on symbolic links
+	SymlinksReject SymlinkPolicy = iota
+	// SymlinksSkip ignores the files that are, or would be written
+	// through, symbolic links
+	SymlinksSkip
+	// SymlinksFollow treats symbolic links as the file they point to
+	SymlinksFollow
+)
+
+// PathPolicy is the set of rules applied to the names of entries when they
+// are turned into paths of the filesystem, by ExtractAll and ApplyPartial,
+// or of other archives, by ToTar and ToZip, and back, by CreateFromDir,
+// such that one policy protects both directions. The zero value is the
+// safest policy.
+type PathPolicy struct {
+	// AllowAbsolute accepts names that are absolute paths, like
+	// /etc/passwd or C:\Windows, which are rejected by default
+	AllowAbsolute bool
+
+	// AllowParentRefs accepts names with a ".." element, which could
+	// escape the directory they are extracted to and are rejected by
+	// default
+	AllowParentRefs bool
+
+	// AllowedPrefixes, if not empty, rejects names that are not under one
+	// of the directories it lists, like "bin" or "defaults/pref". Names
+	// checked against prefixes must be relative and free of ".." elements
+	// whatever AllowAbsolute and AllowParentRefs are.
+	AllowedPrefixes []string
+
+	// Symlinks is how CreateFromDir handles symbolic links found in the
+	// directory, and ExtractAll and ApplyPartial handle existing symbolic
+	// links on the path of the files they write or remove
+	Symlinks SymlinkPolicy
+}
+
+// DefaultPathPolicy returns the policy applied when none is set with
+// WithPathPolicy, which rejects absolute names, parent directory references
+// and symbolic links. It is the zero value.
+func DefaultPathPolicy() PathPolicy {
+	return PathPolicy{}
+}
+
+// WithPathPolicy sets the policy ExtractAll, ApplyPartial, CreateFromDir,
+// ToTar and ToZip apply to the names and paths they touch
+func WithPathPolicy(policy PathPolicy) Option {
+	return func(o *options) {
+		o.pathPolicy = &policy
+	}
+}
+
+// pathPolicyOrDefault returns the path policy of the options
+func (o *options) pathPolicyOrDefault() PathPolicy {
+	if o.pathPolicy == nil {
+		return DefaultPathPolicy()
+	}
+	return *o.pathPolicy
+}
+
+// CheckName returns an error if the name of an entry breaks the policy
+func (policy PathPolicy) CheckName(name string) error {
+	restricted := len(policy.AllowedPrefixes) > 0
+	if !policy.AllowAbsolute || restricted {
+		err := checkAbsolutePath(name)
+		if err != nil {
+			return err
+		}
+	}
+	if !policy.AllowParentRefs || restricted {
+		err := checkParentRefs(name)
+		if err != nil {
+			return err
+		}
+	}
+	if !restricted {
+		return nil
+	}
+	// names are compared once cleaned, such that ./bin//firefox is
+	// an entry of bin
+	cleaned := path.Clean(name)
+	for _, prefix := range policy.AllowedPrefixes {
+		prefix = path.Clean(prefix)
+		if cleaned == prefix || strings.HasPrefix(cleaned, prefix+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", errPathNotAllowed, name)
+}
+
+// checkAbsolutePath returns an error if the name of an entry is absolute
+func checkAbsolutePath(name string) error {
+	if name == "" || name[0] == '/' || name[0] == '\\' || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return fmt.Errorf("refusing to extract entry with absolute name %q", name)
+	}
+	return nil
+}
+
+// checkParentRefs returns an error if the name of an entry contains a
+// parent directory reference
+func checkParentRefs(name string) error {
+	// split on both separators to catch windows style traversals
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return fmt.Errorf("refusing to extract entry %q that contains a parent directory reference", name)
+		}
+	}
+	return nil
+}
+
+// findSymlink returns the first symbolic link on the way from root to
+// path, or an empty string if there is none. Elements of path that don't
+// exist yet can't be links.
+func findSymlink(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	current := root
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, elem)
+		fi, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return current, nil
+		}
+	}
+	return "", nil
+}
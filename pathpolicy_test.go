@@ -0,0 +1,178 @@
+package mar
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathPolicyCheckName(t *testing.T) {
+	prefixes := PathPolicy{AllowedPrefixes: []string{"bin", "defaults/pref/"}}
+	testCases := []struct {
+		policy PathPolicy
+		name   string
+		ok     bool
+	}{
+		{DefaultPathPolicy(), "foo/bar", true},
+		{DefaultPathPolicy(), "/etc/passwd", false},
+		{DefaultPathPolicy(), `\windows\system32`, false},
+		{DefaultPathPolicy(), "foo/../../bar", false},
+		{DefaultPathPolicy(), `foo\..\..\bar`, false},
+		{PathPolicy{}, "/etc/passwd", false},
+		{PathPolicy{}, "../bar", false},
+		{PathPolicy{AllowAbsolute: true}, "/etc/passwd", true},
+		{PathPolicy{AllowParentRefs: true}, "../bar", true},
+		{prefixes, "bin/../../escaped", false},
+		{PathPolicy{AllowedPrefixes: []string{"bin"}, AllowParentRefs: true}, "bin/../../escaped", false},
+		{PathPolicy{AllowedPrefixes: []string{"bin"}, AllowAbsolute: true}, "/bin/sh", false},
+		{prefixes, "bin/./firefox", true},
+		{prefixes, "bin/./", true},
+		{prefixes, "bin", true},
+		{prefixes, "bin/firefox", true},
+		{prefixes, "binary/firefox", false},
+		{prefixes, "defaults/pref/channel-prefs.js", true},
+		{prefixes, "defaults/profile", false},
+	}
+	for i, testCase := range testCases {
+		err := testCase.policy.CheckName(testCase.name)
+		if testCase.ok && err != nil {
+			t.Errorf("testcase %d: expected %q to be accepted but got %v", i, testCase.name, err)
+		}
+		if !testCase.ok && err == nil {
+			t.Errorf("testcase %d: expected %q to be rejected", i, testCase.name)
+		}
+	}
+	err := prefixes.CheckName("lib/libxul.so")
+	if !errors.Is(err, errPathNotAllowed) {
+		t.Fatalf("expected to fail with %q but got %v", errPathNotAllowed, err)
+	}
+}
+
+func TestExtractAllPathPolicy(t *testing.T) {
+	destDir, err := ioutil.TempDir("", "margo_extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(destDir)
+	outDir, err := ioutil.TempDir("", "margo_extract_out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+	err = os.Symlink(outDir, filepath.Join(destDir, "link"))
+	if err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	m := New()
+	m.AddContent([]byte("cariboumaurice"), "link/foo", 0600)
+	m.AddContent([]byte("cariboumaurice"), "bar", 0600)
+
+	err = m.ExtractAll(destDir)
+	if !errors.Is(err, errSymlink) {
+		t.Fatalf("expected to fail with %q but got %v", errSymlink, err)
+	}
+	if _, err = os.Stat(filepath.Join(destDir, "bar")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing to be extracted")
+	}
+
+	err = m.ExtractAll(destDir, WithPathPolicy(PathPolicy{Symlinks: SymlinksSkip}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(destDir, "bar")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(outDir, "foo")); !os.IsNotExist(err) {
+		t.Fatal("expected the entry under the link to be skipped")
+	}
+
+	err = m.ExtractAll(destDir, WithPathPolicy(PathPolicy{Symlinks: SymlinksFollow}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(outDir, "foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.ExtractAll(destDir, WithPathPolicy(PathPolicy{AllowedPrefixes: []string{"link"}, Symlinks: SymlinksFollow}))
+	if !errors.Is(err, errPathNotAllowed) {
+		t.Fatalf("expected to fail with %q but got %v", errPathNotAllowed, err)
+	}
+}
+
+func TestExtractAllPathPolicyPrefixEscape(t *testing.T) {
+	parentDir, err := ioutil.TempDir("", "margo_extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parentDir)
+	destDir := filepath.Join(parentDir, "a", "dest")
+	err = os.MkdirAll(destDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.AddContent([]byte("cariboumaurice"), "bin/../../escaped", 0600)
+	for _, policy := range []PathPolicy{
+		{AllowedPrefixes: []string{"bin"}},
+		{AllowedPrefixes: []string{"bin"}, AllowParentRefs: true},
+	} {
+		err = m.ExtractAll(destDir, WithPathPolicy(policy))
+		if err == nil {
+			t.Fatalf("expected policy %+v to reject the entry", policy)
+		}
+		if _, err = os.Stat(filepath.Join(parentDir, "a", "escaped")); !os.IsNotExist(err) {
+			t.Fatalf("expected nothing to be written outside of the destination with policy %+v", policy)
+		}
+	}
+}
+
+func TestCreateFromDirPathPolicy(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "margo_create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	err = ioutil.WriteFile(filepath.Join(srcDir, "foo"), []byte("cariboumaurice"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("foo", filepath.Join(srcDir, "bar"))
+	if err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+
+	_, err = CreateFromDir(srcDir)
+	if !errors.Is(err, errSymlink) {
+		t.Fatalf("expected to fail with %q but got %v", errSymlink, err)
+	}
+	file, err := CreateFromDir(srcDir, WithPathPolicy(PathPolicy{Symlinks: SymlinksSkip}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Index) != 1 || file.Index[0].FileName != "foo" {
+		t.Fatalf("expected only foo to be added but got %v", file.Index)
+	}
+	file, err = CreateFromDir(srcDir, WithPathPolicy(PathPolicy{Symlinks: SymlinksFollow}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(file.Content["bar"].Data) != "cariboumaurice" || file.Index[0].Flags != 0640 {
+		t.Fatalf("expected bar to hold the content and mode of foo but got %+v", file.Index)
+	}
+	_, err = CreateFromDir(srcDir, WithPathPolicy(PathPolicy{AllowedPrefixes: []string{"bin"}, Symlinks: SymlinksSkip}))
+	if !errors.Is(err, errPathNotAllowed) {
+		t.Fatalf("expected to fail with %q but got %v", errPathNotAllowed, err)
+	}
+
+	err = os.Symlink(srcDir, filepath.Join(srcDir, "loop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CreateFromDir(srcDir, WithPathPolicy(PathPolicy{Symlinks: SymlinksFollow}))
+	if !errors.Is(err, errSymlink) {
+		t.Fatalf("expected a link to a directory to fail with %q but got %v", errSymlink, err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package pkcs11 signs MAR files with RSA keys held in PKCS#11 tokens,
+// such as SoftHSM or hardware security modules.
+//
+// A Signer is configured with the path of the PKCS#11 module, the slot of
+// the token, its PIN and the label of the key, like signmar is with NSS.
+// It implements the crypto.Signer interface, so it plugs into the signing
+// functions of the mar package:
+//
+//	signer, err := pkcs11.New(pkcs11.Config{
+//		Module:   "/usr/lib/softhsm/libsofthsm2.so",
+//		Slot:     0,
+//		PIN:      "1234",
+//		KeyLabel: "release_sha384",
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer signer.Close()
+//	err = file.Sign(rand.Reader, signer, mar.SigAlgRsaPkcs1Sha384)
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+)
+
+// Config locates a key in a PKCS#11 token
+type Config struct {
+	// Module is the path to the shared library of the PKCS#11 module
+	Module string
+	// Slot is the ID of the slot holding the token
+	Slot uint
+	// PIN is the user PIN of the token
+	PIN string
+	// KeyLabel is the label of the private and public key objects
+	KeyLabel string
+}
+
+// Signer signs digests with a private key held in a PKCS#11 token
+type Signer struct {
+	ctx     *p11.Ctx
+	session p11.SessionHandle
+	key     p11.ObjectHandle
+	public  *rsa.PublicKey
+
+	// mu serializes operations on the session, which can only
+	// run one signing operation at a time
+	mu sync.Mutex
+}
+
+// digestInfoPrefixes are the DER encoded DigestInfo prefixes of PKCS1v15
+// signatures, which the CKM_RSA_PKCS mechanism expects before the digest
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+}
+
+// New loads the PKCS#11 module, logs into the token and finds the RSA key
+// pair labelled KeyLabel. The Signer must be closed to release the token.
+func New(cfg Config) (*Signer, error) {
+	ctx := p11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: failed to load module %q", cfg.Module)
+	}
+	err := ctx.Initialize()
+	if err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: failed to initialize module: %w", err)
+	}
+	s := &Signer{ctx: ctx}
+	err = s.open(cfg)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open logs into the token and finds the key pair of the signer
+func (s *Signer) open(cfg Config) error {
+	session, err := s.ctx.OpenSession(cfg.Slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("pkcs11: failed to open session on slot %d: %w", cfg.Slot, err)
+	}
+	s.session = session
+	err = s.ctx.Login(session, p11.CKU_USER, cfg.PIN)
+	if err != nil {
+		return fmt.Errorf("pkcs11: failed to log into slot %d: %w", cfg.Slot, err)
+	}
+	s.key, err = s.findObject(p11.CKO_PRIVATE_KEY, cfg.KeyLabel)
+	if err != nil {
+		return err
+	}
+	pubKey, err := s.findObject(p11.CKO_PUBLIC_KEY, cfg.KeyLabel)
+	if err != nil {
+		return err
+	}
+	attrs, err := s.ctx.GetAttributeValue(session, pubKey, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_KEY_TYPE, nil),
+		p11.NewAttribute(p11.CKA_MODULUS, nil),
+		p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("pkcs11: failed to read public key %q: %w", cfg.KeyLabel, err)
+	}
+	if len(attrs) != 3 || new(big.Int).SetBytes(attrs[0].Value).Uint64() != p11.CKK_RSA {
+		return fmt.Errorf("pkcs11: key %q is not an RSA key", cfg.KeyLabel)
+	}
+	s.public = &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[1].Value),
+		E: int(new(big.Int).SetBytes(attrs[2].Value).Int64()),
+	}
+	return nil
+}
+
+// findObject returns the handle of the only object of the class with the label
+func (s *Signer) findObject(class uint, label string) (p11.ObjectHandle, error) {
+	err := s.ctx.FindObjectsInit(s.session, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, class),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: failed to search for key %q: %w", label, err)
+	}
+	objs, _, err := s.ctx.FindObjects(s.session, 2)
+	s.ctx.FindObjectsFinal(s.session)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: failed to search for key %q: %w", label, err)
+	}
+	switch len(objs) {
+	case 0:
+		return 0, fmt.Errorf("pkcs11: no key labelled %q found", label)
+	case 1:
+		return objs[0], nil
+	}
+	return 0, fmt.Errorf("pkcs11: several keys labelled %q found", label)
+}
+
+// Public returns the public key of the signer
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign returns the PKCS1v15 signature of the digest made by the token. The
+// token makes the entropy it needs, so rand is unused.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	prefix, ok := digestInfoPrefixes[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: unsupported hash function %v", opts.HashFunc())
+	}
+	if len(digest) != opts.HashFunc().Size() {
+		return nil, errors.New("pkcs11: digest length does not match the hash function")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.ctx.SignInit(s.session, []*p11.Mechanism{p11.NewMechanism(p11.CKM_RSA_PKCS, nil)}, s.key)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: failed to initialize signature: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, append(append([]byte{}, prefix...), digest...))
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: failed to sign: %w", err)
+	}
+	return sig, nil
+}
+
+// Close logs out of the token and unloads the PKCS#11 module
+func (s *Signer) Close() error {
+	if s.session != 0 {
+		s.ctx.Logout(s.session)
+		s.ctx.CloseSession(s.session)
+	}
+	err := s.ctx.Finalize()
+	s.ctx.Destroy()
+	return err
+}
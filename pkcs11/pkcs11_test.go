@@ -0,0 +1,81 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"strconv"
+	"testing"
+
+	"go.mozilla.org/mar"
+)
+
+func TestDigestInfoPrefixes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h, prefix := range digestInfoPrefixes {
+		md := h.New()
+		md.Write([]byte("margo"))
+		digest := md.Sum(nil)
+		expected, err := rsa.SignPKCS1v15(nil, key, h, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// signing the prefixed digest without a hash is what CKM_RSA_PKCS does
+		sig, err := rsa.SignPKCS1v15(nil, key, crypto.Hash(0), append(append([]byte{}, prefix...), digest...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sig, expected) {
+			t.Fatalf("digest info prefix of hash %v is wrong", h)
+		}
+	}
+}
+
+// TestSoftHSM signs a MAR file with a key in a SoftHSM token, configured
+// by the MAR_PKCS11_MODULE, MAR_PKCS11_SLOT, MAR_PKCS11_PIN and
+// MAR_PKCS11_LABEL environment variables
+func TestSoftHSM(t *testing.T) {
+	module := os.Getenv("MAR_PKCS11_MODULE")
+	if module == "" {
+		t.Skip("MAR_PKCS11_MODULE is not set")
+	}
+	slot, err := strconv.ParseUint(os.Getenv("MAR_PKCS11_SLOT"), 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := New(Config{
+		Module:   module,
+		Slot:     uint(slot),
+		PIN:      os.Getenv("MAR_PKCS11_PIN"),
+		KeyLabel: os.Getenv("MAR_PKCS11_LABEL"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	for _, alg := range []uint32{mar.SigAlgRsaPkcs1Sha1, mar.SigAlgRsaPkcs1Sha384} {
+		file := mar.New()
+		file.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+		err = file.Sign(rand.Reader, signer, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = file.VerifySignature(signer.Public())
+		if err != nil {
+			t.Fatalf("signature with algorithm %d failed to verify: %v", alg, err)
+		}
+	}
+}
+
+func TestBadModule(t *testing.T) {
+	_, err := New(Config{Module: "/nonexistent/libpkcs11.so"})
+	if err == nil {
+		t.Fatal("expected loading a nonexistent module to fail")
+	}
+}
@@ -0,0 +1,123 @@
+package mar
+
+import (
+	"crypto"
+	"fmt"
+	"time"
+)
+
+// Policy describes the signatures a MAR file must carry to be accepted
+// by VerifyPolicy, such as "at least one SHA384 signature from these keys,
+// with SHA1 signatures allowed until a given date"
+type Policy struct {
+	// Keys are the named public keys signatures are verified against
+	Keys map[string]crypto.PublicKey
+	// MinValid is the number of distinct keys that must have a valid
+	// signature of the file, such that several signatures made with the
+	// same key only count once. At least one is required when it is zero.
+	MinValid int
+	// Algorithms lists the IDs of the signature algorithms that are
+	// allowed, with the time after which signatures of that algorithm
+	// no longer count, or the zero time if they don't expire. All
+	// algorithms are allowed if it is empty.
+	Algorithms map[uint32]time.Time
+	// RequiredAlgorithms lists the IDs of the signature algorithms that
+	// must each have at least one valid signature
+	RequiredAlgorithms []uint32
+	// Time is the time at which the policy is evaluated, which
+	// defaults to the current time
+	Time time.Time
+}
+
+// PolicyResult is the outcome of the verification of a MAR file
+// against a Policy
+type PolicyResult struct {
+	// Signatures holds the result of each signature of the file,
+	// in the order they appear in the file
+	Signatures []SignatureResult `json:"signatures" yaml:"signatures"`
+	// Satisfied is true if the file meets the policy
+	Satisfied bool `json:"satisfied" yaml:"satisfied"`
+	// Reason explains why the policy is satisfied or not
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// SignatureResult is the result of the verification of a single signature,
+// as returned by VerifyReport and VerifyPolicy
+type SignatureResult struct {
+	// AlgorithmID is the ID of the algorithm of the signature
+	AlgorithmID uint32 `json:"algorithm_id" yaml:"algorithm_id"`
+	// Algorithm is the name of the algorithm of the signature
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// Valid is true if the signature verifies, and with VerifyPolicy,
+	// if it also counts toward the policy
+	Valid bool `json:"valid" yaml:"valid"`
+	// KeyName is the name of the key that verified the signature, if any
+	KeyName string `json:"key_name" yaml:"key_name"`
+	// KeyFingerprint is the fingerprint of the key that verified
+	// the signature, as returned by KeyFingerprint
+	KeyFingerprint string `json:"key_fingerprint" yaml:"key_fingerprint"`
+	// Reason explains why the signature is not valid
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// VerifyPolicy verifies the signatures of the MAR file against the keys of
+// the policy and checks they meet its requirements. The result lists the
+// outcome of each signature and is always returned, while the error is
+// non-nil if the policy is not satisfied.
+func (file *File) VerifyPolicy(policy Policy) (*PolicyResult, error) {
+	result := new(PolicyResult)
+	if len(file.Signatures) == 0 {
+		result.Reason = errNoSignature.Error()
+		return result, errNoSignature
+	}
+	sigResults, err := file.VerifyReport(policy.Keys)
+	if err != nil {
+		return result, err
+	}
+	now := policy.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	// signatures are counted by key, such that a key signing twice
+	// can't meet a policy that requires several keys
+	validKeys := make(map[string]bool)
+	validCount := 0
+	validAlgs := make(map[uint32]bool)
+	for _, sr := range sigResults {
+		notAfter, allowed := policy.Algorithms[sr.AlgorithmID]
+		switch {
+		case !sr.Valid:
+			// the reason is set by VerifyReport
+		case len(policy.Algorithms) > 0 && !allowed:
+			sr.Valid = false
+			sr.Reason = fmt.Sprintf("algorithm %s is not allowed", sr.Algorithm)
+		case !notAfter.IsZero() && now.After(notAfter):
+			sr.Valid = false
+			sr.Reason = fmt.Sprintf("algorithm %s is no longer allowed since %s", sr.Algorithm, notAfter.Format(time.RFC3339))
+		default:
+			validCount++
+			validKeys[sr.KeyName] = true
+			validAlgs[sr.AlgorithmID] = true
+		}
+		result.Signatures = append(result.Signatures, sr)
+	}
+
+	minValid := policy.MinValid
+	if minValid < 1 {
+		minValid = 1
+	}
+	if len(validKeys) < minValid {
+		result.Reason = fmt.Sprintf("found %d valid signatures from %d keys but the policy requires %d keys",
+			validCount, len(validKeys), minValid)
+		return result, fmt.Errorf("policy not satisfied: %s", result.Reason)
+	}
+	for _, algID := range policy.RequiredAlgorithms {
+		if !validAlgs[algID] {
+			result.Reason = fmt.Sprintf("no valid signature with required algorithm %s", getSigAlgNameFromID(algID))
+			return result, fmt.Errorf("policy not satisfied: %s", result.Reason)
+		}
+	}
+	result.Satisfied = true
+	result.Reason = fmt.Sprintf("found %d valid signatures out of %d, from %d keys", validCount, len(file.Signatures), len(validKeys))
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+)
+
+func TestVerifyPolicy(t *testing.T) {
+	secondKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err = m.SignAll(rand.Reader,
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha1},
+		SigningKey{secondKey, SigAlgRsaPkcs1Sha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{"test": rsa2048Key.Public(), "second": secondKey.Public()}
+	cutoff := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		policy    Policy
+		satisfied bool
+		valid     []bool
+	}{
+		{Policy{Keys: keys}, true, []bool{true, true}},
+		{Policy{Keys: keys, MinValid: 2}, true, []bool{true, true}},
+		{Policy{Keys: keys, MinValid: 3}, false, []bool{true, true}},
+		{Policy{Keys: map[string]crypto.PublicKey{"other": otherKey.Public()}}, false, []bool{false, false}},
+		{Policy{
+			Keys:       keys,
+			Algorithms: map[uint32]time.Time{SigAlgRsaPkcs1Sha384: {}},
+		}, true, []bool{false, true}},
+		{Policy{
+			Keys:       keys,
+			Algorithms: map[uint32]time.Time{SigAlgRsaPkcs1Sha1: {}},
+			MinValid:   2,
+		}, false, []bool{true, false}},
+		{Policy{
+			Keys:       keys,
+			Algorithms: map[uint32]time.Time{SigAlgRsaPkcs1Sha1: cutoff, SigAlgRsaPkcs1Sha384: {}},
+			MinValid:   2,
+			Time:       cutoff.Add(-time.Hour),
+		}, true, []bool{true, true}},
+		{Policy{
+			Keys:       keys,
+			Algorithms: map[uint32]time.Time{SigAlgRsaPkcs1Sha1: cutoff, SigAlgRsaPkcs1Sha384: {}},
+			MinValid:   2,
+			Time:       cutoff.Add(time.Hour),
+		}, false, []bool{false, true}},
+		{Policy{
+			Keys:               keys,
+			Algorithms:         map[uint32]time.Time{SigAlgRsaPkcs1Sha1: {}},
+			RequiredAlgorithms: []uint32{SigAlgRsaPkcs1Sha384},
+		}, false, []bool{true, false}},
+	}
+	for i, testCase := range testCases {
+		result, err := m.VerifyPolicy(testCase.policy)
+		if testCase.satisfied != (err == nil) || testCase.satisfied != result.Satisfied {
+			t.Fatalf("testcase %d expected policy satisfied to be %t, got %t with error %v",
+				i, testCase.satisfied, result.Satisfied, err)
+		}
+		if result.Reason == "" {
+			t.Fatalf("testcase %d expected a reason", i)
+		}
+		if len(result.Signatures) != len(testCase.valid) {
+			t.Fatalf("testcase %d expected %d signature results, got %d", i, len(testCase.valid), len(result.Signatures))
+		}
+		for j, valid := range testCase.valid {
+			sr := result.Signatures[j]
+			if sr.Valid != valid {
+				t.Fatalf("testcase %d expected signature %d valid to be %t, got %t: %s", i, j, valid, sr.Valid, sr.Reason)
+			}
+			if !valid && sr.Reason == "" {
+				t.Fatalf("testcase %d expected a reason for invalid signature %d", i, j)
+			}
+		}
+	}
+}
+
+func TestVerifyPolicySameKey(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.SignAll(rand.Reader,
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha1},
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{"test": rsa2048Key.Public()}
+	result, err := m.VerifyPolicy(Policy{Keys: keys, MinValid: 2})
+	if err == nil || result.Satisfied {
+		t.Fatal("expected two signatures from the same key not to satisfy a policy requiring two keys")
+	}
+	for i, sr := range result.Signatures {
+		if !sr.Valid {
+			t.Fatalf("expected signature %d to be valid: %s", i, sr.Reason)
+		}
+	}
+	_, err = m.VerifyPolicy(Policy{Keys: keys, MinValid: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyPolicyUnsigned(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	result, err := m.VerifyPolicy(Policy{})
+	if err != errNoSignature {
+		t.Fatalf("expected error %v, got %v", errNoSignature, err)
+	}
+	if result.Satisfied {
+		t.Fatal("expected policy not to be satisfied")
+	}
+}
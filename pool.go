@@ -0,0 +1,45 @@
+package mar
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity above which scratch buffers are
+// dropped instead of being returned to the pool, such that a single
+// large entry doesn't pin its memory for the life of the process
+const maxPooledBufferSize = 64 << 20
+
+// bufferPool holds the scratch buffers entries are decompressed into
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// copyBufferPool holds the buffers used to copy streams
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 32*1024)
+		return &b
+	},
+}
+
+// copyBuffer copies src to dst like io.Copy, with a buffer from the pool
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	b := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(b)
+	return io.CopyBuffer(dst, src, *b)
+}
@@ -0,0 +1,30 @@
+package mar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("caribou")
+	putBuffer(buf)
+	buf = getBuffer()
+	if buf.Len() != 0 {
+		t.Fatalf("expected pooled buffer to be empty but it holds %q", buf.String())
+	}
+	putBuffer(buf)
+}
+
+func TestCopyBuffer(t *testing.T) {
+	var dst bytes.Buffer
+	src := strings.Repeat("maurice ", 10000)
+	n, err := copyBuffer(&dst, strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(src)) || dst.String() != src {
+		t.Fatalf("expected to copy %d bytes but copied %d", len(src), n)
+	}
+}
@@ -0,0 +1,176 @@
+package mar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ProductInfo is the content of a Product Information block, which holds
+// the MAR channel IDs an update is accepted on and the version of the
+// product it updates to
+type ProductInfo struct {
+	// Version is the product version, such as "62.0"
+	Version string `json:"version" yaml:"version"`
+	// Channels lists the accepted MAR channel IDs, such as "firefox-mozilla-release"
+	Channels []string `json:"channels" yaml:"channels"`
+}
+
+// ParseProductInfo parses the data of a Product Information block, which
+// is made of a comma-separated list of MAR channel IDs and a product
+// version, each terminated by a null byte. It returns false if the data
+// is not in this format, such as a block written by AddProductInfo.
+func ParseProductInfo(data []byte) (ProductInfo, bool) {
+	var info ProductInfo
+	// split on the terminator of the channels before trimming the padding,
+	// which would otherwise remove it along with an empty version
+	sep := bytes.IndexByte(data, 0)
+	if sep < 0 {
+		return info, false
+	}
+	version := bytes.TrimRight(data[sep+1:], "\x00")
+	if bytes.IndexByte(version, 0) >= 0 {
+		return info, false
+	}
+	for _, channel := range strings.Split(string(data[:sep]), ",") {
+		if channel != "" {
+			info.Channels = append(info.Channels, channel)
+		}
+	}
+	info.Version = string(version)
+	return info, true
+}
+
+// cacheProductInfo sets the ProductInformation and ProductInfo fields of
+// the file from the data of a Product Information block
+func (file *File) cacheProductInfo(data []byte) {
+	file.ProductInformation = productInfoString(data)
+	if info, ok := ParseProductInfo(data); ok {
+		file.ProductInfo = &info
+	}
+}
+
+// productInfo parses the Product Information blocks of the additional
+// sections, rather than trusting the ProductInfo field, which isn't kept
+// in sync when the sections are modified directly. Like the parser, the
+// last block in the expected format wins.
+func (file *File) productInfo() *ProductInfo {
+	var found *ProductInfo
+	for _, as := range file.AdditionalSections {
+		if as.BlockID != BlockIDProductInfo {
+			continue
+		}
+		if info, ok := ParseProductInfo(as.Data); ok {
+			found = &info
+		}
+	}
+	return found
+}
+
+// maximum sizes of the fields of a Product Information block, without
+// their null terminator, as defined by Mozilla's libmar
+const (
+	productInfoMaxChannelIDSize = 63
+	productInfoMaxVersionSize   = 31
+)
+
+// Bytes returns the data of the Product Information block of info. Like
+// Mozilla's tools, it is padded with null bytes to the maximum size of
+// the fields, and it fails if they're too long to fit.
+func (info ProductInfo) Bytes() ([]byte, error) {
+	err := info.check()
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(strings.Join(info.Channels, ",") + "\x00" + info.Version + "\x00")
+	return append(data, make([]byte, productInfoMaxChannelIDSize+productInfoMaxVersionSize+2-len(data))...), nil
+}
+
+// check verifies the fields of info fit in a Product Information block
+func (info ProductInfo) check() error {
+	if len(strings.Join(info.Channels, ",")) > productInfoMaxChannelIDSize {
+		return errProductChannelTooLong
+	}
+	if len(info.Version) > productInfoMaxVersionSize {
+		return errProductVersionTooLong
+	}
+	return nil
+}
+
+// SetProductInformation sets the Product Information block of the MAR to
+// the product version and MAR channel IDs, replacing the existing block if
+// any. The block has the null-padded layout Firefox's updater expects, and
+// the sizes and offsets of the file are updated accordingly.
+func (file *File) SetProductInformation(version string, channels ...string) error {
+	info := ProductInfo{Version: version, Channels: channels}
+	data, err := info.Bytes()
+	if err != nil {
+		return err
+	}
+	file.ProductInformation = productInfoString(data)
+	file.ProductInfo = &info
+	for i, as := range file.AdditionalSections {
+		if as.BlockID == BlockIDProductInfo {
+			file.AdditionalSections[i].Data = data
+			file.Normalize()
+			return nil
+		}
+	}
+	file.AddAdditionalSection(data, BlockIDProductInfo)
+	return nil
+}
+
+// AddProductInfoBlock adds a Product Information block made of the
+// MAR channel IDs and version of info into the additional sections
+// of a MAR. It fails if the fields of info are too long to fit.
+func (file *File) AddProductInfoBlock(info ProductInfo) error {
+	data, err := info.Bytes()
+	if err != nil {
+		return err
+	}
+	file.AddAdditionalSection(data, BlockIDProductInfo)
+	return nil
+}
+
+// ChannelError is returned by VerifyMarChannel when none of the MAR
+// channel IDs of a MAR file is accepted
+type ChannelError struct {
+	// Channels are the MAR channel IDs of the file, empty if it
+	// has no Product Information block
+	Channels []string
+	// Accepted are the MAR channel IDs that were accepted
+	Accepted []string
+}
+
+func (e *ChannelError) Error() string {
+	if len(e.Channels) == 0 {
+		return fmt.Sprintf("mar has no channel id, accepted channels are %s", strings.Join(e.Accepted, ","))
+	}
+	return fmt.Sprintf("mar channel ids %s are not in the accepted channels %s",
+		strings.Join(e.Channels, ","), strings.Join(e.Accepted, ","))
+}
+
+// Unwrap returns ErrChannelMismatch, such that errors.Is can
+// match all the channel errors
+func (e *ChannelError) Unwrap() error {
+	return ErrChannelMismatch
+}
+
+// VerifyMarChannel checks that one of the MAR channel IDs of the Product
+// Information block of the MAR file is in the accepted channels, like
+// Firefox's updater does with its MAR_CHANNEL_ID. It returns a *ChannelError
+// if the file has no channel ID or none of them is accepted.
+func (file *File) VerifyMarChannel(acceptedChannels []string) error {
+	var channels []string
+	if info := file.productInfo(); info != nil {
+		channels = info.Channels
+	}
+	for _, channel := range channels {
+		for _, accepted := range acceptedChannels {
+			if channel == accepted {
+				return nil
+			}
+		}
+	}
+	return &ChannelError{Channels: channels, Accepted: acceptedChannels}
+}
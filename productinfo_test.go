@@ -0,0 +1,203 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProductInfo(t *testing.T) {
+	testCases := []struct {
+		data     string
+		ok       bool
+		expected ProductInfo
+	}{
+		{"firefox-mozilla-release\x0062.0\x00", true, ProductInfo{Version: "62.0", Channels: []string{"firefox-mozilla-release"}}},
+		{"firefox-mozilla-beta,firefox-mozilla-release\x0063.0b1\x00\x00\x00", true,
+			ProductInfo{Version: "63.0b1", Channels: []string{"firefox-mozilla-beta", "firefox-mozilla-release"}}},
+		{"\x0062.0\x00", true, ProductInfo{Version: "62.0"}},
+		{"firefox-mozilla-release\x00\x00", true, ProductInfo{Channels: []string{"firefox-mozilla-release"}}},
+		{"firefox-mozilla-release\x00", true, ProductInfo{Channels: []string{"firefox-mozilla-release"}}},
+		{"caribou maurice v1.2", false, ProductInfo{}},
+		{"a\x00b\x00c\x00", false, ProductInfo{}},
+	}
+	for i, testCase := range testCases {
+		info, ok := ParseProductInfo([]byte(testCase.data))
+		if ok != testCase.ok {
+			t.Fatalf("testcase %d expected ok to be %t, got %t", i, testCase.ok, ok)
+		}
+		if !reflect.DeepEqual(info, testCase.expected) {
+			t.Fatalf("testcase %d expected %+v, got %+v", i, testCase.expected, info)
+		}
+	}
+}
+
+func TestProductInfoBlock(t *testing.T) {
+	info := ProductInfo{Version: "62.0", Channels: []string{"firefox-mozilla-beta", "firefox-mozilla-release"}}
+	m := New()
+	err := m.AddProductInfoBlock(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.ProductInfo == nil || !reflect.DeepEqual(*reparsed.ProductInfo, info) {
+		t.Fatalf("expected product info %+v, got %+v", info, reparsed.ProductInfo)
+	}
+	if reparsed.ProductInformation != "firefox-mozilla-beta,firefox-mozilla-release 62.0" {
+		t.Fatalf("unexpected raw product information %q", reparsed.ProductInformation)
+	}
+}
+
+func TestSetProductInformation(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.SetProductInformation("62.0", "firefox-mozilla-beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.SetProductInformation("63.0", "firefox-mozilla-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.AdditionalSections) != 1 {
+		t.Fatalf("expected the product information block to be replaced, found %d sections", len(m.AdditionalSections))
+	}
+	expected := "firefox-mozilla-release\x0063.0\x00"
+	data := m.AdditionalSections[0].Data
+	if len(data) != 96 || string(data[:len(expected)]) != expected || !bytes.Equal(data[len(expected):], make([]byte, 96-len(expected))) {
+		t.Fatalf("unexpected product information block %q", data)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.ProductInfo == nil || reparsed.ProductInfo.Version != "63.0" ||
+		!reflect.DeepEqual(reparsed.ProductInfo.Channels, []string{"firefox-mozilla-release"}) {
+		t.Fatalf("unexpected product info %+v", reparsed.ProductInfo)
+	}
+	if reparsed.AdditionalSections[0].BlockSize != 104 {
+		t.Fatalf("expected block size of 104, got %d", reparsed.AdditionalSections[0].BlockSize)
+	}
+	if reparsed.Content["/foo/bar"].Data == nil {
+		t.Fatal("expected content to be preserved")
+	}
+}
+
+func TestSetProductInformationTooLong(t *testing.T) {
+	m := New()
+	err := m.SetProductInformation(strings.Repeat("1", 32), "release")
+	if err != errProductVersionTooLong {
+		t.Fatalf("expected error %v, got %v", errProductVersionTooLong, err)
+	}
+	err = m.SetProductInformation("62.0", strings.Repeat("a", 40), strings.Repeat("b", 23))
+	if err != errProductChannelTooLong {
+		t.Fatalf("expected error %v, got %v", errProductChannelTooLong, err)
+	}
+	if len(m.AdditionalSections) != 0 {
+		t.Fatalf("expected no section to be added, found %d", len(m.AdditionalSections))
+	}
+}
+
+func TestProductInfoBlockTooLong(t *testing.T) {
+	info := ProductInfo{Version: strings.Repeat("1", 32), Channels: []string{"release"}}
+	_, err := info.Bytes()
+	if err != errProductVersionTooLong {
+		t.Fatalf("expected error %v, got %v", errProductVersionTooLong, err)
+	}
+	m := New()
+	err = m.AddProductInfoBlock(info)
+	if err != errProductVersionTooLong {
+		t.Fatalf("expected error %v, got %v", errProductVersionTooLong, err)
+	}
+	if len(m.AdditionalSections) != 0 {
+		t.Fatalf("expected no section to be added, found %d", len(m.AdditionalSections))
+	}
+	w := NewWriter(new(bytes.Buffer))
+	err = w.AddProductInfoBlock(ProductInfo{Version: "62.0", Channels: []string{strings.Repeat("a", 64)}})
+	if err != errProductChannelTooLong {
+		t.Fatalf("expected error %v, got %v", errProductChannelTooLong, err)
+	}
+}
+
+func TestVerifyMarChannel(t *testing.T) {
+	m := New()
+	err := m.VerifyMarChannel([]string{"firefox-mozilla-release"})
+	if !errors.Is(err, ErrChannelMismatch) {
+		t.Fatalf("expected a channel mismatch without product information, got %v", err)
+	}
+	err = m.SetProductInformation("62.0", "firefox-mozilla-beta", "firefox-mozilla-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.VerifyMarChannel([]string{"firefox-mozilla-esr", "firefox-mozilla-release"})
+	if err != nil {
+		t.Fatalf("expected channel to be accepted, got %v", err)
+	}
+	err = m.VerifyMarChannel([]string{"firefox-mozilla-esr"})
+	var chanErr *ChannelError
+	if !errors.As(err, &chanErr) || !errors.Is(err, ErrChannelMismatch) {
+		t.Fatalf("expected a channel error, got %v", err)
+	}
+	if len(chanErr.Channels) != 2 || len(chanErr.Accepted) != 1 {
+		t.Fatalf("unexpected channel error %+v", chanErr)
+	}
+}
+
+func TestVerifyMarChannelAddedBlock(t *testing.T) {
+	info := ProductInfo{Version: "62.0", Channels: []string{"firefox-mozilla-release"}}
+	m := New()
+	err := m.AddProductInfoBlock(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.VerifyMarChannel([]string{"firefox-mozilla-release"})
+	if err != nil {
+		t.Fatalf("expected channel of AddProductInfoBlock to be accepted, got %v", err)
+	}
+	if m.ProductInfo == nil || m.ProductInfo.Version != "62.0" {
+		t.Fatalf("expected AddProductInfoBlock to set the product info, got %+v", m.ProductInfo)
+	}
+
+	m = New()
+	err = m.AddSectionValue(BlockIDProductInfo, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.VerifyMarChannel([]string{"firefox-mozilla-release"})
+	if err != nil {
+		t.Fatalf("expected channel of AddSectionValue to be accepted, got %v", err)
+	}
+
+	// sections modified in place are read as well
+	m.AdditionalSections[0].Data, err = ProductInfo{Version: "63.0", Channels: []string{"firefox-mozilla-beta"}}.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.VerifyMarChannel([]string{"firefox-mozilla-release"})
+	if !errors.Is(err, ErrChannelMismatch) {
+		t.Fatalf("expected a channel mismatch after the block changed, got %v", err)
+	}
+	md, err := m.ReleaseMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.AppVersion != "63.0" {
+		t.Fatalf("expected the version of the modified block but got %q", md.AppVersion)
+	}
+}
@@ -0,0 +1,43 @@
+package mar
+
+import "sync"
+
+// ProgressFunc is called by long operations to report their progress. It
+// receives the number of bytes processed so far, the total number of bytes
+// to process, and the name of the section or entry that was just processed.
+// Sections are named "headers", "index" and "slack", and entries by their
+// file name. When entries are processed by several goroutines, the function
+// may be called from any of them, but never concurrently. It must return
+// quickly, since it holds up the operation.
+type ProgressFunc func(done, total uint64, current string)
+
+// WithProgress sets the function Unmarshal, Marshal and ExtractAll call to
+// report their progress, such that a progress bar can be rendered while
+// large files are processed
+func WithProgress(fn ProgressFunc) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// progress accumulates the bytes processed by an operation
+// and reports them to a ProgressFunc, if any
+type progress struct {
+	mu          sync.Mutex
+	fn          ProgressFunc
+	done, total uint64
+}
+
+func newProgress(fn ProgressFunc, total uint64) *progress {
+	return &progress{fn: fn, total: total}
+}
+
+// add records that n more bytes were processed
+func (p *progress) add(n uint64, current string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if p.fn != nil {
+		p.fn(p.done, p.total, current)
+	}
+}
@@ -0,0 +1,119 @@
+package mar
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type progressRecorder struct {
+	calls []string
+	done  []uint64
+	total uint64
+}
+
+func (pr *progressRecorder) record(done, total uint64, current string) {
+	pr.calls = append(pr.calls, current)
+	pr.done = append(pr.done, done)
+	pr.total = total
+}
+
+// check verifies that progress only moved forward and ended at total
+func (pr *progressRecorder) check(t *testing.T, total uint64) {
+	t.Helper()
+	if len(pr.done) == 0 {
+		t.Fatal("progress was never reported")
+	}
+	if pr.total != total {
+		t.Fatalf("expected a total of %d bytes but got %d", total, pr.total)
+	}
+	for i := 1; i < len(pr.done); i++ {
+		if pr.done[i] < pr.done[i-1] {
+			t.Fatalf("progress went backward from %d to %d", pr.done[i-1], pr.done[i])
+		}
+	}
+	if pr.done[len(pr.done)-1] != total {
+		t.Fatalf("expected progress to end at %d but got %d", total, pr.done[len(pr.done)-1])
+	}
+}
+
+func TestUnmarshalProgress(t *testing.T) {
+	for _, zeroCopy := range []bool{false, true} {
+		var pr progressRecorder
+		opts := []Option{WithProgress(pr.record)}
+		if zeroCopy {
+			opts = append(opts, ZeroCopy())
+		}
+		var file File
+		err := Unmarshal(miniMarB, &file, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pr.check(t, uint64(len(miniMarB)))
+		if pr.calls[0] != "index" || len(pr.calls) != len(file.Index)+1 {
+			t.Fatalf("unexpected progress calls %q", pr.calls)
+		}
+		for i, idx := range file.Index {
+			if pr.calls[i+1] != idx.FileName {
+				t.Fatalf("expected progress of entry %q but got %q", idx.FileName, pr.calls[i+1])
+			}
+		}
+	}
+}
+
+func TestMarshalProgress(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+	var pr progressRecorder
+	output, err := m.Marshal(WithProgress(pr.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.check(t, uint64(len(output)))
+	expected := []string{"headers", "/foo/bar", "/foo/baz", "index"}
+	if len(pr.calls) != len(expected) {
+		t.Fatalf("expected progress calls %q but got %q", expected, pr.calls)
+	}
+	for i := range expected {
+		if pr.calls[i] != expected[i] {
+			t.Fatalf("expected progress calls %q but got %q", expected, pr.calls)
+		}
+	}
+
+	// trailing data kept by the lenient parser counts in the total
+	var file File
+	err = Unmarshal(append(output, "trailing"...), &file, Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr = progressRecorder{}
+	output, err = file.Marshal(WithProgress(pr.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.check(t, uint64(len(output)))
+}
+
+func TestExtractAllProgress(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "foo/bar", 0600)
+	err := m.AddContent([]byte("bcdef"), "foo/baz", 0640, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "marprogress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var pr progressRecorder
+	err = m.ExtractAll(dir, WithProgress(pr.record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.check(t, uint64(40+len(m.Content["foo/baz"].Data)))
+	if len(pr.calls) != 2 || pr.calls[0] != "foo/bar" || pr.calls[1] != "foo/baz" {
+		t.Fatalf("unexpected progress calls %q", pr.calls)
+	}
+}
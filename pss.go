@@ -0,0 +1,40 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RsaPssAlgorithm returns an RSA-PSS signature algorithm with the hash
+// function h, to register under an ID of the caller's choosing with
+// RegisterSignatureAlgorithm, as RSA-PSS has no algorithm ID in the MAR
+// format and the Firefox updater does not support it. Signatures are made
+// with a salt as long as the digest, and verified with any salt length,
+// such that signatures made by other signing services verify as well.
+func RsaPssAlgorithm(h crypto.Hash) SignatureAlgorithm {
+	name := "RSA-PSS-" + strings.ToUpper(hashName(h))
+	return SignatureAlgorithm{
+		Name: name,
+		Hash: h,
+		SignatureSize: func(pub crypto.PublicKey) (uint32, error) {
+			rsaKey, ok := pub.(*rsa.PublicKey)
+			if !ok {
+				return 0, fmt.Errorf("%w: %s signatures can't be made with a key of type %T", errBadSigAlg, name, pub)
+			}
+			return rsaSignatureSize(rsaKey), nil
+		},
+		Sign: func(signer crypto.Signer, rand io.Reader, digest []byte) ([]byte, error) {
+			return signer.Sign(rand, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h})
+		},
+		Verify: func(pub crypto.PublicKey, digest, sig []byte) error {
+			rsaKey, ok := pub.(*rsa.PublicKey)
+			if !ok {
+				return fmt.Errorf("unknown public key type %T", pub)
+			}
+			return rsa.VerifyPSS(rsaKey, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		},
+	}
+}
@@ -0,0 +1,100 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+// algorithm IDs the tests register RSA-PSS under
+const (
+	sigAlgRsaPssSha256 = 0x5A35
+	sigAlgRsaPssSha384 = 0x5A36
+)
+
+func init() {
+	err := RegisterSignatureAlgorithm(sigAlgRsaPssSha256, RsaPssAlgorithm(crypto.SHA256))
+	if err != nil {
+		panic(err)
+	}
+	err = RegisterSignatureAlgorithm(sigAlgRsaPssSha384, RsaPssAlgorithm(crypto.SHA384))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRsaPssSignVerify(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.SignAll(rand.Reader,
+		SigningKey{hsmSigner{rsa2048Key, crypto.SHA256}, sigAlgRsaPssSha256},
+		SigningKey{rsa2048Key, sigAlgRsaPssSha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	err = Unmarshal(signed, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"RSA-PSS-SHA256", "RSA-PSS-SHA384"} {
+		if file.Signatures[i].Algorithm != name {
+			t.Fatalf("expected signature %d to be %s but got %q", i, name, file.Signatures[i].Algorithm)
+		}
+	}
+	validKeys, err := file.VerifyWithKeys(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 2 {
+		t.Fatalf("expected 2 valid signatures but got %d", len(validKeys))
+	}
+
+	// pss signatures don't verify as pkcs1v15 ones
+	data, err := file.MarshalForSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifySignature(data, file.Signatures[1].Data, SigAlgRsaPkcs1Sha384, rsa2048Key.Public())
+	if err == nil {
+		t.Fatal("expected a pss signature to fail pkcs1v15 verification")
+	}
+}
+
+func TestRsaPssOtherSaltLength(t *testing.T) {
+	digest, _, err := Hash([]byte("caribou maurice"), sigAlgRsaPssSha256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := rsa.SignPSS(rand.Reader, rsa2048Key, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifySignature([]byte("caribou maurice"), sig, sigAlgRsaPssSha256, rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRsaPssWrongKeyType(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = New().Sign(rand.Reader, ecdsaKey, sigAlgRsaPssSha256)
+	if !errors.Is(err, errBadSigAlg) {
+		t.Fatalf("expected to fail with %q but got %v", errBadSigAlg, err)
+	}
+	err = VerifySignature([]byte("foo"), make([]byte, 64), sigAlgRsaPssSha256, ecdsaKey.Public())
+	if err == nil {
+		t.Fatal("expected verifying pss with an ecdsa key to fail")
+	}
+}
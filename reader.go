@@ -0,0 +1,86 @@
+package mar
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reader gives access to a MAR file stored in an io.ReaderAt, such as an
+// *os.File, without loading it entirely in memory. The headers, signatures,
+// additional sections and index are parsed when the Reader is created, and
+// the content of entries is only read when requested.
+type Reader struct {
+	// File contains the headers, signatures, additional sections and
+	// index of the MAR. Its Content map is left empty.
+	File *File
+
+	input   io.ReaderAt
+	entries map[string]IndexEntry
+	limits  Limits
+}
+
+// NewReader parses the headers and index of the MAR file of the given size
+// read from input. The same security checks as Unmarshal are applied, such
+// that content entries that overlap each other or the headers are rejected.
+// It accepts the same WithLimits, Strict and Lenient options as Unmarshal.
+func NewReader(input io.ReaderAt, size int64, opts ...Option) (*Reader, error) {
+	if size < 0 {
+		return nil, errTooSmall
+	}
+	o := newOptions(opts)
+	file := &File{debug: o.debug}
+	p := newReaderAtParser(input, uint64(size))
+	p.limits = o.limits
+	p.mode = o.mode
+	p.names = o.nameRules()
+	p.duplicates = o.duplicates
+	p.debug = o.debug
+	err := unmarshalHeaders(p, file)
+	if err != nil {
+		return nil, err
+	}
+	file.Content = make(map[string]Entry)
+	r := &Reader{
+		File:    file,
+		input:   input,
+		entries: make(map[string]IndexEntry, len(file.Index)),
+		limits:  o.limits,
+	}
+	for _, idxEntry := range file.Index {
+		if _, ok := r.entries[idxEntry.FileName]; ok {
+			return nil, fmt.Errorf("%w: file named %q already exists in the archive", ErrDuplicateEntry, idxEntry.FileName)
+		}
+		r.entries[idxEntry.FileName] = idxEntry
+	}
+	return r, nil
+}
+
+// Open returns a reader of the raw content of the entry named name, which
+// may still be compressed. Reading from it reads directly from the input
+// of the Reader.
+func (r *Reader) Open(name string) (*io.SectionReader, error) {
+	idxEntry, ok := r.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("file named %q does not exist in the archive", name)
+	}
+	return io.NewSectionReader(r.input, int64(idxEntry.OffsetToContent), int64(idxEntry.Size)), nil
+}
+
+// GetEntry reads the content of the entry named name directly from its
+// offset in the input, without reading any other entry, and returns it
+// with its compression format detected
+func (r *Reader) GetEntry(name string) (Entry, error) {
+	sr, err := r.Open(name)
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	entry.Data = make([]byte, sr.Size())
+	_, err = io.ReadFull(sr, entry.Data)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to read content of %q: %w", name, err)
+	}
+	entry.Compression = detectCompression(entry.Data)
+	entry.IsCompressed = entry.Compression != CompressionNone
+	return entry, nil
+}
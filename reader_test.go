@@ -0,0 +1,152 @@
+package mar
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+	m.AddProductInfo("caribou maurice v1.2")
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write the mar to disk and read it back from the file descriptor
+	fd, err := ioutil.TempFile("", "margo_reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+	_, err = fd.Write(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(fd, int64(len(o)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File.Index) != 2 {
+		t.Fatalf("expected 2 index entries but found %d", len(r.File.Index))
+	}
+	if len(r.File.Content) != 0 {
+		t.Fatalf("expected no content to be loaded but found %d entries", len(r.File.Content))
+	}
+	if r.File.ProductInformation != "caribou maurice v1.2" {
+		t.Fatalf("expected product information %q but found %q", "caribou maurice v1.2", r.File.ProductInformation)
+	}
+	for _, idx := range m.Index {
+		sr, err := r.Open(idx.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, m.Content[idx.FileName].Data) {
+			t.Fatalf("expected to read %q from entry %q but got %q", m.Content[idx.FileName].Data, idx.FileName, data)
+		}
+	}
+	_, err = r.Open("/does/not/exist")
+	if err == nil {
+		t.Fatal("expected opening a missing entry to fail but it succeeded")
+	}
+}
+
+func TestReaderOldMar(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(oldMarB), int64(len(oldMarB)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.File.Revision != 2005 {
+		t.Fatalf("expected to find revision set to 2005 but found %d instead", r.File.Revision)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	_, err := NewReader(bytes.NewReader(miniMarB), int64(len(miniMarB)+10))
+	if err == nil {
+		t.Fatal("expected reading past the end of the input to fail but it succeeded")
+	}
+	t.Log(err)
+}
+
+// countingReaderAt counts the bytes read from the underlying io.ReaderAt
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func TestReaderGetEntry(t *testing.T) {
+	m := New()
+	m.AddContent(bytes.Repeat([]byte("a"), 100000), "/big", 0600)
+	m.AddContent([]byte("manifest"), "update.manifest", 0644, Compress())
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := &countingReaderAt{r: bytes.NewReader(o)}
+	r, err := NewReader(input, int64(len(o)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headersRead := input.n
+	entry, err := r.GetEntry("update.manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.n-headersRead != len(m.Content["update.manifest"].Data) {
+		t.Fatalf("expected to read only the entry content but read %d bytes", input.n-headersRead)
+	}
+	if headersRead >= 100000 {
+		t.Fatalf("expected the content of the big entry to not be read but read %d bytes", headersRead)
+	}
+	if entry.Compression != CompressionXZ {
+		t.Fatalf("expected entry to be compressed with xz but found %s", entry.Compression)
+	}
+	data, err := entry.Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "manifest" {
+		t.Fatalf("expected entry to contain %q but found %q", "manifest", data)
+	}
+	_, err = r.GetEntry("/does/not/exist")
+	if err == nil {
+		t.Fatal("expected getting a missing entry to fail but it succeeded")
+	}
+}
+
+func TestReaderOptions(t *testing.T) {
+	input := append(append([]byte{}, miniMarB...), []byte("garbage")...)
+	_, err := NewReader(bytes.NewReader(input), int64(len(input)))
+	if err == nil {
+		t.Fatal("expected reading a file with trailing data to fail but it succeeded")
+	}
+	r, err := NewReader(bytes.NewReader(input), int64(len(input)), Lenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File.Warnings) != 1 {
+		t.Fatalf("expected 1 warning but got %q", r.File.Warnings)
+	}
+	_, err = NewReader(bytes.NewReader(miniMarB), int64(len(miniMarB)), WithLimits(Limits{MaxTotalSize: 100}))
+	if _, ok := err.(*LimitError); !ok {
+		t.Fatalf("expected to fail with a limit error but got %v", err)
+	}
+}
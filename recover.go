@@ -0,0 +1,165 @@
+package mar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"go.mozilla.org/mar/internal/manifest"
+)
+
+// manifestMagic is the start of the text of an update manifest
+var manifestMagic = []byte(`type "`)
+
+// Recover makes a best effort to salvage a MAR file whose index or offset
+// to index is damaged. The signatures and additional sections are parsed
+// if they are intact, then the content is scanned for the start of
+// compressed streams and of update manifests, and an index is rebuilt with
+// one entry per stream found, running until the start of the next one.
+// Manifests are named after the manifest they look like, and other entries
+// "recovered/N". Entries get 0644 permissions. Signatures are dropped since
+// they can't be valid for the rebuilt file, and the Warnings of the File
+// describe what was recovered. The WithLimits option applies to the
+// signatures and additional sections.
+//
+// The rebuilt index is only as good as the scan: uncompressed entries that
+// follow a compressed one or each other are merged, and the names of the
+// original files are lost.
+func Recover(input []byte, opts ...Option) (*File, error) {
+	o := newOptions(opts)
+	if uint64(len(input)) < limitMinFileSize {
+		return nil, errTooSmall
+	}
+	if string(input[:MarIDLen]) != "MAR1" {
+		return nil, errBadMarID
+	}
+	file := New()
+
+	// parse the headers of a modern MAR, or assume an old one if they
+	// don't make sense
+	var parsed File
+	p := newParser(input)
+	p.limits = o.limits
+	p.cursor = MarIDLen + OffsetToIndexLen + FileSizeLen
+	contentStart := uint64(MarIDLen + OffsetToIndexLen)
+	err := unmarshalSignaturesAndSections(p, &parsed)
+	if err == nil {
+		contentStart = p.cursor
+		file.AdditionalSections = parsed.AdditionalSections
+		file.ProductInformation = parsed.ProductInformation
+		file.ProductInfo = parsed.ProductInfo
+		if len(parsed.Signatures) > 0 {
+			file.addWarning("dropped %d signatures", len(parsed.Signatures))
+		}
+	} else {
+		file.addWarning("no valid signatures and additional sections, assuming an old MAR: %v", err)
+	}
+
+	// content runs until the index if the offset to it is plausible
+	contentEnd := uint64(len(input))
+	if offset := uint64(binary.BigEndian.Uint32(input[MarIDLen:])); offset >= contentStart && offset <= contentEnd {
+		contentEnd = offset
+	} else {
+		file.addWarning("offset to index %d is out of bounds, scanning until the end of the file", offset)
+	}
+
+	content := input[contentStart:contentEnd]
+	starts := scanEntryStarts(content)
+	if len(content) > 0 && (len(starts) == 0 || starts[0] != 0) {
+		starts = append([]int{0}, starts...)
+	}
+	for i, start := range starts {
+		end := len(content)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		data := content[start:end]
+		if trimmed := trimXZ(data); len(trimmed) < len(data) {
+			file.addWarning("dropped %d bytes after the xz stream at offset %d",
+				len(data)-len(trimmed), contentStart+uint64(start))
+			data = trimmed
+		}
+		data = append([]byte(nil), data...)
+		name := recoveredName(data, i)
+		if _, ok := file.Content[name]; ok {
+			name = fmt.Sprintf("recovered/%d", i)
+		}
+		compression := detectCompression(data)
+		file.Content[name] = Entry{
+			Data:         data,
+			IsCompressed: compression != CompressionNone,
+			Compression:  compression,
+		}
+		file.Index = append(file.Index, IndexEntry{IndexEntryHeader{Flags: FlagsRegular}, name})
+	}
+	file.addWarning("recovered %d entries between offsets %d and %d", len(starts), contentStart, contentEnd)
+	file.Normalize()
+	return file, nil
+}
+
+// scanEntryStarts returns the positions in content where a compressed
+// stream or an update manifest starts. Compressed streams can hold the
+// text of a manifest as is, so manifests are only looked for after
+// uncompressed data.
+func scanEntryStarts(content []byte) []int {
+	codecsMu.RLock()
+	registered := append([]*Codec(nil), codecs...)
+	codecsMu.RUnlock()
+
+	var starts []int
+	inStream := false
+	for i := range content {
+		rest := content[i:]
+		matched := false
+		for _, codec := range registered {
+			if codec != nil && codec.match(rest) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			starts = append(starts, i)
+			inStream = true
+		} else if !inStream && bytes.HasPrefix(rest, manifestMagic) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// recoveredName returns the name of the manifest data looks like,
+// or a generic name for the i-th recovered entry
+func recoveredName(data []byte, i int) string {
+	entry := Entry{Data: data, Compression: detectCompression(data)}
+	r, err := entry.Open()
+	if err == nil {
+		head := make([]byte, 64)
+		n, _ := io.ReadFull(r, head)
+		r.Close()
+		head = head[:n]
+		if bytes.HasPrefix(head, manifestMagic) {
+			return manifest.V3Name
+		}
+	}
+	return fmt.Sprintf("recovered/%d", i)
+}
+
+// trimXZ returns data up to the end of the footer of the last xz stream
+// it contains, or data unchanged if it is not an xz stream. Footers are
+// recognized by their magic bytes and the checksum of their fields.
+func trimXZ(data []byte) []byte {
+	if detectCompression(data) != CompressionXZ {
+		return data
+	}
+	// a footer is made of a crc32, a backward size, stream flags and "YZ"
+	for end := len(data); end >= 12; end-- {
+		footer := data[end-12 : end]
+		if footer[10] == 'Y' && footer[11] == 'Z' &&
+			crc32.ChecksumIEEE(footer[4:10]) == binary.LittleEndian.Uint32(footer[:4]) {
+			return data[:end]
+		}
+	}
+	return data
+}
@@ -0,0 +1,108 @@
+package mar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	manifestData := []byte("type \"complete\"\nadd \"foo\"\nadd \"bar\"\n")
+	random := rand.New(rand.NewSource(1))
+	foo := make([]byte, 1000)
+	random.Read(foo)
+	bar := bytes.Repeat([]byte("bar content "), 50)
+
+	m := New()
+	err := m.SetProductInformation("62.0", "firefox-mozilla-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []struct {
+		name string
+		data []byte
+	}{{"updatev3.manifest", manifestData}, {"foo", foo}, {"bar", bar}} {
+		err = m.AddContent(e.data, e.name, 0755, Compress())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// point the offset to index past the end of the file
+	binary.BigEndian.PutUint32(o[MarIDLen:], uint32(len(o)+10))
+	var damaged File
+	err = Unmarshal(o, &damaged)
+	if err == nil {
+		t.Fatal("expected the damaged file to fail to parse")
+	}
+
+	recovered, err := Recover(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := recovered.Entries()
+	if len(entries) != 3 || entries[0].Name != "updatev3.manifest" {
+		t.Fatalf("unexpected recovered entries %+v", recovered.Index)
+	}
+	for i, expected := range [][]byte{manifestData, foo, bar} {
+		data, err := entries[i].Decompressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("unexpected content in recovered entry %q", entries[i].Name)
+		}
+	}
+	if recovered.ProductInfo == nil || recovered.ProductInfo.Version != "62.0" {
+		t.Fatalf("expected the product information to be recovered, got %+v", recovered.ProductInfo)
+	}
+	if len(recovered.Warnings) == 0 {
+		t.Fatal("expected warnings describing the recovery")
+	}
+	_, err = recovered.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverIntactOffset(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("type \"partial\"\npatch \"foo.patch\" \"foo\"\n"), "update.manifest", 0644)
+	err := m.AddContent(bytes.Repeat([]byte("patch "), 50), "foo.patch", 0644, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wipe the index
+	for i := m.OffsetToIndex; i < uint32(len(o)); i++ {
+		o[i] = 0xff
+	}
+	recovered, err := Recover(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntryNames(t, recovered.Entries(), "updatev3.manifest", "recovered/1")
+	if !bytes.Equal(recovered.Content["recovered/1"].Data, m.Content["foo.patch"].Data) {
+		t.Fatal("unexpected content of the recovered entry")
+	}
+}
+
+func TestRecoverBadInput(t *testing.T) {
+	_, err := Recover([]byte("MAR1"))
+	if err != errTooSmall {
+		t.Fatalf("expected error %v, got %v", errTooSmall, err)
+	}
+	_, err = Recover(bytes.Repeat([]byte("A"), 100))
+	if !errors.Is(err, ErrBadMarID) {
+		t.Fatalf("expected error %v, got %v", ErrBadMarID, err)
+	}
+}
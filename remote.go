@@ -0,0 +1,231 @@
+package mar
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// remoteBlockSize is the size of the blocks fetched by HTTPReaderAt. It is
+// large enough to fetch the headers of a MAR in a single request.
+const remoteBlockSize = 64 * 1024
+
+// remoteMaxBlocks is the number of blocks an HTTPReaderAt keeps in cache
+const remoteMaxBlocks = 16
+
+// HTTPReaderAt is an io.ReaderAt that reads a file from an HTTP server
+// with Range requests, such that the index and a few entries of a MAR
+// stored on a CDN can be read without downloading the entire file. Small
+// reads are served from a cache of aligned blocks to keep the number of
+// requests low while the headers and index are parsed. The file is pinned
+// to the version first read with its ETag or Last-Modified date, and reads
+// fail if it changes, such that ranges of different versions never mix.
+type HTTPReaderAt struct {
+	client *http.Client
+	url    string
+	size   int64
+	// etag and lastModified are the validators of the first response
+	etag, lastModified string
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+// NewHTTPReaderAt returns a reader of the file at url. It fetches the first
+// block of the file to learn its size and fails if the server doesn't
+// support Range requests. The default HTTP client is used if client is nil.
+func NewHTTPReaderAt(client *http.Client, url string) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &HTTPReaderAt{
+		client: client,
+		url:    url,
+		blocks: make(map[int64][]byte),
+	}
+	data, size, err := r.fetch(0, remoteBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	r.size = size
+	r.cache(0, data)
+	return r, nil
+}
+
+// OpenURL returns a Reader of the MAR file at url, as NewReader would for
+// a local file. Only the headers and index are downloaded, and the content
+// of each entry is downloaded when it is opened. Options are passed to
+// NewReader.
+func OpenURL(client *http.Client, url string, opts ...Option) (*Reader, error) {
+	r, err := NewHTTPReaderAt(client, url)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(r, r.Size(), opts...)
+}
+
+// Size returns the size of the remote file
+func (r *HTTPReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) bytes of the remote file starting at off. Reads that
+// are larger than a block are fetched directly in a single request.
+func (r *HTTPReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errNegativeReadLen
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	if end-off > remoteBlockSize {
+		data, _, err := r.fetch(off, end-off)
+		if err != nil {
+			return 0, err
+		}
+		n = copy(p, data)
+	} else {
+		for pos := off; pos < end; {
+			start := pos - pos%remoteBlockSize
+			block, err := r.block(start)
+			if err != nil {
+				return n, err
+			}
+			if pos-start >= int64(len(block)) {
+				return n, io.ErrUnexpectedEOF
+			}
+			copied := copy(p[n:end-off], block[pos-start:])
+			n += copied
+			pos += int64(copied)
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the block that starts at off, from the cache if possible
+func (r *HTTPReaderAt) block(off int64) ([]byte, error) {
+	r.mu.Lock()
+	data, ok := r.blocks[off]
+	r.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+	length := int64(remoteBlockSize)
+	if off+length > r.size {
+		length = r.size - off
+	}
+	data, _, err := r.fetch(off, length)
+	if err != nil {
+		return nil, err
+	}
+	r.cache(off, data)
+	return data, nil
+}
+
+// cache stores a block and evicts the oldest one if the cache is full
+func (r *HTTPReaderAt) cache(off int64, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.blocks[off]; ok {
+		return
+	}
+	if len(r.order) >= remoteMaxBlocks {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.blocks[off] = data
+	r.order = append(r.order, off)
+}
+
+// fetch downloads length bytes starting at off and returns them with the
+// total size of the file reported by the server
+func (r *HTTPReaderAt) fetch(off, length int64) ([]byte, int64, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+	// the server answers with the whole file if it changed
+	if ifRange := r.ifRange(); ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	pinned := r.size > 0
+	if pinned && resp.StatusCode == http.StatusOK {
+		return nil, 0, fmt.Errorf("%w: %s", errRemoteChanged, r.url)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, 0, fmt.Errorf("%w: server returned %q to a range request for %s", errRangeNotSupported, resp.Status, r.url)
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if !pinned {
+		r.etag, r.lastModified = etag, lastModified
+	} else if etag != r.etag || lastModified != r.lastModified {
+		return nil, 0, fmt.Errorf("%w: %s", errRemoteChanged, r.url)
+	}
+	header := resp.Header.Get("Content-Range")
+	start, size, err := parseContentRange(header)
+	if err != nil {
+		return nil, 0, err
+	}
+	// a range that doesn't start where requested, or a file that ends
+	// before it, can't be trusted
+	if start != off || size <= off {
+		return nil, 0, fmt.Errorf("%w: %q in response to a request at offset %d", errBadContentRange, header, off)
+	}
+	if pinned && size != r.size {
+		return nil, 0, fmt.Errorf("%w: %s", errRemoteChanged, r.url)
+	}
+	if off+length > size {
+		length = size - off
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(resp.Body, data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read range %d-%d of %s: %w", off, off+length-1, r.url, err)
+	}
+	return data, size, nil
+}
+
+// ifRange returns the validator of the If-Range header of requests, which
+// must be a strong ETag or a date
+func (r *HTTPReaderAt) ifRange() string {
+	if r.etag != "" && !strings.HasPrefix(r.etag, "W/") {
+		return r.etag
+	}
+	return r.lastModified
+}
+
+// parseContentRange returns the first byte and the total size from a
+// Content-Range header of the form "bytes 0-1023/4096"
+func parseContentRange(header string) (int64, int64, error) {
+	slash := strings.LastIndexByte(header, '/')
+	dash := strings.IndexByte(header, '-')
+	if !strings.HasPrefix(header, "bytes ") || slash < 0 || dash < 0 || dash > slash {
+		return 0, 0, fmt.Errorf("%w: %q", errBadContentRange, header)
+	}
+	start, err := strconv.ParseInt(header[len("bytes "):dash], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("%w: %q", errBadContentRange, header)
+	}
+	size, err := strconv.ParseInt(header[slash+1:], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, fmt.Errorf("%w: %q", errBadContentRange, header)
+	}
+	return start, size, nil
+}
@@ -0,0 +1,171 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRangeServer(input []byte, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		http.ServeContent(w, r, "test.mar", time.Time{}, bytes.NewReader(input))
+	}))
+}
+
+func TestOpenURL(t *testing.T) {
+	m := New()
+	m.AddContent(bytes.Repeat([]byte("a"), 3*remoteBlockSize), "/foo/large", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/small", 0640)
+	m.AddProductInfo("caribou maurice v1.2")
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	srv := newRangeServer(input, &requests)
+	defer srv.Close()
+
+	r, err := OpenURL(nil, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File.Index) != 2 {
+		t.Fatalf("expected 2 index entries but found %d", len(r.File.Index))
+	}
+	if r.File.ProductInformation != "caribou maurice v1.2" {
+		t.Fatalf("unexpected product information %q", r.File.ProductInformation)
+	}
+	// the headers and the index are each in a single block
+	if requests != 2 {
+		t.Fatalf("expected 2 requests to parse the headers and index but got %d", requests)
+	}
+
+	entry, err := r.GetEntry("/foo/small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Data) != "bcdef" {
+		t.Fatalf("unexpected content %q", entry.Data)
+	}
+	entry, err = r.GetEntry("/foo/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entry.Data, bytes.Repeat([]byte("a"), 3*remoteBlockSize)) {
+		t.Fatal("unexpected content of /foo/large")
+	}
+}
+
+func TestHTTPReaderAtEOF(t *testing.T) {
+	var requests int32
+	srv := newRangeServer(miniMarB, &requests)
+	defer srv.Close()
+
+	r, err := NewHTTPReaderAt(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(miniMarB)) {
+		t.Fatalf("expected size %d but got %d", len(miniMarB), r.Size())
+	}
+	buf := make([]byte, 10)
+	n, err := r.ReadAt(buf, r.Size()-4)
+	if n != 4 || err != io.EOF {
+		t.Fatalf("expected 4 bytes and EOF but got %d and %v", n, err)
+	}
+	if !bytes.Equal(buf[:4], miniMarB[len(miniMarB)-4:]) {
+		t.Fatalf("unexpected data %X", buf[:4])
+	}
+	_, err = r.ReadAt(buf, r.Size())
+	if err != io.EOF {
+		t.Fatalf("expected EOF but got %v", err)
+	}
+}
+
+func TestHTTPReaderAtNoRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(miniMarB)
+	}))
+	defer srv.Close()
+
+	_, err := NewHTTPReaderAt(nil, srv.URL)
+	if !errors.Is(err, errRangeNotSupported) {
+		t.Fatalf("expected error %v but got %v", errRangeNotSupported, err)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, size, err := parseContentRange("bytes 1024-2047/4096")
+	if err != nil || start != 1024 || size != 4096 {
+		t.Fatalf("expected start 1024 and size 4096 but got %d, %d and %v", start, size, err)
+	}
+	for _, header := range []string{"", "bytes 0-1023/*", "items 0-1/2", "bytes 0-1023", "bytes -1-1023/4096", "bytes */4096"} {
+		_, _, err = parseContentRange(header)
+		if !errors.Is(err, errBadContentRange) {
+			t.Fatalf("expected error on header %q but got %v", header, err)
+		}
+	}
+}
+
+func TestHTTPReaderAtBadRange(t *testing.T) {
+	// ranges that start elsewhere, or files that end before the range,
+	// are rejected instead of being trusted
+	size := 3 * remoteBlockSize
+	for _, contentRange := range []string{
+		fmt.Sprintf("bytes 0-9/%d", size),
+		fmt.Sprintf("bytes %d-%d/%d", remoteBlockSize, remoteBlockSize+9, remoteBlockSize),
+		fmt.Sprintf("bytes %d-%d/10", remoteBlockSize, remoteBlockSize+9),
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") == fmt.Sprintf("bytes=0-%d", remoteBlockSize-1) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", remoteBlockSize-1, size))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(make([]byte, remoteBlockSize))
+				return
+			}
+			w.Header().Set("Content-Range", contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(make([]byte, 10))
+		}))
+		r, err := NewHTTPReaderAt(srv.Client(), srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.ReadAt(make([]byte, 10), remoteBlockSize+100)
+		if !errors.Is(err, errBadContentRange) {
+			t.Fatalf("expected %q to fail with %q but got %v", contentRange, errBadContentRange, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestHTTPReaderAtChanged(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 3*remoteBlockSize)
+	etag := `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "test.mar", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	r, err := NewHTTPReaderAt(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.ReadAt(make([]byte, 10), remoteBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag = `"v2"`
+	_, err = r.ReadAt(make([]byte, 10), 2*remoteBlockSize)
+	if !errors.Is(err, errRemoteChanged) {
+		t.Fatalf("expected to fail with %q but got %v", errRemoteChanged, err)
+	}
+}
@@ -0,0 +1,153 @@
+package mar
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SectionType describes the format of the additional sections of a block
+// ID, such that their data can be read and written as typed values
+type SectionType struct {
+	// Name is a short name of the block, like "product_info"
+	Name string
+
+	// Parse decodes the data of a section into a typed value
+	Parse func(data []byte) (interface{}, error)
+
+	// Serialize encodes a typed value into the data of a section
+	Serialize func(v interface{}) ([]byte, error)
+}
+
+var (
+	sectionTypes   map[uint32]*SectionType
+	sectionTypesMu sync.RWMutex
+)
+
+func init() {
+	sectionTypes = map[uint32]*SectionType{
+		BlockIDProductInfo: {
+			Name: "product_info",
+			Parse: func(data []byte) (interface{}, error) {
+				info, ok := ParseProductInfo(data)
+				if !ok {
+					return nil, errMalformedProductInfo
+				}
+				return info, nil
+			},
+			Serialize: func(v interface{}) ([]byte, error) {
+				info, ok := v.(ProductInfo)
+				if !ok {
+					return nil, fmt.Errorf("product information blocks hold a ProductInfo, not a %T", v)
+				}
+				return info.Bytes()
+			},
+		},
+		BlockIDCOSESignature: {
+			Name: "cose_sign",
+			Parse: func(data []byte) (interface{}, error) {
+				return ParseCOSESign(data)
+			},
+			Serialize: func(v interface{}) ([]byte, error) {
+				cs, ok := v.(*COSESign)
+				if !ok {
+					return nil, fmt.Errorf("COSE signature blocks hold a *COSESign, not a %T", v)
+				}
+				return cs.Bytes()
+			},
+		},
+		BlockIDTimestamp: {
+			Name: "timestamp",
+			Parse: func(data []byte) (interface{}, error) {
+				return ParseTimestampToken(data)
+			},
+			Serialize: func(v interface{}) ([]byte, error) {
+				ts, ok := v.(*Timestamp)
+				if !ok {
+					return nil, fmt.Errorf("timestamp blocks hold a *Timestamp, not a %T", v)
+				}
+				return ts.Token, nil
+			},
+		},
+		BlockIDEntryHashes: {
+			Name: "entry_hashes",
+			Parse: func(data []byte) (interface{}, error) {
+				return ParseEntryHashes(data)
+			},
+			Serialize: func(v interface{}) ([]byte, error) {
+				hashes, ok := v.(EntryHashes)
+				if !ok {
+					return nil, fmt.Errorf("entry hashes blocks hold EntryHashes, not a %T", v)
+				}
+				err := hashes.check()
+				if err != nil {
+					return nil, err
+				}
+				return hashes.Bytes(), nil
+			},
+		},
+	}
+}
+
+// RegisterSectionType registers the format of the additional sections of
+// a block ID, such as a block of build metadata used by a Firefox fork.
+// Sections of that block ID can then be decoded with Value and added with
+// AddSectionValue. A block ID can only be registered once.
+func RegisterSectionType(blockID uint32, st SectionType) error {
+	if st.Name == "" || st.Parse == nil || st.Serialize == nil {
+		return errBadSectionType
+	}
+	sectionTypesMu.Lock()
+	defer sectionTypesMu.Unlock()
+	if existing, ok := sectionTypes[blockID]; ok {
+		return fmt.Errorf("block ID %d is already registered as %q", blockID, existing.Name)
+	}
+	sectionTypes[blockID] = &st
+	return nil
+}
+
+// lookupSectionType returns the type registered for a block ID,
+// or nil if there is none
+func lookupSectionType(blockID uint32) *SectionType {
+	sectionTypesMu.RLock()
+	defer sectionTypesMu.RUnlock()
+	return sectionTypes[blockID]
+}
+
+// Name returns the name of the type registered for the block ID of the
+// section, or "unknown" if there is none
+func (as AdditionalSection) Name() string {
+	st := lookupSectionType(as.BlockID)
+	if st == nil {
+		return "unknown"
+	}
+	return st.Name
+}
+
+// Value decodes the data of the section with the type registered for its
+// block ID, such as a ProductInfo for a product information block
+func (as AdditionalSection) Value() (interface{}, error) {
+	st := lookupSectionType(as.BlockID)
+	if st == nil {
+		return nil, fmt.Errorf("%w: %d", errUnknownSectionType, as.BlockID)
+	}
+	v, err := st.Parse(as.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s section: %w", st.Name, err)
+	}
+	return v, nil
+}
+
+// AddSectionValue encodes v with the type registered for the block ID and
+// adds it to the additional sections of the file
+func (file *File) AddSectionValue(blockID uint32, v interface{}) error {
+	st := lookupSectionType(blockID)
+	if st == nil {
+		return fmt.Errorf("%w: %d", errUnknownSectionType, blockID)
+	}
+	data, err := st.Serialize(v)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s section: %w", st.Name, err)
+	}
+	file.AddAdditionalSection(data, blockID)
+	return nil
+}
@@ -0,0 +1,119 @@
+package mar
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// blockIDBuildTime is a block ID used by the tests for
+// a section that holds a unix timestamp
+const blockIDBuildTime = 0xB17D
+
+func init() {
+	err := RegisterSectionType(blockIDBuildTime, SectionType{
+		Name: "build_time",
+		Parse: func(data []byte) (interface{}, error) {
+			if len(data) != 8 {
+				return nil, fmt.Errorf("expected 8 bytes but got %d", len(data))
+			}
+			return time.Unix(int64(binary.BigEndian.Uint64(data)), 0).UTC(), nil
+		},
+		Serialize: func(v interface{}) ([]byte, error) {
+			t, ok := v.(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("expected a time.Time but got %T", v)
+			}
+			data := make([]byte, 8)
+			binary.BigEndian.PutUint64(data, uint64(t.Unix()))
+			return data, nil
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestSectionTypes(t *testing.T) {
+	buildTime := time.Date(2018, 9, 5, 12, 0, 0, 0, time.UTC)
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.AddSectionValue(BlockIDProductInfo, ProductInfo{Version: "62.0", Channels: []string{"firefox-mozilla-release"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.AddSectionValue(blockIDBuildTime, buildTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed File
+	err = Unmarshal(output, &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.AdditionalSections) != 2 {
+		t.Fatalf("expected 2 additional sections but got %d", len(parsed.AdditionalSections))
+	}
+	v, err := parsed.AdditionalSections[0].Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, ok := v.(ProductInfo); !ok || info.Version != "62.0" || info.Channels[0] != "firefox-mozilla-release" {
+		t.Fatalf("unexpected product info %#v", v)
+	}
+	v, err = parsed.AdditionalSections[1].Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != buildTime {
+		t.Fatalf("expected build time %s but got %v", buildTime, v)
+	}
+	if parsed.AdditionalSections[1].Name() != "build_time" {
+		t.Fatalf("expected section name build_time but got %q", parsed.AdditionalSections[1].Name())
+	}
+}
+
+func TestSectionTypesErrors(t *testing.T) {
+	err := RegisterSectionType(BlockIDProductInfo, SectionType{
+		Name:      "my_product_info",
+		Parse:     func(data []byte) (interface{}, error) { return nil, nil },
+		Serialize: func(v interface{}) ([]byte, error) { return nil, nil },
+	})
+	if err == nil {
+		t.Fatal("expected registering a block ID twice to fail")
+	}
+	err = RegisterSectionType(42, SectionType{Name: "incomplete"})
+	if err != errBadSectionType {
+		t.Fatalf("expected error %v but got %v", errBadSectionType, err)
+	}
+
+	m := New()
+	err = m.AddSectionValue(42, "caribou")
+	if !errors.Is(err, errUnknownSectionType) {
+		t.Fatalf("expected error %v but got %v", errUnknownSectionType, err)
+	}
+	err = m.AddSectionValue(blockIDBuildTime, "caribou")
+	if err == nil {
+		t.Fatal("expected serializing a value of the wrong type to fail")
+	}
+	m.AddAdditionalSection([]byte("opaque"), 42)
+	m.AddProductInfo("caribou maurice v1.2")
+	if m.AdditionalSections[0].Name() != "unknown" {
+		t.Fatalf("expected section name unknown but got %q", m.AdditionalSections[0].Name())
+	}
+	_, err = m.AdditionalSections[0].Value()
+	if !errors.Is(err, errUnknownSectionType) {
+		t.Fatalf("expected error %v but got %v", errUnknownSectionType, err)
+	}
+	// free form product information strings are not product info blocks
+	_, err = m.AdditionalSections[1].Value()
+	if !errors.Is(err, errMalformedProductInfo) {
+		t.Fatalf("expected error %v but got %v", errMalformedProductInfo, err)
+	}
+}
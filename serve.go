@@ -0,0 +1,133 @@
+package mar
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// contentTypes overrides the content type of extensions that the mime
+// tables of the system get wrong for the files of an update
+var contentTypes = map[string]string{
+	".manifest": "text/plain; charset=utf-8",
+}
+
+// handler serves the entries of a MAR file over HTTP
+type handler struct {
+	r *Reader
+}
+
+// NewHandler returns an http.Handler that serves the entries of the MAR
+// file read by r, such that the content of an update can be browsed. The
+// root path lists the entries, and every other path serves the decompressed
+// content of the entry of the same name, with a content type guessed from
+// its extension or its first bytes. Entries are read from r when they are
+// requested, so the handler works as well with a MappedFile or a MAR opened
+// with OpenURL. Compressed entries are streamed as they are decompressed,
+// up to the MaxDecompressedSize limit r was created with.
+func NewHandler(r *Reader) http.Handler {
+	return &handler{r: r}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.URL.Path == "/" {
+		h.serveIndex(w)
+		return
+	}
+	name, ok := h.entryName(req.URL.Path)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	entry, err := h.r.GetEntry(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ct, ok := contentTypes[path.Ext(name)]; ok {
+		w.Header().Set("Content-Type", ct)
+	}
+	if entry.compression() == CompressionNone {
+		// the size of stored entries is known, so ServeContent can
+		// handle range requests. It guesses the content type from the
+		// extension of the name, or from the first bytes of the data.
+		http.ServeContent(w, req, name, time.Time{}, bytes.NewReader(entry.Data))
+		return
+	}
+	h.serveCompressed(w, req, name, entry)
+}
+
+// serveCompressed streams the decompressed content of a compressed entry,
+// which is only bounded by the MaxDecompressedSize limit since its size
+// isn't known in advance
+func (h *handler) serveCompressed(w http.ResponseWriter, req *http.Request, name string, entry Entry) {
+	rc, err := entry.Open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+	br := bufio.NewReaderSize(newLimitedReader(rc, h.r.File.debug, "MaxDecompressedSize", h.r.limits.MaxDecompressedSize), sniffLen)
+	if w.Header().Get("Content-Type") == "" {
+		ct := mime.TypeByExtension(path.Ext(name))
+		if ct == "" {
+			head, err := br.Peek(sniffLen)
+			if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+				http.Error(w, fmt.Sprintf("failed to decompress %q: %v", name, err), http.StatusInternalServerError)
+				return
+			}
+			ct = http.DetectContentType(head)
+		}
+		w.Header().Set("Content-Type", ct)
+	}
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, err = io.Copy(w, br)
+	if err != nil {
+		// the status is already sent, so the connection is closed for
+		// the client to see the response is incomplete
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// sniffLen is the number of bytes http.DetectContentType looks at
+const sniffLen = 512
+
+// entryName returns the name of the entry served at urlPath. Entry names
+// may or may not start with a slash, so both forms are looked up.
+func (h *handler) entryName(urlPath string) (string, bool) {
+	if _, ok := h.r.entries[urlPath]; ok {
+		return urlPath, true
+	}
+	name := strings.TrimPrefix(urlPath, "/")
+	if _, ok := h.r.entries[name]; ok {
+		return name, true
+	}
+	return "", false
+}
+
+// serveIndex writes an HTML page that links to every entry
+func (h *handler) serveIndex(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<title>MAR entries</title>\n<ul>\n")
+	for _, idxEntry := range h.r.File.Index {
+		link := url.URL{Path: "/" + strings.TrimPrefix(idxEntry.FileName, "/")}
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a> (%d bytes)</li>\n",
+			html.EscapeString(link.EscapedPath()), html.EscapeString(idxEntry.FileName), idxEntry.Size)
+	}
+	fmt.Fprintf(w, "</ul>\n")
+}
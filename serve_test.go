@@ -0,0 +1,118 @@
+package mar
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("type \"complete\"\n"), "updatev3.manifest", 0644)
+	m.AddContent([]byte("<!DOCTYPE html><p>caribou</p>"), "/foo/index.html", 0644)
+	err := m.AddContent([]byte("{\"maurice\": true}"), "/foo/data.json", 0644, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewHandler(r))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path, contentType, body string
+	}{
+		{"/updatev3.manifest", "text/plain; charset=utf-8", "type \"complete\"\n"},
+		{"/foo/index.html", "text/html; charset=utf-8", "<!DOCTYPE html><p>caribou</p>"},
+		{"/foo/data.json", "application/json", "{\"maurice\": true}"},
+	} {
+		resp, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status 200 but got %d", tc.path, resp.StatusCode)
+		}
+		if resp.Header.Get("Content-Type") != tc.contentType {
+			t.Fatalf("%s: expected content type %q but got %q", tc.path, tc.contentType, resp.Header.Get("Content-Type"))
+		}
+		if string(body) != tc.body {
+			t.Fatalf("%s: unexpected body %q", tc.path, body)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{`href="/updatev3.manifest"`, `href="/foo/index.html"`, `href="/foo/data.json"`} {
+		if !strings.Contains(string(body), link) {
+			t.Fatalf("index is missing link %s:\n%s", link, body)
+		}
+	}
+
+	resp, err = http.Get(srv.URL + "/foo/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status 404 but got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(srv.URL+"/foo/data.json", "text/plain", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405 but got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerDecompressedLimit(t *testing.T) {
+	m := New()
+	err := m.AddContent(bytes.Repeat([]byte("caribou "), 10000), "big.txt", 0644, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, max := range []uint64{100, 10000} {
+		r, err := NewReader(bytes.NewReader(input), int64(len(input)), WithLimits(Limits{MaxDecompressedSize: max}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(NewHandler(r))
+		resp, err := http.Get(srv.URL + "/big.txt")
+		if err == nil {
+			body, readErr := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if readErr == nil && resp.StatusCode == http.StatusOK {
+				t.Fatalf("limit %d: expected the response to fail but got %d bytes", max, len(body))
+			}
+		}
+		srv.Close()
+	}
+}
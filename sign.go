@@ -6,15 +6,14 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha1"
-	"crypto/sha256"
-	"crypto/sha512"
+	// register the hash functions of the signature algorithms
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
 	"encoding/asn1"
-	"encoding/base64"
 	"fmt"
 	"hash"
 	"io"
-	"math"
 	"math/big"
 )
 
@@ -35,16 +34,16 @@ const (
 
 // PrepareSignature adds a new signature header to a MAR file
 // but does not sign yet. You have to call FinalizeSignature
-// to actually sign the MAR file.
+// to actually sign the MAR file. The key must implement the
+// crypto.Signer interface, which allows signing with keys that
+// are not held in memory.
 func (file *File) PrepareSignature(key crypto.PrivateKey, pubkey crypto.PublicKey) error {
 	var sig Signature
 	switch pubkey.(type) {
 	case *rsa.PublicKey:
 		sig.AlgorithmID = SigAlgRsaPkcs1Sha384
-		// accept keys that aren't multiples of 8 and round them up to end up with the correct
-		// byte size. eg. 2047/8 = 255.875 = 256
-		sig.Size = uint32(math.Round(float64(pubkey.(*rsa.PublicKey).N.BitLen()) / 8.0))
-		debugPrint("rsa bit len: %d\n", sig.Size)
+		sig.Size = rsaSignatureSize(pubkey.(*rsa.PublicKey))
+		file.tracef("rsa bit len: %d\n", sig.Size)
 	case *ecdsa.PublicKey:
 		sig.AlgorithmID, sig.Size = getEcdsaInfo(pubkey.(*ecdsa.PublicKey).Params().Name)
 		if sig.AlgorithmID == 0 || sig.Size == 0 {
@@ -55,14 +54,19 @@ func (file *File) PrepareSignature(key crypto.PrivateKey, pubkey crypto.PublicKe
 	}
 	sig.privateKey = key
 	file.Signatures = append(file.Signatures, sig)
-	file.SignaturesHeader.NumSignatures++
+	file.Normalize()
 	return nil
 }
 
 // FinalizeSignatures calculates RSA signatures on a MAR file
-// and stores them in the Signatures slice
-func (file *File) FinalizeSignatures() error {
-	signableBlock, err := file.MarshalForSignature()
+// and stores them in the Signatures slice. When signatures computed
+// outside of margo are given, such as after PrepareForSigning, they are
+// stored in the signature entries instead, one per entry and in order.
+func (file *File) FinalizeSignatures(sigs ...[]byte) error {
+	if len(sigs) > 0 {
+		return file.fillSignatures(sigs)
+	}
+	digests, err := file.signedDigests()
 	if err != nil {
 		return err
 	}
@@ -70,7 +74,7 @@ func (file *File) FinalizeSignatures() error {
 		return fmt.Errorf("there are no signatures to finalize")
 	}
 	for i := range file.Signatures {
-		hashed, _, err := Hash(signableBlock, file.Signatures[i].AlgorithmID)
+		hashed, _, err := signatureDigest(digests, file.Signatures[i].AlgorithmID)
 		if err != nil {
 			return err
 		}
@@ -83,7 +87,218 @@ func (file *File) FinalizeSignatures() error {
 	return nil
 }
 
-// MarshalForSignature returns an []byte of the data to be signed, or verified
+// SignatureSlot is the algorithm and size of a signature that is computed
+// outside of margo, such as by a remote signing service
+type SignatureSlot struct {
+	AlgorithmID uint32
+	// Size is the length of the signature in bytes. It can be left to
+	// zero for ECDSA signatures, whose size is set by the curve, but must
+	// be set to the size of the key for RSA signatures.
+	Size uint32
+}
+
+// PrepareForSigning is the first step of a two-pass signing, where the
+// signatures are computed offline or by an external service. Since the size
+// of the signatures shifts every offset of the file, it replaces the
+// signatures of the file with empty entries of the given algorithms and
+// sizes, lays out the file accordingly, and returns the digest each
+// signature must be made over, in the order of the slots. The second step
+// is FinalizeSignatures, with the signatures in the same order.
+//
+// The file must not be modified between the two steps, or the digests
+// will no longer match the signed data.
+func (file *File) PrepareForSigning(slots ...SignatureSlot) ([][]byte, error) {
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("there are no signatures to prepare")
+	}
+	sigs := make([]Signature, 0, len(slots))
+	for _, slot := range slots {
+		if getSigAlgNameFromID(slot.AlgorithmID) == "unknown" {
+			return nil, errBadSigAlg
+		}
+		switch {
+		case slot.AlgorithmID == SigAlgEcdsaP256Sha256 && slot.Size == 0:
+			slot.Size = 64
+		case slot.AlgorithmID == SigAlgEcdsaP384Sha384 && slot.Size == 0:
+			slot.Size = 96
+		case slot.Size == 0:
+			return nil, errSignatureSlotSize
+		}
+		sigs = append(sigs, Signature{
+			SignatureEntryHeader: SignatureEntryHeader{
+				AlgorithmID: slot.AlgorithmID,
+				Size:        slot.Size,
+			},
+			Algorithm: getSigAlgNameFromID(slot.AlgorithmID),
+		})
+	}
+	file.Signatures = sigs
+	file.Normalize()
+	digests, err := file.signedDigests()
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]byte, len(sigs))
+	for i, sig := range sigs {
+		result[i], _, err = signatureDigest(digests, sig.AlgorithmID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// fillSignatures stores the data of externally computed signatures
+// in the signature entries of the file
+func (file *File) fillSignatures(sigs [][]byte) error {
+	if len(sigs) != len(file.Signatures) {
+		return errSignatureCountMismatch
+	}
+	for i, data := range sigs {
+		if uint32(len(data)) != file.Signatures[i].Size {
+			return fmt.Errorf("%w: signature %d is %d bytes long instead of %d",
+				errSignatureSizeMismatch, i, len(data), file.Signatures[i].Size)
+		}
+	}
+	for i, data := range sigs {
+		file.Signatures[i].Data = data
+	}
+	return nil
+}
+
+// Sign adds a new signature to the MAR file and computes it right away using
+// the signer and the algorithm requested, such as SigAlgRsaPkcs1Sha384 or
+// SigAlgEcdsaP384Sha384. The signature is calculated over the output of
+// MarshalForSignature, after the signatures header and the file size have
+// been updated to account for the new signature.
+//
+// The signer can be an *rsa.PrivateKey, an *ecdsa.PrivateKey on the curve
+// of the algorithm, or any other implementation of the crypto.Signer
+// interface that holds such a key, such as a key stored in an HSM. Its Sign
+// method receives the digest of the signed data and the corresponding
+// crypto.Hash as options, and must return a PKCS1v15 signature for RSA keys,
+// or an ASN.1 encoded signature for ECDSA keys, which is converted to the
+// R||S form the MAR format stores.
+//
+// Adding a signature changes the signed data, so any signature already present
+// in the file will no longer verify and should be removed or recomputed. Use
+// SignAll to add several signatures that all verify.
+func (file *File) Sign(rand io.Reader, signer crypto.Signer, algorithmID uint32) error {
+	return file.SignAll(rand, SigningKey{signer, algorithmID})
+}
+
+// SigningKey is a signer and the algorithm of the signature it makes
+type SigningKey struct {
+	Signer      crypto.Signer
+	AlgorithmID uint32
+}
+
+// SignAll adds a signature for each of the keys to the MAR file, such as a
+// SHA1 and a SHA384 signature, or signatures from an old and a new key during
+// a rotation. The entries of all the signatures are added first, so the
+// sizes and offsets of the file are computed once and the signed data is the
+// same for every signature. Keys are subject to the same requirements as
+// in Sign. If any signature fails, none of them is added.
+func (file *File) SignAll(rand io.Reader, keys ...SigningKey) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("there are no keys to sign with")
+	}
+	sigs := make([]Signature, 0, len(keys))
+	for _, key := range keys {
+		sig, err := newSignature(key)
+		if err != nil {
+			return err
+		}
+		sigs = append(sigs, sig)
+	}
+	first := len(file.Signatures)
+	file.Signatures = append(file.Signatures, sigs...)
+	file.Normalize()
+
+	err := file.computeSignatures(rand, first)
+	if err != nil {
+		// remove the signature entries we just added
+		file.Signatures = file.Signatures[:first]
+		file.Normalize()
+		return err
+	}
+	return nil
+}
+
+// newSignature returns the entry of a signature made with the key,
+// without its data
+func newSignature(key SigningKey) (Signature, error) {
+	var sig Signature
+	alg := lookupSignatureAlgorithm(key.AlgorithmID)
+	if alg == nil || alg.Sign == nil || alg.SignatureSize == nil {
+		return sig, errBadSigAlg
+	}
+	size, err := alg.SignatureSize(key.Signer.Public())
+	if err != nil {
+		return sig, err
+	}
+	sig.Size = size
+	sig.AlgorithmID = key.AlgorithmID
+	sig.Algorithm = alg.Name
+	sig.privateKey = key.Signer
+	return sig, nil
+}
+
+// computeSignatures sets the data of the signatures of the file starting
+// at index first, all calculated over the same signed data
+func (file *File) computeSignatures(rand io.Reader, first int) error {
+	digests, err := file.signedDigests()
+	if err != nil {
+		return err
+	}
+	for i := first; i < len(file.Signatures); i++ {
+		hashed, _, err := signatureDigest(digests, file.Signatures[i].AlgorithmID)
+		if err != nil {
+			return err
+		}
+		sigData, err := Sign(file.Signatures[i].privateKey, rand, hashed, file.Signatures[i].AlgorithmID)
+		if err != nil {
+			return err
+		}
+		file.Signatures[i].Data = sigData
+	}
+	return nil
+}
+
+// StripSignatures removes all the signatures of the MAR file. The signatures
+// header, the offsets of the content and the size of the file are updated
+// accordingly.
+func (file *File) StripSignatures() {
+	file.Signatures = nil
+	file.Normalize()
+}
+
+// AttachSignature adds a signature computed outside of margo to the MAR file.
+// The signature must have been made over the output of MarshalForSignature
+// with a signature entry of the same algorithm and size already in place,
+// which is the case when the same signature is attached back after being
+// stripped.
+func (file *File) AttachSignature(algID uint32, sig []byte) error {
+	if getSigAlgNameFromID(algID) == "unknown" {
+		return errBadSigAlg
+	}
+	if len(sig) == 0 {
+		return errEmptySignature
+	}
+	file.Signatures = append(file.Signatures, Signature{
+		SignatureEntryHeader: SignatureEntryHeader{
+			AlgorithmID: algID,
+			Size:        uint32(len(sig)),
+		},
+		Algorithm: getSigAlgNameFromID(algID),
+		Data:      sig,
+	})
+	file.Normalize()
+	return nil
+}
+
+// MarshalForSignature returns an []byte of the data to be signed, or verified.
+// Use WriteSignedData to hash it without building it in memory.
 func (file *File) MarshalForSignature() ([]byte, error) {
 	file.marshalForSignature = true
 	return file.Marshal()
@@ -91,62 +306,84 @@ func (file *File) MarshalForSignature() ([]byte, error) {
 
 // Hash takes an input and a signature algorithm and returns its hashed value
 func Hash(input []byte, sigalg uint32) (output []byte, h crypto.Hash, err error) {
-	// hash the signature block using the appropriate algorithm
-	var md hash.Hash
-	switch sigalg {
-	case SigAlgRsaPkcs1Sha1:
-		md = sha1.New()
-		h = crypto.SHA1
-	case SigAlgEcdsaP256Sha256:
-		md = sha256.New()
-		h = crypto.SHA256
-	case SigAlgRsaPkcs1Sha384, SigAlgEcdsaP384Sha384:
-		md = sha512.New384()
-		h = crypto.SHA384
-	default:
-		return nil, h, fmt.Errorf("unsupported signature algorithm")
+	h, err = sigAlgHash(sigalg)
+	if err != nil {
+		return nil, h, err
 	}
+	// hash the signature block using the appropriate algorithm
+	md := h.New()
 	md.Write(input)
 	return md.Sum(nil), h, nil
 }
 
+// sigAlgHash returns the hash function of a signature algorithm
+func sigAlgHash(sigalg uint32) (crypto.Hash, error) {
+	alg := lookupSignatureAlgorithm(sigalg)
+	if alg == nil {
+		return 0, fmt.Errorf("unsupported signature algorithm")
+	}
+	return alg.Hash, nil
+}
+
+// signatureHashes returns a hash for each of the hash functions used by the
+// signatures, and a writer that feeds them all at once. Signatures of
+// unknown algorithms are skipped, and fail when they are verified.
+func signatureHashes(sigs []Signature) (map[crypto.Hash]hash.Hash, io.Writer) {
+	hashes := make(map[crypto.Hash]hash.Hash)
+	var writers []io.Writer
+	for _, sig := range sigs {
+		h, err := sigAlgHash(sig.AlgorithmID)
+		if err != nil {
+			continue
+		}
+		if _, ok := hashes[h]; !ok {
+			hashes[h] = h.New()
+			writers = append(writers, hashes[h])
+		}
+	}
+	return hashes, io.MultiWriter(writers...)
+}
+
+// signedDigests hashes the signed data of the file in a single pass with
+// the hash function of each of its signatures, without building it in memory
+func (file *File) signedDigests() (map[crypto.Hash][]byte, error) {
+	hashes, w := signatureHashes(file.Signatures)
+	err := file.WriteSignedData(w)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[crypto.Hash][]byte, len(hashes))
+	for h, md := range hashes {
+		digests[h] = md.Sum(nil)
+	}
+	return digests, nil
+}
+
+// signatureDigest returns the digest a signature of algorithm sigalg is
+// made over, from the digests returned by signedDigests
+func signatureDigest(digests map[crypto.Hash][]byte, sigalg uint32) ([]byte, crypto.Hash, error) {
+	h, err := sigAlgHash(sigalg)
+	if err != nil {
+		return nil, h, err
+	}
+	return digests[h], h, nil
+}
+
 // Sign signs digest with the private key, possibly using entropy from rand
 func Sign(key crypto.PrivateKey, rand io.Reader, digest []byte, sigalg uint32) (sigData []byte, err error) {
-	if _, ok := key.(crypto.Signer); !ok {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
 		return nil, fmt.Errorf("private key of type %T does not implement the Signer interface", key)
 	}
-	var h crypto.Hash
-	var sigsize uint32
-	switch sigalg {
-	case SigAlgRsaPkcs1Sha1:
-		h = crypto.SHA1
-	case SigAlgEcdsaP256Sha256:
-		_, sigsize = getEcdsaInfo(elliptic.P256().Params().Name)
-		h = crypto.SHA256
-	case SigAlgRsaPkcs1Sha384, SigAlgEcdsaP384Sha384:
-		_, sigsize = getEcdsaInfo(elliptic.P384().Params().Name)
-		h = crypto.SHA384
-	default:
+	alg := lookupSignatureAlgorithm(sigalg)
+	if alg == nil {
 		return nil, fmt.Errorf("unsupported signature algorithm")
 	}
-	// call the signer interface of the private key to sign the hash
-	sigData, err = key.(crypto.Signer).Sign(rand, digest, h)
-	if err != nil {
-		return nil, err
-	}
-	switch sigalg {
-	case SigAlgRsaPkcs1Sha1, SigAlgRsaPkcs1Sha384:
-		// Signature is already in the PKCSv1_15 format so return it as is
-		return sigData, nil
-	case SigAlgEcdsaP256Sha256, SigAlgEcdsaP384Sha384:
-		// when using an ecdsa key, the Sign() interface returns an ASN.1 encoded signature
-		// which we need to parse and convert to its R||S form
-		if int(sigsize) < 64 {
-			return nil, fmt.Errorf("signature size of %d is too small for signature data", sigsize)
-		}
-		return convertAsn1EcdsaToRS(sigData, int(sigsize))
+	if alg.Sign == nil {
+		return nil, errCannotSign
 	}
-	return nil, fmt.Errorf("unsupported key type %T", key)
+	// call the signer interface of the private key to sign the hash
+	return alg.Sign(signer, rand, digest)
 }
 
 type ecdsaSignature struct {
@@ -154,12 +391,17 @@ type ecdsaSignature struct {
 }
 
 func convertAsn1EcdsaToRS(sigData []byte, sigLen int) ([]byte, error) {
-	debugPrint("asn1.ecdsa: %s\n", base64.StdEncoding.EncodeToString(sigData))
 	var ecdsaSig ecdsaSignature
 	_, err := asn1.Unmarshal(sigData, &ecdsaSig)
 	if err != nil {
 		return nil, err
 	}
+	if ecdsaSig.R == nil || ecdsaSig.S == nil || ecdsaSig.R.Sign() <= 0 || ecdsaSig.S.Sign() <= 0 {
+		return nil, errMalformedEcdsaSignature
+	}
+	if len(ecdsaSig.R.Bytes()) > sigLen/2 || len(ecdsaSig.S.Bytes()) > sigLen/2 {
+		return nil, fmt.Errorf("ecdsa signature does not fit in %d bytes", sigLen)
+	}
 	// write R and S into a slice of len
 	// both R and S are zero-padded to the left to be exactly
 	// len/2 in length
@@ -173,6 +415,14 @@ func convertAsn1EcdsaToRS(sigData []byte, sigLen int) ([]byte, error) {
 	return rs, nil
 }
 
+// rsaSignatureSize returns the size in bytes of signatures made with
+// the RSA key. Keys that aren't multiples of 8 bits are rounded up to
+// end up with the correct byte size, eg. a 2047 bits key makes 256 bytes
+// signatures.
+func rsaSignatureSize(pubkey *rsa.PublicKey) uint32 {
+	return uint32((pubkey.N.BitLen() + 7) / 8)
+}
+
 func getEcdsaInfo(curve string) (uint32, uint32) {
 	switch curve {
 	case elliptic.P256().Params().Name:
@@ -185,15 +435,9 @@ func getEcdsaInfo(curve string) (uint32, uint32) {
 }
 
 func getSigAlgNameFromID(id uint32) string {
-	switch id {
-	case SigAlgRsaPkcs1Sha1:
-		return "RSA-PKCS1v15-SHA1"
-	case SigAlgRsaPkcs1Sha384:
-		return "RSA-PKCS1v15-SHA384"
-	case SigAlgEcdsaP256Sha256:
-		return "ECDSA-P256-SHA256"
-	case SigAlgEcdsaP384Sha384:
-		return "ECDSA-P384-SHA384"
-	}
-	return "unknown"
+	alg := lookupSignatureAlgorithm(id)
+	if alg == nil {
+		return "unknown"
+	}
+	return alg.Name
 }
@@ -1,12 +1,16 @@
 package mar
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/big"
@@ -70,6 +74,166 @@ func testSign(t *testing.T, key crypto.PrivateKey, pub crypto.PublicKey, alg uin
 	}
 }
 
+func TestFileSign(t *testing.T) {
+	for _, alg := range []uint32{SigAlgRsaPkcs1Sha1, SigAlgRsaPkcs1Sha384} {
+		m := New()
+		m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+		err := m.Sign(rand.Reader, rsa2048Key, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.SignaturesHeader.NumSignatures != 1 {
+			t.Fatalf("expected 1 signature but found %d", m.SignaturesHeader.NumSignatures)
+		}
+		if m.Signatures[0].Size != 256 || len(m.Signatures[0].Data) != 256 {
+			t.Fatalf("expected signature of 256 bytes but found size %d and data length %d",
+				m.Signatures[0].Size, len(m.Signatures[0].Data))
+		}
+		o, err := m.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(o)) != m.Size {
+			t.Fatalf("expected file size %d to match output length %d", m.Size, len(o))
+		}
+		var reparsed File
+		err = Unmarshal(o, &reparsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = reparsed.VerifySignature(rsa2048Key.Public())
+		if err != nil {
+			t.Fatalf("signature with algorithm %d failed to verify: %v", alg, err)
+		}
+	}
+}
+
+// hsmSigner only exposes the crypto.Signer interface of a key,
+// like a key stored in an HSM would, and checks the digest it
+// receives was made with the expected hash
+type hsmSigner struct {
+	key  crypto.Signer
+	hash crypto.Hash
+}
+
+func (s hsmSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s hsmSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != s.hash {
+		return nil, fmt.Errorf("expected hash %v but got %v", s.hash, opts.HashFunc())
+	}
+	if len(digest) != s.hash.Size() {
+		return nil, fmt.Errorf("expected digest of %d bytes but got %d", s.hash.Size(), len(digest))
+	}
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestFileSignWithSigner(t *testing.T) {
+	testCases := []struct {
+		alg  uint32
+		hash crypto.Hash
+	}{
+		{SigAlgRsaPkcs1Sha1, crypto.SHA1},
+		{SigAlgRsaPkcs1Sha384, crypto.SHA384},
+	}
+	for _, testCase := range testCases {
+		m := New()
+		m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+		err := m.Sign(rand.Reader, hsmSigner{rsa2048Key, testCase.hash}, testCase.alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.VerifySignature(rsa2048Key.Public())
+		if err != nil {
+			t.Fatalf("signature with algorithm %d failed to verify: %v", testCase.alg, err)
+		}
+	}
+}
+
+func TestFileSignBadAlgorithm(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgEcdsaP256Sha256)
+	if !errors.Is(err, errBadSigAlg) {
+		t.Fatalf("expected to fail with %q but got %v", errBadSigAlg, err)
+	}
+	if len(m.Signatures) != 0 {
+		t.Fatalf("expected no signature but found %d", len(m.Signatures))
+	}
+}
+
+func TestFileSignEcdsaP384(t *testing.T) {
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err = m.SignAll(rand.Reader,
+		SigningKey{p384Key, SigAlgEcdsaP384Sha384},
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Signatures[0].Size != 96 || len(m.Signatures[0].Data) != 96 {
+		t.Fatalf("expected a 96 bytes signature but got size %d with %d bytes of data", m.Signatures[0].Size, len(m.Signatures[0].Data))
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	err = Unmarshal(signed, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validKeys, err := file.VerifyWithKeys(map[string]crypto.PublicKey{"ecdsa": p384Key.Public(), "rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 2 || validKeys[0] != "ecdsa" || validKeys[1] != "rsa" {
+		t.Fatalf("expected signatures from keys [ecdsa rsa] but got %v", validKeys)
+	}
+
+	// keys on another curve can't make P-384 signatures
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = New().Sign(rand.Reader, p256Key, SigAlgEcdsaP384Sha384)
+	if !errors.Is(err, errBadSigAlg) {
+		t.Fatalf("expected to fail with %q but got %v", errBadSigAlg, err)
+	}
+}
+
+func TestConvertAsn1EcdsaToRS(t *testing.T) {
+	sig, err := asn1.Marshal(ecdsaSignature{R: big.NewInt(0x0102), S: big.NewInt(0x03)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := convertAsn1EcdsaToRS(sig, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rs, []byte{0, 0, 1, 2, 0, 0, 0, 3}) {
+		t.Fatalf("expected R and S to be left padded but got %x", rs)
+	}
+	_, err = convertAsn1EcdsaToRS(sig, 2)
+	if err == nil {
+		t.Fatal("expected a signature that doesn't fit to fail")
+	}
+	sig, err = asn1.Marshal(ecdsaSignature{R: big.NewInt(-1), S: big.NewInt(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = convertAsn1EcdsaToRS(sig, 8)
+	if err != errMalformedEcdsaSignature {
+		t.Fatalf("expected to fail with %q but got %v", errMalformedEcdsaSignature, err)
+	}
+}
+
 // this is a valid 2047 bits RSA just to mess with signature size rounding
 var rsa2048Key = &rsa.PrivateKey{
 	PublicKey: rsa.PublicKey{
@@ -90,3 +254,247 @@ func fromBase10(base10 string) *big.Int {
 	}
 	return i
 }
+
+func TestStripAndAttachSignature(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	unsigned, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigData := m.Signatures[0].Data
+
+	m.StripSignatures()
+	if m.SignaturesHeader.NumSignatures != 0 {
+		t.Fatalf("expected no signature but found %d", m.SignaturesHeader.NumSignatures)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(o, unsigned) {
+		t.Fatal("expected stripped file to match the unsigned file")
+	}
+
+	err = m.AttachSignature(SigAlgRsaPkcs1Sha384, sigData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err = m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(o)) != m.Size {
+		t.Fatalf("expected file size %d to match output length %d", m.Size, len(o))
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reparsed.VerifySignature(rsa2048Key.Public())
+	if err != nil {
+		t.Fatalf("attached signature failed to verify: %v", err)
+	}
+}
+
+func TestAttachSignatureBadInput(t *testing.T) {
+	m := New()
+	err := m.AttachSignature(42, []byte("sig"))
+	if err != errBadSigAlg {
+		t.Fatalf("expected error %v, got %v", errBadSigAlg, err)
+	}
+	err = m.AttachSignature(SigAlgRsaPkcs1Sha384, nil)
+	if err != errEmptySignature {
+		t.Fatalf("expected error %v, got %v", errEmptySignature, err)
+	}
+	if len(m.Signatures) != 0 {
+		t.Fatalf("expected no signature to be attached, found %d", len(m.Signatures))
+	}
+}
+
+func TestFileSignAll(t *testing.T) {
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err = m.SignAll(rand.Reader,
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha1},
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha384},
+		SigningKey{newKey, SigAlgRsaPkcs1Sha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SignaturesHeader.NumSignatures != 3 {
+		t.Fatalf("expected 3 signatures but found %d", m.SignaturesHeader.NumSignatures)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBlock, err := reparsed.MarshalForSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []*rsa.PrivateKey{rsa2048Key, rsa2048Key, newKey} {
+		sig := reparsed.Signatures[i]
+		err = VerifySignature(signedBlock, sig.Data, sig.AlgorithmID, key.Public())
+		if err != nil {
+			t.Fatalf("signature %d failed to verify: %v", i, err)
+		}
+	}
+}
+
+func TestFileSignAllFailure(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	size := m.Size
+	err := m.SignAll(rand.Reader,
+		SigningKey{rsa2048Key, SigAlgRsaPkcs1Sha384},
+		SigningKey{hsmSigner{rsa2048Key, crypto.SHA1}, SigAlgRsaPkcs1Sha384})
+	if err == nil {
+		t.Fatal("expected signing with a failing signer to fail")
+	}
+	if len(m.Signatures) != 0 || m.Size != size {
+		t.Fatalf("expected no signature and size %d but found %d signatures and size %d", size, len(m.Signatures), m.Size)
+	}
+	err = m.SignAll(rand.Reader)
+	if err == nil {
+		t.Fatal("expected signing without keys to fail")
+	}
+}
+
+func TestWriteSignedData(t *testing.T) {
+	var parsed File
+	err := Unmarshal(miniMarB, &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := New()
+	created.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	created.PrepareSignature(rsa2048Key, rsa2048Key.Public())
+	for i, file := range []*File{&parsed, created} {
+		expected, err := file.MarshalForSignature()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = file.WriteSignedData(&buf)
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Fatalf("testcase %d: signed data differs from the output of MarshalForSignature", i)
+		}
+		if file.marshalForSignature {
+			t.Fatalf("testcase %d: signature flag was not reset", i)
+		}
+	}
+
+	// errors of the writer are returned
+	err = parsed.WriteSignedData(failingWriter{})
+	if err != errFailingWriter {
+		t.Fatalf("expected error %v but got %v", errFailingWriter, err)
+	}
+}
+
+var errFailingWriter = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errFailingWriter
+}
+
+func TestPrepareForSigning(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	digests, err := m.PrepareForSigning(
+		SignatureSlot{AlgorithmID: SigAlgRsaPkcs1Sha384, Size: rsaSignatureSize(&rsa2048Key.PublicKey)},
+		SignatureSlot{AlgorithmID: SigAlgEcdsaP256Sha256},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 2 || len(digests[0]) != 48 || len(digests[1]) != 32 {
+		t.Fatalf("expected a sha384 and a sha256 digest but got %d digests", len(digests))
+	}
+
+	// sign the digests as an external service would
+	rsaSig, err := Sign(rsa2048Key, rand.Reader, digests[0], SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaSig, err := Sign(ecdsaKey, rand.Reader, digests[1], SigAlgEcdsaP256Sha256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.FinalizeSignatures(rsaSig)
+	if err != errSignatureCountMismatch {
+		t.Fatalf("expected error %v but got %v", errSignatureCountMismatch, err)
+	}
+	err = m.FinalizeSignatures(rsaSig, ecdsaSig[:10])
+	if !errors.Is(err, errSignatureSizeMismatch) {
+		t.Fatalf("expected error %v but got %v", errSignatureSizeMismatch, err)
+	}
+	err = m.FinalizeSignatures(rsaSig, ecdsaSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed File
+	err = Unmarshal(output, &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validKeys, err := parsed.VerifyWithKeys(map[string]crypto.PublicKey{
+		"rsa":   rsa2048Key.Public(),
+		"ecdsa": ecdsaKey.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 2 || validKeys[0] != "rsa" || validKeys[1] != "ecdsa" {
+		t.Fatalf("expected signatures from keys [rsa ecdsa] but got %v", validKeys)
+	}
+}
+
+func TestPrepareForSigningErrors(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	_, err := m.PrepareForSigning()
+	if err == nil {
+		t.Fatal("expected preparing no signature to fail")
+	}
+	_, err = m.PrepareForSigning(SignatureSlot{AlgorithmID: SigAlgRsaPkcs1Sha1})
+	if err != errSignatureSlotSize {
+		t.Fatalf("expected error %v but got %v", errSignatureSlotSize, err)
+	}
+	_, err = m.PrepareForSigning(SignatureSlot{AlgorithmID: 42, Size: 256})
+	if err != errBadSigAlg {
+		t.Fatalf("expected error %v but got %v", errBadSigAlg, err)
+	}
+	if len(m.Signatures) != 0 {
+		t.Fatalf("expected failed preparations to leave the signatures untouched but found %d", len(m.Signatures))
+	}
+}
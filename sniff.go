@@ -0,0 +1,130 @@
+package mar
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Info is what Sniff reports about a blob
+type Info struct {
+	// IsMAR is true if the blob starts with the MAR ID
+	IsMAR bool `json:"is_mar" yaml:"is_mar"`
+	// Revision is 2005 for old MARs without signatures and additional
+	// sections, and 2012 otherwise
+	Revision int `json:"revision" yaml:"revision"`
+	// OffsetToIndex is the declared offset of the index
+	OffsetToIndex uint32 `json:"offset_to_index" yaml:"offset_to_index"`
+	// Size is the declared total size of the file, or zero for old MARs
+	// that don't declare it
+	Size uint64 `json:"size" yaml:"size"`
+	// SignatureAlgorithms lists the algorithm ID of each signature
+	SignatureAlgorithms []uint32 `json:"signature_algorithms" yaml:"signature_algorithms"`
+	// NumAdditionalSections is the number of additional sections
+	NumAdditionalSections uint32 `json:"num_additional_sections" yaml:"num_additional_sections"`
+}
+
+// Signed returns true if the blob has at least one signature
+func (info Info) Signed() bool {
+	return len(info.SignatureAlgorithms) > 0
+}
+
+// Sniff reads the headers of the blob in r to report whether it is a MAR,
+// whether it is signed, how many signatures and additional sections it has
+// and its declared size. It only reads the headers and the first index
+// entry, and doesn't validate the file, so a blob Sniff accepts may still
+// fail to parse. A blob that is not a MAR is reported with IsMAR set to
+// false and no error. The limits of the parser apply to the number and
+// size of the signatures, and the WithLimits option changes them.
+func Sniff(r io.ReaderAt, opts ...Option) (Info, error) {
+	o := newOptions(opts)
+	var info Info
+	marID := make([]byte, MarIDLen)
+	err := sniffRead(r, marID, 0)
+	if err != nil {
+		if errors.Is(err, ErrTruncated) {
+			return info, nil
+		}
+		return info, err
+	}
+	if string(marID) != "MAR1" {
+		return info, nil
+	}
+	info.IsMAR = true
+	info.OffsetToIndex, err = sniffUint32(r, MarIDLen)
+	if err != nil {
+		return info, err
+	}
+
+	// old MARs have the content of an entry at byte 8, where modern ones
+	// have their headers. looking at the first entry is cheap and good
+	// enough for a sniffer.
+	firstOffset, err := sniffUint32(r, uint64(info.OffsetToIndex)+IndexHeaderLen)
+	if err != nil {
+		return info, err
+	}
+	if firstOffset == MarIDLen+OffsetToIndexLen {
+		info.Revision = 2005
+		return info, nil
+	}
+	info.Revision = 2012
+
+	buf := make([]byte, FileSizeLen)
+	err = sniffRead(r, buf, MarIDLen+OffsetToIndexLen)
+	if err != nil {
+		return info, err
+	}
+	info.Size = binary.BigEndian.Uint64(buf)
+	pos := uint64(MarIDLen + OffsetToIndexLen + FileSizeLen)
+	numSignatures, err := sniffUint32(r, pos)
+	if err != nil {
+		return info, err
+	}
+	err = checkLimit(o.debug, "MaxSignatures", uint64(numSignatures), uint64(o.limits.MaxSignatures))
+	if err != nil {
+		return info, err
+	}
+	pos += SignaturesHeaderLen
+	for i := uint32(0); i < numSignatures; i++ {
+		algorithmID, err := sniffUint32(r, pos)
+		if err != nil {
+			return info, err
+		}
+		size, err := sniffUint32(r, pos+4)
+		if err != nil {
+			return info, err
+		}
+		err = checkLimit(o.debug, "MaxSignatureSize", uint64(size), uint64(o.limits.MaxSignatureSize))
+		if err != nil {
+			return info, err
+		}
+		info.SignatureAlgorithms = append(info.SignatureAlgorithms, algorithmID)
+		pos += SignatureEntryHeaderLen + uint64(size)
+	}
+	info.NumAdditionalSections, err = sniffUint32(r, pos)
+	return info, err
+}
+
+// sniffRead reads len(p) bytes of r at off, and returns a truncation
+// error if r is too short
+func sniffRead(r io.ReaderAt, p []byte, off uint64) error {
+	n, err := r.ReadAt(p, int64(off))
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return fmt.Errorf("%w: %d bytes at offset %d", ErrTruncated, len(p), off)
+	}
+	return err
+}
+
+// sniffUint32 reads a big endian uint32 of r at off
+func sniffUint32(r io.ReaderAt, off uint64) (uint32, error) {
+	buf := make([]byte, 4)
+	err := sniffRead(r, buf, off)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf), nil
+}
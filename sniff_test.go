@@ -0,0 +1,78 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	m := New()
+	m.SetProductInformation("62.0", "firefox-mozilla-release")
+	m.AddContent([]byte("content"), "foo", 0644)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.SignAll(rand.Reader, SigningKey{key, SigAlgRsaPkcs1Sha1}, SigningKey{key, SigAlgRsaPkcs1Sha384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Sniff(bytes.NewReader(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsMAR || info.Revision != 2012 || !info.Signed() || info.Size != uint64(len(o)) ||
+		info.OffsetToIndex != m.OffsetToIndex || info.NumAdditionalSections != 1 ||
+		len(info.SignatureAlgorithms) != 2 || info.SignatureAlgorithms[1] != SigAlgRsaPkcs1Sha384 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	info, err = Sniff(bytes.NewReader(miniMarB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsMAR || info.Revision != 2012 || len(info.SignatureAlgorithms) != 2 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	info, err = Sniff(bytes.NewReader(oldMarB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsMAR || info.Revision != 2005 || info.Signed() || info.Size != 0 {
+		t.Fatalf("unexpected info of old MAR %+v", info)
+	}
+}
+
+func TestSniffNotMar(t *testing.T) {
+	for _, input := range [][]byte{nil, []byte("MA"), []byte("PK\x03\x04 not a mar")} {
+		info, err := Sniff(bytes.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.IsMAR {
+			t.Fatalf("expected %q not to be a MAR", input)
+		}
+	}
+}
+
+func TestSniffErrors(t *testing.T) {
+	info, err := Sniff(bytes.NewReader(miniMarB[:20]))
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected error %v, got %v", ErrTruncated, err)
+	}
+	if !info.IsMAR {
+		t.Fatal("expected a truncated MAR to be recognized")
+	}
+	_, err = Sniff(bytes.NewReader(miniMarB), WithLimits(Limits{MaxSignatures: 1}))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected error %v, got %v", ErrLimitExceeded, err)
+	}
+}
@@ -0,0 +1,146 @@
+package mar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// statsLargestEntries is the number of entries listed in Stats.Largest
+const statsLargestEntries = 10
+
+// Stats are the size statistics of a MAR file, to track the size budget
+// of updates. Stored sizes are of the data as stored in the file, and
+// decompressed sizes of the content of entries once decompressed.
+type Stats struct {
+	// FileSize is the total size of the file, in bytes
+	FileSize uint64 `json:"file_size" yaml:"file_size"`
+	// Entries is the number of entries
+	Entries int `json:"entries" yaml:"entries"`
+	// CompressedEntries is the number of compressed entries
+	CompressedEntries int `json:"compressed_entries" yaml:"compressed_entries"`
+	// StoredSize is the size of the content of all entries, in bytes
+	StoredSize uint64 `json:"stored_size" yaml:"stored_size"`
+	// DecompressedSize is the size of the decompressed content of all
+	// entries, in bytes
+	DecompressedSize uint64 `json:"decompressed_size" yaml:"decompressed_size"`
+	// CompressionRatio is the stored size over the decompressed size
+	CompressionRatio float64 `json:"compression_ratio" yaml:"compression_ratio"`
+	// SignatureOverhead is the size of the signatures and their headers
+	SignatureOverhead uint64 `json:"signature_overhead" yaml:"signature_overhead"`
+	// AdditionalSectionsSize is the size of the additional sections and
+	// their headers
+	AdditionalSectionsSize uint64 `json:"additional_sections_size" yaml:"additional_sections_size"`
+	// IndexSize is the size of the index and its header
+	IndexSize uint64 `json:"index_size" yaml:"index_size"`
+	// Extensions break the entries down by file extension, from the
+	// largest stored size to the smallest
+	Extensions []ExtensionStats `json:"extensions" yaml:"extensions"`
+	// Largest are the entries with the largest stored size, largest first
+	Largest []EntryStats `json:"largest" yaml:"largest"`
+}
+
+// ExtensionStats are the sizes of the entries with a file extension
+type ExtensionStats struct {
+	// Extension is the lowercase extension, like ".dll", or empty for
+	// entries that have none
+	Extension        string  `json:"extension" yaml:"extension"`
+	Entries          int     `json:"entries" yaml:"entries"`
+	StoredSize       uint64  `json:"stored_size" yaml:"stored_size"`
+	DecompressedSize uint64  `json:"decompressed_size" yaml:"decompressed_size"`
+	CompressionRatio float64 `json:"compression_ratio" yaml:"compression_ratio"`
+}
+
+// EntryStats are the sizes of an entry
+type EntryStats struct {
+	Name             string  `json:"name" yaml:"name"`
+	StoredSize       uint64  `json:"stored_size" yaml:"stored_size"`
+	DecompressedSize uint64  `json:"decompressed_size" yaml:"decompressed_size"`
+	CompressionRatio float64 `json:"compression_ratio" yaml:"compression_ratio"`
+	// Compression is the name of the compression format, like "xz"
+	Compression string `json:"compression" yaml:"compression"`
+}
+
+// Stats computes the size statistics of the file. Entries are decompressed
+// as a stream to measure their size, and never fully held in memory.
+func (file *File) Stats() (*Stats, error) {
+	s := &Stats{
+		FileSize: file.Size,
+		Entries:  len(file.Index),
+	}
+	if file.Revision != 2005 {
+		s.SignatureOverhead = SignaturesHeaderLen
+		for _, sig := range file.Signatures {
+			s.SignatureOverhead += SignatureEntryHeaderLen + uint64(len(sig.Data))
+		}
+		s.AdditionalSectionsSize = AdditionalSectionsHeaderLen
+		for _, as := range file.AdditionalSections {
+			s.AdditionalSectionsSize += AdditionalSectionsEntryHeaderLen + uint64(len(as.Data))
+		}
+	}
+	s.IndexSize = IndexHeaderLen
+	extensions := make(map[string]*ExtensionStats)
+	var entries []EntryStats
+	for _, e := range file.Entries() {
+		r, err := e.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+		decompressed, err := copyBuffer(ioutil.Discard, r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %q: %w", e.Name, err)
+		}
+		es := EntryStats{
+			Name:             e.Name,
+			StoredSize:       uint64(len(e.Data)),
+			DecompressedSize: uint64(decompressed),
+			CompressionRatio: ratio(uint64(len(e.Data)), uint64(decompressed)),
+			Compression:      e.compression().String(),
+		}
+		entries = append(entries, es)
+		s.IndexSize += IndexEntryHeaderLen + uint64(len(e.Name)) + 1
+		s.StoredSize += es.StoredSize
+		s.DecompressedSize += es.DecompressedSize
+		if e.compression() != CompressionNone {
+			s.CompressedEntries++
+		}
+		ext := strings.ToLower(path.Ext(e.Name))
+		if extensions[ext] == nil {
+			extensions[ext] = &ExtensionStats{Extension: ext}
+		}
+		extensions[ext].Entries++
+		extensions[ext].StoredSize += es.StoredSize
+		extensions[ext].DecompressedSize += es.DecompressedSize
+	}
+	s.CompressionRatio = ratio(s.StoredSize, s.DecompressedSize)
+
+	for _, ext := range extensions {
+		ext.CompressionRatio = ratio(ext.StoredSize, ext.DecompressedSize)
+		s.Extensions = append(s.Extensions, *ext)
+	}
+	sort.Slice(s.Extensions, func(i, j int) bool {
+		if s.Extensions[i].StoredSize != s.Extensions[j].StoredSize {
+			return s.Extensions[i].StoredSize > s.Extensions[j].StoredSize
+		}
+		return s.Extensions[i].Extension < s.Extensions[j].Extension
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StoredSize > entries[j].StoredSize
+	})
+	if len(entries) > statsLargestEntries {
+		entries = entries[:statsLargestEntries]
+	}
+	s.Largest = entries
+	return s, nil
+}
+
+// ratio returns stored over decompressed, or 1 if nothing was decompressed
+func ratio(stored, decompressed uint64) float64 {
+	if decompressed == 0 {
+		return 1
+	}
+	return float64(stored) / float64(decompressed)
+}
@@ -0,0 +1,75 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	m := New()
+	m.AddProductInfo("caribou maurice v1.2")
+	err := m.AddContent(bytes.Repeat([]byte("a"), 10000), "/bin/firefox.EXE", 0755, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddContent(bytes.Repeat([]byte("b"), 3000), "/lib/libxul.so", 0644)
+	m.AddContent(bytes.Repeat([]byte("c"), 1000), "/lib/libnss.so", 0644)
+	m.AddContent([]byte("update"), "/updatev3.manifest", 0644)
+	m.AddContent([]byte("README"), "/README", 0644)
+	err = m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	err = Unmarshal(input, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := file.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exeSize := uint64(len(file.Content["/bin/firefox.EXE"].Data))
+	if s.FileSize != uint64(len(input)) || s.Entries != 5 || s.CompressedEntries != 1 {
+		t.Fatalf("unexpected counts in %+v", s)
+	}
+	if s.StoredSize != exeSize+4012 || s.DecompressedSize != 14012 {
+		t.Fatalf("unexpected sizes in %+v", s)
+	}
+	if s.SignatureOverhead != SignaturesHeaderLen+SignatureEntryHeaderLen+256 {
+		t.Fatalf("expected the overhead of a 2048 bits RSA signature but got %d", s.SignatureOverhead)
+	}
+	if s.AdditionalSectionsSize != AdditionalSectionsHeaderLen+AdditionalSectionsEntryHeaderLen+20 {
+		t.Fatalf("unexpected additional sections size %d", s.AdditionalSectionsSize)
+	}
+	if s.IndexSize != uint64(IndexHeaderLen+file.IndexHeader.Size) {
+		t.Fatalf("expected an index of %d bytes but got %d", IndexHeaderLen+file.IndexHeader.Size, s.IndexSize)
+	}
+	// every byte of the file is accounted for
+	total := MarIDLen + OffsetToIndexLen + FileSizeLen + s.SignatureOverhead + s.AdditionalSectionsSize + s.StoredSize + s.IndexSize
+	if total != s.FileSize {
+		t.Fatalf("expected the sizes to add up to %d but got %d", s.FileSize, total)
+	}
+
+	if len(s.Extensions) != 4 || s.Extensions[0].Extension != ".so" || s.Extensions[0].Entries != 2 ||
+		s.Extensions[0].StoredSize != 4000 || s.Extensions[0].CompressionRatio != 1 {
+		t.Fatalf("unexpected extensions %+v", s.Extensions)
+	}
+	var exe *ExtensionStats
+	for i := range s.Extensions {
+		if s.Extensions[i].Extension == ".exe" {
+			exe = &s.Extensions[i]
+		}
+	}
+	if exe == nil || exe.CompressionRatio >= 0.1 {
+		t.Fatalf("expected a highly compressed .exe extension but got %+v", s.Extensions)
+	}
+	if len(s.Largest) != 5 || s.Largest[0].Name != "/lib/libxul.so" || s.Largest[0].Compression != "none" {
+		t.Fatalf("unexpected largest entries %+v", s.Largest)
+	}
+}
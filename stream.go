@@ -0,0 +1,146 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+)
+
+// ReadFrom reads a MAR file from a stream, such as the body of an HTTP
+// response, and parses it with the same options as Unmarshal. The MAR ID
+// and total file size headers are checked as soon as they are read, such
+// that a stream that is not a MAR or that exceeds the MaxTotalSize limit
+// is rejected early, and the buffer is preallocated to the declared size,
+// up to 1MB, before it grows with the bytes actually read.
+// Since the index is at the end of the file, the rest of the file is only
+// parsed once the stream is complete. The entries of the File point into
+// the buffer, as with the ZeroCopy option.
+func ReadFrom(r io.Reader, opts ...Option) (*File, error) {
+	input, err := readStream(r, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	err = Unmarshal(input, &file, append(opts, ZeroCopy())...)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// VerifiedFile is a MAR file read by ReadVerified whose signatures have all
+// been verified. It keeps the bytes that were verified, such that they can
+// be written out without being marshaled again.
+type VerifiedFile struct {
+	*File
+
+	// Keys are the names of the keys that verified each signature, in
+	// the order the signatures appear in the file
+	Keys []string
+
+	// SHA512 is the digest of the bytes read from the stream
+	SHA512 []byte
+
+	raw []byte
+}
+
+// ReadVerified reads a MAR file from a stream, such as an HTTP download,
+// and verifies its signatures against the named public keys as soon as the
+// last bytes have arrived. It returns an error unless every signature
+// validates with one of the keys, such that an update mirror can write the
+// result to its serving path without ever storing an unverified archive.
+// It accepts the same options as ReadFrom.
+func ReadVerified(r io.Reader, keys map[string]crypto.PublicKey, opts ...Option) (*VerifiedFile, error) {
+	hw, err := NewHashWriter(nil, crypto.SHA512)
+	if err != nil {
+		return nil, err
+	}
+	input, err := readStream(io.TeeReader(r, hw), newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	err = Unmarshal(input, &file, append(opts, ZeroCopy())...)
+	if err != nil {
+		return nil, err
+	}
+	validKeys, err := file.VerifyWithKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifiedFile{File: &file, Keys: validKeys, SHA512: hw.Sum(), raw: input}, nil
+}
+
+// Bytes returns the verified bytes of the MAR file
+func (vf *VerifiedFile) Bytes() []byte {
+	return vf.raw
+}
+
+// WriteTo writes the verified bytes of the MAR file to w
+func (vf *VerifiedFile) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(vf.raw)
+	return int64(n), err
+}
+
+// WriteFile atomically writes the verified bytes of the MAR file to path
+func (vf *VerifiedFile) WriteFile(path string, perm os.FileMode) error {
+	return writeFileAtomic(path, vf.raw, perm)
+}
+
+// streamPreallocSize is the largest buffer allocated for a stream before
+// its content is read
+const streamPreallocSize = 1 << 20
+
+// readStream reads a MAR file from a stream, checking its MAR ID and
+// declared size against the limits as soon as they are read
+func readStream(r io.Reader, o *options) ([]byte, error) {
+	limits := o.limits
+	head := make([]byte, MarIDLen+OffsetToIndexLen+FileSizeLen)
+	n, err := io.ReadFull(r, head)
+	if n >= MarIDLen && string(head[:MarIDLen]) != "MAR1" {
+		return nil, errBadMarID
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return nil, errTooSmall
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// preallocate the declared size if it is consistent with the offset
+	// to index, otherwise this is an old MAR without a size header. The
+	// size isn't trusted beyond streamPreallocSize, such that a short
+	// stream can't make the buffer allocate up to MaxTotalSize, and the
+	// buffer grows as the stream is read.
+	offsetToIndex := uint64(binary.BigEndian.Uint32(head[MarIDLen:]))
+	err = checkLimit(o.debug, "MaxTotalSize", offsetToIndex, limits.MaxTotalSize)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	size := binary.BigEndian.Uint64(head[MarIDLen+OffsetToIndexLen:])
+	if size > offsetToIndex && size <= limits.MaxTotalSize {
+		if size > streamPreallocSize {
+			size = streamPreallocSize
+		}
+		buf.Grow(int(size))
+	}
+	buf.Write(head)
+	// read one byte more than allowed to detect streams that exceed the limit
+	remaining := limits.MaxTotalSize - uint64(buf.Len()) + 1
+	if remaining > math.MaxInt64 {
+		remaining = math.MaxInt64
+	}
+	_, err = buf.ReadFrom(io.LimitReader(r, int64(remaining)))
+	if err != nil {
+		return nil, err
+	}
+	err = checkLimit(o.debug, "MaxTotalSize", uint64(buf.Len()), limits.MaxTotalSize)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
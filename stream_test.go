@@ -0,0 +1,178 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadFrom(t *testing.T) {
+	for i, input := range [][]byte{miniMarB, oldMarB} {
+		file, err := ReadFrom(iotest.OneByteReader(bytes.NewReader(input)))
+		if err != nil {
+			t.Fatalf("testcase %d: %v", i, err)
+		}
+		var expected File
+		err = Unmarshal(input, &expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(file.Index) != len(expected.Index) || file.Revision != expected.Revision {
+			t.Fatalf("testcase %d: unexpected file %+v", i, file.Index)
+		}
+		for _, idx := range expected.Index {
+			if !bytes.Equal(file.Content[idx.FileName].Data, expected.Content[idx.FileName].Data) {
+				t.Fatalf("testcase %d: unexpected content of %q", i, idx.FileName)
+			}
+		}
+	}
+}
+
+func TestReadFromPipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < len(miniMarB); i += 100 {
+			end := i + 100
+			if end > len(miniMarB) {
+				end = len(miniMarB)
+			}
+			pw.Write(miniMarB[i:end])
+		}
+		pw.Close()
+	}()
+	file, err := ReadFrom(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Signatures) != 2 {
+		t.Fatalf("expected 2 signatures, got %d", len(file.Signatures))
+	}
+}
+
+func TestReadFromErrors(t *testing.T) {
+	_, err := ReadFrom(bytes.NewReader([]byte("PK\x03\x04 this is not a mar file")))
+	if err != errBadMarID {
+		t.Fatalf("expected error %v, got %v", errBadMarID, err)
+	}
+	_, err = ReadFrom(bytes.NewReader([]byte("MAR1")))
+	if err != errTooSmall {
+		t.Fatalf("expected error %v, got %v", errTooSmall, err)
+	}
+	_, err = ReadFrom(bytes.NewReader(miniMarB), WithLimits(Limits{MaxTotalSize: 200}))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected error %v, got %v", ErrLimitExceeded, err)
+	}
+	_, err = ReadFrom(bytes.NewReader(miniMarB[:len(miniMarB)-10]))
+	if err == nil {
+		t.Fatal("expected an error reading a truncated stream")
+	}
+	_, err = ReadFrom(iotest.TimeoutReader(bytes.NewReader(miniMarB)))
+	if err != iotest.ErrTimeout {
+		t.Fatalf("expected error %v, got %v", iotest.ErrTimeout, err)
+	}
+}
+
+func TestReadVerified(t *testing.T) {
+	testMar := New()
+	testMar.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	testMar.PrepareSignature(rsa2048Key, rsa2048Key.Public())
+	err := testMar.FinalizeSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := testMar.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()}
+	vf, err := ReadVerified(iotest.HalfReader(bytes.NewReader(input)), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vf.Keys) != 1 || vf.Keys[0] != "rsa" {
+		t.Fatalf("expected signature from key [rsa] but got %v", vf.Keys)
+	}
+	digest := sha512.Sum512(input)
+	if !bytes.Equal(vf.SHA512, digest[:]) {
+		t.Fatalf("expected sha512 %X but got %X", digest, vf.SHA512)
+	}
+	if string(vf.Content["/foo/bar"].Data) != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Fatalf("unexpected content %q", vf.Content["/foo/bar"].Data)
+	}
+
+	dir, err := ioutil.TempDir("", "marverified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "update.mar")
+	err = vf.WriteFile(path, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, input) {
+		t.Fatal("written file differs from the verified input")
+	}
+}
+
+func TestReadVerifiedFails(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{"other": otherKey.Public()}
+
+	testMar := New()
+	testMar.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	unsigned, err := testMar.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadVerified(bytes.NewReader(unsigned), keys)
+	if err != errNoSignature {
+		t.Fatalf("expected to fail with %q but got %v", errNoSignature, err)
+	}
+
+	testMar.PrepareSignature(rsa2048Key, rsa2048Key.Public())
+	err = testMar.FinalizeSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := testMar.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadVerified(bytes.NewReader(signed), keys)
+	if err == nil {
+		t.Fatal("expected verification with the wrong key to fail but it succeeded")
+	}
+}
+
+func TestReadFromDeclaredSize(t *testing.T) {
+	// a short stream that declares a large size must not allocate it
+	head := []byte("MAR1\x00\x00\x10\x00\x00\x00\x00\x00\x1f\x40\x00\x00")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := ReadFrom(bytes.NewReader(head))
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Fatal("expected an error reading a truncated stream")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 10<<20 {
+		t.Fatalf("expected a small allocation but %d bytes were allocated", allocated)
+	}
+}
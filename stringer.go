@@ -0,0 +1,41 @@
+package mar
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// String returns a one-line summary of the signature, without its data,
+// like "RSA-PKCS1v15-SHA384 signature (algorithm id 2, 512 bytes)"
+func (s Signature) String() string {
+	return fmt.Sprintf("%s signature (algorithm id %d, %d bytes)",
+		getSigAlgNameFromID(s.AlgorithmID), s.AlgorithmID, s.Size)
+}
+
+// String returns a one-line summary of the additional section, without its
+// data, like "product_info section (block id 1, 36 bytes)"
+func (as AdditionalSection) String() string {
+	return fmt.Sprintf("%s section (block id %d, %d bytes)", as.Name(), as.BlockID, as.BlockSize)
+}
+
+// String returns a one-line summary of the index entry, like
+// "/foo/bar (offset 158, 96 bytes, -rw-r--r--)"
+func (idx IndexEntry) String() string {
+	return fmt.Sprintf("%s (offset %d, %d bytes, %s)", idx.FileName, idx.OffsetToContent, idx.Size, os.FileMode(idx.Flags))
+}
+
+// String returns a one-line summary of the file, with its size and the
+// number of signatures, additional sections and entries it has
+func (file *File) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s revision %d, %d bytes, %d signatures, %d additional sections, %d entries",
+		file.MarID, file.Revision, file.Size, len(file.Signatures), len(file.AdditionalSections), len(file.Index))
+	switch {
+	case file.ProductInfo != nil:
+		fmt.Fprintf(&b, ", version %q", file.ProductInfo.Version)
+	case file.ProductInformation != "":
+		fmt.Fprintf(&b, ", product %q", file.ProductInformation)
+	}
+	return b.String()
+}
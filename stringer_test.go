@@ -0,0 +1,43 @@
+package mar
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+)
+
+func TestStringers(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0644)
+	m.AddProductInfo("caribou maurice v1.2")
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	err = Unmarshal(input, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []struct {
+		v        fmt.Stringer
+		expected string
+	}{
+		{file.Signatures[0], "RSA-PKCS1v15-SHA384 signature (algorithm id 2, 256 bytes)"},
+		{file.AdditionalSections[0], "product_info section (block id 1, 28 bytes)"},
+		{file.Index[0], fmt.Sprintf("/foo/bar (offset %d, 40 bytes, -rw-r--r--)", file.Index[0].OffsetToContent)},
+		{&file, fmt.Sprintf("MAR1 revision 2012, %d bytes, 1 signatures, 1 additional sections, 1 entries, product \"caribou maurice v1.2\"", file.Size)},
+	} {
+		if testCase.v.String() != testCase.expected {
+			t.Fatalf("expected %q but got %q", testCase.expected, testCase.v.String())
+		}
+	}
+	// formatting doesn't dump the raw bytes
+	if s := fmt.Sprintf("%v", file.Signatures); len(s) > 80 {
+		t.Fatalf("expected a concise summary but got %q", s)
+	}
+}
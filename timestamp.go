@@ -0,0 +1,577 @@
+package mar
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// BlockIDTimestamp is the ID of the additional section that holds an
+// RFC 3161 timestamp token over the content of the file
+const BlockIDTimestamp = 0x54535431
+
+// maxTimestampResponseSize is the maximum size of the response of a time
+// stamping authority, which is a signed structure of a few kilobytes
+const maxTimestampResponseSize = 1 << 20
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// the ASN.1 structures of RFC 3161 and of the CMS SignedData (RFC 5652)
+// that wraps timestamp tokens
+
+type tsMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsRequest struct {
+	Version        int
+	MessageImprint tsMessageImprint
+	Nonce          *big.Int
+	CertReq        bool
+}
+
+type tsStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type tsResponse struct {
+	Status         tsStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type tsAccuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tsMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       tsAccuracy    `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsEncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo cmsEncapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// Timestamp is an RFC 3161 timestamp token of a file
+type Timestamp struct {
+	// Time is the time the time stamping authority attests the content of
+	// the file existed at
+	Time time.Time
+
+	// SerialNumber is the serial number of the token
+	SerialNumber *big.Int
+
+	// Policy is the policy the authority issued the token under
+	Policy asn1.ObjectIdentifier
+
+	// Certificate is the certificate of the authority that signed the token
+	Certificate *x509.Certificate
+
+	// Token is the DER encoded token
+	Token []byte
+}
+
+// ParseTimestampToken returns the timestamp of a DER encoded token, as
+// stored in the timestamp section of a file, without verifying it
+func ParseTimestampToken(token []byte) (*Timestamp, error) {
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return nil, err
+	}
+	info, err := sd.tstInfo()
+	if err != nil {
+		return nil, err
+	}
+	_, signer, err := sd.signer()
+	if err != nil {
+		return nil, err
+	}
+	return &Timestamp{
+		Time:         info.GenTime,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Certificate:  signer,
+		Token:        token,
+	}, nil
+}
+
+// TimestampDigest returns the SHA256 digest of the signed data of the file
+// as if it had no signature, COSE section or timestamp section. Timestamp
+// tokens are requested over that digest.
+func (file *File) TimestampDigest() ([]byte, error) {
+	return file.contentDigest(crypto.SHA256)
+}
+
+// RequestTimestamp requests a timestamp token over the digest returned by
+// TimestampDigest from the RFC 3161 time stamping authority at url, and
+// stores it in the additional section of block ID BlockIDTimestamp,
+// replacing the existing one if any. The default HTTP client is used if
+// client is nil.
+//
+// As with any additional section, adding the timestamp invalidates the
+// existing signatures of the file, so it must be requested before the
+// file is signed, and the signatures then cover the token. The token
+// attests the content of the file existed at its time, which tells
+// whether the file was made while a signing key that has since been
+// rotated or revoked was still trusted.
+func (file *File) RequestTimestamp(client *http.Client, url string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	digest, err := file.TimestampDigest()
+	if err != nil {
+		return err
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return err
+	}
+	req, err := asn1.Marshal(tsRequest{
+		Version: 1,
+		MessageImprint: tsMessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("time stamping authority returned %q", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTimestampResponseSize))
+	if err != nil {
+		return err
+	}
+	token, err := parseTimestampResponse(body)
+	if err != nil {
+		return err
+	}
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return err
+	}
+	info, err := sd.tstInfo()
+	if err != nil {
+		return err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return fmt.Errorf("%w: the nonce of the token does not match the request", errMalformedTimestamp)
+	}
+	return file.AddTimestampToken(token)
+}
+
+// AddTimestampToken stores a timestamp token obtained from an RFC 3161
+// time stamping authority over the digest returned by TimestampDigest in
+// the timestamp section of the file, replacing the existing one if any.
+// The token must be a DER encoded ContentInfo.
+func (file *File) AddTimestampToken(token []byte) error {
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return err
+	}
+	info, err := sd.tstInfo()
+	if err != nil {
+		return err
+	}
+	err = file.checkTimestampImprint(info)
+	if err != nil {
+		return err
+	}
+	for i, as := range file.AdditionalSections {
+		if as.BlockID == BlockIDTimestamp {
+			file.AdditionalSections[i].Data = token
+			file.Normalize()
+			return nil
+		}
+	}
+	file.AddAdditionalSection(token, BlockIDTimestamp)
+	return nil
+}
+
+// VerifyTimestamp checks that the token of the timestamp section of the
+// file is over the content of the file and is signed by a time stamping
+// authority whose certificate validates against the roots and
+// intermediates of opts at the time of the token. Certificates included
+// in the token are used as intermediates. It returns the verified
+// timestamp.
+func (file *File) VerifyTimestamp(opts x509.VerifyOptions) (*Timestamp, error) {
+	var token []byte
+	for _, as := range file.AdditionalSections {
+		if as.BlockID == BlockIDTimestamp {
+			token = as.Data
+		}
+	}
+	if token == nil {
+		return nil, errNoTimestamp
+	}
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return nil, err
+	}
+	info, err := sd.tstInfo()
+	if err != nil {
+		return nil, err
+	}
+	err = file.checkTimestampImprint(info)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := sd.verify(info.GenTime, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Timestamp{
+		Time:         info.GenTime,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Certificate:  cert,
+		Token:        token,
+	}, nil
+}
+
+// checkTimestampImprint checks that the message imprint of a token is the
+// digest of the content of the file
+func (file *File) checkTimestampImprint(info *tstInfo) error {
+	h, ok := digestAlgorithmHash(info.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: unsupported message imprint algorithm %s", errMalformedTimestamp, info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	digest, err := file.contentDigest(h)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, info.MessageImprint.HashedMessage) {
+		return errTimestampMismatch
+	}
+	return nil
+}
+
+// parseTimestampResponse returns the token of a TimeStampResp, if the
+// authority granted the request
+func parseTimestampResponse(data []byte) ([]byte, error) {
+	var resp tsResponse
+	rest, err := asn1.Unmarshal(data, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing data after the response", errMalformedTimestamp)
+	}
+	// 0 is granted and 1 is granted with modifications
+	if resp.Status.Status > 1 {
+		var text []string
+		for _, rv := range resp.Status.StatusString {
+			text = append(text, string(rv.Bytes))
+		}
+		return nil, fmt.Errorf("time stamping authority rejected the request with status %d %q", resp.Status.Status, text)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("%w: the response has no token", errMalformedTimestamp)
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// parseSignedData returns the SignedData of a token
+func parseSignedData(token []byte) (*cmsSignedData, error) {
+	var ci cmsContentInfo
+	rest, err := asn1.Unmarshal(token, &ci)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing data after the token", errMalformedTimestamp)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: the token is not a SignedData", errMalformedTimestamp)
+	}
+	var sd cmsSignedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("%w: the token does not hold a TSTInfo", errMalformedTimestamp)
+	}
+	return &sd, nil
+}
+
+// tstInfo returns the TSTInfo of the SignedData without checking its
+// signature
+func (sd *cmsSignedData) tstInfo() (*tstInfo, error) {
+	content, err := sd.content()
+	if err != nil {
+		return nil, err
+	}
+	var info tstInfo
+	_, err = asn1.Unmarshal(content, &info)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+	}
+	return &info, nil
+}
+
+// signer returns the signer info of the SignedData and the certificate of
+// the signer, which must be included in the token
+func (sd *cmsSignedData) signer() (*cmsSignerInfo, *x509.Certificate, error) {
+	if len(sd.SignerInfos) != 1 {
+		return nil, nil, fmt.Errorf("%w: the token must have a single signer", errMalformedTimestamp)
+	}
+	si := &sd.SignerInfos[0]
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+	}
+	var sid cmsIssuerAndSerialNumber
+	_, err = asn1.Unmarshal(si.SID.FullBytes, &sid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: signers must be identified by issuer and serial number", errMalformedTimestamp)
+	}
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, sid.Issuer.FullBytes) && cert.SerialNumber.Cmp(sid.SerialNumber) == 0 {
+			return si, cert, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: the token does not include the certificate of its signer", errMalformedTimestamp)
+}
+
+// content returns the DER encoded TSTInfo of the SignedData
+func (sd *cmsSignedData) content() ([]byte, error) {
+	var content []byte
+	_, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+	}
+	return content, nil
+}
+
+// verify checks the signature of the SignedData and validates the
+// certificate of its signer at genTime, which it returns
+func (sd *cmsSignedData) verify(genTime time.Time, opts x509.VerifyOptions) (*x509.Certificate, error) {
+	si, signer, err := sd.signer()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := digestAlgorithmHash(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported digest algorithm %s", errMalformedTimestamp, si.DigestAlgorithm.Algorithm)
+	}
+	sigAlg, ok := cmsSignatureAlgorithm(si.SignatureAlgorithm.Algorithm, h)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported signature algorithm %s", errMalformedTimestamp, si.SignatureAlgorithm.Algorithm)
+	}
+	content, err := sd.content()
+	if err != nil {
+		return nil, err
+	}
+	md := h.New()
+	md.Write(content)
+	err = checkSignedAttributes(si.SignedAttrs.Bytes, md.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	// the signature is over the DER encoding of the attributes as a SET,
+	// not with the implicit tag they are stored with
+	signed := append([]byte{}, si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+	err = signer.CheckSignature(sigAlg, signed, si.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("the signature of the timestamp token did not validate: %w", err)
+	}
+
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+	}
+	for _, cert := range certs {
+		if !cert.Equal(signer) {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	opts.CurrentTime = genTime
+	opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+	_, err = signer.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %q of the time stamping authority did not validate: %w", signer.Subject.CommonName, err)
+	}
+	return signer, nil
+}
+
+// checkSignedAttributes checks that the signed attributes of a token have
+// the content type of a TSTInfo and the digest of its content
+func checkSignedAttributes(attrs, digest []byte) error {
+	var contentType, messageDigest bool
+	for len(attrs) > 0 {
+		var attr cmsAttribute
+		var err error
+		attrs, err = asn1.Unmarshal(attrs, &attr)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errMalformedTimestamp, err)
+		}
+		switch {
+		case attr.Type.Equal(oidAttributeContentType):
+			var oid asn1.ObjectIdentifier
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &oid)
+			if err != nil || !oid.Equal(oidTSTInfo) {
+				return fmt.Errorf("%w: the signed content type is not a TSTInfo", errMalformedTimestamp)
+			}
+			contentType = true
+		case attr.Type.Equal(oidAttributeMessageDigest):
+			var value []byte
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &value)
+			if err != nil || !bytes.Equal(value, digest) {
+				return fmt.Errorf("%w: the signed digest does not match the TSTInfo", errMalformedTimestamp)
+			}
+			messageDigest = true
+		}
+	}
+	if !contentType || !messageDigest {
+		return fmt.Errorf("%w: the token must sign its content type and digest", errMalformedTimestamp)
+	}
+	return nil
+}
+
+// digestAlgorithmHash returns the hash function of a digest algorithm OID
+func digestAlgorithmHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, true
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// cmsSignatureAlgorithm returns the x509 signature algorithm of a CMS
+// signature algorithm OID, which is either a key type used with the digest
+// algorithm h or a signature algorithm with its own hash function
+func cmsSignatureAlgorithm(oid asn1.ObjectIdentifier, h crypto.Hash) (x509.SignatureAlgorithm, bool) {
+	switch {
+	case oid.Equal(oidRSAEncryption):
+		switch h {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, true
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, true
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, true
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, true
+		}
+	case oid.Equal(oidECPublicKey):
+		switch h {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, true
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, true
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, true
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, true
+		}
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, true
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, true
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, true
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, true
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, true
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, true
+	}
+	return x509.UnknownSignatureAlgorithm, false
+}
@@ -0,0 +1,295 @@
+package mar
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testTSA is a time stamping authority that signs tokens for the tests
+type testTSA struct {
+	root *testCA
+	cert *x509.Certificate
+	key  crypto.Signer
+
+	// status is the status of the responses, and nonce overrides the
+	// nonce of the tokens if set
+	status int
+	nonce  *big.Int
+}
+
+func newTestTSA(t *testing.T) *testTSA {
+	root := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := root.issue(t, signingCertificateTemplate(7, x509.ExtKeyUsageTimeStamping), key.Public())
+	return &testTSA{root: root, cert: cert, key: key}
+}
+
+func (tsa *testTSA) roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(tsa.root.cert)
+	return roots
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// token returns a token over the SHA256 digest signed at genTime
+func (tsa *testTSA) token(t *testing.T, digest []byte, nonce *big.Int, genTime time.Time) []byte {
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	content := mustMarshal(t, tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: tsMessageImprint{HashAlgorithm: sha256Alg, HashedMessage: digest},
+		SerialNumber:   big.NewInt(42),
+		GenTime:        genTime.UTC().Truncate(time.Second),
+		Nonce:          nonce,
+	})
+	contentDigest := sha256.Sum256(content)
+	attribute := func(oid asn1.ObjectIdentifier, value interface{}) []byte {
+		return mustMarshal(t, cmsAttribute{
+			Type:   oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, value)},
+		})
+	}
+	attrs := append(attribute(oidAttributeContentType, oidTSTInfo),
+		attribute(oidAttributeMessageDigest, contentDigest[:])...)
+	signed := sha256.Sum256(mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs}))
+	sig, err := tsa.key.Sign(rand.Reader, signed[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := mustMarshal(t, cmsSignedData{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, sha256Alg)},
+		EncapContentInfo: cmsEncapsulatedContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: mustMarshal(t, content)},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw},
+		SignerInfos: []cmsSignerInfo{{
+			Version: 1,
+			SID: asn1.RawValue{FullBytes: mustMarshal(t, cmsIssuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: tsa.cert.RawIssuer},
+				SerialNumber: tsa.cert.SerialNumber,
+			})},
+			DigestAlgorithm:    sha256Alg,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          sig,
+		}},
+	})
+	return mustMarshal(t, cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// server returns a server that answers timestamp requests
+func (tsa *testTSA) server(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/timestamp-query" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req tsRequest
+		_, err = asn1.Unmarshal(body, &req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := tsResponse{Status: tsStatusInfo{Status: tsa.status}}
+		if tsa.status == 0 {
+			nonce := req.Nonce
+			if tsa.nonce != nil {
+				nonce = tsa.nonce
+			}
+			resp.TimeStampToken = asn1.RawValue{FullBytes: tsa.token(t, req.MessageImprint.HashedMessage, nonce, time.Now())}
+		} else {
+			resp.Status.StatusString = []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte("request rejected")}}
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(mustMarshal(t, resp))
+	}))
+}
+
+func TestTimestamp(t *testing.T) {
+	tsa := newTestTSA(t)
+	srv := tsa.server(t)
+	defer srv.Close()
+
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	_, err := m.VerifyTimestamp(x509.VerifyOptions{Roots: tsa.roots()})
+	if err != errNoTimestamp {
+		t.Fatalf("expected to fail with %q but got %v", errNoTimestamp, err)
+	}
+	// requesting a timestamp twice replaces the section
+	for i := 0; i < 2; i++ {
+		err = m.RequestTimestamp(srv.Client(), srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(m.AdditionalSections) != 2 {
+		t.Fatalf("expected 2 additional sections but got %d", len(m.AdditionalSections))
+	}
+	err = m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file File
+	err = Unmarshal(signed, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.VerifyWithKeys(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := file.VerifyTimestamp(x509.VerifyOptions{Roots: tsa.roots()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(ts.Time) > time.Minute || !ts.Certificate.Equal(tsa.cert) || ts.SerialNumber.Int64() != 42 {
+		t.Fatalf("unexpected timestamp %+v", ts)
+	}
+	as := file.AdditionalSections[1]
+	if as.Name() != "timestamp" {
+		t.Fatalf("expected section name timestamp but got %q", as.Name())
+	}
+	v, err := as.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.(*Timestamp).Time.Equal(ts.Time) {
+		t.Fatalf("expected the section value to hold the time of the token")
+	}
+
+	// the certificate of the authority must chain to the roots
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(newTestCA(t).cert)
+	_, err = file.VerifyTimestamp(x509.VerifyOptions{Roots: otherRoots})
+	if err == nil {
+		t.Fatal("expected verification against other roots to fail")
+	}
+
+	// the token covers the content
+	file.Content["/foo/bar"] = Entry{Data: []byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")}
+	_, err = file.VerifyTimestamp(x509.VerifyOptions{Roots: tsa.roots()})
+	if err != errTimestampMismatch {
+		t.Fatalf("expected to fail with %q but got %v", errTimestampMismatch, err)
+	}
+}
+
+func TestTimestampVerifyErrors(t *testing.T) {
+	tsa := newTestTSA(t)
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	digest, err := m.TimestampDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens over other content can't be added
+	other := sha256.Sum256([]byte("other content"))
+	err = m.AddTimestampToken(tsa.token(t, other[:], nil, time.Now()))
+	if err != errTimestampMismatch {
+		t.Fatalf("expected to fail with %q but got %v", errTimestampMismatch, err)
+	}
+	err = m.AddTimestampToken([]byte("garbage"))
+	if !errors.Is(err, errMalformedTimestamp) {
+		t.Fatalf("expected to fail with %q but got %v", errMalformedTimestamp, err)
+	}
+
+	// the certificate of the authority must be valid at the time of the token
+	err = m.AddTimestampToken(tsa.token(t, digest, nil, time.Now().Add(2*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.VerifyTimestamp(x509.VerifyOptions{Roots: tsa.roots()})
+	if err == nil {
+		t.Fatal("expected a token outside of the validity of its certificate to fail")
+	}
+
+	// the signature must cover the token
+	token := tsa.token(t, digest, nil, time.Now())
+	err = m.AddTimestampToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.VerifyTimestamp(x509.VerifyOptions{Roots: tsa.roots()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the signature is at the end of the token
+	token[len(token)-2] ^= 0xff
+	err = m.AddTimestampToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.VerifyTimestamp(x509.VerifyOptions{Roots: tsa.roots()})
+	if err == nil {
+		t.Fatal("expected a tampered token to fail")
+	}
+}
+
+func TestRequestTimestampErrors(t *testing.T) {
+	tsa := newTestTSA(t)
+	srv := tsa.server(t)
+	defer srv.Close()
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+
+	tsa.status = 2
+	err := m.RequestTimestamp(srv.Client(), srv.URL)
+	if err == nil {
+		t.Fatal("expected a rejected request to fail")
+	}
+	tsa.status = 0
+	tsa.nonce = big.NewInt(1)
+	err = m.RequestTimestamp(srv.Client(), srv.URL)
+	if !errors.Is(err, errMalformedTimestamp) {
+		t.Fatalf("expected to fail with %q but got %v", errMalformedTimestamp, err)
+	}
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	err = m.RequestTimestamp(notFound.Client(), notFound.URL)
+	if err == nil {
+		t.Fatal("expected a server error to fail")
+	}
+	if len(m.AdditionalSections) != 0 {
+		t.Fatalf("expected no additional section but got %d", len(m.AdditionalSections))
+	}
+}
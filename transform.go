@@ -0,0 +1,52 @@
+package mar
+
+import "fmt"
+
+// TransformFunc is called by Marshal on every entry of the file when set
+// with TransformWith. It can change the name, flags and content of the
+// entry, and returns false to drop it from the output. The compression
+// format of the entry is detected again from its content afterwards.
+type TransformFunc func(e *NamedEntry) (keep bool, err error)
+
+// TransformWith makes Marshal pass every entry through fn before writing
+// the file out, with the index and offsets recomputed for the transformed
+// entries. The File itself is left untouched. The option can be given
+// several times to chain transformations.
+func TransformWith(fn TransformFunc) Option {
+	return func(o *options) {
+		o.transforms = append(o.transforms, fn)
+	}
+}
+
+// transformed returns a copy of the file with its entries passed through
+// the transformation functions
+func (file *File) transformed(fns []TransformFunc) (*File, error) {
+	t := *file
+	t.Index = make([]IndexEntry, 0, len(file.Index))
+	t.Content = make(map[string]Entry, len(file.Content))
+entries:
+	for _, e := range file.Entries() {
+		name := e.Name
+		for _, fn := range fns {
+			keep, err := fn(&e)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transform %q: %w", name, err)
+			}
+			if !keep {
+				continue entries
+			}
+		}
+		err := checkFileName(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := t.Content[e.Name]; ok {
+			return nil, fmt.Errorf("%w: file named %q already exists in the archive", ErrDuplicateEntry, e.Name)
+		}
+		e.Compression = detectCompression(e.Data)
+		e.IsCompressed = e.Compression != CompressionNone
+		t.Index = append(t.Index, IndexEntry{e.IndexEntryHeader, e.Name})
+		t.Content[e.Name] = e.Entry
+	}
+	return &t, nil
+}
@@ -0,0 +1,82 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransformWith(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("browser"), "browser/omni.ja", 0644)
+	m.AddContent([]byte("french"), "localization/fr/browser.ftl", 0644)
+	m.AddContent([]byte("german"), "localization/de/browser.ftl", 0644)
+	err := m.AddContent(bytes.Repeat([]byte("prefs "), 50), "defaults/prefs.js", 0644, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripLocales := TransformWith(func(e *NamedEntry) (bool, error) {
+		return !strings.HasPrefix(e.Name, "localization/"), nil
+	})
+	rewritePrefs := TransformWith(func(e *NamedEntry) (bool, error) {
+		if e.Name == "defaults/prefs.js" {
+			e.Data = []byte("rewritten")
+			e.Flags = 0600
+		}
+		return true, nil
+	})
+	// stale headers are recomputed on a copy of the file, not on the file
+	m.Size, m.OffsetToIndex = 0, 0
+	o, err := m.Marshal(stripLocales, rewritePrefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(o, &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntryNames(t, reparsed.Entries(), "browser/omni.ja", "defaults/prefs.js")
+	prefs := reparsed.Content["defaults/prefs.js"]
+	if string(prefs.Data) != "rewritten" || prefs.IsCompressed || reparsed.Index[1].Flags != 0600 {
+		t.Fatalf("unexpected rewritten entry %+v with flags %o", prefs, reparsed.Index[1].Flags)
+	}
+	// the file itself is left untouched
+	checkEntryNames(t, m.Entries(), "browser/omni.ja", "localization/fr/browser.ftl",
+		"localization/de/browser.ftl", "defaults/prefs.js")
+	if !m.Content["defaults/prefs.js"].IsCompressed {
+		t.Fatal("expected the original entry to still be compressed")
+	}
+	if m.Size != 0 || m.OffsetToIndex != 0 {
+		t.Fatalf("expected the headers of the file to be left untouched but got size=%d offsetToIndex=%d",
+			m.Size, m.OffsetToIndex)
+	}
+}
+
+func TestTransformWithErrors(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("a"), "a", 0644)
+	m.AddContent([]byte("b"), "b", 0644)
+	errTest := errors.New("test error")
+	_, err := m.Marshal(TransformWith(func(e *NamedEntry) (bool, error) {
+		return false, errTest
+	}))
+	if !errors.Is(err, errTest) {
+		t.Fatalf("expected error %v, got %v", errTest, err)
+	}
+	_, err = m.Marshal(TransformWith(func(e *NamedEntry) (bool, error) {
+		e.Name = "same"
+		return true, nil
+	}))
+	if !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("expected error %v, got %v", ErrDuplicateEntry, err)
+	}
+	_, err = m.Marshal(TransformWith(func(e *NamedEntry) (bool, error) {
+		e.Name = ""
+		return true, nil
+	}))
+	if err != errEmptyFileName {
+		t.Fatalf("expected error %v, got %v", errEmptyFileName, err)
+	}
+}
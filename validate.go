@@ -0,0 +1,140 @@
+package mar
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every violation of the invariants of the MAR
+// format found by Validate
+type ValidationError struct {
+	Violations []error
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Violations) == 1 {
+		return e.Violations[0].Error()
+	}
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Error())
+	}
+	return fmt.Sprintf("%d violations: %s", len(e.Violations), strings.Join(msgs, "; "))
+}
+
+// Is returns true if one of the violations matches target, such that
+// errors.Is can check for a specific violation or class of error
+func (e *ValidationError) Is(target error) bool {
+	for _, v := range e.Violations {
+		if errors.Is(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the cross-field invariants of the file against the rules
+// enforced by Unmarshal and by Firefox's libmar: the total file size must
+// match the offset and size of the index, the headers must count the
+// signatures and additional sections, the sizes of signatures, additional
+// sections and index must match their data, and each index entry must
+// reference existing content of the same size, located between the end of
+// the signatures and additional sections and the beginning of the index,
+// without overlapping other entries. It is useful to check a File that was
+// built or modified in memory before signing it.
+//
+// Rather than stopping at the first violation, Validate returns a
+// *ValidationError that lists all of them.
+func (file *File) Validate() error {
+	var violations []error
+	violate := func(err error, format string, a ...interface{}) {
+		if format != "" {
+			err = fmt.Errorf("%s: %w", fmt.Sprintf(format, a...), err)
+		}
+		violations = append(violations, err)
+	}
+	if file.MarID != "MAR1" {
+		violate(errBadMarID, "")
+	}
+	contentStart := file.contentStart()
+	if file.Revision == 2005 {
+		contentStart = MarIDLen + OffsetToIndexLen
+	} else {
+		if file.Size != uint64(file.OffsetToIndex)+IndexHeaderLen+uint64(file.IndexHeader.Size) {
+			violate(errMalformedFileSize, "file size %d, offset to index %d, index size %d",
+				file.Size, file.OffsetToIndex, file.IndexHeader.Size)
+		}
+		if file.SignaturesHeader.NumSignatures != uint32(len(file.Signatures)) {
+			violate(errNumSignaturesMismatch, "header has %d, file has %d",
+				file.SignaturesHeader.NumSignatures, len(file.Signatures))
+		}
+		for i, sig := range file.Signatures {
+			if sig.Size != uint32(len(sig.Data)) {
+				violate(errSignatureSizeMismatch, "signature %d", i)
+			}
+		}
+		if file.AdditionalSectionsHeader.NumAdditionalSections != uint32(len(file.AdditionalSections)) {
+			violate(errNumSectionsMismatch, "header has %d, file has %d",
+				file.AdditionalSectionsHeader.NumAdditionalSections, len(file.AdditionalSections))
+		}
+		for i, as := range file.AdditionalSections {
+			if uint64(as.BlockSize) != uint64(len(as.Data))+AdditionalSectionsEntryHeaderLen {
+				violate(errBlockSizeMismatch, "additional section %d", i)
+			}
+		}
+	}
+	if uint64(file.OffsetToIndex) < contentStart {
+		violate(errIndexOverlapsHeaders, "offset to index %d, end of headers %d", file.OffsetToIndex, contentStart)
+	}
+
+	var idxSize uint64
+	for _, idx := range file.Index {
+		idxSize += IndexEntryHeaderLen + uint64(len(idx.FileName)) + 1
+		if file.Content != nil {
+			entry, ok := file.Content[idx.FileName]
+			if !ok {
+				violate(errIndexBadContentReference, "entry %q", idx.FileName)
+			} else if uint64(len(entry.Data)) != uint64(idx.Size) {
+				violate(errContentSizeMismatch, "entry %q", idx.FileName)
+			}
+		}
+		err := checkContentRange(file.debug, idx, contentStart, uint64(file.OffsetToIndex))
+		if err != nil {
+			violate(err, "entry %q", idx.FileName)
+		}
+	}
+	if idxSize != uint64(file.IndexHeader.Size) {
+		violate(errIndexSizeMismatch, "index header size %d, index entries %d", file.IndexHeader.Size, idxSize)
+	}
+
+	// sort the entries by offset, and compare each of them to the entry
+	// that ends the furthest among the previous ones, which can overlap
+	// several of the following entries
+	entries := make([]IndexEntry, 0, len(file.Index))
+	for _, idx := range file.Index {
+		// empty entries don't contain anything that could overlap
+		if idx.Size > 0 {
+			entries = append(entries, idx)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].OffsetToContent < entries[j].OffsetToContent
+	})
+	var furthest IndexEntry
+	var furthestEnd uint64
+	for i, idx := range entries {
+		if i > 0 && furthestEnd > uint64(idx.OffsetToContent) {
+			file.tracef("entry %q overlaps entry %q\n", furthest.FileName, idx.FileName)
+			violate(errContentOverlap, "entries %q and %q", furthest.FileName, idx.FileName)
+		}
+		if end := uint64(idx.OffsetToContent) + uint64(idx.Size); end > furthestEnd {
+			furthest, furthestEnd = idx, end
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
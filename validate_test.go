@@ -0,0 +1,162 @@
+package mar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for i, input := range [][]byte{miniMarB, oldMarB} {
+		var m File
+		err := Unmarshal(input, &m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.Validate()
+		if err != nil {
+			t.Fatalf("testcase %d expected parsed file to be valid but got %v", i, err)
+		}
+	}
+}
+
+func TestValidateBadLayout(t *testing.T) {
+	newMar := func() *File {
+		m := New()
+		m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+		m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+		m.AddProductInfo("caribou maurice v1.2")
+		return m
+	}
+	err := newMar().Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := newMar()
+	m.Index[0].OffsetToContent = MarIDLen + OffsetToIndexLen + FileSizeLen
+	err = m.Validate()
+	if !errors.Is(err, errContentOverlapsHeaders) {
+		t.Fatalf("expected to fail with %q but got %v", errContentOverlapsHeaders, err)
+	}
+
+	m = newMar()
+	m.Index[1].Size = 100
+	err = m.Validate()
+	if !errors.Is(err, errContentOverlapsIndex) {
+		t.Fatalf("expected to fail with %q but got %v", errContentOverlapsIndex, err)
+	}
+
+	m = newMar()
+	m.Index[1].OffsetToContent = m.Index[0].OffsetToContent + 10
+	err = m.Validate()
+	if !errors.Is(err, errContentOverlap) {
+		t.Fatalf("expected to fail with %q but got %v", errContentOverlap, err)
+	}
+
+	m = newMar()
+	m.Index[0].Size = 10
+	err = m.Validate()
+	if !errors.Is(err, errContentSizeMismatch) {
+		t.Fatalf("expected to fail with %q but got %v", errContentSizeMismatch, err)
+	}
+
+	m = newMar()
+	delete(m.Content, "/foo/baz")
+	err = m.Validate()
+	if !errors.Is(err, errIndexBadContentReference) {
+		t.Fatalf("expected to fail with %q but got %v", errIndexBadContentReference, err)
+	}
+}
+
+func TestValidateAllViolations(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+	m.AddProductInfo("caribou maurice v1.2")
+	m.Size++
+	m.SignaturesHeader.NumSignatures = 3
+	m.AdditionalSections[0].BlockSize = 2
+	m.IndexHeader.Size = 1
+	m.Index[1].OffsetToContent = m.Index[0].OffsetToContent + 10
+	err := m.Validate()
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	for _, expected := range []error{
+		errMalformedFileSize,
+		errNumSignaturesMismatch,
+		errBlockSizeMismatch,
+		errIndexSizeMismatch,
+		errContentOverlap,
+	} {
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected violation %q in %v", expected, err)
+		}
+	}
+	if len(verr.Violations) != 5 {
+		t.Fatalf("expected 5 violations, got %d: %v", len(verr.Violations), err)
+	}
+	if !errors.Is(err, ErrMalformedHeader) || !errors.Is(err, ErrOverlappingContent) {
+		t.Fatalf("expected violations to match their class, got %v", err)
+	}
+}
+
+func TestValidateNestedOverlaps(t *testing.T) {
+	m := New()
+	m.AddContent(bytes.Repeat([]byte("a"), 100), "a", 0600)
+	m.AddContent(bytes.Repeat([]byte("b"), 10), "b", 0600)
+	m.AddContent(bytes.Repeat([]byte("c"), 10), "c", 0600)
+	// b and c are both within a, but don't overlap each other
+	m.Index[1].OffsetToContent = m.Index[0].OffsetToContent + 10
+	m.Index[2].OffsetToContent = m.Index[0].OffsetToContent + 30
+	err := m.Validate()
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error but got %v", err)
+	}
+	var overlaps []string
+	for _, v := range verr.Violations {
+		if errors.Is(v, errContentOverlap) {
+			overlaps = append(overlaps, v.Error())
+		}
+	}
+	if len(overlaps) != 2 ||
+		!strings.HasPrefix(overlaps[0], `entries "a" and "b"`) ||
+		!strings.HasPrefix(overlaps[1], `entries "a" and "c"`) {
+		t.Fatalf("expected a to overlap b and c but got %q", overlaps)
+	}
+}
+
+func TestUnmarshalContentInHeaders(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	o, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstEntryPos := m.OffsetToIndex + IndexHeaderLen
+
+	// point the first entry at the product information block
+	crafted := make([]byte, len(o))
+	copy(crafted, o)
+	binary.BigEndian.PutUint32(crafted[firstEntryPos:], MarIDLen+OffsetToIndexLen+FileSizeLen+SignaturesHeaderLen)
+	var reparsed File
+	err = Unmarshal(crafted, &reparsed)
+	if !errors.Is(err, errContentOverlapsHeaders) || !errors.Is(err, ErrOverlappingContent) {
+		t.Fatalf("expected to fail with %q but got %v", errContentOverlapsHeaders, err)
+	}
+
+	// make the first entry run into the index
+	copy(crafted, o)
+	binary.BigEndian.PutUint32(crafted[firstEntryPos+4:], 50)
+	var intoIndex File
+	err = Unmarshal(crafted, &intoIndex)
+	if !errors.Is(err, errContentOverlapsIndex) || !errors.Is(err, ErrOverlappingContent) {
+		t.Fatalf("expected to fail with %q but got %v", errContentOverlapsIndex, err)
+	}
+}
@@ -4,20 +4,23 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
-	"encoding/pem"
+	"encoding/hex"
 	"fmt"
 	"math/big"
+	"sort"
+	"strings"
 )
 
 // VerifySignature takes a signed block, a signature, an algorithm id and a public key and returns
 // nil if the signature verifies, or an error if it does not
 func VerifySignature(input []byte, signature []byte, sigalg uint32, key crypto.PublicKey) error {
-	digest, hashAlg, err := Hash(input, sigalg)
+	digest, _, err := Hash(input, sigalg)
 	if err != nil {
 		return err
 	}
-	return VerifyHashSignature(signature, digest, hashAlg, key)
+	return lookupSignatureAlgorithm(sigalg).Verify(key, digest, signature)
 }
 
 // VerifyHashSignature takes a signature, the digest of a signed MAR block, a hash algorithm and a public
@@ -42,39 +45,184 @@ func VerifyHashSignature(signature []byte, digest []byte, hashAlg crypto.Hash, k
 	return fmt.Errorf("invalid signature")
 }
 
+// verifyDigest verifies a signature of the file against the digests of its
+// signed data returned by signedDigests
+func verifyDigest(digests map[crypto.Hash][]byte, sig Signature, key crypto.PublicKey) error {
+	digest, _, err := signatureDigest(digests, sig.AlgorithmID)
+	if err != nil {
+		return err
+	}
+	return lookupSignatureAlgorithm(sig.AlgorithmID).Verify(key, digest, sig.Data)
+}
+
 // VerifySignature attempts to verify signatures in the MAR file using
 // the provided public key until one of them passes. A valid signature
 // is indicated by returning a nil error.
 func (file *File) VerifySignature(key crypto.PublicKey) error {
-	signedBlock, err := file.MarshalForSignature()
+	digests, err := file.signedDigests()
 	if err != nil {
 		return err
 	}
 	for _, sig := range file.Signatures {
-		err = VerifySignature(signedBlock, sig.Data, sig.AlgorithmID, key)
+		err = verifyDigest(digests, sig, key)
 		if err == nil {
-			debugPrint("found valid %s signature\n", sig.Algorithm)
+			file.tracef("found valid %s signature\n", sig.Algorithm)
 			return nil
 		}
 	}
 	return fmt.Errorf("no valid signature found")
 }
 
+// VerifyWithKeys checks that every signature in the MAR file validates against
+// at least one of the named public keys. It returns the names of the keys that
+// validated each signature, in the order the signatures appear in the file, or
+// an error identifying the first signature that didn't match any key.
+func (file *File) VerifyWithKeys(keys map[string]crypto.PublicKey) (validKeys []string, err error) {
+	if len(file.Signatures) == 0 {
+		return nil, errNoSignature
+	}
+	digests, err := file.signedDigests()
+	if err != nil {
+		return nil, err
+	}
+	keyNames := sortedKeyNames(keys)
+	for i, sig := range file.Signatures {
+		matched := false
+		for _, keyName := range keyNames {
+			err = verifyDigest(digests, sig, keys[keyName])
+			if err == nil {
+				file.tracef("found valid %s signature from key %q\n", sig.Algorithm, keyName)
+				validKeys = append(validKeys, keyName)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("signature %d with algorithm %s did not validate with any key", i, getSigAlgNameFromID(sig.AlgorithmID))
+		}
+	}
+	return validKeys, nil
+}
+
+// VerifyReport verifies each signature of the MAR file against the named
+// public keys and returns the result of every signature, in the order they
+// appear in the file, with the name and fingerprint of the key that verified
+// it. Unlike VerifyWithKeys, it doesn't stop at the first invalid signature,
+// such that the report can be kept in audit logs to track the progress of a
+// key rotation. The error is only set if the file can't be verified at all.
+func (file *File) VerifyReport(keys map[string]crypto.PublicKey) ([]SignatureResult, error) {
+	digests, err := file.signedDigests()
+	if err != nil {
+		return nil, err
+	}
+	keyNames := sortedKeyNames(keys)
+	results := make([]SignatureResult, 0, len(file.Signatures))
+	for _, sig := range file.Signatures {
+		sr := SignatureResult{
+			AlgorithmID: sig.AlgorithmID,
+			Algorithm:   getSigAlgNameFromID(sig.AlgorithmID),
+			Reason:      "signature did not validate with any key",
+		}
+		for _, keyName := range keyNames {
+			if verifyDigest(digests, sig, keys[keyName]) == nil {
+				sr.Valid = true
+				sr.KeyName = keyName
+				sr.KeyFingerprint, _ = KeyFingerprint(keys[keyName])
+				sr.Reason = ""
+				break
+			}
+		}
+		results = append(results, sr)
+	}
+	return results, nil
+}
+
+// KeyFingerprint returns the hex encoded SHA256 hash of the PKIX
+// encoding of the public key
+func KeyFingerprint(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// FormatFingerprint formats a fingerprint returned by KeyFingerprint as
+// colon separated pairs of upper case hex digits, the way tools like
+// openssl print them
+func FormatFingerprint(fingerprint string) string {
+	fingerprint = strings.ToUpper(fingerprint)
+	pairs := make([]string, 0, (len(fingerprint)+1)/2)
+	for i := 0; i < len(fingerprint); i += 2 {
+		end := i + 2
+		if end > len(fingerprint) {
+			end = len(fingerprint)
+		}
+		pairs = append(pairs, fingerprint[i:end])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// KeyNameByFingerprint returns the name of the key of the named keys that
+// has the fingerprint, which can be formatted by FormatFingerprint or not,
+// to label signatures whose fingerprint was recorded in an audit log
+func KeyNameByFingerprint(keys map[string]crypto.PublicKey, fingerprint string) (string, bool) {
+	fingerprint = strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+	for _, keyName := range sortedKeyNames(keys) {
+		fp, err := KeyFingerprint(keys[keyName])
+		if err == nil && fp == fingerprint {
+			return keyName, true
+		}
+	}
+	return "", false
+}
+
+// FirefoxKeys returns the public keys of FirefoxReleasePublicKeys by name,
+// ready to be used with VerifyWithKeys or VerifyReport
+func FirefoxKeys() (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey, len(FirefoxReleasePublicKeys))
+	for keyName := range FirefoxReleasePublicKeys {
+		pub, err := parseFirefoxKey(keyName)
+		if err != nil {
+			return nil, err
+		}
+		keys[keyName] = pub
+	}
+	return keys, nil
+}
+
+// sortedKeyNames returns the names of the keys in a stable order to try them
+func sortedKeyNames(keys map[string]crypto.PublicKey) []string {
+	keyNames := make([]string, 0, len(keys))
+	for keyName := range keys {
+		keyNames = append(keyNames, keyName)
+	}
+	sort.Strings(keyNames)
+	return keyNames
+}
+
+// FirefoxChannelKeys maps Firefox update channels to the names of the keys in
+// FirefoxReleasePublicKeys that sign their MAR files. Beta and ESR updates are
+// signed with the release keys, while dep keys are used by development builds.
+var FirefoxChannelKeys = map[string][]string{
+	"release": {"release1_sha384", "release2_sha384", "release1_sha1", "release2_sha1"},
+	"beta":    {"release1_sha384", "release2_sha384", "release1_sha1", "release2_sha1"},
+	"esr":     {"release1_sha384", "release2_sha384", "release1_sha1", "release2_sha1"},
+	"nightly": {"nightly1_sha384", "nightly2_sha384", "nightly1_sha1", "nightly2_sha1"},
+	"aurora":  {"nightly1_sha384", "nightly2_sha384", "nightly1_sha1", "nightly2_sha1"},
+	"dep":     {"dep1_sha384", "dep2_sha384", "dep1_sha1", "dep2_sha1"},
+}
+
 // VerifyWithFirefoxKeys checks each signature in the MAR file against the list of known
 // Firefox signing keys, and returns isSigned = true if at least one signature
 // validates against a known key. It also returns the names of the signing keys
 // in an []string
 func (file *File) VerifyWithFirefoxKeys() (keys []string, isSigned bool, err error) {
 	isSigned = false
-	for keyName, keyPem := range FirefoxReleasePublicKeys {
-		block, _ := pem.Decode([]byte(keyPem))
-		if block == nil {
-			err = fmt.Errorf("failed to parse PEM block of key %q", keyName)
-			return nil, false, err
-		}
-		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	for keyName := range FirefoxReleasePublicKeys {
+		pub, err := parseFirefoxKey(keyName)
 		if err != nil {
-			err = fmt.Errorf("failed to parse DER block of key %q: %v", keyName, err)
 			return nil, false, err
 		}
 		err = file.VerifySignature(pub)
@@ -83,8 +231,49 @@ func (file *File) VerifyWithFirefoxKeys() (keys []string, isSigned bool, err err
 			keys = append(keys, keyName)
 			isSigned = true
 		} else {
-			debugPrint("signature verification failed with firefox key %q\n", keyName)
+			file.tracef("signature verification failed with firefox key %q\n", keyName)
 		}
 	}
 	return
 }
+
+// VerifyWithFirefoxChannel checks the signatures in the MAR file against the
+// Firefox keys of an update channel listed in FirefoxChannelKeys, such as
+// "release", "beta" or "nightly". It returns the name of the first key that
+// validates a signature, or an error if no signature is valid for the channel.
+func (file *File) VerifyWithFirefoxChannel(channel string) (keyName string, err error) {
+	keyNames, ok := FirefoxChannelKeys[channel]
+	if !ok {
+		return "", fmt.Errorf("unknown firefox update channel %q", channel)
+	}
+	digests, err := file.signedDigests()
+	if err != nil {
+		return "", err
+	}
+	for _, keyName := range keyNames {
+		pub, err := parseFirefoxKey(keyName)
+		if err != nil {
+			return "", err
+		}
+		for _, sig := range file.Signatures {
+			if verifyDigest(digests, sig, pub) == nil {
+				file.tracef("found valid %s signature from firefox key %q\n", sig.Algorithm, keyName)
+				return keyName, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no valid signature found from the keys of the %s channel", channel)
+}
+
+// parseFirefoxKey returns the public key named keyName in FirefoxReleasePublicKeys
+func parseFirefoxKey(keyName string) (crypto.PublicKey, error) {
+	keyPem, ok := FirefoxReleasePublicKeys[keyName]
+	if !ok {
+		return nil, fmt.Errorf("unknown firefox key %q", keyName)
+	}
+	pub, err := ParsePublicKeyPEM([]byte(keyPem))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %q: %w", keyName, err)
+	}
+	return pub, nil
+}
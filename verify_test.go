@@ -1,11 +1,16 @@
 package mar
 
 import (
+	"crypto"
 	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"log"
+	"strings"
 	"testing"
 )
 
@@ -25,6 +30,7 @@ func TestFirefoxKeys(t *testing.T) {
 	}
 	publicKeyPem := string(pem.EncodeToMemory(&publicKeyBlock))
 	FirefoxReleasePublicKeys["unit_test"] = publicKeyPem
+	defer delete(FirefoxReleasePublicKeys, "unit_test")
 
 	testMar.PrepareSignature(rsa2048Key, rsa2048Key.Public())
 	testMar.FinalizeSignatures()
@@ -41,6 +47,102 @@ func TestFirefoxKeys(t *testing.T) {
 	}
 }
 
+func TestVerifyWithKeys(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testMar := New()
+	testMar.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	testMar.PrepareSignature(rsa2048Key, rsa2048Key.Public())
+	testMar.PrepareSignature(ecdsaKey, ecdsaKey.Public())
+	err = testMar.FinalizeSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validKeys, err := testMar.VerifyWithKeys(map[string]crypto.PublicKey{
+		"other": otherKey.Public(),
+		"ecdsa": ecdsaKey.Public(),
+		"rsa":   rsa2048Key.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validKeys) != 2 || validKeys[0] != "rsa" || validKeys[1] != "ecdsa" {
+		t.Fatalf("expected signatures from keys [rsa ecdsa] but got %v", validKeys)
+	}
+
+	// without the ecdsa key, the second signature must fail
+	_, err = testMar.VerifyWithKeys(map[string]crypto.PublicKey{
+		"other": otherKey.Public(),
+		"rsa":   rsa2048Key.Public(),
+	})
+	if err == nil {
+		t.Fatal("expected verification to fail without the ecdsa key but it succeeded")
+	}
+	t.Log(err)
+}
+
+func TestVerifyWithKeysUnsigned(t *testing.T) {
+	testMar := New()
+	testMar.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	_, err := testMar.VerifyWithKeys(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != errNoSignature {
+		t.Fatalf("expected to fail with %q but got %v", errNoSignature, err)
+	}
+}
+
+func TestFirefoxChannel(t *testing.T) {
+	testMar := New()
+	testMar.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := testMar.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add the test rsa key to the list of firefox keys, in its own channel
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(&rsa2048Key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	FirefoxReleasePublicKeys["unit_test"] = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer}))
+	defer delete(FirefoxReleasePublicKeys, "unit_test")
+	FirefoxChannelKeys["unit_test"] = []string{"unit_test"}
+	defer delete(FirefoxChannelKeys, "unit_test")
+
+	keyName, err := testMar.VerifyWithFirefoxChannel("unit_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyName != "unit_test" {
+		t.Fatalf("expected signature from 'unit_test' key but got %q", keyName)
+	}
+	_, err = testMar.VerifyWithFirefoxChannel("release")
+	if err == nil {
+		t.Fatal("expected verification with release keys to fail but it succeeded")
+	}
+	_, err = testMar.VerifyWithFirefoxChannel("caribou")
+	if err == nil {
+		t.Fatal("expected verification with unknown channel to fail but it succeeded")
+	}
+}
+
+func TestFirefoxChannelKeysExist(t *testing.T) {
+	for channel, keyNames := range FirefoxChannelKeys {
+		for _, keyName := range keyNames {
+			_, err := parseFirefoxKey(keyName)
+			if err != nil {
+				t.Fatalf("key %q of channel %q is invalid: %v", keyName, channel, err)
+			}
+		}
+	}
+}
+
 func TestBadKey(t *testing.T) {
 	var priv dsa.PrivateKey
 	params := &priv.Parameters
@@ -56,7 +158,104 @@ func TestBadKey(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected to fail with invalid dsa key type but succeeded")
 	}
-	if err.Error() != "unknown public key type dsa.PublicKey" {
+	if !errors.Is(err, errBadSigAlg) || !strings.Contains(err.Error(), "key of type dsa.PublicKey") {
 		t.Fatalf("expect to fail with invalid dsa key type but failed with: %v", err)
 	}
 }
+
+func TestVerifyReport(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testMar := New()
+	testMar.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	testMar.PrepareSignature(rsa2048Key, rsa2048Key.Public())
+	testMar.PrepareSignature(ecdsaKey, ecdsaKey.Public())
+	err = testMar.FinalizeSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFingerprint, err := KeyFingerprint(rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := testMar.VerifyReport(map[string]crypto.PublicKey{"rsa": rsa2048Key.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if !results[0].Valid || results[0].KeyName != "rsa" || results[0].KeyFingerprint != rsaFingerprint ||
+		results[0].AlgorithmID != SigAlgRsaPkcs1Sha384 || results[0].Algorithm != "RSA-PKCS1v15-SHA384" {
+		t.Fatalf("unexpected result for the rsa signature: %+v", results[0])
+	}
+	if results[1].Valid || results[1].KeyName != "" || results[1].Reason == "" ||
+		results[1].AlgorithmID != SigAlgEcdsaP256Sha256 {
+		t.Fatalf("unexpected result for the ecdsa signature: %+v", results[1])
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	fp1, err := KeyFingerprint(rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fp1) != 64 {
+		t.Fatalf("expected a hex encoded sha256 fingerprint, got %q", fp1)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp2, err := KeyFingerprint(ecdsaKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp1 == fp2 {
+		t.Fatal("expected different keys to have different fingerprints")
+	}
+	_, err = KeyFingerprint("not a key")
+	if err == nil {
+		t.Fatal("expected fingerprint of an invalid key to fail")
+	}
+}
+
+func TestFormatFingerprint(t *testing.T) {
+	for in, out := range map[string]string{
+		"":       "",
+		"ab":     "AB",
+		"ab01cd": "AB:01:CD",
+		"ab01c":  "AB:01:C",
+	} {
+		if got := FormatFingerprint(in); got != out {
+			t.Fatalf("expected %q to be formatted as %q but got %q", in, out, got)
+		}
+	}
+}
+
+func TestKeyNameByFingerprint(t *testing.T) {
+	keys, err := FirefoxKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(FirefoxReleasePublicKeys) {
+		t.Fatalf("expected %d firefox keys but got %d", len(FirefoxReleasePublicKeys), len(keys))
+	}
+	keys["rsa"] = rsa2048Key.Public()
+	fp, err := KeyFingerprint(rsa2048Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fingerprint := range []string{fp, FormatFingerprint(fp)} {
+		name, ok := KeyNameByFingerprint(keys, fingerprint)
+		if !ok || name != "rsa" {
+			t.Fatalf("expected fingerprint %q to be key rsa but got %q", fingerprint, name)
+		}
+	}
+	_, ok := KeyNameByFingerprint(keys, "0123")
+	if ok {
+		t.Fatal("expected an unknown fingerprint not to match any key")
+	}
+}
@@ -0,0 +1,308 @@
+package mar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Writer creates a MAR file by streaming the content of entries to an
+// io.Writer one at a time, such that large archives can be written without
+// holding all their content in memory. Additional sections must be added
+// before the first entry, since they precede the content in the file. The
+// index and headers are finalized when the Writer is closed.
+//
+// If the destination implements io.WriteSeeker, like an *os.File, content is
+// written to it directly and the headers are rewritten on Close. Otherwise,
+// content is buffered in a temporary file until Close.
+//
+// With the Compress or CompressWith options, the content of every entry
+// is compressed as it is written, unless it is already compressed, as
+// AddContent does. With the AlignContent option, the content
+// of every entry starts at an aligned offset.
+type Writer struct {
+	w    io.Writer
+	opts *options
+
+	// file holds the headers, additional sections and index being written
+	file File
+	// contentWriter is where the content of entries is written to,
+	// either the destination or the temporary file
+	contentWriter io.Writer
+	// spool is the temporary file used when the destination can't seek
+	spool *os.File
+	// offset is the position in the final MAR where the next entry goes
+	offset uint64
+	// base is the position of the beginning of the MAR in a seekable destination
+	base  int64
+	names map[string]bool
+	// err is the first failure that left the output inconsistent with the
+	// index, after which every call fails with it
+	err error
+
+	started, closed bool
+}
+
+// NewWriter returns a Writer that writes a MAR file to w
+func NewWriter(w io.Writer, opts ...Option) *Writer {
+	return &Writer{
+		w:    w,
+		opts: newOptions(opts),
+		file: File{
+			MarID:    "MAR1",
+			Revision: 2012,
+		},
+		names: make(map[string]bool),
+	}
+}
+
+// AddAdditionalSection stores data in the additional section of the MAR.
+// It must be called before the first entry is added.
+func (w *Writer) AddAdditionalSection(data []byte, blockID uint32) error {
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.started {
+		return errWriterStarted
+	}
+	w.file.AddAdditionalSection(data, blockID)
+	return nil
+}
+
+// AddProductInfo adds a product information string into the additional
+// sections of the MAR. It must be called before the first entry is added.
+func (w *Writer) AddProductInfo(productInfo string) error {
+	return w.AddAdditionalSection([]byte(productInfo), BlockIDProductInfo)
+}
+
+// AddProductInfoBlock adds a Product Information block made of the MAR
+// channel IDs and version of info into the additional sections of the MAR.
+// It must be called before the first entry is added, and fails if the
+// fields of info are too long to fit.
+func (w *Writer) AddProductInfoBlock(info ProductInfo) error {
+	data, err := info.Bytes()
+	if err != nil {
+		return err
+	}
+	return w.AddAdditionalSection(data, BlockIDProductInfo)
+}
+
+// AddFile copies the content read from r into a new entry of the MAR
+// named name with the given permission flags
+func (w *Writer) AddFile(name string, r io.Reader, flags uint32) error {
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	err := checkFileName(name)
+	if err != nil {
+		return err
+	}
+	if w.opts.names != nil {
+		err = w.opts.names.Check(name)
+		if err != nil {
+			return err
+		}
+	}
+	if w.names[name] {
+		return errDupContent
+	}
+	if !w.started {
+		err = w.start()
+		if err != nil {
+			return w.fail(err)
+		}
+	}
+	err = w.pad()
+	if err != nil {
+		return w.fail(err)
+	}
+	n, err := w.copyContent(r)
+	if err != nil {
+		return w.fail(fmt.Errorf("failed to write content of %q: %w", name, err))
+	}
+	if w.offset+uint64(n) > limitMaxFileSize {
+		return w.fail(errTooBig)
+	}
+	w.file.Index = append(w.file.Index, IndexEntry{
+		IndexEntryHeader{
+			OffsetToContent: uint32(w.offset),
+			Size:            uint32(n),
+			Flags:           flags,
+		},
+		name,
+	})
+	w.names[name] = true
+	w.offset += uint64(n)
+	return nil
+}
+
+// fail records an error after which the output no longer matches the
+// index, and returns it
+func (w *Writer) fail(err error) error {
+	w.err = err
+	return err
+}
+
+// pad writes the zeros needed to align the offset of the next entry
+func (w *Writer) pad() error {
+	if w.opts.alignment <= 1 || w.offset%w.opts.alignment == 0 {
+		return nil
+	}
+	padding := w.opts.alignment - w.offset%w.opts.alignment
+	if w.offset+padding > limitMaxFileSize {
+		return errTooBig
+	}
+	_, err := w.contentWriter.Write(make([]byte, padding))
+	if err != nil {
+		return err
+	}
+	w.offset += padding
+	return nil
+}
+
+// copyContent writes the content read from r, compressed if needed, and
+// returns the number of bytes written
+func (w *Writer) copyContent(r io.Reader) (int64, error) {
+	if w.opts.compression == CompressionNone {
+		return io.Copy(w.contentWriter, r)
+	}
+	// content that is already compressed is copied as is, which is
+	// detected from its first bytes
+	br := bufio.NewReaderSize(r, compressionSniffLen)
+	head, err := br.Peek(compressionSniffLen)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if isCompressed(head) {
+		return io.Copy(w.contentWriter, br)
+	}
+	cw := &countingWriter{w: w.contentWriter}
+	zw, err := newCompressWriter(w.opts.compression, cw)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(zw, br)
+	if err != nil {
+		return 0, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return 0, err
+	}
+	return cw.n, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// start writes the headers to the destination if it can seek back to rewrite
+// them later, or otherwise opens a temporary file to write content to
+func (w *Writer) start() error {
+	w.started = true
+	w.file.Normalize()
+	w.offset = uint64(w.file.OffsetToIndex)
+	if ws, ok := w.w.(io.WriteSeeker); ok {
+		base, err := ws.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		w.base = base
+		w.contentWriter = w.w
+		// the offset to index and size are placeholders at this point
+		return w.file.marshalHeaders(w.w)
+	}
+	spool, err := ioutil.TempFile("", "margo_writer")
+	if err != nil {
+		return err
+	}
+	w.spool = spool
+	w.contentWriter = spool
+	return nil
+}
+
+// Close writes the index and finalizes the headers of the MAR. It does not
+// close the underlying writer. If writing an entry failed, the output is
+// incomplete and Close returns the error of that failure.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.err == nil && !w.started {
+		w.err = w.start()
+	}
+	w.closed = true
+	if w.spool != nil {
+		defer os.Remove(w.spool.Name())
+		defer w.spool.Close()
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	// compute the final layout from the entries that were written
+	var idxSize uint64
+	for _, idx := range w.file.Index {
+		idxSize += IndexEntryHeaderLen + uint64(len(idx.FileName)) + 1
+	}
+	w.file.IndexHeader.Size = uint32(idxSize)
+	w.file.OffsetToIndex = uint32(w.offset)
+	w.file.Size = w.offset + IndexHeaderLen + idxSize
+	if w.file.Size > limitMaxFileSize {
+		return errTooBig
+	}
+	if w.file.OffsetToIndex < uint32(limitMinFileSize-IndexHeaderLen) {
+		return errOffsetTooSmall
+	}
+
+	if w.spool == nil {
+		err := w.file.marshalIndex(w.w)
+		if err != nil {
+			return err
+		}
+		// go back to the beginning of the file to write the final headers
+		ws := w.w.(io.WriteSeeker)
+		_, err = ws.Seek(w.base, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = w.file.marshalHeaders(ws)
+		if err != nil {
+			return err
+		}
+		_, err = ws.Seek(0, io.SeekEnd)
+		return err
+	}
+
+	// write the headers, then the content from the temporary file,
+	// and finally the index
+	err := w.file.marshalHeaders(w.w)
+	if err != nil {
+		return err
+	}
+	_, err = w.spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w.w, w.spool)
+	if err != nil {
+		return err
+	}
+	return w.file.marshalIndex(w.w)
+}
@@ -0,0 +1,292 @@
+package mar
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	// build the same mar in memory to compare the outputs
+	m := New()
+	m.AddProductInfo("caribou maurice v1.2")
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddContent([]byte("bcdef"), "/foo/baz", 0640)
+	expected, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeMar := func(w *Writer) {
+		err := w.AddProductInfo("caribou maurice v1.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.AddFile("/foo/bar", strings.NewReader("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.AddFile("/foo/baz", strings.NewReader("bcdef"), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a bytes.Buffer can't seek so content is buffered in a temporary file
+	buf := new(bytes.Buffer)
+	writeMar(NewWriter(buf))
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatal("expected output of writer to match marshalled mar but it didn't")
+	}
+
+	// a file can seek so headers are rewritten at the end
+	fd, err := ioutil.TempFile("", "margo_writer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+	writeMar(NewWriter(fd))
+	output, err := ioutil.ReadFile(fd.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Fatal("expected output of writer to file to match marshalled mar but it didn't")
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer))
+	err := w.AddFile("/foo/bar", strings.NewReader("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.AddFile("/foo/bar", strings.NewReader("bcdef"), 0600)
+	if err != errDupContent {
+		t.Fatalf("expected to fail with %q but got %v", errDupContent, err)
+	}
+	err = w.AddProductInfo("caribou maurice v1.2")
+	if err != errWriterStarted {
+		t.Fatalf("expected to fail with %q but got %v", errWriterStarted, err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.AddFile("/foo/baz", strings.NewReader("bcdef"), 0600)
+	if err != errWriterClosed {
+		t.Fatalf("expected to fail with %q but got %v", errWriterClosed, err)
+	}
+}
+
+// failingReader returns some data, then fails
+type failingReader struct{ read bool }
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if fr.read {
+		return 0, errors.New("read failure")
+	}
+	fr.read = true
+	return copy(p, "partial content"), nil
+}
+
+func TestWriterStickyError(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer))
+	err := w.AddFile("/foo/bar", strings.NewReader("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.AddFile("/foo/baz", &failingReader{}, 0600)
+	if err == nil {
+		t.Fatal("expected a failing reader to fail")
+	}
+	// the partial content of the failed entry is in the output, so
+	// nothing else can be written
+	failure := err
+	err = w.AddFile("/foo/qux", strings.NewReader("bcdef"), 0600)
+	if err != failure {
+		t.Fatalf("expected to fail with %q but got %v", failure, err)
+	}
+	err = w.Close()
+	if err != failure {
+		t.Fatalf("expected close to fail with %q but got %v", failure, err)
+	}
+	err = w.Close()
+	if err != errWriterClosed {
+		t.Fatalf("expected to fail with %q but got %v", errWriterClosed, err)
+	}
+}
+
+func TestWriterCompressed(t *testing.T) {
+	m := New()
+	err := m.AddContent(bytes.Repeat([]byte("a"), 4096), "/foo/bar", 0600, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Content["/foo/bar"].IsCompressed {
+		t.Fatal("expected content added with compression to be compressed")
+	}
+	expected, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, Compress())
+	err = w.AddFile("/foo/bar", bytes.NewReader(bytes.Repeat([]byte("a"), 4096)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatal("expected output of compressing writer to match marshalled mar but it didn't")
+	}
+
+	var reparsed File
+	err = Unmarshal(buf.Bytes(), &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := reparsed.Content["/foo/bar"].Decompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat([]byte("a"), 4096)) {
+		t.Fatal("decompressed entry doesn't match the original content")
+	}
+}
+
+func TestWriterAlreadyCompressed(t *testing.T) {
+	compressed, err := compressXZ(bytes.Repeat([]byte("a"), 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, Compress())
+	err = w.AddFile("/foo/bar", bytes.NewReader(compressed), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reparsed File
+	err = Unmarshal(buf.Bytes(), &reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reparsed.Content["/foo/bar"].Data, compressed) {
+		t.Fatal("expected compressed content to be written as is")
+	}
+}
+
+func TestWriterProductInfoBlock(t *testing.T) {
+	info := ProductInfo{Version: "62.0", Channels: []string{"firefox-mozilla-release"}}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	err := w.AddProductInfoBlock(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.AddFile("/foo/bar", strings.NewReader("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m File
+	err = Unmarshal(buf.Bytes(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ProductInfo == nil || m.ProductInfo.Version != "62.0" || len(m.ProductInfo.Channels) != 1 {
+		t.Fatalf("unexpected product info %+v", m.ProductInfo)
+	}
+}
+
+func TestWriterAlignContent(t *testing.T) {
+	writeMar := func(w *Writer) {
+		err := w.AddProductInfo("caribou maurice v1.2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.AddFile("/foo/bar", strings.NewReader("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.AddFile("/foo/baz", strings.NewReader("bcdef"), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkAligned := func(output []byte) {
+		var file File
+		err := Unmarshal(output, &file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Size != uint64(len(output)) {
+			t.Fatalf("expected size %d but got %d", len(output), file.Size)
+		}
+		for _, idx := range file.Index {
+			if idx.OffsetToContent%4096 != 0 {
+				t.Fatalf("expected %q to be aligned but it starts at %d", idx.FileName, idx.OffsetToContent)
+			}
+		}
+		if file.Index[0].Size != 40 || file.Index[1].Size != 5 {
+			t.Fatalf("expected the padding to be excluded from the index but got %+v", file.Index)
+		}
+		if string(file.Content["/foo/baz"].Data) != "bcdef" {
+			t.Fatalf("unexpected content %q", file.Content["/foo/baz"].Data)
+		}
+		// the padding is kept when the file is marshalled again
+		remarshalled, err := file.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(remarshalled, output) {
+			t.Fatal("expected the aligned file to marshal to its input")
+		}
+		err = Unmarshal(output, new(File), Strict())
+		if err == nil {
+			t.Fatal("expected the strict parser to reject the padding")
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	writeMar(NewWriter(buf, AlignContent(4096)))
+	checkAligned(buf.Bytes())
+
+	fd, err := ioutil.TempFile("", "margo_writer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+	writeMar(NewWriter(fd, AlignContent(4096)))
+	output, err := ioutil.ReadFile(fd.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, buf.Bytes()) {
+		t.Fatal("expected output of writer to file to match output of writer to buffer")
+	}
+}
@@ -0,0 +1,165 @@
+package mar
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// the YAML encodings of the types holding binary data, which is encoded in
+// base64. The methods implement the Marshaler and Unmarshaler interfaces
+// of gopkg.in/yaml.v2 without the package depending on it.
+
+type signatureYAML struct {
+	SignatureEntryHeader `yaml:"signature_entry"`
+	Algorithm            string `yaml:"algorithm"`
+	Data                 string `yaml:"data,omitempty"`
+}
+
+type additionalSectionYAML struct {
+	AdditionalSectionEntryHeader `yaml:"additional_section_entry"`
+	Data                         string `yaml:"data,omitempty"`
+}
+
+type entryYAML struct {
+	Data         string          `yaml:"data,omitempty"`
+	IsCompressed bool            `yaml:"is_compressed"`
+	Compression  CompressionType `yaml:"compression"`
+}
+
+func newEntryYAML(e Entry) entryYAML {
+	return entryYAML{
+		Data:         base64.StdEncoding.EncodeToString(e.Data),
+		IsCompressed: e.IsCompressed,
+		Compression:  e.Compression,
+	}
+}
+
+// entry returns the entry of its YAML encoding
+func (v entryYAML) entry() (Entry, error) {
+	data, err := decodeYAMLData(v.Data)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Data: data, IsCompressed: v.IsCompressed, Compression: v.Compression}, nil
+}
+
+// decodeYAMLData decodes binary data encoded in base64, or in hexadecimal
+// when prefixed with "hex:"
+func decodeYAMLData(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "hex:") {
+		data, err := hex.DecodeString(s[len("hex:"):])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformedYAMLData, err)
+		}
+		return data, nil
+	}
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedYAMLData, err)
+	}
+	return data, nil
+}
+
+// MarshalYAML encodes the signature with its data in base64
+func (s Signature) MarshalYAML() (interface{}, error) {
+	return signatureYAML{
+		SignatureEntryHeader: s.SignatureEntryHeader,
+		Algorithm:            s.Algorithm,
+		Data:                 base64.StdEncoding.EncodeToString(s.Data),
+	}, nil
+}
+
+// UnmarshalYAML decodes a signature encoded by MarshalYAML. Its data may
+// also be encoded in hexadecimal with a "hex:" prefix.
+func (s *Signature) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v signatureYAML
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+	data, err := decodeYAMLData(v.Data)
+	if err != nil {
+		return err
+	}
+	*s = Signature{SignatureEntryHeader: v.SignatureEntryHeader, Algorithm: v.Algorithm, Data: data}
+	return nil
+}
+
+// MarshalYAML encodes the additional section with its data in base64
+func (as AdditionalSection) MarshalYAML() (interface{}, error) {
+	return additionalSectionYAML{
+		AdditionalSectionEntryHeader: as.AdditionalSectionEntryHeader,
+		Data:                         base64.StdEncoding.EncodeToString(as.Data),
+	}, nil
+}
+
+// UnmarshalYAML decodes an additional section encoded by MarshalYAML. Its
+// data may also be encoded in hexadecimal with a "hex:" prefix.
+func (as *AdditionalSection) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v additionalSectionYAML
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+	data, err := decodeYAMLData(v.Data)
+	if err != nil {
+		return err
+	}
+	*as = AdditionalSection{AdditionalSectionEntryHeader: v.AdditionalSectionEntryHeader, Data: data}
+	return nil
+}
+
+// MarshalYAML encodes the entry with its data in base64
+func (e Entry) MarshalYAML() (interface{}, error) {
+	return newEntryYAML(e), nil
+}
+
+// UnmarshalYAML decodes an entry encoded by MarshalYAML. Its data may also
+// be encoded in hexadecimal with a "hex:" prefix.
+func (e *Entry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v entryYAML
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+	*e, err = v.entry()
+	return err
+}
+
+// MarshalYAML encodes the named entry with its name, index entry header
+// and data in base64
+func (ne NamedEntry) MarshalYAML() (interface{}, error) {
+	return struct {
+		Name             string `yaml:"name"`
+		IndexEntryHeader `yaml:",inline"`
+		Entry            entryYAML `yaml:",inline"`
+	}{
+		Name:             ne.Name,
+		IndexEntryHeader: ne.IndexEntryHeader,
+		Entry:            newEntryYAML(ne.Entry),
+	}, nil
+}
+
+// UnmarshalYAML decodes a named entry encoded by MarshalYAML
+func (ne *NamedEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v struct {
+		Name             string `yaml:"name"`
+		IndexEntryHeader `yaml:",inline"`
+		Entry            entryYAML `yaml:",inline"`
+	}
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+	entry, err := v.Entry.entry()
+	if err != nil {
+		return err
+	}
+	*ne = NamedEntry{Name: v.Name, IndexEntryHeader: v.IndexEntryHeader, Entry: entry}
+	return nil
+}
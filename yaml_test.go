@@ -0,0 +1,94 @@
+package mar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestFileYAMLRoundTrip(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	m.AddProductInfo("caribou maurice v1.2")
+	err := m.Sign(rand.Reader, rsa2048Key, SigAlgRsaPkcs1Sha384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := yaml.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// binary data is a single base64 string rather than a list of integers
+	if !strings.Contains(string(out), "data: Y2FyaWJvdSBtYXVyaWNlIHYxLjI=") {
+		t.Fatalf("expected the product information to be encoded in base64 in\n%s", out)
+	}
+	var decoded File
+	err = yaml.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Signatures) != 1 || !bytes.Equal(decoded.Signatures[0].Data, m.Signatures[0].Data) ||
+		decoded.Signatures[0].SignatureEntryHeader != m.Signatures[0].SignatureEntryHeader {
+		t.Fatalf("expected the signature to round-trip but got %+v", decoded.Signatures)
+	}
+	if !reflect.DeepEqual(decoded.AdditionalSections, m.AdditionalSections) {
+		t.Fatalf("expected the additional sections to round-trip but got %+v", decoded.AdditionalSections)
+	}
+}
+
+func TestEntriesYAMLRoundTrip(t *testing.T) {
+	m := New()
+	m.AddContent([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "/foo/bar", 0600)
+	err := m.AddContent([]byte("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"), "/foo/baz", 0600, Compress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := m.Entries()
+	out, err := yaml.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []NamedEntry
+	err = yaml.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, entries) {
+		t.Fatalf("expected the entries to round-trip but got %+v from\n%s", decoded, out)
+	}
+
+	out, err = yaml.Marshal(m.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content map[string]Entry
+	err = yaml.Unmarshal(out, &content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(content, m.Content) {
+		t.Fatalf("expected the content to round-trip but got %+v", content)
+	}
+}
+
+func TestUnmarshalYAMLData(t *testing.T) {
+	var e Entry
+	err := yaml.Unmarshal([]byte("data: hex:616263\n"), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(e.Data) != "abc" {
+		t.Fatalf("expected hex data to decode to abc but got %q", e.Data)
+	}
+	for _, input := range []string{"data: hex:zz\n", "data: '!!!'\n"} {
+		err = yaml.Unmarshal([]byte(input), &e)
+		if !errors.Is(err, errMalformedYAMLData) {
+			t.Fatalf("expected %q to fail with %q but got %v", input, errMalformedYAMLData, err)
+		}
+	}
+}